@@ -0,0 +1,64 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"logreason/internal/coverage"
+)
+
+// runCoverage implements the coverage subcommand, which combines the saved isochrones of a
+// range into the union, coverage level and pairwise overlap layers
+func runCoverage(args []string) {
+	flags := flag.NewFlagSet("coverage", flag.ExitOnError)
+	inputDir := flags.String("output", "out/geojson", "Directory holding the GeoJSON isochrone files")
+	rangeValue := flags.Int("range", 0, "Range of the isochrones to combine (required when several ranges were fetched)")
+	cellSize := flags.Float64("cell", coverage.DefaultCellSize, "Grid resolution in meters")
+	maxLevel := flags.Int("levels", coverage.DefaultMaxLevel, "Highest coverage level; areas reached by more stations are merged into it")
+	outFile := flags.String("out", "out/coverage.geojson", "Path of the GeoJSON file receiving the coverage layers")
+	top := flags.Int("top", 10, "Number of largest overlaps listed in the summary")
+	flags.Parse(args)
+
+	isochrones, err := coverage.Load(*inputDir, *rangeValue)
+	if err != nil {
+		log.Fatalf("Error loading isochrones: %v", err)
+	}
+	fmt.Printf("Analysing %d isochrones with %.0f m cells...\n", len(isochrones), *cellSize)
+
+	result := coverage.Analyze(isochrones, coverage.Options{CellSize: *cellSize, MaxLevel: *maxLevel})
+
+	data, err := json.Marshal(result.FeatureCollection())
+	if err != nil {
+		log.Fatalf("Error encoding coverage: %v", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(*outFile), 0755); err != nil {
+		log.Fatalf("Error creating output directory: %v", err)
+	}
+	if err := os.WriteFile(*outFile, data, 0644); err != nil {
+		log.Fatalf("Error writing coverage: %v", err)
+	}
+
+	fmt.Printf("Area covered within range %d: %.2f km²\n", result.Range, result.Union.Area)
+	for _, level := range result.Levels {
+		fmt.Printf("  reached by %s stations: %.2f km²\n", level.Label, level.Area)
+	}
+
+	overlaps := result.Overlaps
+	sort.SliceStable(overlaps, func(i, j int) bool { return overlaps[i].Area > overlaps[j].Area })
+	if len(overlaps) > *top {
+		overlaps = overlaps[:*top]
+	}
+	if len(overlaps) > 0 {
+		fmt.Println("Largest overlaps:")
+		for _, overlap := range overlaps {
+			fmt.Printf("  %s / %s: %.2f km²\n", overlap.Stations[0], overlap.Stations[1], overlap.Area)
+		}
+	}
+
+	fmt.Printf("Coverage layers saved to %s\n", *outFile)
+}
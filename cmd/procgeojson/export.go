@@ -0,0 +1,100 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"logreason/internal/geojson"
+)
+
+// runExport implements the export subcommand, which converts the saved isochrones into a
+// single KML, KMZ, GPX, Shapefile or GeoPackage file for desktop GIS tools
+func runExport(args []string) {
+	var formatNames []string
+	for _, format := range geojson.ExportFormats() {
+		formatNames = append(formatNames, string(format))
+	}
+
+	flags := flag.NewFlagSet("export", flag.ExitOnError)
+	formatName := flags.String("format", string(geojson.FormatKML), "Export format: "+strings.Join(formatNames, ", "))
+	inputDir := flags.String("output", "out/geojson", "Directory holding the GeoJSON isochrone files")
+	rangeValue := flags.Int("range", 0, "Range of the isochrones to export (0 exports every range)")
+	namesList := flags.String("names", "", "Comma-separated file names to export, without extension (default every file)")
+	outFile := flags.String("out", "", "Path of the exported file (default out/isochrones.<extension>)")
+	flags.Parse(args)
+
+	format, err := geojson.ParseExportFormat(*formatName)
+	if err != nil {
+		log.Fatalf("Error: %v", err)
+	}
+	if *outFile == "" {
+		*outFile = filepath.Join("out", "isochrones."+format.Extension())
+	}
+
+	names, err := exportFileNames(*inputDir, *namesList, *rangeValue)
+	if err != nil {
+		log.Fatalf("Error listing isochrones: %v", err)
+	}
+
+	var sources []string
+	var collections []*geojson.FeatureCollection
+	for _, name := range names {
+		content, err := os.ReadFile(filepath.Join(*inputDir, name))
+		if err != nil {
+			log.Printf("Warning: skipping %s: %v", name, err)
+			continue
+		}
+		var fc geojson.FeatureCollection
+		if err := json.Unmarshal(content, &fc); err != nil {
+			log.Printf("Warning: skipping %s: %v", name, err)
+			continue
+		}
+		sources = append(sources, strings.TrimSuffix(name, ".json"))
+		collections = append(collections, &fc)
+	}
+	if len(collections) == 0 {
+		log.Fatalf("Error: no isochrone files found in %s", *inputDir)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(*outFile), 0755); err != nil {
+		log.Fatalf("Error creating output directory: %v", err)
+	}
+	out, err := os.Create(*outFile)
+	if err != nil {
+		log.Fatalf("Error creating %s: %v", *outFile, err)
+	}
+	if err := geojson.Export(out, format, geojson.Merge(sources, collections)); err != nil {
+		out.Close()
+		log.Fatalf("Error exporting isochrones: %v", err)
+	}
+	if err := out.Close(); err != nil {
+		log.Fatalf("Error writing %s: %v", *outFile, err)
+	}
+
+	fmt.Printf("Exported %d isochrone files as %s to %s\n", len(collections), format, *outFile)
+}
+
+// exportFileNames returns the files to export: the named ones, or every file of the range
+func exportFileNames(dir, namesList string, rangeValue int) ([]string, error) {
+	if namesList == "" {
+		return geojson.ListFiles(dir, rangeValue)
+	}
+
+	var names []string
+	for _, name := range strings.Split(namesList, ",") {
+		name = strings.TrimSuffix(strings.TrimSpace(name), ".json")
+		if name == "" {
+			continue
+		}
+		if rangeValue > 0 {
+			name = fmt.Sprintf("%s-%d", name, rangeValue)
+		}
+		names = append(names, filepath.Base(name)+".json")
+	}
+	return names, nil
+}
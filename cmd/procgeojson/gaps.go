@@ -0,0 +1,63 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+
+	"logreason/internal/coverage"
+)
+
+// runGaps implements the gaps subcommand, which finds the parts of an administrative
+// boundary not reached by any station within a range
+func runGaps(args []string) {
+	flags := flag.NewFlagSet("gaps", flag.ExitOnError)
+	inputDir := flags.String("output", "out/geojson", "Directory holding the GeoJSON isochrone files")
+	rangeValue := flags.Int("range", 0, "Range of the isochrones to combine (required when several ranges were fetched)")
+	boundaryPath := flags.String("boundary", "locations/boundary.geojson", "GeoJSON file with the boundary of the operating territory")
+	cellSize := flags.Float64("cell", coverage.DefaultCellSize, "Grid resolution in meters")
+	minArea := flags.Float64("min-area", 0.1, "Smallest gap listed, in km²")
+	outFile := flags.String("out", "out/gaps.geojson", "Path of the GeoJSON file receiving the gap polygons")
+	flags.Parse(args)
+
+	boundary, err := coverage.LoadBoundary(*boundaryPath)
+	if err != nil {
+		log.Fatalf("Error loading boundary: %v", err)
+	}
+
+	isochrones, err := coverage.Load(*inputDir, *rangeValue)
+	if err != nil {
+		log.Fatalf("Error loading isochrones: %v", err)
+	}
+	fmt.Printf("Comparing %d isochrones with %s using %.0f m cells...\n", len(isochrones), *boundaryPath, *cellSize)
+
+	result := coverage.Gaps(isochrones, boundary, coverage.Options{CellSize: *cellSize}, *minArea)
+
+	data, err := json.Marshal(result.FeatureCollection())
+	if err != nil {
+		log.Fatalf("Error encoding gaps: %v", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(*outFile), 0755); err != nil {
+		log.Fatalf("Error creating output directory: %v", err)
+	}
+	if err := os.WriteFile(*outFile, data, 0644); err != nil {
+		log.Fatalf("Error writing gaps: %v", err)
+	}
+
+	summary := result.Summary
+	fmt.Printf("Boundary area: %.2f km²\n", summary.BoundaryArea)
+	fmt.Printf("Reached within range %d: %.2f km² (%.1f%%)\n", summary.Range, summary.CoveredArea, summary.CoveredShare*100)
+	fmt.Printf("Not reached: %.2f km² in %d gaps of at least %.2f km²\n", summary.GapArea, len(result.Gaps), *minArea)
+	for i, gap := range result.Gaps {
+		if i == 10 {
+			fmt.Printf("  ... and %d more\n", len(result.Gaps)-i)
+			break
+		}
+		fmt.Printf("  gap %d: %.2f km²\n", i+1, gap.Area)
+	}
+
+	fmt.Printf("Gaps saved to %s\n", *outFile)
+}
@@ -1,10 +1,17 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"fmt"
 	"log"
 	"os"
+	"os/signal"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"syscall"
 
 	"logreason/internal/csvparser"
 	"logreason/internal/geojson"
@@ -12,13 +19,66 @@ import (
 )
 
 func main() {
+	// Subcommands analyse the saved isochrones; without one the isochrones are fetched
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "coverage":
+			runCoverage(os.Args[2:])
+			return
+		case "gaps":
+			runGaps(os.Args[2:])
+			return
+		case "population":
+			runPopulation(os.Args[2:])
+			return
+		case "optimise":
+			runOptimise(os.Args[2:])
+			return
+		case "export":
+			runExport(os.Args[2:])
+			return
+		}
+	}
+
 	// Define command line flags
 	csvFilePath := flag.String("csv", "locations/input.csv", "Path to the input CSV file")
-	rangeValue := flag.Int("range", 600, "Range value for GeoJSON API calls (in seconds)")
+	rangeList := flag.String("range", "600", "Comma-separated range values for GeoJSON API calls (seconds or meters, see -type), e.g. 480,720,1200")
 	outputDir := flag.String("output", "out/geojson", "Directory to save GeoJSON files")
 	secretsFilePath := flag.String("secrets", "config/secret.json", "Path to the secrets file")
+	workers := flag.Int("workers", geojson.DefaultConcurrency, "Number of locations processed in parallel")
+	rps := flag.Float64("rps", geojson.DefaultRateLimit, "Maximum API requests per second (0 disables the limit)")
+	modeName := flag.String("mode", string(geojson.ModeDrive), "Travel mode: drive, truck, walk, bicycle or approximated_transit")
+	typeName := flag.String("type", string(geojson.TypeTime), "Isoline type: time (range in seconds) or distance (range in meters)")
+	force := flag.Bool("force", false, "Refetch every isochrone, even those that are up to date")
+	prune := flag.Bool("prune", false, "Delete isochrone files of stations no longer in the CSV file")
+	useStaging := flag.Bool("staging", false, "Write into a staging directory and swap it with the output directory when done")
+	providerName := flag.String("provider", "", "Isochrone provider: "+strings.Join(geojson.ProviderNames(), ", ")+" (default from ISOCHRONE_PROVIDER secret, or geoapify)")
+	graphPath := flag.String("graph", "", "GeoJSON road network used by the offline provider (implies -provider offline)")
+	simplifyTolerance := flag.Float64("simplify", 0, "Simplify isochrone outlines to this tolerance in meters before saving (0 keeps every vertex)")
+	simplifyAlgorithm := flag.String("simplify-algorithm", string(geojson.AlgorithmDouglasPeucker), "Simplification algorithm: douglas-peucker or visvalingam")
+	precision := flag.Int("precision", 0, "Decimal digits kept in saved coordinates (0 keeps full precision)")
 	flag.Parse()
 
+	ranges, err := parseRanges(*rangeList)
+	if err != nil {
+		log.Fatalf("Error: %v", err)
+	}
+
+	mode, err := geojson.ParseMode(*modeName)
+	if err != nil {
+		log.Fatalf("Error: %v", err)
+	}
+
+	isolineType, err := geojson.ParseIsolineType(*typeName)
+	if err != nil {
+		log.Fatalf("Error: %v", err)
+	}
+
+	algorithm, err := geojson.ParseSimplifyAlgorithm(*simplifyAlgorithm)
+	if err != nil {
+		log.Fatalf("Error: %v", err)
+	}
+
 	// Create a new parser
 	parser := csvparser.NewParser()
 
@@ -44,33 +104,102 @@ func main() {
 
 	fmt.Printf("Found %d locations\n", len(result.Locations))
 
-	// Create a secrets manager and load secrets from file
+	// Create a secrets manager and load secrets from file; self-hosted providers may need none
 	secretsManager := secrets.NewManager()
 	if err := secretsManager.LoadFromFile(*secretsFilePath); err != nil {
-		log.Fatalf("Error loading secrets: %v", err)
+		log.Printf("Warning: Error loading secrets: %v", err)
+	}
+
+	// Select the isochrone provider; a road graph selects the offline provider
+	if *graphPath != "" {
+		secretsManager.Set("OFFLINE_ROAD_GRAPH", *graphPath)
+		if *providerName == "" {
+			*providerName = geojson.ProviderOffline
+		}
+	}
+	if *providerName == "" {
+		*providerName = geojson.DefaultProviderName(secretsManager)
+	}
+	provider, err := geojson.NewProvider(*providerName, secretsManager)
+	if err != nil {
+		log.Fatalf("Error creating isochrone provider: %v", err)
+	}
+
+	// Count isochrones skipped because they are already up to date
+	var skipped int32
+	trackSkipped := func(p geojson.Progress) {
+		if p.Skipped {
+			atomic.AddInt32(&skipped, 1)
+		}
 	}
 
 	// Create a GeoJSON manager
-	geoJSONManager, err := geojson.NewManager(secretsManager)
+	geoJSONManager, err := geojson.NewManager(secretsManager,
+		geojson.WithProvider(provider),
+		geojson.WithConcurrency(*workers),
+		geojson.WithRateLimit(*rps),
+		geojson.WithMode(mode),
+		geojson.WithType(isolineType),
+		geojson.WithForce(*force),
+		geojson.WithSimplify(geojson.SimplifyOptions{Tolerance: *simplifyTolerance, Algorithm: algorithm, Precision: *precision}),
+		geojson.WithProgress(trackSkipped),
+	)
 	if err != nil {
 		log.Fatalf("Error creating GeoJSON manager: %v", err)
 	}
 
+	// Keep regeneration jobs of the API server from writing to the output directory at the
+	// same time; the lock file sits next to the directory, which staging may replace
+	if err := os.MkdirAll(filepath.Dir(*outputDir), 0755); err != nil {
+		log.Fatalf("Error creating output directory: %v", err)
+	}
+	outputLock, err := csvparser.LockFile(*outputDir, csvparser.DefaultLockTimeout)
+	if err != nil {
+		log.Fatalf("Error: %v; wait for the running regeneration to finish", err)
+	}
+	defer outputLock.Unlock()
+
+	// In staging mode files are written next to the output directory and swapped in at the end
+	writeDir := *outputDir
+	var staging *geojson.Staging
+	if *useStaging {
+		staging, err = geojson.NewStaging(*outputDir)
+		if err != nil {
+			log.Fatalf("Error creating staging directory: %v", err)
+		}
+		writeDir = staging.Dir()
+	}
+
 	// Set the output directory
-	if *outputDir != geojson.DefaultOutputDir {
-		if err := geoJSONManager.SetOutputDir(*outputDir); err != nil {
+	if writeDir != geojson.DefaultOutputDir {
+		if err := geoJSONManager.SetOutputDir(writeDir); err != nil {
 			log.Fatalf("Error setting output directory: %v", err)
 		}
 	}
 
 	// Ensure the output directory exists
-	if err := os.MkdirAll(*outputDir, 0755); err != nil {
+	if err := os.MkdirAll(writeDir, 0755); err != nil {
 		log.Fatalf("Error creating output directory: %v", err)
 	}
 
+	// Cancel in-flight requests on Ctrl-C or SIGTERM
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
 	// Process the locations and save their GeoJSON data
-	fmt.Printf("Processing locations and saving GeoJSON data to %s...\n", *outputDir)
-	errors := geoJSONManager.ProcessLocations(result.Locations, *rangeValue)
+	fmt.Printf("Processing locations with %s and saving GeoJSON data to %s...\n", provider.Name(), *outputDir)
+	errors := geoJSONManager.ProcessLocationsContext(ctx, result.Locations, ranges...)
+
+	if ctx.Err() != nil {
+		if staging != nil {
+			staging.Abort()
+		}
+		log.Fatalf("Interrupted: %d of %d isochrones failed or were not processed", len(errors), len(result.Locations)*len(ranges))
+	}
+
+	if skipped > 0 {
+		fmt.Printf("Skipped %d up-to-date isochrones (use -force to refetch them)\n", skipped)
+	}
 
 	// Check if there were any errors during processing
 	if len(errors) > 0 {
@@ -80,5 +209,44 @@ func main() {
 		}
 	}
 
+	// Delete the files of stations removed from the CSV file
+	if *prune {
+		removed, err := geoJSONManager.Prune(result.Locations)
+		if err != nil {
+			log.Printf("Warning: Error pruning output directory: %v", err)
+		}
+		for _, name := range removed {
+			fmt.Printf("Removed %s\n", name)
+		}
+	}
+
+	// Swap the complete new version in
+	if staging != nil {
+		if err := staging.Commit(); err != nil {
+			staging.Abort()
+			log.Fatalf("Error replacing output directory: %v", err)
+		}
+	}
+
 	fmt.Println("Done!")
 }
+
+// parseRanges parses a comma-separated list of positive range values
+func parseRanges(s string) ([]int, error) {
+	var ranges []int
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		value, err := strconv.Atoi(part)
+		if err != nil || value <= 0 {
+			return nil, fmt.Errorf("invalid range value %q", part)
+		}
+		ranges = append(ranges, value)
+	}
+	if len(ranges) == 0 {
+		return nil, fmt.Errorf("at least one range value is required")
+	}
+	return ranges, nil
+}
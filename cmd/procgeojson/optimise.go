@@ -0,0 +1,222 @@
+package main
+
+import (
+	"encoding/csv"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"logreason/internal/coverage"
+	"logreason/internal/csvparser"
+	"logreason/internal/geojson"
+	"logreason/internal/optimise"
+)
+
+// site is a station that can be chosen by the optimisation
+type site struct {
+	name      string
+	location  *csvparser.Location
+	isochrone coverage.Isochrone
+	existing  bool
+}
+
+// runOptimise implements the optimise subcommand, which picks where to add stations, or
+// which stations to move, to reach as much demand as possible within a range
+func runOptimise(args []string) {
+	flags := flag.NewFlagSet("optimise", flag.ExitOnError)
+	candidatesCSV := flags.String("candidates", "locations/candidates.csv", "CSV file with the candidate sites, in the same format as the locations CSV")
+	candidatesDir := flags.String("candidates-dir", "out/candidates", "Directory holding the isochrones of the candidate sites")
+	locationsCSV := flags.String("csv", "locations/input.csv", "CSV file with the existing stations")
+	inputDir := flags.String("output", "out/geojson", "Directory holding the isochrones of the existing stations")
+	rangeValue := flags.Int("range", 0, "Range of the isochrones to use (required when several ranges were fetched)")
+	populationPath := flags.String("population", "", "Population grid used as demand; without it demand is spread evenly over the area")
+	cellSize := flags.Float64("cell", 200, "Grid resolution in meters of the even demand used without a population grid")
+	k := flags.Int("k", 3, "Number of sites to add, or of existing stations to move with -relocate")
+	relocate := flags.Bool("relocate", false, "Move up to k existing stations to candidate sites, keeping the others, instead of adding sites")
+	cover := flags.Float64("cover", 0, "Instead of choosing k sites, choose the fewest sites reaching this share of the demand, e.g. 0.95")
+	outFile := flags.String("out", "out/optimise.csv", "Path of the CSV report of the chosen sites")
+	flags.Parse(args)
+
+	if *relocate && *cover > 0 {
+		log.Fatalf("Error: -cover cannot be combined with -relocate")
+	}
+
+	candidates := loadCandidates(*candidatesCSV, *candidatesDir, *rangeValue)
+
+	// Existing stations are kept, or become the starting network when relocating
+	existing, err := coverage.Load(*inputDir, *rangeValue)
+	if err != nil {
+		log.Printf("Warning: No existing stations loaded: %v", err)
+	}
+	stations := make(map[string]csvparser.Location)
+	for _, location := range csvparser.NewParser().ParseFile(*locationsCSV).Locations {
+		stations[geojson.StationFileName(location)] = location
+	}
+
+	var sites []site
+	var fixed []coverage.Isochrone
+	var current []int
+	for _, isochrone := range existing {
+		if !*relocate {
+			fixed = append(fixed, isochrone)
+			continue
+		}
+		s := site{name: isochrone.Name, isochrone: isochrone, existing: true}
+		if location, ok := stations[isochrone.Name]; ok {
+			s.location = &location
+		}
+		current = append(current, len(sites))
+		sites = append(sites, s)
+	}
+	sites = append(sites, candidates...)
+	if len(sites) == 0 {
+		log.Fatalf("Error: No candidate sites with isochrones found")
+	}
+
+	isochrones := make([]coverage.Isochrone, len(sites))
+	for i, s := range sites {
+		isochrones[i] = s.isochrone
+	}
+
+	// Build the demand points
+	var demand []coverage.PopulationCell
+	if *populationPath != "" {
+		demand, err = coverage.LoadPopulation(*populationPath)
+		if err != nil {
+			log.Fatalf("Error loading population grid: %v", err)
+		}
+	} else {
+		demand = optimise.AreaDemand(append(append([]coverage.Isochrone{}, isochrones...), fixed...), *cellSize)
+		fmt.Printf("No population grid given, spreading demand evenly over %d cells of %.0f m\n", len(demand), *cellSize)
+	}
+
+	unit := "residents"
+	if *populationPath == "" {
+		unit = "km²"
+	}
+
+	if *relocate {
+		fmt.Printf("Moving up to %d of %d stations to %d candidate sites for %d demand points...\n", *k, len(current), len(sites)-len(current), len(demand))
+		relocation := optimise.NewProblem(isochrones, nil, demand).Relocate(current, *k)
+
+		if err := writeOptimiseReport(*outFile, sites, relocation.Solution); err != nil {
+			log.Fatalf("Error writing report: %v", err)
+		}
+
+		fmt.Printf("Covered before: %.1f %s (%.1f%%)\n", relocation.Before, unit, share(relocation.Before, relocation.Total)*100)
+		for i, move := range relocation.Moves {
+			fmt.Printf("  %d. %s -> %s: +%.1f %s\n", i+1, sites[move.From].name, sites[move.To].name, move.Gain, unit)
+		}
+		fmt.Printf("Covered after: %.1f %s (%.1f%%), gain %.1f\n", relocation.Covered, unit, relocation.Share()*100, relocation.Covered-relocation.Before)
+		fmt.Printf("Report of the new network saved to %s\n", *outFile)
+		return
+	}
+
+	fmt.Printf("Choosing among %d sites (%d existing stations kept) for %d demand points...\n", len(sites), len(fixed), len(demand))
+	problem := optimise.NewProblem(isochrones, fixed, demand)
+
+	var solution *optimise.Solution
+	if *cover > 0 {
+		solution = problem.SetCover(*cover)
+	} else {
+		greedy := problem.Greedy(*k)
+		solution = problem.LocalSearch(greedy, 0)
+		if solution.Covered > greedy.Covered {
+			fmt.Printf("Local search improved the greedy solution by %.1f\n", solution.Covered-greedy.Covered)
+		}
+	}
+
+	if err := writeOptimiseReport(*outFile, sites, solution); err != nil {
+		log.Fatalf("Error writing report: %v", err)
+	}
+
+	fmt.Printf("Covered before: %.1f %s (%.1f%%)\n", solution.Baseline, unit, share(solution.Baseline, solution.Total)*100)
+	for i, index := range solution.Sites {
+		fmt.Printf("  %d. %s: +%.1f %s\n", i+1, sites[index].name, solution.Gains[i], unit)
+	}
+	fmt.Printf("Covered after: %.1f %s (%.1f%%), gain %.1f\n", solution.Covered, unit, solution.Share()*100, solution.Gain())
+	fmt.Printf("Report saved to %s\n", *outFile)
+}
+
+// loadCandidates parses the candidate sites and matches them with their isochrones,
+// skipping sites whose isochrone was not generated
+func loadCandidates(csvPath, dir string, rangeValue int) []site {
+	result := csvparser.NewParser().ParseFile(csvPath)
+	for _, err := range result.Errors {
+		log.Printf("Warning: %s", err.Error())
+	}
+
+	isochrones, err := coverage.Load(dir, rangeValue)
+	if err != nil {
+		log.Fatalf("Error loading candidate isochrones: %v (generate them with: procgeojson -csv %s -output %s)", err, csvPath, dir)
+	}
+	byName := make(map[string]coverage.Isochrone, len(isochrones))
+	for _, isochrone := range isochrones {
+		byName[isochrone.Name] = isochrone
+	}
+
+	var sites []site
+	for i := range result.Locations {
+		location := result.Locations[i]
+		name := geojson.StationFileName(location)
+		isochrone, ok := byName[name]
+		if !ok {
+			log.Printf("Warning: No isochrone found for candidate %s, skipping it", name)
+			continue
+		}
+		sites = append(sites, site{name: name, location: &location, isochrone: isochrone})
+	}
+	return sites
+}
+
+// writeOptimiseReport writes the chosen sites with the demand they add as CSV
+func writeOptimiseReport(path string, sites []site, solution *optimise.Solution) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	writer := csv.NewWriter(file)
+	writer.Write([]string{"rank", "site", "latitude", "longitude", "existing", "gain", "covered", "share"})
+
+	covered := solution.Baseline
+	for i, index := range solution.Sites {
+		s := sites[index]
+		covered += solution.Gains[i]
+		latitude, longitude := "", ""
+		if s.location != nil {
+			latitude = strconv.FormatFloat(s.location.Latitude, 'f', -1, 64)
+			longitude = strconv.FormatFloat(s.location.Longitude, 'f', -1, 64)
+		}
+		writer.Write([]string{
+			strconv.Itoa(i + 1),
+			s.name,
+			latitude,
+			longitude,
+			strconv.FormatBool(s.existing),
+			strconv.FormatFloat(solution.Gains[i], 'f', 2, 64),
+			strconv.FormatFloat(covered, 'f', 2, 64),
+			strconv.FormatFloat(share(covered, solution.Total), 'f', 4, 64),
+		})
+	}
+
+	writer.Flush()
+	if err := writer.Error(); err != nil {
+		return err
+	}
+	return file.Close()
+}
+
+func share(part, total float64) float64 {
+	if total == 0 {
+		return 0
+	}
+	return part / total
+}
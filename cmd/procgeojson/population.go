@@ -0,0 +1,57 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+
+	"logreason/internal/coverage"
+)
+
+// runPopulation implements the population subcommand, which writes a CSV report of the
+// residents reached by every station and by all stations together within a range
+func runPopulation(args []string) {
+	flags := flag.NewFlagSet("population", flag.ExitOnError)
+	inputDir := flags.String("output", "out/geojson", "Directory holding the GeoJSON isochrone files")
+	rangeValue := flags.Int("range", 0, "Range of the isochrones to combine (required when several ranges were fetched)")
+	populationPath := flags.String("population", "locations/population.csv", "Population grid as CSV (lon,lat,population) or GeoJSON")
+	maxLevel := flags.Int("levels", coverage.DefaultMaxLevel, "Highest coverage level; population reached by more stations is merged into it")
+	outFile := flags.String("out", "out/population.csv", "Path of the CSV report")
+	flags.Parse(args)
+
+	cells, err := coverage.LoadPopulation(*populationPath)
+	if err != nil {
+		log.Fatalf("Error loading population grid: %v", err)
+	}
+
+	isochrones, err := coverage.Load(*inputDir, *rangeValue)
+	if err != nil {
+		log.Fatalf("Error loading isochrones: %v", err)
+	}
+	fmt.Printf("Matching %d population cells with %d isochrones...\n", len(cells), len(isochrones))
+
+	result := coverage.PopulationCoverage(isochrones, cells, *maxLevel)
+
+	if err := os.MkdirAll(filepath.Dir(*outFile), 0755); err != nil {
+		log.Fatalf("Error creating output directory: %v", err)
+	}
+	file, err := os.Create(*outFile)
+	if err != nil {
+		log.Fatalf("Error creating report: %v", err)
+	}
+	if err := result.WriteCSV(file); err != nil {
+		file.Close()
+		log.Fatalf("Error writing report: %v", err)
+	}
+	if err := file.Close(); err != nil {
+		log.Fatalf("Error writing report: %v", err)
+	}
+
+	fmt.Printf("Population reached within range %d: %.0f of %.0f (%.1f%%)\n", result.Range, result.Covered, result.Total, result.CoveredShare*100)
+	for _, level := range result.Levels {
+		fmt.Printf("  reached by %s stations: %.0f (%.1f%%)\n", level.Label, level.Population, level.Share*100)
+	}
+	fmt.Printf("Report saved to %s\n", *outFile)
+}
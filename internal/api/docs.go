@@ -16,16 +16,146 @@ const Documentation = `
   - Returns the parsed content of locations/input.csv as a JSON array
   - Example: curl http://localhost:3000/api/locations/json
 
+- POST /api/locations
+  - Adds a location to locations/input.csv and returns the updated list (201 Created)
+  - Body: {"name": "APMPAD", "city": "PADERNO DUGNANO", "latitude": 45.5752, "longitude": 9.15325}
+  - Name, latitude and longitude are required; 0, 0 is rejected as missing coordinates
+  - Names are unique (case-insensitive) and may not contain parentheses or slashes; coordinates are saved with every decimal given
+  - Example: curl -X POST -H "Content-Type: application/json" -d '{"name":"APMBOL","city":"BOLLATE","latitude":45.5461,"longitude":9.1178}' http://localhost:3000/api/locations
+
+- PUT /api/locations/:name
+  - Updates the location with that name with the fields of the body, which may rename or move it, and returns the updated list
+  - Fields missing from the body keep their current value, e.g. {"city": "BOLLATE"} only changes the city
+  - Example: curl -X PUT -H "Content-Type: application/json" -d '{"city":"BOLLATE","latitude":45.5470,"longitude":9.1190}' http://localhost:3000/api/locations/APMBOL
+
+- DELETE /api/locations/:name
+  - Removes the location with that name and returns the updated list
+  - Example: curl -X DELETE http://localhost:3000/api/locations/APMBOL
+
+- Edits lock the file (locations/input.csv.lock) and replace it atomically; a file with parse errors is not rewritten (409 Conflict)
+
 ### GeoJSON Endpoints
-- GET /api/geojson
+Isochrone files are named STATIONCODE-cityName-RANGE.json, one per station and travel-time band.
+Every GeoJSON endpoint accepts an optional range query parameter (in seconds) to select a band; a range
+that is not a positive integer is rejected with 400 Bad Request.
+Geometries can be lightened with simplify (tolerance in meters), algorithm (douglas-peucker or
+visvalingam) and precision (decimal digits kept in coordinates), e.g. ?simplify=20&precision=5.
+
+- GET /api/geojson?range=600
   - Returns all GeoJSON files from out/geojson directory as a combined JSON array
-  - Example: curl http://localhost:3000/api/geojson
+  - Example: curl http://localhost:3000/api/geojson?range=480
+  - Example: curl "http://localhost:3000/api/geojson?range=480&simplify=25&precision=5"
 
-- GET /api/geojson/:name
+- GET /api/geojson/:name?range=600
   - Returns a specific GeoJSON file by name (without .json extension)
-  - Example: curl http://localhost:3000/api/geojson/APMPAD
+  - Example: curl http://localhost:3000/api/geojson/APMPAD-padernoDugnano?range=720
+  - Example: curl http://localhost:3000/api/geojson/APMPAD-padernoDugnano-720
 
-- GET /api/geojson/filter?names=name1,name2,name3
+- GET /api/geojson/filter?names=name1,name2,name3&range=600
   - Returns multiple specific GeoJSON files as a combined JSON array
-  - Example: curl http://localhost:3000/api/geojson/filter?names=APMPAD,ARGLIM
+  - Example: curl http://localhost:3000/api/geojson/filter?names=APMPAD-padernoDugnano,ARGLIM-limbiate&range=1200
+
+- GET /api/geojson/collection?names=name1,name2&range=600
+  - Returns the GeoJSON files as a single RFC 7946 FeatureCollection that QGIS and MapLibre open as-is
+  - Every feature carries a source property with the file it comes from (e.g. APMPAD-padernoDugnano-600)
+  - Without names every file is included; /api/geojson and /api/geojson/filter do the same with format=featurecollection
+  - Example: curl -o isochrones-720.geojson http://localhost:3000/api/geojson/collection?range=720
+  - Example: curl "http://localhost:3000/api/geojson?range=720&format=featurecollection"
+
+- Export formats on every GeoJSON endpoint: format=kml, kmz, gpx, shp or gpkg
+  - Returns the selected files as a download for Google Earth, GPS devices or desktop GIS tools
+  - shp is a zip archive with an isochrones and a stations shapefile; gpkg is a GeoPackage with the same two tables
+  - Without a format parameter the Accept header is honoured (application/vnd.google-earth.kml+xml,
+    application/vnd.google-earth.kmz, application/gpx+xml, application/x-shapefile+zip, application/geopackage+sqlite3)
+  - Example: curl -o isochrones-480.gpkg "http://localhost:3000/api/geojson?range=480&format=gpkg"
+  - Example: curl -O -J -H "Accept: application/vnd.google-earth.kml+xml" http://localhost:3000/api/geojson/APMPAD-padernoDugnano-720
+
+### Coverage Endpoints
+Coverage is computed on a grid of cell meters (default 100, minimum 25); areas are in km².
+The levels parameter must lie between 1 and 10. Without isochrones for the range 404 Not Found is returned.
+
+- GET /api/coverage?range=600&cell=100&levels=3
+  - Returns a GeoJSON FeatureCollection combining the isochrones of a range; the layer property tells the features apart:
+    - union: the area reached by at least one station
+    - coverage: the area reached by exactly level stations (label 1, 2, ...), the last level counting that many or more (label 3+)
+    - overlap: the area reached by both stations listed in the stations property
+  - The range is required when isochrones were generated for several ranges
+  - Example: curl http://localhost:3000/api/coverage?range=720
+
+- GET /api/coverage/gaps?range=600&cell=100&min_area=0.1
+  - Returns the parts of the boundary in locations/boundary.geojson not reached by any station within the range
+  - Each gap is a feature with its area_km2 and share of the boundary, largest first; gaps under min_area km² are omitted
+  - A summary member holds boundary_area_km2, covered_area_km2, gap_area_km2 and covered_share
+  - Example: curl http://localhost:3000/api/coverage/gaps?range=720&min_area=0.5
+
+- GET /api/coverage/population?range=480&levels=3
+  - Returns the residents reached within the range, using the population grid in locations/population.csv (lon,lat,population) or locations/population.geojson
+  - The JSON object holds total, covered and covered_share, the population reached by 1, 2 and 3+ stations (levels)
+    and, for every station, its population, share and exclusive population reached by no other station
+  - Example: curl http://localhost:3000/api/coverage/population?range=480
+
+### Reach Endpoints
+- GET /api/reach?lat=45.61&lon=9.15
+  - Returns the stations whose isochrones contain the point, grouped in bands by range, shortest first
+  - Each band holds the range and the matching locations; a station is listed in every band it reaches the point in
+  - Example: curl "http://localhost:3000/api/reach?lat=45.6123&lon=9.1544"
+
+### Routing Endpoints
+- POST /api/eta
+  - Ranks the stations of locations/input.csv by real travel time to one or more incidents (at most 25)
+  - Body: {"incidents": [{"latitude": 45.61, "longitude": 9.15}], "mode": "drive", "limit": 5}; mode and limit are optional
+  - Returns, for every incident, the stations with their time (seconds), distance (meters) and reachable flag, fastest first
+  - Uses the Geoapify route matrix API when GEOAPIFY_API_KEY is set, falling back to the OFFLINE_ROAD_GRAPH road network
+  - Routes are cached per station and incident pair for 24 hours
+  - Example: curl -X POST -H "Content-Type: application/json" -d '{"incidents":[{"latitude":45.6123,"longitude":9.1544}],"limit":3}' http://localhost:3000/api/eta
+
+### Job Endpoints
+- POST /api/jobs/regenerate
+  - Regenerates the isochrones of locations/input.csv into out/geojson in the background and returns the job (202 Accepted)
+  - Optional body: {"stations": ["APMPAD"], "ranges": [480, 720], "mode": "drive", "type": "time", "force": false}
+  - Without ranges, the ranges already present in out/geojson are regenerated (600 when there are none)
+  - Stations (compared case-insensitively) and ranges listed more than once are regenerated once
+  - Up-to-date isochrones are skipped unless force is set; the provider is configured by config/secret.json
+  - Only one job runs at a time: while one is running, 409 Conflict is returned with the running job
+  - Jobs and procgeojson lock out/geojson (out/geojson.lock): a job waits up to 15 minutes for a procgeojson run to finish
+  - Example: curl -X POST -H "Content-Type: application/json" -d '{"stations":["APMPAD"],"ranges":[720]}' http://localhost:3000/api/jobs/regenerate
+
+- GET /api/jobs/:id
+  - Returns the status (running, succeeded or failed), progress (0 to 1), completed/skipped/failed counts,
+    the result of every isochrone processed with its error and duration_seconds, and the job timing
+  - The 50 most recent finished jobs are kept
+  - Example: curl http://localhost:3000/api/jobs/3f2a9c1e5b7d4a60
+
+- Automatic regeneration
+  - Off by default; set WATCH_LOCATIONS in config/secret.json or the environment to true (file system notifications
+    through inotify, kqueue or ReadDirectoryChangesW) or polling (checks every 2 seconds) to watch locations/input.csv
+  - When it changes, a job regenerates the isochrones of the added stations and of the stations whose city or coordinates changed
+  - Edits made while a job is running are regenerated once it finishes; removed stations are only logged
+
+### Event Endpoints
+- GET /api/events?types=station,job.finished
+  - Streams dataset change notifications as Server-Sent Events (text/event-stream), so dashboards can refresh without polling
+  - Event types: station.added, station.modified, station.removed (from the location endpoints, and from edits of
+    locations/input.csv by hand when WATCH_LOCATIONS is set),
+    isochrone.regenerated (an isochrone file was written by a job, as it is written, or by procgeojson, within a few
+    seconds of the end of the run) and job.finished (the job as returned by GET /api/jobs/:id)
+  - The optional types filter takes a comma-separated list of types or groups (station, isochrone, job); every type by default
+  - Every event has an id; reconnecting with the Last-Event-ID header (or lastEventId query parameter) replays the 100 most recent events missed
+  - Data is a JSON object {"id": 12, "type": "isochrone.regenerated", "time": "...", "data": {"station": "APMPAD", "city": "PADERNO DUGNANO", "range": 600, "file": "APMPAD-padernoDugnano-600.json"}}
+  - A keep-alive comment is sent every 15 seconds; clients falling far behind are disconnected and replay on reconnection
+  - Sending "Upgrade: websocket" switches to a WebSocket carrying the same JSON objects as text messages
+  - Browsers may only open the WebSocket from pages of this host or of the origins listed, comma-separated, in
+    EVENTS_ALLOWED_ORIGINS (config/secret.json or the environment, * for any); other origins get 403 Forbidden
+  - Example: curl -N http://localhost:3000/api/events
+  - Browser: new EventSource("http://localhost:3000/api/events").addEventListener("job.finished", e => console.log(JSON.parse(e.data)))
+  - WebSocket: new WebSocket("ws://localhost:3000/api/events?types=station")
+
+### Vector Tile Endpoints
+- GET /api/tiles/{z}/{x}/{y}.mvt?range=600
+  - Returns a Mapbox Vector Tile (application/vnd.mapbox-vector-tile) rendered on demand from out/geojson
+  - The isochrones layer holds the isochrone polygons with their station properties, the stations layer one point per station
+  - The optional range restricts the isochrones layer to one band; tiles without features return 204 No Content
+  - Rendered tiles are cached in memory until an isochrone file changes
+  - Example: curl -o tile.mvt http://localhost:3000/api/tiles/12/2174/1467.mvt?range=720
+  - MapLibre source: {"type": "vector", "tiles": ["http://localhost:3000/api/tiles/{z}/{x}/{y}.mvt"], "maxzoom": 22}
 `
@@ -0,0 +1,303 @@
+// Package coverage combines the isochrones of all stations to find which areas are reached
+// within a travel time by at least one station and where stations overlap.
+// Polygon operations are approximated on a raster grid whose cell size bounds the error.
+package coverage
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"os"
+	"path/filepath"
+
+	"logreason/internal/geojson"
+	"logreason/internal/raster"
+)
+
+// Defaults of the coverage analysis
+const (
+	// DefaultCellSize Default grid resolution in meters
+	DefaultCellSize = 100.0
+	// DefaultMaxLevel Default highest coverage level; areas reached by more stations are merged into it
+	DefaultMaxLevel = 3
+	// MaxLevelLimit Highest coverage level accepted; larger values are clamped to it, since
+	// every level is traced over the whole grid
+	MaxLevelLimit = 10
+)
+
+// Errors returned by Load
+var (
+	// ErrNoIsochrones is returned when no isochrone file matches the range
+	ErrNoIsochrones = errors.New("no isochrones found")
+	// ErrMixedRanges is returned when no range is given and the files have several
+	ErrMixedRanges = errors.New("isochrones with several ranges found, select a range")
+)
+
+// Properties of the features returned by FeatureCollection
+const (
+	PropertyLayer    = "layer"
+	PropertyArea     = "area_km2"
+	PropertyLevel    = "level"
+	PropertyLabel    = "label"
+	PropertyStations = "stations"
+	PropertyRange    = "range"
+)
+
+// Values of the layer property
+const (
+	LayerUnion    = "union"
+	LayerCoverage = "coverage"
+	LayerOverlap  = "overlap"
+)
+
+// Isochrone is the area reached by one station within a range
+type Isochrone struct {
+	// Name is the station part of the file name, STATIONCODE-cityName
+	Name     string
+	Range    int
+	Polygons [][][]raster.Point
+}
+
+// Load reads the isochrones for a range from a GeoJSON output directory. With a range of 0
+// every file is loaded, which is only allowed when all files share the same range.
+// Files that cannot be parsed are skipped with a warning.
+func Load(dir string, rangeValue int) ([]Isochrone, error) {
+	names, err := geojson.ListFiles(dir, rangeValue)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list isochrones: %w", err)
+	}
+
+	var isochrones []Isochrone
+	for _, name := range names {
+		station, fileRange := geojson.ParseFileName(name)
+		if rangeValue == 0 && len(isochrones) > 0 && isochrones[0].Range != fileRange {
+			return nil, fmt.Errorf("%w: %d and %d", ErrMixedRanges, isochrones[0].Range, fileRange)
+		}
+
+		content, err := os.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read isochrone: %w", err)
+		}
+		fc, err := geojson.ParseFeatureCollection(content)
+		if err != nil {
+			log.Printf("Warning: skipping %s: %v", name, err)
+			continue
+		}
+
+		isochrones = append(isochrones, Isochrone{Name: station, Range: fileRange, Polygons: Polygons(fc)})
+	}
+
+	if len(isochrones) == 0 {
+		return nil, fmt.Errorf("%w in %s", ErrNoIsochrones, dir)
+	}
+	return isochrones, nil
+}
+
+// Polygons returns the isochrone polygons of a collection, ignoring station points
+func Polygons(fc *geojson.FeatureCollection) [][][]raster.Point {
+	var polygons [][][]raster.Point
+	for _, feature := range fc.Features {
+		if feature.Properties[geojson.PropertyFeatureType] == geojson.FeatureTypeStation {
+			continue
+		}
+		for _, polygon := range feature.Geometry.Polygons() {
+			rings := make([][]raster.Point, len(polygon))
+			for i, ring := range polygon {
+				rings[i] = make([]raster.Point, len(ring))
+				for j, position := range ring {
+					rings[i][j] = raster.Point{position.Lon(), position.Lat()}
+				}
+			}
+			polygons = append(polygons, rings)
+		}
+	}
+	return polygons
+}
+
+// Layer is a region of the coverage analysis
+type Layer struct {
+	Polygons [][][]raster.Point
+	// Area in square kilometers
+	Area float64
+}
+
+// Level is the area reached by exactly Level stations, or by at least Level stations
+// for the highest level
+type Level struct {
+	Layer
+	Level int
+	Label string
+}
+
+// Overlap is the area reached by both stations of a pair
+type Overlap struct {
+	Layer
+	Stations [2]string
+}
+
+// Result holds the outcome of Analyze
+type Result struct {
+	Range    int
+	CellSize float64
+	Union    Layer
+	Levels   []Level
+	Overlaps []Overlap
+	// Grid counts the stations reaching every cell
+	Grid *raster.Grid
+	// Cells lists the cells reached by every station, indexed like the isochrones
+	Cells [][]int
+}
+
+// Options configures Analyze
+type Options struct {
+	// CellSize is the grid resolution in meters; DefaultCellSize when 0
+	CellSize float64
+	// MaxLevel is the highest coverage level; DefaultMaxLevel when 0, at most MaxLevelLimit
+	MaxLevel int
+	// Padding is extra space in meters kept around the isochrones
+	Padding float64
+}
+
+// Analyze rasterises the isochrones and computes their union, the coverage levels and
+// the overlap of every pair of stations
+func Analyze(isochrones []Isochrone, options Options) *Result {
+	if options.CellSize <= 0 {
+		options.CellSize = DefaultCellSize
+	}
+	if options.MaxLevel <= 0 {
+		options.MaxLevel = DefaultMaxLevel
+	}
+	options.MaxLevel = min(options.MaxLevel, MaxLevelLimit)
+
+	result := &Result{CellSize: options.CellSize}
+	if len(isochrones) > 0 {
+		result.Range = isochrones[0].Range
+	}
+
+	var all [][][]raster.Point
+	for _, isochrone := range isochrones {
+		all = append(all, isochrone.Polygons...)
+	}
+	result.Grid = NewGrid(all, options.CellSize, options.Padding)
+
+	// Rasterise every station on its own so that overlapping polygons of the same
+	// station count once, then add it to the station counters
+	scratch := result.Grid.Empty()
+	result.Cells = make([][]int, len(isochrones))
+	for i, isochrone := range isochrones {
+		result.Cells[i] = Rasterize(scratch, isochrone.Polygons)
+		for _, cell := range result.Cells[i] {
+			result.Grid.Cells[cell]++
+		}
+	}
+
+	result.Union = layer(result.Grid, func(count int32) bool { return count > 0 })
+
+	for level := 1; level <= options.MaxLevel; level++ {
+		level := int32(level)
+		match := func(count int32) bool { return count == level }
+		label := fmt.Sprint(level)
+		if int(level) == options.MaxLevel {
+			match = func(count int32) bool { return count >= level }
+			label += "+"
+		}
+		result.Levels = append(result.Levels, Level{Layer: layer(result.Grid, match), Level: int(level), Label: label})
+	}
+
+	for i := range isochrones {
+		for j := i + 1; j < len(isochrones); j++ {
+			common := intersect(result.Cells[i], result.Cells[j])
+			if len(common) == 0 {
+				continue
+			}
+			result.Overlaps = append(result.Overlaps, Overlap{
+				Layer:    cellsLayer(result.Grid, common),
+				Stations: [2]string{isochrones[i].Name, isochrones[j].Name},
+			})
+		}
+	}
+
+	return result
+}
+
+// NewGrid creates an empty grid covering the polygons with a margin of padding meters
+func NewGrid(polygons [][][]raster.Point, cellSize, padding float64) *raster.Grid {
+	minLon, minLat := math.Inf(1), math.Inf(1)
+	maxLon, maxLat := math.Inf(-1), math.Inf(-1)
+	for _, polygon := range polygons {
+		for _, point := range polygon[0] {
+			minLon, maxLon = math.Min(minLon, point[0]), math.Max(maxLon, point[0])
+			minLat, maxLat = math.Min(minLat, point[1]), math.Max(maxLat, point[1])
+		}
+	}
+	if math.IsInf(minLon, 1) {
+		minLon, minLat, maxLon, maxLat = 0, 0, 0, 0
+	}
+
+	// Keep a margin of one cell so regions never touch the grid border
+	padLat := (padding + cellSize) / raster.MetersPerDegree
+	padLon := padLat / math.Cos((minLat+maxLat)/2*math.Pi/180)
+	return raster.NewGrid(minLon-padLon, minLat-padLat, maxLon+padLon, maxLat+padLat, cellSize)
+}
+
+// Rasterize fills the polygons into scratch and returns the indices of the covered cells
+// in ascending order, leaving scratch empty again
+func Rasterize(scratch *raster.Grid, polygons [][][]raster.Point) []int {
+	for _, polygon := range polygons {
+		scratch.FillPolygon(polygon)
+	}
+
+	var cells []int
+	for i, value := range scratch.Cells {
+		if value != 0 {
+			cells = append(cells, i)
+			scratch.Cells[i] = 0
+		}
+	}
+	return cells
+}
+
+// layer traces the cells matching the predicate and measures their area
+func layer(grid *raster.Grid, include func(int32) bool) Layer {
+	return Layer{Polygons: grid.Polygons(include), Area: grid.Area(include)}
+}
+
+// cellsLayer traces a list of cells of the grid on a window restricted to their bounding box,
+// so that the work depends on the size of the region rather than of the whole grid
+func cellsLayer(grid *raster.Grid, cells []int) Layer {
+	minCol, minRow := grid.Cols, grid.Rows
+	maxCol, maxRow := -1, -1
+	for _, cell := range cells {
+		col, row := cell%grid.Cols, cell/grid.Cols
+		minCol, maxCol = min(minCol, col), max(maxCol, col)
+		minRow, maxRow = min(minRow, row), max(maxRow, row)
+	}
+	if maxCol < 0 {
+		return Layer{}
+	}
+
+	window := grid.Window(minCol, minRow, maxCol-minCol+1, maxRow-minRow+1)
+	for _, cell := range cells {
+		window.Set(cell%grid.Cols-minCol, cell/grid.Cols-minRow, 1)
+	}
+	return layer(window, func(value int32) bool { return value != 0 })
+}
+
+// intersect returns the values found in both ascending lists
+func intersect(a, b []int) []int {
+	var common []int
+	for i, j := 0, 0; i < len(a) && j < len(b); {
+		switch {
+		case a[i] < b[j]:
+			i++
+		case a[i] > b[j]:
+			j++
+		default:
+			common = append(common, a[i])
+			i++
+			j++
+		}
+	}
+	return common
+}
@@ -0,0 +1,290 @@
+package coverage
+
+import (
+	"encoding/json"
+	"errors"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"logreason/internal/raster"
+)
+
+// square returns a polygon of size by size degrees with its south-west corner at lon, lat
+func square(lon, lat, size float64) [][]raster.Point {
+	return [][]raster.Point{{{lon, lat}, {lon + size, lat}, {lon + size, lat + size}, {lon, lat + size}, {lon, lat}}}
+}
+
+// squareArea returns the area of a square of size degrees near latitude 45 in km²
+func squareArea(size float64) float64 {
+	return size * raster.MetersPerDegree * size * raster.MetersPerDegree * math.Cos(45.05*math.Pi/180) / 1e6
+}
+
+// near accepts the error of cells straddling the polygon outlines
+func near(got, want float64) bool {
+	return math.Abs(got-want) <= want*0.1
+}
+
+func TestAnalyze(t *testing.T) {
+	// A and B overlap on half their area, C lies inside the overlap, D is on its own
+	isochrones := []Isochrone{
+		{Name: "A-city", Range: 600, Polygons: [][][]raster.Point{square(9.0, 45.0, 0.1)}},
+		{Name: "B-city", Range: 600, Polygons: [][][]raster.Point{square(9.05, 45.0, 0.1)}},
+		{Name: "C-city", Range: 600, Polygons: [][][]raster.Point{square(9.06, 45.02, 0.02)}},
+		{Name: "D-city", Range: 600, Polygons: [][][]raster.Point{square(9.5, 45.0, 0.05)}},
+	}
+
+	result := Analyze(isochrones, Options{CellSize: 100})
+
+	if result.Range != 600 {
+		t.Errorf("Range = %d, want 600", result.Range)
+	}
+	if want := squareArea(0.1)*1.5 + squareArea(0.05); !near(result.Union.Area, want) {
+		t.Errorf("Union area = %.2f, want %.2f", result.Union.Area, want)
+	}
+	if len(result.Union.Polygons) != 2 {
+		t.Errorf("Union has %d polygons, want 2", len(result.Union.Polygons))
+	}
+
+	if len(result.Levels) != 3 || result.Levels[2].Label != "3+" {
+		t.Fatalf("Unexpected levels %+v", result.Levels)
+	}
+	wantLevels := []float64{
+		squareArea(0.1) + squareArea(0.05),
+		squareArea(0.05)*2 - squareArea(0.02),
+		squareArea(0.02),
+	}
+	for i, want := range wantLevels {
+		if !near(result.Levels[i].Area, want) {
+			t.Errorf("Level %s area = %.2f, want %.2f", result.Levels[i].Label, result.Levels[i].Area, want)
+		}
+	}
+
+	if len(result.Overlaps) != 3 {
+		t.Fatalf("Got %d overlaps, want 3 (A-B, A-C, B-C)", len(result.Overlaps))
+	}
+	if result.Overlaps[0].Stations != [2]string{"A-city", "B-city"} {
+		t.Errorf("Unexpected first overlap %v", result.Overlaps[0].Stations)
+	}
+	if want := squareArea(0.05) * 2; !near(result.Overlaps[0].Area, want) {
+		t.Errorf("A-B overlap area = %.2f, want %.2f", result.Overlaps[0].Area, want)
+	}
+
+	// Overlaps are traced on a window of the grid, so their outline must match the overlap
+	for _, ring := range result.Overlaps[0].Polygons[0] {
+		for _, point := range ring {
+			if point[0] < 9.05-0.002 || point[0] > 9.1+0.002 || point[1] < 45.0-0.002 || point[1] > 45.1+0.002 {
+				t.Fatalf("A-B overlap point %v lies outside the overlap", point)
+			}
+		}
+	}
+
+	fc := result.FeatureCollection()
+	if len(fc.Features) != 1+3+3 {
+		t.Errorf("Got %d features, want 7", len(fc.Features))
+	}
+	if err := fc.Validate(); err != nil {
+		t.Errorf("Invalid feature collection: %v", err)
+	}
+}
+
+func TestAnalyze_MaxLevelLimit(t *testing.T) {
+	isochrones := []Isochrone{{Name: "A-city", Range: 600, Polygons: [][][]raster.Point{square(9.0, 45.0, 0.01)}}}
+	result := Analyze(isochrones, Options{CellSize: 100, MaxLevel: math.MaxInt})
+	if len(result.Levels) != MaxLevelLimit {
+		t.Errorf("Got %d levels, want them clamped to %d", len(result.Levels), MaxLevelLimit)
+	}
+}
+
+func TestLoad(t *testing.T) {
+	dir := t.TempDir()
+
+	write := func(name string, polygon [][]raster.Point) {
+		data, _ := json.Marshal(map[string]interface{}{
+			"type": "FeatureCollection",
+			"features": []interface{}{
+				map[string]interface{}{
+					"type":       "Feature",
+					"properties": map[string]interface{}{"feature_type": "isochrone"},
+					"geometry":   map[string]interface{}{"type": "Polygon", "coordinates": polygon},
+				},
+				map[string]interface{}{
+					"type":       "Feature",
+					"properties": map[string]interface{}{"feature_type": "station"},
+					"geometry":   map[string]interface{}{"type": "Point", "coordinates": []float64{9, 45}},
+				},
+			},
+		})
+		if err := os.WriteFile(filepath.Join(dir, name), data, 0644); err != nil {
+			t.Fatalf("Failed to write %s: %v", name, err)
+		}
+	}
+	write("A-city-600.json", square(9.0, 45.0, 0.1))
+	write("B-city-600.json", square(9.1, 45.0, 0.1))
+	write("A-city-1200.json", square(8.9, 44.9, 0.3))
+
+	isochrones, err := Load(dir, 600)
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if len(isochrones) != 2 || isochrones[0].Name != "A-city" || len(isochrones[0].Polygons) != 1 {
+		t.Errorf("Unexpected isochrones %+v", isochrones)
+	}
+
+	if _, err := Load(dir, 0); !errors.Is(err, ErrMixedRanges) {
+		t.Errorf("Expected ErrMixedRanges when loading mixed ranges, got %v", err)
+	}
+	if _, err := Load(dir, 900); !errors.Is(err, ErrNoIsochrones) {
+		t.Errorf("Expected ErrNoIsochrones when no isochrone matches the range, got %v", err)
+	}
+}
+
+func TestGaps(t *testing.T) {
+	// The boundary is a 0.2 degree square; A covers its western half except a hole,
+	// B covers the north-eastern quarter, leaving the south-eastern quarter and the hole
+	boundary := [][][]raster.Point{square(9.0, 45.0, 0.2)}
+	withHole := append(square(9.0, 45.0, 0.1), []raster.Point{{9.04, 45.14}, {9.04, 45.16}, {9.06, 45.16}, {9.06, 45.14}, {9.04, 45.14}})
+	withHole[0] = []raster.Point{{9.0, 45.0}, {9.1, 45.0}, {9.1, 45.2}, {9.0, 45.2}, {9.0, 45.0}}
+	isochrones := []Isochrone{
+		{Name: "A-city", Range: 600, Polygons: [][][]raster.Point{withHole}},
+		{Name: "B-city", Range: 600, Polygons: [][][]raster.Point{square(9.1, 45.1, 0.1), square(9.3, 45.0, 0.1)}},
+	}
+
+	result := Gaps(isochrones, boundary, Options{CellSize: 100}, 0.5)
+
+	if want := squareArea(0.2); !near(result.Summary.BoundaryArea, want) {
+		t.Errorf("Boundary area = %.2f, want %.2f", result.Summary.BoundaryArea, want)
+	}
+	wantGap := squareArea(0.1) + squareArea(0.02)
+	if !near(result.Summary.GapArea, wantGap) {
+		t.Errorf("Gap area = %.2f, want %.2f", result.Summary.GapArea, wantGap)
+	}
+	if share := result.Summary.CoveredShare; share < 0.72 || share > 0.76 {
+		t.Errorf("Covered share = %.4f, want about 0.74", share)
+	}
+
+	if len(result.Gaps) != 2 {
+		t.Fatalf("Got %d gaps, want 2", len(result.Gaps))
+	}
+	if !near(result.Gaps[0].Area, squareArea(0.1)) || !near(result.Gaps[1].Area, squareArea(0.02)) {
+		t.Errorf("Gap areas = %.2f, %.2f", result.Gaps[0].Area, result.Gaps[1].Area)
+	}
+
+	if gaps := Gaps(isochrones, boundary, Options{CellSize: 100}, 5); len(gaps.Gaps) != 1 {
+		t.Errorf("Got %d gaps above 5 km², want 1", len(gaps.Gaps))
+	}
+
+	fc := result.FeatureCollection()
+	if err := fc.Validate(); err != nil {
+		t.Errorf("Invalid feature collection: %v", err)
+	}
+	data, _ := json.Marshal(fc)
+	var decoded map[string]interface{}
+	json.Unmarshal(data, &decoded)
+	if decoded["type"] != "FeatureCollection" || decoded["summary"] == nil {
+		t.Errorf("Unexpected encoding %s", data)
+	}
+}
+
+func TestLoadBoundary(t *testing.T) {
+	dir := t.TempDir()
+	documents := map[string]string{
+		"collection.geojson": `{"type":"FeatureCollection","features":[{"type":"Feature","properties":{"name":"MI"},
+			"geometry":{"type":"Polygon","coordinates":[[[9,45],[9.2,45],[9.2,45.2],[9,45.2],[9,45]]]}}]}`,
+		"feature.geojson": `{"type":"Feature","properties":{},
+			"geometry":{"type":"MultiPolygon","coordinates":[[[[9,45],[9.2,45],[9.2,45.2],[9,45.2],[9,45]]]]}}`,
+		"geometry.geojson": `{"type":"Polygon","coordinates":[[[9,45],[9.2,45],[9.2,45.2],[9,45.2],[9,45]]]}`,
+	}
+	for name, content := range documents {
+		path := filepath.Join(dir, name)
+		os.WriteFile(path, []byte(content), 0644)
+		polygons, err := LoadBoundary(path)
+		if err != nil || len(polygons) != 1 {
+			t.Errorf("LoadBoundary(%s) = %v, %v", name, polygons, err)
+		}
+	}
+
+	path := filepath.Join(dir, "point.geojson")
+	os.WriteFile(path, []byte(`{"type":"Point","coordinates":[9,45]}`), 0644)
+	if _, err := LoadBoundary(path); err == nil {
+		t.Error("Expected an error for a boundary without polygons")
+	}
+}
+
+func TestPopulationCoverage(t *testing.T) {
+	isochrones := []Isochrone{
+		{Name: "A-city", Range: 480, Polygons: [][][]raster.Point{square(9.0, 45.0, 0.1)}},
+		{Name: "B-city", Range: 480, Polygons: [][][]raster.Point{square(9.05, 45.0, 0.1)}},
+	}
+
+	grid := "lon,lat,population\n" +
+		"9.01,45.01,100\n" + // A only
+		"9.07,45.05,50\n" + // A and B
+		"9.12,45.05,30\n" + // B only
+		"9.50,45.50,20\n" // nobody
+	cells, err := ReadPopulationCSV(strings.NewReader(grid))
+	if err != nil {
+		t.Fatalf("ReadPopulationCSV failed: %v", err)
+	}
+
+	result := PopulationCoverage(isochrones, cells, 2)
+
+	if result.Total != 200 || result.Covered != 180 || result.CoveredShare != 0.9 {
+		t.Errorf("Total %v, covered %v (%v), want 200, 180 (0.9)", result.Total, result.Covered, result.CoveredShare)
+	}
+	if result.Levels[0].Population != 130 || result.Levels[1].Population != 50 || result.Levels[1].Label != "2+" {
+		t.Errorf("Unexpected levels %+v", result.Levels)
+	}
+	want := []StationPopulation{
+		{Station: "A-city", Population: 150, Share: 0.75, Exclusive: 100},
+		{Station: "B-city", Population: 80, Share: 0.4, Exclusive: 30},
+	}
+	for i := range want {
+		if result.Stations[i] != want[i] {
+			t.Errorf("Station %d = %+v, want %+v", i, result.Stations[i], want[i])
+		}
+	}
+
+	// An oversized level count must not overflow or exhaust memory
+	if clamped := PopulationCoverage(isochrones, cells, math.MaxInt); len(clamped.Levels) != MaxLevelLimit {
+		t.Errorf("Got %d levels, want them clamped to %d", len(clamped.Levels), MaxLevelLimit)
+	}
+
+	var report strings.Builder
+	if err := result.WriteCSV(&report); err != nil {
+		t.Fatalf("WriteCSV failed: %v", err)
+	}
+	wantReport := "station,range,population,share,exclusive\n" +
+		"A-city,480,150,0.75,100\n" +
+		"B-city,480,80,0.4,30\n" +
+		"TOTAL,480,180,0.9,\n"
+	if report.String() != wantReport {
+		t.Errorf("Unexpected report:\n%s", report.String())
+	}
+}
+
+func TestReadPopulation(t *testing.T) {
+	if _, err := ReadPopulationCSV(strings.NewReader("x,y\n1,2\n")); err == nil {
+		t.Error("Expected an error for a CSV without population column")
+	}
+	if _, err := ReadPopulationCSV(strings.NewReader("Longitude,Latitude,POP\n9,45,abc\n")); err == nil {
+		t.Error("Expected an error for an invalid number")
+	}
+
+	grid := `{"type":"FeatureCollection","features":[
+		{"type":"Feature","properties":{"population":12},"geometry":{"type":"Point","coordinates":[9.1,45.1]}},
+		{"type":"Feature","properties":{"POP":"8"},
+		 "geometry":{"type":"Polygon","coordinates":[[[9,45],[9.2,45],[9.2,45.2],[9,45.2],[9,45]]]}}]}`
+	cells, err := ReadPopulationGeoJSON(strings.NewReader(grid))
+	if err != nil {
+		t.Fatalf("ReadPopulationGeoJSON failed: %v", err)
+	}
+	want := []PopulationCell{{9.1, 45.1, 12}, {9.1, 45.1, 8}}
+	for i := range want {
+		if math.Abs(cells[i].Lon-want[i].Lon) > 1e-9 || math.Abs(cells[i].Lat-want[i].Lat) > 1e-9 || cells[i].Population != want[i].Population {
+			t.Errorf("Cell %d = %+v, want %+v", i, cells[i], want[i])
+		}
+	}
+}
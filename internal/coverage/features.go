@@ -0,0 +1,69 @@
+package coverage
+
+import (
+	"math"
+
+	"logreason/internal/geojson"
+	"logreason/internal/raster"
+)
+
+// FeatureCollection returns the union, the coverage levels and the pairwise overlaps as
+// GeoJSON features told apart by their layer property
+func (r *Result) FeatureCollection() *geojson.FeatureCollection {
+	fc := &geojson.FeatureCollection{Type: geojson.TypeFeatureCollection, Features: []*geojson.Feature{}}
+
+	add := func(l Layer, properties map[string]interface{}) {
+		if len(l.Polygons) == 0 {
+			return
+		}
+		properties[PropertyArea] = roundArea(l.Area)
+		properties[PropertyRange] = r.Range
+		fc.Features = append(fc.Features, &geojson.Feature{
+			Type:       geojson.TypeFeature,
+			Geometry:   Geometry(l.Polygons),
+			Properties: properties,
+		})
+	}
+
+	add(r.Union, map[string]interface{}{PropertyLayer: LayerUnion})
+	for _, level := range r.Levels {
+		add(level.Layer, map[string]interface{}{
+			PropertyLayer: LayerCoverage,
+			PropertyLevel: level.Level,
+			PropertyLabel: level.Label,
+		})
+	}
+	for _, overlap := range r.Overlaps {
+		add(overlap.Layer, map[string]interface{}{
+			PropertyLayer:    LayerOverlap,
+			PropertyStations: overlap.Stations[:],
+		})
+	}
+
+	return fc
+}
+
+// Geometry converts traced polygons to a GeoJSON Polygon or MultiPolygon
+func Geometry(polygons [][][]raster.Point) *geojson.Geometry {
+	converted := make([][][]geojson.Position, len(polygons))
+	for i, polygon := range polygons {
+		converted[i] = make([][]geojson.Position, len(polygon))
+		for j, ring := range polygon {
+			converted[i][j] = make([]geojson.Position, len(ring))
+			for k, point := range ring {
+				converted[i][j][k] = geojson.Position{point[0], point[1]}
+			}
+		}
+	}
+
+	if len(converted) == 1 {
+		return &geojson.Geometry{Type: geojson.TypePolygon, Polygon: converted[0]}
+	}
+	return &geojson.Geometry{Type: geojson.TypeMultiPolygon, MultiPolygon: converted}
+}
+
+// roundArea rounds an area to hundredths of a square kilometer, the grid resolution
+// making further digits meaningless
+func roundArea(area float64) float64 {
+	return math.Round(area*100) / 100
+}
@@ -0,0 +1,168 @@
+package coverage
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"sort"
+
+	"logreason/internal/geojson"
+	"logreason/internal/raster"
+)
+
+// LayerGap is the layer property value of gap features
+const LayerGap = "gap"
+
+// PropertyShare is the fraction of the boundary area taken by a gap
+const PropertyShare = "share"
+
+// LoadBoundary reads the polygons of an operating territory, such as a province or health
+// district, from a GeoJSON file holding a FeatureCollection, a Feature or a bare geometry
+func LoadBoundary(path string) ([][][]raster.Point, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read boundary: %w", err)
+	}
+
+	var header struct {
+		Type string `json:"type"`
+	}
+	if err := json.Unmarshal(content, &header); err != nil {
+		return nil, fmt.Errorf("failed to parse boundary: %w", err)
+	}
+
+	// Wrap features and geometries into a collection to validate them in one way
+	fc := &geojson.FeatureCollection{}
+	switch header.Type {
+	case geojson.TypeFeatureCollection:
+		err = json.Unmarshal(content, fc)
+	case geojson.TypeFeature:
+		var feature geojson.Feature
+		err = json.Unmarshal(content, &feature)
+		fc = &geojson.FeatureCollection{Type: geojson.TypeFeatureCollection, Features: []*geojson.Feature{&feature}}
+	default:
+		var geometry geojson.Geometry
+		err = json.Unmarshal(content, &geometry)
+		fc = &geojson.FeatureCollection{
+			Type:     geojson.TypeFeatureCollection,
+			Features: []*geojson.Feature{{Type: geojson.TypeFeature, Geometry: &geometry}},
+		}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse boundary: %w", err)
+	}
+	if err := fc.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid boundary: %w", err)
+	}
+
+	polygons := Polygons(fc)
+	if len(polygons) == 0 {
+		return nil, fmt.Errorf("boundary %s has no Polygon or MultiPolygon", path)
+	}
+	return polygons, nil
+}
+
+// GapSummary compares the boundary area with the part reached by the stations
+type GapSummary struct {
+	Range        int     `json:"range"`
+	BoundaryArea float64 `json:"boundary_area_km2"`
+	CoveredArea  float64 `json:"covered_area_km2"`
+	GapArea      float64 `json:"gap_area_km2"`
+	// CoveredShare is the fraction of the boundary reached by at least one station
+	CoveredShare float64 `json:"covered_share"`
+}
+
+// GapResult holds the outcome of Gaps
+type GapResult struct {
+	Summary GapSummary
+	// Gaps are the unreached parts of the boundary, largest first
+	Gaps []Layer
+}
+
+// Gaps computes the parts of the boundary not reached by any of the isochrones. Every
+// disconnected gap is returned as its own layer; gaps smaller than minArea square
+// kilometers, typically slivers along the boundary, are left out of the list but still
+// count towards the gap area.
+func Gaps(isochrones []Isochrone, boundary [][][]raster.Point, options Options, minArea float64) *GapResult {
+	if options.CellSize <= 0 {
+		options.CellSize = DefaultCellSize
+	}
+
+	result := &GapResult{}
+	if len(isochrones) > 0 {
+		result.Summary.Range = isochrones[0].Range
+	}
+
+	// The grid spans the isochrones too, which is simpler than clipping them to the boundary
+	all := append([][][]raster.Point{}, boundary...)
+	for _, isochrone := range isochrones {
+		all = append(all, isochrone.Polygons...)
+	}
+	grid := NewGrid(all, options.CellSize, options.Padding)
+
+	// Mark the boundary cells with 1 and the reached boundary cells with 2
+	scratch := grid.Empty()
+	for _, cell := range Rasterize(scratch, boundary) {
+		grid.Cells[cell] = 1
+	}
+	for _, isochrone := range isochrones {
+		for _, cell := range Rasterize(scratch, isochrone.Polygons) {
+			if grid.Cells[cell] != 0 {
+				grid.Cells[cell] = 2
+			}
+		}
+	}
+
+	isGap := func(value int32) bool { return value == 1 }
+	result.Summary.BoundaryArea = roundArea(grid.Area(func(value int32) bool { return value != 0 }))
+	result.Summary.GapArea = roundArea(grid.Area(isGap))
+	result.Summary.CoveredArea = roundArea(result.Summary.BoundaryArea - result.Summary.GapArea)
+	if result.Summary.BoundaryArea > 0 {
+		result.Summary.CoveredShare = roundShare(result.Summary.CoveredArea / result.Summary.BoundaryArea)
+	}
+
+	for _, polygon := range grid.Polygons(isGap) {
+		area := raster.PolygonArea(polygon)
+		if area < minArea {
+			continue
+		}
+		result.Gaps = append(result.Gaps, Layer{Polygons: [][][]raster.Point{polygon}, Area: area})
+	}
+	sort.SliceStable(result.Gaps, func(i, j int) bool { return result.Gaps[i].Area > result.Gaps[j].Area })
+
+	return result
+}
+
+// GapCollection is a FeatureCollection of gaps with the summary as a foreign member
+type GapCollection struct {
+	*geojson.FeatureCollection
+	Summary GapSummary `json:"summary"`
+}
+
+// FeatureCollection returns one feature per gap, largest first, with its area and
+// share of the boundary
+func (r *GapResult) FeatureCollection() *GapCollection {
+	fc := &geojson.FeatureCollection{Type: geojson.TypeFeatureCollection, Features: []*geojson.Feature{}}
+	for _, gap := range r.Gaps {
+		properties := map[string]interface{}{
+			PropertyLayer: LayerGap,
+			PropertyArea:  roundArea(gap.Area),
+			PropertyRange: r.Summary.Range,
+		}
+		if r.Summary.BoundaryArea > 0 {
+			properties[PropertyShare] = roundShare(gap.Area / r.Summary.BoundaryArea)
+		}
+		fc.Features = append(fc.Features, &geojson.Feature{
+			Type:       geojson.TypeFeature,
+			Geometry:   Geometry(gap.Polygons),
+			Properties: properties,
+		})
+	}
+	return &GapCollection{FeatureCollection: fc, Summary: r.Summary}
+}
+
+// roundShare rounds a fraction to four decimal places
+func roundShare(share float64) float64 {
+	return math.Round(share*10000) / 10000
+}
@@ -0,0 +1,321 @@
+package coverage
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"logreason/internal/geojson"
+	"logreason/internal/raster"
+)
+
+// PopulationCell is a cell of a population grid, represented by its centre
+type PopulationCell struct {
+	Lon        float64
+	Lat        float64
+	Population float64
+}
+
+// Column and property names recognised in population files, compared case-insensitively
+var (
+	lonNames        = []string{"lon", "lng", "longitude", "x"}
+	latNames        = []string{"lat", "latitude", "y"}
+	populationNames = []string{"population", "pop", "value", "tot_p"}
+)
+
+// LoadPopulation reads a population grid. CSV files (.csv) need a header with longitude,
+// latitude and population columns; GeoJSON files (.json, .geojson) hold Point or Polygon
+// features with a population property, polygons being represented by their centroid.
+func LoadPopulation(path string) ([]PopulationCell, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open population grid: %w", err)
+	}
+	defer file.Close()
+
+	var cells []PopulationCell
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".csv":
+		cells, err = ReadPopulationCSV(file)
+	case ".json", ".geojson":
+		cells, err = ReadPopulationGeoJSON(file)
+	default:
+		return nil, fmt.Errorf("unsupported population grid format %q, expected .csv or .geojson", filepath.Ext(path))
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read population grid %s: %w", path, err)
+	}
+	if len(cells) == 0 {
+		return nil, fmt.Errorf("population grid %s is empty", path)
+	}
+	return cells, nil
+}
+
+// ReadPopulationCSV reads population cells from CSV data with a header row
+func ReadPopulationCSV(r io.Reader) ([]PopulationCell, error) {
+	reader := csv.NewReader(r)
+
+	header, err := reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read header: %w", err)
+	}
+	lonColumn, latColumn, popColumn := findColumn(header, lonNames), findColumn(header, latNames), findColumn(header, populationNames)
+	if lonColumn < 0 || latColumn < 0 || popColumn < 0 {
+		return nil, fmt.Errorf("header must contain longitude, latitude and population columns, got %v", header)
+	}
+
+	var cells []PopulationCell
+	for row := 1; ; row++ {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("row %d: %w", row, err)
+		}
+
+		var values [3]float64
+		for i, column := range []int{lonColumn, latColumn, popColumn} {
+			if column >= len(record) {
+				return nil, fmt.Errorf("row %d: missing column %d", row, column+1)
+			}
+			values[i], err = strconv.ParseFloat(strings.TrimSpace(record[column]), 64)
+			if err != nil {
+				return nil, fmt.Errorf("row %d: invalid number %q", row, record[column])
+			}
+		}
+		cells = append(cells, PopulationCell{Lon: values[0], Lat: values[1], Population: values[2]})
+	}
+	return cells, nil
+}
+
+// ReadPopulationGeoJSON reads population cells from a GeoJSON FeatureCollection
+func ReadPopulationGeoJSON(r io.Reader) ([]PopulationCell, error) {
+	var fc geojson.FeatureCollection
+	if err := json.NewDecoder(r).Decode(&fc); err != nil {
+		return nil, err
+	}
+	if err := fc.Validate(); err != nil {
+		return nil, err
+	}
+
+	var cells []PopulationCell
+	for i, feature := range fc.Features {
+		population, ok := populationProperty(feature.Properties)
+		if !ok {
+			return nil, fmt.Errorf("features[%d] has no population property", i)
+		}
+
+		var lon, lat float64
+		switch {
+		case feature.Geometry == nil:
+			return nil, fmt.Errorf("features[%d] has no geometry", i)
+		case feature.Geometry.Type == geojson.TypePoint:
+			lon, lat = feature.Geometry.Point.Lon(), feature.Geometry.Point.Lat()
+		case len(feature.Geometry.Polygons()) > 0:
+			lon, lat = centroid(feature.Geometry.Polygons()[0][0])
+		default:
+			return nil, fmt.Errorf("features[%d] is a %s, expected a Point or Polygon", i, feature.Geometry.Type)
+		}
+		cells = append(cells, PopulationCell{Lon: lon, Lat: lat, Population: population})
+	}
+	return cells, nil
+}
+
+func findColumn(header []string, names []string) int {
+	for i, column := range header {
+		column = strings.ToLower(strings.TrimSpace(column))
+		for _, name := range names {
+			if column == name {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
+func populationProperty(properties map[string]interface{}) (float64, bool) {
+	for key, value := range properties {
+		if findColumn([]string{key}, populationNames) < 0 {
+			continue
+		}
+		switch v := value.(type) {
+		case float64:
+			return v, true
+		case string:
+			population, err := strconv.ParseFloat(strings.TrimSpace(v), 64)
+			return population, err == nil
+		}
+	}
+	return 0, false
+}
+
+// centroid returns the average of the distinct vertices of a closed ring, which is
+// the centre of the regular cells found in population grids
+func centroid(ring []geojson.Position) (lon, lat float64) {
+	n := len(ring) - 1
+	for _, position := range ring[:n] {
+		lon += position.Lon()
+		lat += position.Lat()
+	}
+	return lon / float64(n), lat / float64(n)
+}
+
+// StationPopulation is the population reached by one station
+type StationPopulation struct {
+	Station    string  `json:"station"`
+	Population float64 `json:"population"`
+	// Share is the fraction of the total population reached by the station
+	Share float64 `json:"share"`
+	// Exclusive is the population reached by this station and no other one
+	Exclusive float64 `json:"exclusive"`
+}
+
+// PopulationResult holds the outcome of PopulationCoverage
+type PopulationResult struct {
+	Range int `json:"range"`
+	// Total is the population of the whole grid
+	Total float64 `json:"total"`
+	// Covered is the population reached by at least one station
+	Covered      float64 `json:"covered"`
+	CoveredShare float64 `json:"covered_share"`
+	// Levels is the population reached by exactly 1, 2, ... stations, the last level
+	// counting that many stations or more
+	Levels   []PopulationLevel   `json:"levels"`
+	Stations []StationPopulation `json:"stations"`
+}
+
+// PopulationLevel is the population reached by a number of stations
+type PopulationLevel struct {
+	Level      int     `json:"level"`
+	Label      string  `json:"label"`
+	Population float64 `json:"population"`
+	Share      float64 `json:"share"`
+}
+
+// PopulationCoverage computes the population reached by every station and by the stations
+// together, testing each population cell centre against the isochrone polygons. maxLevel is
+// clamped to MaxLevelLimit.
+func PopulationCoverage(isochrones []Isochrone, cells []PopulationCell, maxLevel int) *PopulationResult {
+	if maxLevel <= 0 {
+		maxLevel = DefaultMaxLevel
+	}
+	maxLevel = min(maxLevel, MaxLevelLimit)
+
+	result := &PopulationResult{}
+	if len(isochrones) > 0 {
+		result.Range = isochrones[0].Range
+	}
+
+	// Count the stations reaching every cell and the population each station reaches
+	reached := make([]int, len(cells))
+	last := make([]int, len(cells))
+	stations := make([]float64, len(isochrones))
+	for s, isochrone := range isochrones {
+		bboxes := make([][4]float64, len(isochrone.Polygons))
+		for p, polygon := range isochrone.Polygons {
+			bboxes[p] = polygonBounds(polygon)
+		}
+
+		for c, cell := range cells {
+			for p, polygon := range isochrone.Polygons {
+				b := bboxes[p]
+				if cell.Lon < b[0] || cell.Lat < b[1] || cell.Lon > b[2] || cell.Lat > b[3] {
+					continue
+				}
+				if raster.PolygonContains(polygon, cell.Lon, cell.Lat) {
+					reached[c]++
+					last[c] = s
+					stations[s] += cell.Population
+					break
+				}
+			}
+		}
+	}
+
+	// Cells reached by a single station count towards its exclusive population
+	levels := make([]float64, maxLevel+1)
+	exclusive := make([]float64, len(isochrones))
+	for c, cell := range cells {
+		result.Total += cell.Population
+		if reached[c] > 0 {
+			result.Covered += cell.Population
+			levels[min(reached[c], maxLevel)] += cell.Population
+		}
+		if reached[c] == 1 {
+			exclusive[last[c]] += cell.Population
+		}
+	}
+
+	result.CoveredShare = share(result.Covered, result.Total)
+	for level := 1; level <= maxLevel; level++ {
+		label := strconv.Itoa(level)
+		if level == maxLevel {
+			label += "+"
+		}
+		result.Levels = append(result.Levels, PopulationLevel{
+			Level:      level,
+			Label:      label,
+			Population: math.Round(levels[level]),
+			Share:      share(levels[level], result.Total),
+		})
+	}
+	for s, isochrone := range isochrones {
+		result.Stations = append(result.Stations, StationPopulation{
+			Station:    isochrone.Name,
+			Population: math.Round(stations[s]),
+			Share:      share(stations[s], result.Total),
+			Exclusive:  math.Round(exclusive[s]),
+		})
+	}
+	result.Total = math.Round(result.Total)
+	result.Covered = math.Round(result.Covered)
+
+	return result
+}
+
+// WriteCSV writes the per-station population as CSV, followed by a TOTAL row for the
+// stations together
+func (r *PopulationResult) WriteCSV(w io.Writer) error {
+	writer := csv.NewWriter(w)
+	writer.Write([]string{"station", "range", "population", "share", "exclusive"})
+	for _, station := range r.Stations {
+		writer.Write([]string{
+			station.Station,
+			strconv.Itoa(r.Range),
+			formatFloat(station.Population),
+			formatFloat(station.Share),
+			formatFloat(station.Exclusive),
+		})
+	}
+	writer.Write([]string{"TOTAL", strconv.Itoa(r.Range), formatFloat(r.Covered), formatFloat(r.CoveredShare), ""})
+	writer.Flush()
+	return writer.Error()
+}
+
+func formatFloat(value float64) string {
+	return strconv.FormatFloat(value, 'f', -1, 64)
+}
+
+func polygonBounds(polygon [][]raster.Point) [4]float64 {
+	b := [4]float64{math.Inf(1), math.Inf(1), math.Inf(-1), math.Inf(-1)}
+	for _, point := range polygon[0] {
+		b[0], b[1] = math.Min(b[0], point[0]), math.Min(b[1], point[1])
+		b[2], b[3] = math.Max(b[2], point[0]), math.Max(b[3], point[1])
+	}
+	return b
+}
+
+// share returns part / total rounded to four decimal places, or 0 for an empty total
+func share(part, total float64) float64 {
+	if total == 0 {
+		return 0
+	}
+	return roundShare(part / total)
+}
@@ -4,7 +4,10 @@ import (
 	"encoding/csv"
 	"fmt"
 	"io"
+	"math"
 	"os"
+	"path/filepath"
+	"strconv"
 	"strings"
 )
 
@@ -16,6 +19,32 @@ type Location struct {
 	Longitude float64 `json:"longitude"`
 }
 
+// Validate checks that a location can be written to and read back from a CSV file: the name
+// is required, and neither the name nor the city may hold the parentheses that separate them
+// or path separators, since station names are part of the isochrone file names. Coordinates
+// of exactly 0, 0 are rejected as they are what a location without coordinates decodes to.
+func (l Location) Validate() error {
+	if strings.TrimSpace(l.Name) == "" {
+		return fmt.Errorf("name is required")
+	}
+	if strings.ContainsAny(l.Name, "()/\\") {
+		return fmt.Errorf("name %q must not contain parentheses or slashes", l.Name)
+	}
+	if strings.ContainsAny(l.City, "()/\\") {
+		return fmt.Errorf("city %q must not contain parentheses or slashes", l.City)
+	}
+	if math.IsNaN(l.Latitude) || l.Latitude < -90 || l.Latitude > 90 {
+		return fmt.Errorf("latitude %v must be between -90 and 90", l.Latitude)
+	}
+	if math.IsNaN(l.Longitude) || l.Longitude < -180 || l.Longitude > 180 {
+		return fmt.Errorf("longitude %v must be between -180 and 180", l.Longitude)
+	}
+	if l.Latitude == 0 && l.Longitude == 0 {
+		return fmt.Errorf("latitude and longitude are required")
+	}
+	return nil
+}
+
 // ParseError represents an error that occurred during parsing
 type ParseError struct {
 	Row     int
@@ -128,19 +157,38 @@ func (p *DefaultParser) ParseFile(filePath string) ParseResult {
 	return p.Parse(file)
 }
 
-// UpdateFile updates a CSV file with new location data
+// UpdateFile updates a CSV file with new location data. The file is written to a temporary
+// file next to it and renamed into place, so readers never see a partially written file.
 func (p *DefaultParser) UpdateFile(filePath string, locations []Location) error {
-	file, err := os.Create(filePath)
+	file, err := os.CreateTemp(filepath.Dir(filePath), "."+filepath.Base(filePath)+".tmp-*")
 	if err != nil {
 		return fmt.Errorf("failed to create file: %w", err)
 	}
-	defer file.Close()
+	tmpPath := file.Name()
+	defer os.Remove(tmpPath)
 
-	writer := csv.NewWriter(file)
-	defer writer.Flush()
+	if err := writeLocations(file, locations); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return fmt.Errorf("failed to write file: %w", err)
+	}
+	if err := os.Chmod(tmpPath, 0644); err != nil {
+		return fmt.Errorf("failed to set file permissions: %w", err)
+	}
+	if err := os.Rename(tmpPath, filePath); err != nil {
+		return fmt.Errorf("failed to replace file: %w", err)
+	}
+	return nil
+}
+
+// writeLocations writes the header and one row per location
+func writeLocations(w io.Writer, locations []Location) error {
+	writer := csv.NewWriter(w)
 
 	// Write header
-	err = writer.Write([]string{"STAZIONAMENTO", "LAT", "LON"})
+	err := writer.Write([]string{"STAZIONAMENTO", "LAT", "LON"})
 	if err != nil {
 		return fmt.Errorf("failed to write header: %w", err)
 	}
@@ -154,16 +202,22 @@ func (p *DefaultParser) UpdateFile(filePath string, locations []Location) error
 			name = loc.Name
 		}
 
+		// Coordinates keep every digit they have, so rewriting the file for one edit
+		// leaves the other rows as they were
 		err = writer.Write([]string{
 			name,
-			fmt.Sprintf("%.5f", loc.Latitude),
-			fmt.Sprintf("%.5f", loc.Longitude),
+			strconv.FormatFloat(loc.Latitude, 'f', -1, 64),
+			strconv.FormatFloat(loc.Longitude, 'f', -1, 64),
 		})
 		if err != nil {
 			return fmt.Errorf("failed to write location: %w", err)
 		}
 	}
 
+	writer.Flush()
+	if err := writer.Error(); err != nil {
+		return fmt.Errorf("failed to write locations: %w", err)
+	}
 	return nil
 }
 
@@ -5,7 +5,10 @@ import (
 	"os"
 	"path/filepath"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 )
 
 func TestParseNameAndCity(t *testing.T) {
@@ -229,8 +232,8 @@ func TestUpdateFile(t *testing.T) {
 	}
 
 	expected := `STAZIONAMENTO,LAT,LON
-APMPAD (PADERNO DUGNANO),45.57520,9.15325
-ARGLIM (LIMBIATE),45.61493,9.12310
+APMPAD (PADERNO DUGNANO),45.5752,9.15325
+ARGLIM (LIMBIATE),45.61493,9.1231
 `
 
 	if string(data) != expected {
@@ -248,6 +251,20 @@ ARGLIM (LIMBIATE),45.61493,9.12310
 	if len(result.Errors) != 0 {
 		t.Errorf("ParseFile() error count = %v, want 0", len(result.Errors))
 	}
+
+	// A round-trip keeps coordinates stored with more than 5 decimals
+	precise := []Location{{Name: "APMBOL", City: "BOLLATE", Latitude: 45.5461234, Longitude: 9.1178765}}
+	if err := parser.UpdateFile(testFilePath, precise); err != nil {
+		t.Fatalf("UpdateFile() error = %v", err)
+	}
+	result = parser.ParseFile(testFilePath)
+	if len(result.Locations) != 1 {
+		t.Fatalf("ParseFile() location count = %v, want 1", len(result.Locations))
+	}
+	if got := result.Locations[0]; got.Latitude != precise[0].Latitude || got.Longitude != precise[0].Longitude {
+		t.Errorf("Round-trip changed the coordinates to %v, %v, want %v, %v",
+			got.Latitude, got.Longitude, precise[0].Latitude, precise[0].Longitude)
+	}
 }
 
 func TestRecoverFromPanic(t *testing.T) {
@@ -282,3 +299,138 @@ func TestRecoverFromPanic(t *testing.T) {
 		t.Errorf("Expected 1 error after panic, got %d", len(result.Errors))
 	}
 }
+
+func TestLocationValidate(t *testing.T) {
+	tests := []struct {
+		name     string
+		location Location
+		wantErr  bool
+	}{
+		{"Valid", Location{Name: "APMPAD", City: "PADERNO DUGNANO", Latitude: 45.5752, Longitude: 9.15325}, false},
+		{"Without city", Location{Name: "APMPAD", Latitude: 45.5752, Longitude: 9.15325}, false},
+		{"Missing name", Location{Name: "  ", Latitude: 45.5752, Longitude: 9.15325}, true},
+		{"Parenthesis in name", Location{Name: "APM (PAD)", Latitude: 45.5752, Longitude: 9.15325}, true},
+		{"Slash in city", Location{Name: "APMPAD", City: "A/B", Latitude: 45.5752, Longitude: 9.15325}, true},
+		{"Latitude out of range", Location{Name: "APMPAD", Latitude: 95, Longitude: 9.15325}, true},
+		{"Longitude out of range", Location{Name: "APMPAD", Latitude: 45.5752, Longitude: -181}, true},
+		{"Missing coordinates", Location{Name: "APMPAD", City: "PADERNO DUGNANO"}, true},
+		{"On the equator", Location{Name: "APMPAD", Latitude: 0, Longitude: 9.15325}, false},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if err := tc.location.Validate(); (err != nil) != tc.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tc.wantErr)
+			}
+		})
+	}
+}
+
+func TestLockFile(t *testing.T) {
+	filePath := filepath.Join(t.TempDir(), "input.csv")
+
+	lock, err := LockFile(filePath, time.Second)
+	if err != nil {
+		t.Fatalf("LockFile() error = %v", err)
+	}
+
+	// A second writer waits, then gives up
+	if _, err := LockFile(filePath, 100*time.Millisecond); err == nil {
+		t.Fatal("Expected the second lock to time out")
+	}
+
+	// It gets the lock once the first writer releases it
+	released := make(chan error, 1)
+	go func() {
+		second, err := LockFile(filePath, time.Second)
+		if err == nil {
+			err = second.Unlock()
+		}
+		released <- err
+	}()
+	time.Sleep(100 * time.Millisecond)
+	if err := lock.Unlock(); err != nil {
+		t.Fatalf("Unlock() error = %v", err)
+	}
+	if err := <-released; err != nil {
+		t.Errorf("Expected the waiting writer to get the lock, got %v", err)
+	}
+
+	// Lock files left behind by a crashed writer do not block
+	stale := time.Now().Add(-2 * DefaultLockStale)
+	if err := os.WriteFile(filePath+".lock", nil, 0644); err != nil {
+		t.Fatalf("Failed to write lock file: %v", err)
+	}
+	if err := os.Chtimes(filePath+".lock", stale, stale); err != nil {
+		t.Fatalf("Failed to age lock file: %v", err)
+	}
+	lock, err = LockFile(filePath, 100*time.Millisecond)
+	if err != nil {
+		t.Fatalf("Expected a stale lock to be taken over, got %v", err)
+	}
+	lock.Unlock()
+}
+
+func TestLockFile_Exclusive(t *testing.T) {
+	filePath := filepath.Join(t.TempDir(), "input.csv")
+
+	// Writers racing for the lock never overlap
+	var holders, overlaps int32
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 5; j++ {
+				lock, err := LockFile(filePath, 5*time.Second)
+				if err != nil {
+					t.Errorf("LockFile() error = %v", err)
+					return
+				}
+				if atomic.AddInt32(&holders, 1) > 1 {
+					atomic.AddInt32(&overlaps, 1)
+				}
+				time.Sleep(time.Millisecond)
+				atomic.AddInt32(&holders, -1)
+				lock.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	if overlaps > 0 {
+		t.Errorf("The lock was held by several writers at once %d times", overlaps)
+	}
+}
+
+func TestDiffLocations(t *testing.T) {
+	previous := []Location{
+		{Name: "APMPAD", City: "PADERNO DUGNANO", Latitude: 45.5752345, Longitude: 9.15325},
+		{Name: "ARGLIM", City: "LIMBIATE", Latitude: 45.61493, Longitude: 9.12310},
+		{Name: "APMBOL", City: "BOLLATE", Latitude: 45.54610, Longitude: 9.11780},
+	}
+	// APMPAD was only rounded to 5 decimals
+	current := []Location{
+		{Name: "APMPAD", City: "PADERNO DUGNANO", Latitude: 45.57523, Longitude: 9.15325},
+		{Name: "ARGLIM", City: "LIMBIATE", Latitude: 45.61500, Longitude: 9.12310},
+		{Name: "APMNOV", City: "NOVATE MILANESE", Latitude: 45.53010, Longitude: 9.13400},
+	}
+
+	diff := DiffLocations(previous, current)
+	if len(diff.Added) != 1 || diff.Added[0].Name != "APMNOV" {
+		t.Errorf("Added = %v, want APMNOV", diff.Added)
+	}
+	if len(diff.Modified) != 1 || diff.Modified[0].Name != "ARGLIM" || diff.Modified[0].Latitude != 45.615 {
+		t.Errorf("Modified = %v, want the new ARGLIM", diff.Modified)
+	}
+	if len(diff.Removed) != 1 || diff.Removed[0].Name != "APMBOL" {
+		t.Errorf("Removed = %v, want APMBOL", diff.Removed)
+	}
+	if changed := diff.Changed(); len(changed) != 2 || changed[0].Name != "APMNOV" || changed[1].Name != "ARGLIM" {
+		t.Errorf("Changed = %v, want APMNOV and ARGLIM", changed)
+	}
+
+	if !DiffLocations(previous, previous).Empty() {
+		t.Error("Expected no difference between identical lists")
+	}
+}
@@ -0,0 +1,58 @@
+package csvparser
+
+import "math"
+
+// coordinateTolerance is the smallest coordinate change in degrees reported as a move, about
+// a meter. Rounding to 5 decimals, as spreadsheets often do when saving the file, moves a
+// value by up to 5e-6 and is not reported.
+const coordinateTolerance = 1e-5
+
+// Diff lists the locations added, modified or removed between two versions of a CSV file.
+// Locations are matched by name; a location is modified when its city or coordinates changed.
+type Diff struct {
+	Added    []Location
+	Modified []Location
+	Removed  []Location
+}
+
+// Empty reports whether the two versions hold the same locations
+func (d Diff) Empty() bool {
+	return len(d.Added) == 0 && len(d.Modified) == 0 && len(d.Removed) == 0
+}
+
+// Changed returns the added and modified locations, in their new version
+func (d Diff) Changed() []Location {
+	changed := make([]Location, 0, len(d.Added)+len(d.Modified))
+	changed = append(changed, d.Added...)
+	return append(changed, d.Modified...)
+}
+
+// DiffLocations compares the previous and current locations. The lists keep the order of
+// the file the locations come from.
+func DiffLocations(previous, current []Location) Diff {
+	before := make(map[string]Location, len(previous))
+	for _, location := range previous {
+		before[location.Name] = location
+	}
+	after := make(map[string]bool, len(current))
+
+	var diff Diff
+	for _, location := range current {
+		after[location.Name] = true
+		old, exists := before[location.Name]
+		switch {
+		case !exists:
+			diff.Added = append(diff.Added, location)
+		case old.City != location.City ||
+			math.Abs(old.Latitude-location.Latitude) > coordinateTolerance ||
+			math.Abs(old.Longitude-location.Longitude) > coordinateTolerance:
+			diff.Modified = append(diff.Modified, location)
+		}
+	}
+	for _, location := range previous {
+		if !after[location.Name] {
+			diff.Removed = append(diff.Removed, location)
+		}
+	}
+	return diff
+}
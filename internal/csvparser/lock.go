@@ -0,0 +1,40 @@
+package csvparser
+
+import (
+	"fmt"
+	"time"
+)
+
+// File locking defaults
+const (
+	// DefaultLockTimeout Default time LockFile waits for another writer to release the file
+	DefaultLockTimeout = 10 * time.Second
+	// DefaultLockStale Default age after which a lock is considered abandoned by a crashed
+	// writer, on platforms without flock where the lock is a file that outlives its process
+	DefaultLockStale = time.Minute
+)
+
+// lockRetryInterval is the delay between attempts to take a held lock
+const lockRetryInterval = 50 * time.Millisecond
+
+// LockFile takes the exclusive lock of a file, held on a FILE.lock file next to it so that it
+// is shared by every process editing the file, waiting up to timeout for the current holder
+// to release it
+func LockFile(filePath string, timeout time.Duration) (*FileLock, error) {
+	lockPath := filePath + ".lock"
+	deadline := time.Now().Add(timeout)
+
+	for {
+		lock, held, err := tryLock(lockPath)
+		if err != nil {
+			return nil, err
+		}
+		if !held {
+			return lock, nil
+		}
+		if time.Now().After(deadline) {
+			return nil, fmt.Errorf("%s is locked by another writer", filePath)
+		}
+		time.Sleep(lockRetryInterval)
+	}
+}
@@ -0,0 +1,73 @@
+//go:build !unix
+
+package csvparser
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+)
+
+// FileLock is a lock file created exclusively and holding a random token that identifies its
+// owner, so that a writer never removes a lock it does not hold
+type FileLock struct {
+	path  string
+	token []byte
+}
+
+// tryLock takes the lock without waiting; held reports that another writer has it. A lock
+// older than DefaultLockStale is removed, provided it still holds the token read before.
+func tryLock(lockPath string) (lock *FileLock, held bool, err error) {
+	token := make([]byte, 16)
+	if _, err := rand.Read(token); err != nil {
+		return nil, false, fmt.Errorf("failed to create lock token: %w", err)
+	}
+	token = []byte(hex.EncodeToString(token))
+
+	file, err := os.OpenFile(lockPath, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
+	if err == nil {
+		_, err = file.Write(token)
+		if closeErr := file.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			os.Remove(lockPath)
+			return nil, false, fmt.Errorf("failed to write lock file: %w", err)
+		}
+		return &FileLock{path: lockPath, token: token}, false, nil
+	}
+	if !errors.Is(err, os.ErrExist) {
+		return nil, false, fmt.Errorf("failed to create lock file: %w", err)
+	}
+
+	if info, err := os.Stat(lockPath); err == nil && time.Since(info.ModTime()) > DefaultLockStale {
+		if owner, err := os.ReadFile(lockPath); err == nil {
+			removeOwned(lockPath, owner)
+		}
+	}
+	return nil, true, nil
+}
+
+// Unlock releases the lock, leaving alone a lock file another writer has since taken over
+func (l *FileLock) Unlock() error {
+	if err := removeOwned(l.path, l.token); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("failed to remove lock file: %w", err)
+	}
+	return nil
+}
+
+// removeOwned removes the lock file if it holds the token
+func removeOwned(lockPath string, token []byte) error {
+	current, err := os.ReadFile(lockPath)
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(current, token) {
+		return nil
+	}
+	return os.Remove(lockPath)
+}
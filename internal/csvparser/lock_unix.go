@@ -0,0 +1,43 @@
+//go:build unix
+
+package csvparser
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"syscall"
+)
+
+// FileLock is an exclusive flock on the lock file. The kernel releases it when the holder
+// exits, so a crashed writer never leaves the file locked.
+type FileLock struct {
+	file *os.File
+}
+
+// tryLock takes the lock without waiting; held reports that another writer has it
+func tryLock(lockPath string) (lock *FileLock, held bool, err error) {
+	file, err := os.OpenFile(lockPath, os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to open lock file: %w", err)
+	}
+
+	if err := syscall.Flock(int(file.Fd()), syscall.LOCK_EX|syscall.LOCK_NB); err != nil {
+		file.Close()
+		if errors.Is(err, syscall.EWOULDBLOCK) || errors.Is(err, syscall.EINTR) {
+			return nil, true, nil
+		}
+		return nil, false, fmt.Errorf("failed to lock file: %w", err)
+	}
+	return &FileLock{file: file}, false, nil
+}
+
+// Unlock releases the lock. The lock file is kept: removing it would let a writer waiting on
+// the old file and one creating a new file both hold a lock.
+func (l *FileLock) Unlock() error {
+	if err := syscall.Flock(int(l.file.Fd()), syscall.LOCK_UN); err != nil {
+		l.file.Close()
+		return fmt.Errorf("failed to unlock file: %w", err)
+	}
+	return l.file.Close()
+}
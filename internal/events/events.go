@@ -0,0 +1,181 @@
+// Package events broadcasts notifications about changes to the dataset, such as stations
+// edited in the CSV file or isochrones regenerated, to the clients streaming them.
+package events
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Type identifies what an event is about
+type Type string
+
+// Event types
+const (
+	TypeStationAdded    Type = "station.added"
+	TypeStationModified Type = "station.modified"
+	TypeStationRemoved  Type = "station.removed"
+	// TypeIsochroneRegenerated is published when an isochrone file was written again
+	TypeIsochroneRegenerated Type = "isochrone.regenerated"
+	TypeJobFinished          Type = "job.finished"
+)
+
+// Defaults of a broker
+const (
+	// DefaultHistory Default number of recent events kept to replay to reconnecting clients
+	DefaultHistory = 100
+	// SubscriberBuffer Number of events a subscriber may fall behind before it is dropped
+	SubscriberBuffer = 64
+)
+
+// Types lists every event type
+func Types() []Type {
+	return []Type{TypeStationAdded, TypeStationModified, TypeStationRemoved, TypeIsochroneRegenerated, TypeJobFinished}
+}
+
+// ParseTypes converts a comma-separated list of event types into a filter. A prefix such as
+// "station" selects every type in that group. An empty list selects every type.
+func ParseTypes(s string) ([]Type, error) {
+	var selected []Type
+	for _, part := range strings.Split(s, ",") {
+		part = strings.ToLower(strings.TrimSpace(part))
+		if part == "" {
+			continue
+		}
+		found := false
+		for _, t := range Types() {
+			if string(t) == part || strings.HasPrefix(string(t), part+".") {
+				selected = append(selected, t)
+				found = true
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("unknown event type %q", part)
+		}
+	}
+	return selected, nil
+}
+
+// Event is a notification sent to subscribers
+type Event struct {
+	// ID increases with every event published by a broker
+	ID   int64       `json:"id"`
+	Type Type        `json:"type"`
+	Time time.Time   `json:"time"`
+	Data interface{} `json:"data"`
+}
+
+// Broker delivers published events to every subscriber and keeps the most recent ones
+type Broker struct {
+	mu          sync.Mutex
+	lastID      int64
+	history     []Event
+	size        int
+	subscribers map[*Subscription]bool
+	now         func() time.Time
+}
+
+// NewBroker creates a broker keeping the given number of recent events
+func NewBroker(history int) *Broker {
+	if history < 0 {
+		history = 0
+	}
+	return &Broker{size: history, subscribers: make(map[*Subscription]bool), now: time.Now}
+}
+
+// Subscription receives the events of a broker until it is closed
+type Subscription struct {
+	// C receives the events; it is closed when the subscription is closed or when the
+	// subscriber fell more than SubscriberBuffer events behind
+	C      <-chan Event
+	c      chan Event
+	types  map[Type]bool
+	broker *Broker
+}
+
+// Publish sends an event to every subscriber interested in its type and returns it.
+// Subscribers whose buffer is full are dropped rather than slowing down the publisher.
+func (b *Broker) Publish(t Type, data interface{}) Event {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.lastID++
+	event := Event{ID: b.lastID, Type: t, Time: b.now(), Data: data}
+
+	if b.size > 0 {
+		b.history = append(b.history, event)
+		if len(b.history) > b.size {
+			b.history = append([]Event(nil), b.history[len(b.history)-b.size:]...)
+		}
+	}
+
+	for s := range b.subscribers {
+		if !s.wants(t) {
+			continue
+		}
+		select {
+		case s.c <- event:
+		default:
+			b.remove(s)
+		}
+	}
+	return event
+}
+
+// Subscribe registers a subscriber for the given types, or every type when none are given.
+// When lastID is positive, the events published after it that are still in the history are
+// returned, so that a client reconnecting with the id of the last event it received misses
+// nothing.
+func (b *Broker) Subscribe(lastID int64, types ...Type) (*Subscription, []Event) {
+	c := make(chan Event, SubscriberBuffer)
+	s := &Subscription{C: c, c: c, broker: b}
+	if len(types) > 0 {
+		s.types = make(map[Type]bool, len(types))
+		for _, t := range types {
+			s.types[t] = true
+		}
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	var missed []Event
+	if lastID > 0 {
+		for _, event := range b.history {
+			if event.ID > lastID && s.wants(event.Type) {
+				missed = append(missed, event)
+			}
+		}
+	}
+	b.subscribers[s] = true
+	return s, missed
+}
+
+// Subscribers returns the number of active subscriptions
+func (b *Broker) Subscribers() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return len(b.subscribers)
+}
+
+// Close unregisters the subscription and closes its channel; it may be called more than once
+func (s *Subscription) Close() {
+	s.broker.mu.Lock()
+	defer s.broker.mu.Unlock()
+	s.broker.remove(s)
+}
+
+// remove unregisters a subscription; the broker mutex must be held
+func (b *Broker) remove(s *Subscription) {
+	if b.subscribers[s] {
+		delete(b.subscribers, s)
+		close(s.c)
+	}
+}
+
+// wants reports whether the subscription receives events of a type
+func (s *Subscription) wants(t Type) bool {
+	return s.types == nil || s.types[t]
+}
@@ -0,0 +1,92 @@
+package events
+
+import "testing"
+
+func TestParseTypes(t *testing.T) {
+	types, err := ParseTypes("station, job.finished")
+	if err != nil {
+		t.Fatalf("ParseTypes failed: %v", err)
+	}
+	want := []Type{TypeStationAdded, TypeStationModified, TypeStationRemoved, TypeJobFinished}
+	if len(types) != len(want) {
+		t.Fatalf("ParseTypes = %v, want %v", types, want)
+	}
+	for i := range want {
+		if types[i] != want[i] {
+			t.Errorf("ParseTypes = %v, want %v", types, want)
+			break
+		}
+	}
+
+	if types, err := ParseTypes(""); err != nil || len(types) != 0 {
+		t.Errorf("Expected no filter for an empty list, got %v, %v", types, err)
+	}
+	if _, err := ParseTypes("stations"); err == nil {
+		t.Error("Expected an error for an unknown type")
+	}
+}
+
+func TestBroker(t *testing.T) {
+	broker := NewBroker(3)
+
+	all, _ := broker.Subscribe(0)
+	jobsOnly, _ := broker.Subscribe(0, TypeJobFinished)
+
+	broker.Publish(TypeStationAdded, "STA")
+	broker.Publish(TypeJobFinished, "job")
+
+	if event := <-all.C; event.ID != 1 || event.Type != TypeStationAdded || event.Data != "STA" {
+		t.Errorf("Unexpected first event %+v", event)
+	}
+	if event := <-all.C; event.ID != 2 {
+		t.Errorf("Unexpected second event %+v", event)
+	}
+	if event := <-jobsOnly.C; event.Type != TypeJobFinished {
+		t.Errorf("Expected only job events, got %+v", event)
+	}
+
+	// Reconnecting clients get the events after the last one they saw, within the history
+	broker.Publish(TypeStationRemoved, "STB")
+	broker.Publish(TypeIsochroneRegenerated, "STC")
+	_, missed := broker.Subscribe(1)
+	if len(missed) != 3 || missed[0].ID != 2 || missed[2].ID != 4 {
+		t.Errorf("Expected events 2 to 4 to be replayed, got %+v", missed)
+	}
+	if _, missed := broker.Subscribe(3, TypeStationRemoved, TypeJobFinished); len(missed) != 0 {
+		t.Errorf("Expected the filter to apply to the replay, got %+v", missed)
+	}
+
+	// Closing keeps the buffered events readable, then closes the channel
+	all.Close()
+	all.Close()
+	buffered := 0
+	for range all.C {
+		buffered++
+	}
+	if buffered != 2 {
+		t.Errorf("Expected the 2 events still buffered, got %d", buffered)
+	}
+	if n := broker.Subscribers(); n != 3 {
+		t.Errorf("Subscribers = %d, want 3", n)
+	}
+}
+
+func TestBroker_SlowSubscriber(t *testing.T) {
+	broker := NewBroker(0)
+	slow, _ := broker.Subscribe(0)
+
+	for i := 0; i <= SubscriberBuffer; i++ {
+		broker.Publish(TypeIsochroneRegenerated, i)
+	}
+
+	received := 0
+	for range slow.C {
+		received++
+	}
+	if received != SubscriberBuffer {
+		t.Errorf("Expected the buffered events before the subscriber was dropped, got %d", received)
+	}
+	if broker.Subscribers() != 0 {
+		t.Error("Expected the slow subscriber to be dropped")
+	}
+}
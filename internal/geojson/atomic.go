@@ -0,0 +1,174 @@
+package geojson
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// writeFileAtomic writes data to a temporary file in the same directory and renames it
+// over path, so concurrent readers observe either the old or the new content, never a
+// partially written file. The temporary file is hidden from ListFiles.
+func writeFileAtomic(path string, data []byte, perm os.FileMode) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	tmpPath := tmp.Name()
+
+	// Remove the temporary file unless it was renamed into place
+	committed := false
+	defer func() {
+		if !committed {
+			os.Remove(tmpPath)
+		}
+	}()
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmpPath, perm); err != nil {
+		return err
+	}
+	if err := os.Rename(tmpPath, path); err != nil {
+		return err
+	}
+
+	committed = true
+	return nil
+}
+
+// Staging builds a complete new version of an output directory next to it and swaps it in
+// at once, so the API never serves a mix of old and new isochrones. The staging directory
+// starts as a copy of the current output, so isochrones that are up to date or fail to
+// refresh keep their previous version.
+type Staging struct {
+	target string
+	dir    string
+}
+
+// NewStaging creates a staging directory for the target output directory
+func NewStaging(target string) (*Staging, error) {
+	target = filepath.Clean(target)
+	parent := filepath.Dir(target)
+	if err := os.MkdirAll(parent, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create parent directory: %w", err)
+	}
+
+	dir, err := os.MkdirTemp(parent, "."+filepath.Base(target)+".staging-*")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create staging directory: %w", err)
+	}
+	if err := os.Chmod(dir, 0755); err != nil {
+		os.RemoveAll(dir)
+		return nil, fmt.Errorf("failed to set staging directory permissions: %w", err)
+	}
+
+	staging := &Staging{target: target, dir: dir}
+	if err := staging.seed(); err != nil {
+		os.RemoveAll(dir)
+		return nil, err
+	}
+	return staging, nil
+}
+
+// Dir returns the staging directory, to be used as the Manager output directory
+func (s *Staging) Dir() string {
+	return s.dir
+}
+
+// seed copies the files of the current output directory into the staging directory.
+// Files are hard linked when possible: they are only ever replaced by rename, never
+// modified in place, so sharing them with the live directory is safe.
+func (s *Staging) seed() error {
+	entries, err := os.ReadDir(s.target)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read output directory: %w", err)
+	}
+
+	for _, entry := range entries {
+		if !entry.Type().IsRegular() {
+			continue
+		}
+		src := filepath.Join(s.target, entry.Name())
+		dst := filepath.Join(s.dir, entry.Name())
+		if err := os.Link(src, dst); err == nil {
+			continue
+		}
+		if err := copyFile(src, dst); err != nil {
+			return fmt.Errorf("failed to copy %s to staging directory: %w", entry.Name(), err)
+		}
+	}
+
+	return nil
+}
+
+// Commit replaces the target directory with the staging directory. The previous
+// version is moved aside and removed once the new one is in place; readers may
+// briefly find no directory between the two renames, but never a mixed one.
+func (s *Staging) Commit() error {
+	old := fmt.Sprintf("%s.old-%d", s.target, time.Now().UnixNano())
+
+	hadTarget := true
+	if err := os.Rename(s.target, old); err != nil {
+		if !os.IsNotExist(err) {
+			return fmt.Errorf("failed to move previous output aside: %w", err)
+		}
+		hadTarget = false
+	}
+
+	if err := os.Rename(s.dir, s.target); err != nil {
+		if hadTarget {
+			os.Rename(old, s.target)
+		}
+		return fmt.Errorf("failed to move staging directory into place: %w", err)
+	}
+
+	if hadTarget {
+		if err := os.RemoveAll(old); err != nil {
+			return fmt.Errorf("failed to remove previous output %s: %w", old, err)
+		}
+	}
+	return nil
+}
+
+// Abort discards the staging directory, leaving the target untouched
+func (s *Staging) Abort() error {
+	return os.RemoveAll(s.dir)
+}
+
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	info, err := in.Stat()
+	if err != nil {
+		return err
+	}
+
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, info.Mode().Perm())
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
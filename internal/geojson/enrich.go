@@ -0,0 +1,83 @@
+package geojson
+
+import (
+	"time"
+
+	"logreason/internal/csvparser"
+)
+
+// Property names injected into every saved feature
+const (
+	PropertyFeatureType = "feature_type"
+	PropertyStation     = "station"
+	PropertyCity        = "city"
+	PropertyLatitude    = "latitude"
+	PropertyLongitude   = "longitude"
+	PropertyRange       = "range"
+	PropertyProvider    = "provider"
+	PropertyMode        = "mode"
+	PropertyType        = "type"
+	PropertyFetchedAt   = "fetched_at"
+)
+
+// Values of the feature_type property
+const (
+	FeatureTypeIsochrone = "isochrone"
+	FeatureTypeStation   = "station"
+)
+
+// enrich tags every isochrone feature with the station and fetch parameters and
+// appends a point feature for the station itself
+func enrich(fc *FeatureCollection, location csvparser.Location, metadata Metadata) {
+	for _, feature := range fc.Features {
+		if feature.Properties == nil {
+			feature.Properties = make(map[string]interface{})
+		}
+		setStationProperties(feature.Properties, location, metadata)
+		feature.Properties[PropertyFeatureType] = FeatureTypeIsochrone
+	}
+
+	station := &Feature{
+		Type: TypeFeature,
+		Geometry: &Geometry{
+			Type:  TypePoint,
+			Point: Position{location.Longitude, location.Latitude},
+		},
+		Properties: make(map[string]interface{}),
+	}
+	setStationProperties(station.Properties, location, metadata)
+	station.Properties[PropertyFeatureType] = FeatureTypeStation
+
+	fc.Features = append(fc.Features, station)
+}
+
+func setStationProperties(properties map[string]interface{}, location csvparser.Location, metadata Metadata) {
+	properties[PropertyStation] = location.Name
+	properties[PropertyCity] = location.City
+	properties[PropertyLatitude] = location.Latitude
+	properties[PropertyLongitude] = location.Longitude
+	properties[PropertyRange] = metadata.Range
+	properties[PropertyProvider] = metadata.Provider
+	properties[PropertyMode] = metadata.Mode
+	properties[PropertyType] = metadata.Type
+	properties[PropertyFetchedAt] = metadata.FetchedAt.Format(time.RFC3339)
+}
+
+// StationLocation returns the station an isochrone file was generated for, read from the
+// properties injected by enrich. Files saved before stations were recorded report false.
+func (fc *FeatureCollection) StationLocation() (csvparser.Location, bool) {
+	for _, feature := range fc.Features {
+		if feature.Properties[PropertyFeatureType] != FeatureTypeStation {
+			continue
+		}
+		name, _ := feature.Properties[PropertyStation].(string)
+		city, _ := feature.Properties[PropertyCity].(string)
+		latitude, latOK := feature.Properties[PropertyLatitude].(float64)
+		longitude, lonOK := feature.Properties[PropertyLongitude].(float64)
+		if name == "" || !latOK || !lonOK {
+			return csvparser.Location{}, false
+		}
+		return csvparser.Location{Name: name, City: city, Latitude: latitude, Longitude: longitude}, true
+	}
+	return csvparser.Location{}, false
+}
@@ -0,0 +1,216 @@
+package geojson
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ExportFormat is a file format the isochrones can be exported to for GIS tools other than GeoJSON ones
+type ExportFormat string
+
+// Export formats
+const (
+	// FormatKML is a KML document for Google Earth
+	FormatKML ExportFormat = "kml"
+	// FormatKMZ is a KML document compressed in a zip archive
+	FormatKMZ ExportFormat = "kmz"
+	// FormatGPX is a GPX file holding the isochrone outlines as tracks and the stations as waypoints
+	FormatGPX ExportFormat = "gpx"
+	// FormatShapefile is a zip archive with an isochrones and a stations shapefile
+	FormatShapefile ExportFormat = "shp"
+	// FormatGeoPackage is an OGC GeoPackage with an isochrones and a stations feature table
+	FormatGeoPackage ExportFormat = "gpkg"
+)
+
+// Names of the layers the exported features are split into
+const (
+	ExportLayerIsochrones = "isochrones"
+	ExportLayerStations   = "stations"
+)
+
+// ExportFormats lists the formats accepted by Export
+func ExportFormats() []ExportFormat {
+	return []ExportFormat{FormatKML, FormatKMZ, FormatGPX, FormatShapefile, FormatGeoPackage}
+}
+
+// ParseExportFormat converts a format name or file extension into an ExportFormat
+func ParseExportFormat(s string) (ExportFormat, error) {
+	switch strings.ToLower(strings.TrimPrefix(s, ".")) {
+	case "kml":
+		return FormatKML, nil
+	case "kmz":
+		return FormatKMZ, nil
+	case "gpx":
+		return FormatGPX, nil
+	case "shp", "shapefile", "zip":
+		return FormatShapefile, nil
+	case "gpkg", "geopackage":
+		return FormatGeoPackage, nil
+	}
+	return "", fmt.Errorf("unknown export format %q", s)
+}
+
+// ContentType returns the media type of the format
+func (f ExportFormat) ContentType() string {
+	switch f {
+	case FormatKML:
+		return "application/vnd.google-earth.kml+xml"
+	case FormatKMZ:
+		return "application/vnd.google-earth.kmz"
+	case FormatGPX:
+		return "application/gpx+xml"
+	case FormatShapefile:
+		return "application/x-shapefile+zip"
+	case FormatGeoPackage:
+		return "application/geopackage+sqlite3"
+	}
+	return "application/octet-stream"
+}
+
+// Extension returns the file extension of the format, without the dot
+func (f ExportFormat) Extension() string {
+	if f == FormatShapefile {
+		return "zip"
+	}
+	return string(f)
+}
+
+// Export writes the features of a collection, typically built by Merge, in the given format.
+// Polygon features are exported as isochrones and point features as stations; other
+// geometries cannot be represented in every format and are skipped.
+func Export(w io.Writer, format ExportFormat, fc *FeatureCollection) error {
+	layers := exportLayers(fc)
+
+	switch format {
+	case FormatKML:
+		return writeKML(w, layers)
+	case FormatKMZ:
+		return writeKMZ(w, layers)
+	case FormatGPX:
+		return writeGPX(w, layers)
+	case FormatShapefile:
+		return writeShapefile(w, layers)
+	case FormatGeoPackage:
+		return writeGeoPackage(w, layers)
+	}
+	return fmt.Errorf("unknown export format %q", format)
+}
+
+// exportLayer groups the features sharing a geometry kind with the attributes they carry
+type exportLayer struct {
+	name       string
+	polygons   bool
+	features   []*Feature
+	attributes []exportAttribute
+}
+
+// exportAttribute is a column of the attribute table of a layer
+type exportAttribute struct {
+	name string
+	// numeric is set when every value of the property is a number
+	numeric bool
+}
+
+// exportLayers splits the features into an isochrones and a stations layer, keeping one
+// point per station and position
+func exportLayers(fc *FeatureCollection) []*exportLayer {
+	isochrones := &exportLayer{name: ExportLayerIsochrones, polygons: true}
+	stations := &exportLayer{name: ExportLayerStations}
+
+	seen := make(map[string]bool)
+	for _, feature := range fc.Features {
+		if feature == nil || feature.Geometry == nil {
+			continue
+		}
+		switch {
+		case len(feature.Geometry.Polygons()) > 0:
+			isochrones.features = append(isochrones.features, feature)
+		case feature.Geometry.Type == TypePoint:
+			// Every range file carries the same station point; export it once
+			point := feature.Geometry.Point
+			key := fmt.Sprintf("%v|%v|%v", feature.Properties[PropertyStation], point.Lon(), point.Lat())
+			if seen[key] {
+				continue
+			}
+			seen[key] = true
+			stations.features = append(stations.features, feature)
+		}
+	}
+
+	layers := []*exportLayer{isochrones, stations}
+	for _, layer := range layers {
+		layer.attributes = exportAttributes(layer.features)
+	}
+	return layers
+}
+
+// exportAttributes returns the properties of the features sorted by name, with the
+// properties describing the station first
+func exportAttributes(features []*Feature) []exportAttribute {
+	numeric := make(map[string]bool)
+	for _, feature := range features {
+		for name, value := range feature.Properties {
+			_, isNumber := value.(float64)
+			isNumber = isNumber || value == nil
+			if previous, seen := numeric[name]; seen {
+				isNumber = isNumber && previous
+			}
+			numeric[name] = isNumber
+		}
+	}
+
+	rank := map[string]int{PropertySource: 1, PropertyStation: 2, PropertyCity: 3, PropertyRange: 4}
+	attributes := make([]exportAttribute, 0, len(numeric))
+	for name, isNumber := range numeric {
+		attributes = append(attributes, exportAttribute{name: name, numeric: isNumber})
+	}
+	sort.Slice(attributes, func(i, j int) bool {
+		ri, rj := rank[attributes[i].name], rank[attributes[j].name]
+		if ri == 0 {
+			ri = len(rank) + 1
+		}
+		if rj == 0 {
+			rj = len(rank) + 1
+		}
+		if ri != rj {
+			return ri < rj
+		}
+		return attributes[i].name < attributes[j].name
+	})
+	return attributes
+}
+
+// exportText formats a property value as text; objects and arrays are encoded as JSON
+func exportText(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case bool:
+		return strconv.FormatBool(v)
+	}
+	data, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Sprint(value)
+	}
+	return string(data)
+}
+
+// featureName returns a label for a feature, from its station, range or source
+func featureName(feature *Feature) string {
+	station := exportText(feature.Properties[PropertyStation])
+	if station == "" {
+		return exportText(feature.Properties[PropertySource])
+	}
+	if rangeValue, ok := feature.Properties[PropertyRange].(float64); ok && len(feature.Geometry.Polygons()) > 0 {
+		return fmt.Sprintf("%s %g", station, rangeValue)
+	}
+	return station
+}
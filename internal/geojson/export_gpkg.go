@@ -0,0 +1,200 @@
+package geojson
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"strings"
+	"time"
+)
+
+// GeoPackage identification written to the SQLite header: the "GPKG" application id and
+// version 1.2 of the specification
+const (
+	gpkgApplicationID = 0x47504B47
+	gpkgUserVersion   = 10200
+)
+
+// wgs84SRSID is the spatial reference system of every exported geometry
+const wgs84SRSID = 4326
+
+const wgs84Definition = `GEOGCS["WGS 84",DATUM["WGS_1984",SPHEROID["WGS 84",6378137,298.257223563,AUTHORITY["EPSG","7030"]],AUTHORITY["EPSG","6326"]],PRIMEM["Greenwich",0,AUTHORITY["EPSG","8901"]],UNIT["degree",0.0174532925199433,AUTHORITY["EPSG","9122"]],AUTHORITY["EPSG","4326"]]`
+
+// Definitions of the GeoPackage metadata tables, as given by the specification
+const (
+	gpkgSpatialRefSysSQL = `CREATE TABLE gpkg_spatial_ref_sys (srs_name TEXT NOT NULL, srs_id INTEGER NOT NULL PRIMARY KEY, organization TEXT NOT NULL, organization_coordsys_id INTEGER NOT NULL, definition TEXT NOT NULL, description TEXT)`
+	gpkgContentsSQL      = `CREATE TABLE gpkg_contents (table_name TEXT NOT NULL PRIMARY KEY, data_type TEXT NOT NULL, identifier TEXT UNIQUE, description TEXT DEFAULT '', last_change DATETIME NOT NULL DEFAULT (strftime('%Y-%m-%dT%H:%M:%fZ','now')), min_x DOUBLE, min_y DOUBLE, max_x DOUBLE, max_y DOUBLE, srs_id INTEGER, CONSTRAINT fk_gc_r_srs_id FOREIGN KEY (srs_id) REFERENCES gpkg_spatial_ref_sys(srs_id))`
+	gpkgGeometryColsSQL  = `CREATE TABLE gpkg_geometry_columns (table_name TEXT NOT NULL, column_name TEXT NOT NULL, geometry_type_name TEXT NOT NULL, srs_id INTEGER NOT NULL, z TINYINT NOT NULL, m TINYINT NOT NULL, CONSTRAINT pk_geom_cols PRIMARY KEY (table_name, column_name), CONSTRAINT uk_gc_table_name UNIQUE (table_name), CONSTRAINT fk_gc_tn FOREIGN KEY (table_name) REFERENCES gpkg_contents(table_name), CONSTRAINT fk_gc_srs FOREIGN KEY (srs_id) REFERENCES gpkg_spatial_ref_sys (srs_id))`
+	sqliteSequenceSQL    = `CREATE TABLE sqlite_sequence(name,seq)`
+)
+
+// writeGeoPackage writes the layers as feature tables of a GeoPackage: isochrones as
+// MULTIPOLYGON and stations as POINT geometries in WGS 84, with a column per property.
+// Empty layers are left out.
+func writeGeoPackage(w io.Writer, layers []*exportLayer) error {
+	spatialRefSys := sqliteTable{
+		name: "gpkg_spatial_ref_sys",
+		sql:  gpkgSpatialRefSysSQL,
+		rows: [][]interface{}{
+			{"Undefined cartesian SRS", nil, "NONE", int64(-1), "undefined", "undefined cartesian coordinate reference system"},
+			{"Undefined geographic SRS", nil, "NONE", int64(0), "undefined", "undefined geographic coordinate reference system"},
+			{"WGS 84 geodetic", nil, "EPSG", int64(wgs84SRSID), wgs84Definition, "longitude/latitude coordinates in decimal degrees on the WGS 84 spheroid"},
+		},
+		rowids: []int64{-1, 0, wgs84SRSID},
+	}
+	contents := sqliteTable{name: "gpkg_contents", sql: gpkgContentsSQL, indexes: [][]int{{0}, {2}}}
+	geometryColumns := sqliteTable{name: "gpkg_geometry_columns", sql: gpkgGeometryColsSQL, indexes: [][]int{{0, 1}, {0}}}
+	sequence := sqliteTable{name: "sqlite_sequence", sql: sqliteSequenceSQL}
+
+	lastChange := time.Now().UTC().Format("2006-01-02T15:04:05.000Z")
+	var features []sqliteTable
+	for _, layer := range layers {
+		if len(layer.features) == 0 {
+			continue
+		}
+
+		table, bounds := gpkgFeatureTable(layer)
+		features = append(features, table)
+
+		geometryType := "POINT"
+		if layer.polygons {
+			geometryType = "MULTIPOLYGON"
+		}
+		contents.rows = append(contents.rows, []interface{}{layer.name, "features", layer.name, "", lastChange, bounds[0], bounds[1], bounds[2], bounds[3], int64(wgs84SRSID)})
+		geometryColumns.rows = append(geometryColumns.rows, []interface{}{layer.name, "geom", geometryType, int64(wgs84SRSID), int64(0), int64(0)})
+		sequence.rows = append(sequence.rows, []interface{}{layer.name, int64(len(layer.features))})
+	}
+
+	tables := []sqliteTable{spatialRefSys, contents, geometryColumns}
+	for i, table := range features {
+		tables = append(tables, table)
+		// SQLite creates sqlite_sequence with the first AUTOINCREMENT table
+		if i == 0 {
+			tables = append(tables, sequence)
+		}
+	}
+
+	data, err := writeSQLite(tables, gpkgApplicationID, gpkgUserVersion)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(data)
+	return err
+}
+
+// gpkgFeatureTable returns the feature table of a layer and the bounds of its geometries
+func gpkgFeatureTable(layer *exportLayer) (sqliteTable, [4]float64) {
+	columns := []string{"fid INTEGER PRIMARY KEY AUTOINCREMENT NOT NULL"}
+	if layer.polygons {
+		columns = append(columns, "geom MULTIPOLYGON")
+	} else {
+		columns = append(columns, "geom POINT")
+	}
+	for _, attribute := range layer.attributes {
+		columnType := "TEXT"
+		if attribute.numeric {
+			columnType = "REAL"
+		}
+		columns = append(columns, fmt.Sprintf("%s %s", sqliteIdentifier(attribute.name), columnType))
+	}
+
+	table := sqliteTable{
+		name: layer.name,
+		sql:  fmt.Sprintf("CREATE TABLE %s (%s)", sqliteIdentifier(layer.name), strings.Join(columns, ", ")),
+	}
+
+	bounds := [4]float64{math.Inf(1), math.Inf(1), math.Inf(-1), math.Inf(-1)}
+	for _, feature := range layer.features {
+		var geometry []byte
+		if layer.polygons {
+			geometry = gpkgMultiPolygon(feature.Geometry.Polygons(), &bounds)
+		} else {
+			geometry = gpkgPoint(feature.Geometry.Point, &bounds)
+		}
+
+		// The fid is stored as the rowid
+		row := []interface{}{nil, geometry}
+		for _, attribute := range layer.attributes {
+			value := feature.Properties[attribute.name]
+			switch {
+			case value == nil:
+				row = append(row, nil)
+			case attribute.numeric:
+				row = append(row, value.(float64))
+			default:
+				row = append(row, exportText(value))
+			}
+		}
+		table.rows = append(table.rows, row)
+	}
+
+	return table, bounds
+}
+
+// sqliteIdentifier quotes a table or column name
+func sqliteIdentifier(name string) string {
+	return `"` + strings.ReplaceAll(name, `"`, `""`) + `"`
+}
+
+// gpkgPoint encodes a point as a GeoPackage geometry blob without envelope
+func gpkgPoint(position Position, bounds *[4]float64) []byte {
+	extendBounds(bounds, position)
+
+	blob := gpkgHeader(nil)
+	blob = append(blob, 1)
+	blob = binary.LittleEndian.AppendUint32(blob, 1)
+	blob = binary.LittleEndian.AppendUint64(blob, math.Float64bits(position.Lon()))
+	return binary.LittleEndian.AppendUint64(blob, math.Float64bits(position.Lat()))
+}
+
+// gpkgMultiPolygon encodes polygons as a GeoPackage geometry blob with an envelope.
+// Altitudes are dropped, as the geometry column is declared two-dimensional.
+func gpkgMultiPolygon(polygons [][][]Position, bounds *[4]float64) []byte {
+	envelope := [4]float64{math.Inf(1), math.Inf(1), math.Inf(-1), math.Inf(-1)}
+	for _, polygon := range polygons {
+		for _, ring := range polygon {
+			for _, position := range ring {
+				extendBounds(&envelope, position)
+			}
+		}
+	}
+	extendBounds(bounds, Position{envelope[0], envelope[1]})
+	extendBounds(bounds, Position{envelope[2], envelope[3]})
+
+	blob := gpkgHeader(&envelope)
+	blob = append(blob, 1)
+	blob = binary.LittleEndian.AppendUint32(blob, 6)
+	blob = binary.LittleEndian.AppendUint32(blob, uint32(len(polygons)))
+	for _, polygon := range polygons {
+		blob = append(blob, 1)
+		blob = binary.LittleEndian.AppendUint32(blob, 3)
+		blob = binary.LittleEndian.AppendUint32(blob, uint32(len(polygon)))
+		for _, ring := range polygon {
+			blob = binary.LittleEndian.AppendUint32(blob, uint32(len(ring)))
+			for _, position := range ring {
+				blob = binary.LittleEndian.AppendUint64(blob, math.Float64bits(position.Lon()))
+				blob = binary.LittleEndian.AppendUint64(blob, math.Float64bits(position.Lat()))
+			}
+		}
+	}
+	return blob
+}
+
+// gpkgHeader returns the GeoPackage binary header in little endian, with the [minx, maxx,
+// miny, maxy] envelope when one is given
+func gpkgHeader(envelope *[4]float64) []byte {
+	flags := byte(1)
+	if envelope != nil {
+		flags |= 1 << 1
+	}
+
+	header := []byte{'G', 'P', 0, flags}
+	header = binary.LittleEndian.AppendUint32(header, wgs84SRSID)
+	if envelope != nil {
+		for _, value := range []float64{envelope[0], envelope[2], envelope[1], envelope[3]} {
+			header = binary.LittleEndian.AppendUint64(header, math.Float64bits(value))
+		}
+	}
+	return header
+}
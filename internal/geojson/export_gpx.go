@@ -0,0 +1,62 @@
+package geojson
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// writeGPX writes the stations as waypoints and the outline of every isochrone polygon as a
+// track segment, since GPX has no area geometries. Holes are written as further segments.
+func writeGPX(w io.Writer, layers []*exportLayer) error {
+	var b strings.Builder
+	b.WriteString(xml.Header)
+	b.WriteString(`<gpx version="1.1" creator="logreason" xmlns="http://www.topografix.com/GPX/1/1">` + "\n")
+
+	// GPX requires waypoints to come before tracks
+	for _, layer := range layers {
+		if layer.polygons {
+			continue
+		}
+		for _, feature := range layer.features {
+			fmt.Fprintf(&b, `  <wpt lat="%s" lon="%s"><name>%s</name>`, gpxCoordinate(feature.Geometry.Point.Lat()), gpxCoordinate(feature.Geometry.Point.Lon()), xmlEscape(featureName(feature)))
+			if city := exportText(feature.Properties[PropertyCity]); city != "" {
+				fmt.Fprintf(&b, "<desc>%s</desc>", xmlEscape(city))
+			}
+			b.WriteString("</wpt>\n")
+		}
+	}
+
+	for _, layer := range layers {
+		if !layer.polygons {
+			continue
+		}
+		for _, feature := range layer.features {
+			fmt.Fprintf(&b, "  <trk><name>%s</name>", xmlEscape(featureName(feature)))
+			if source := exportText(feature.Properties[PropertySource]); source != "" {
+				fmt.Fprintf(&b, "<src>%s</src>", xmlEscape(source))
+			}
+			for _, polygon := range feature.Geometry.Polygons() {
+				for _, ring := range polygon {
+					b.WriteString("<trkseg>")
+					for _, position := range ring {
+						fmt.Fprintf(&b, `<trkpt lat="%s" lon="%s"/>`, gpxCoordinate(position.Lat()), gpxCoordinate(position.Lon()))
+					}
+					b.WriteString("</trkseg>")
+				}
+			}
+			b.WriteString("</trk>\n")
+		}
+	}
+
+	b.WriteString("</gpx>\n")
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+func gpxCoordinate(value float64) string {
+	return strconv.FormatFloat(value, 'f', -1, 64)
+}
@@ -0,0 +1,109 @@
+package geojson
+
+import (
+	"archive/zip"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// kmlStyles colours isochrones with a translucent fill so that overlapping stations stay visible
+const kmlStyles = `
+  <Style id="isochrone"><LineStyle><color>ff0055ff</color><width>1.5</width></LineStyle><PolyStyle><color>400055ff</color></PolyStyle></Style>
+  <Style id="station"><IconStyle><Icon><href>http://maps.google.com/mapfiles/kml/shapes/hospitals.png</href></Icon></IconStyle></Style>`
+
+// writeKML writes the layers as KML folders of placemarks, with the feature properties as extended data
+func writeKML(w io.Writer, layers []*exportLayer) error {
+	var b strings.Builder
+	b.WriteString(xml.Header)
+	b.WriteString(`<kml xmlns="http://www.opengis.net/kml/2.2">` + "\n<Document>\n  <name>Isochrones</name>")
+	b.WriteString(kmlStyles)
+
+	for _, layer := range layers {
+		fmt.Fprintf(&b, "\n  <Folder>\n    <name>%s</name>", xmlEscape(layer.name))
+		for _, feature := range layer.features {
+			b.WriteString("\n    <Placemark>")
+			fmt.Fprintf(&b, "<name>%s</name>", xmlEscape(featureName(feature)))
+			if layer.polygons {
+				b.WriteString("<styleUrl>#isochrone</styleUrl>")
+			} else {
+				b.WriteString("<styleUrl>#station</styleUrl>")
+			}
+
+			b.WriteString("<ExtendedData>")
+			for _, attribute := range layer.attributes {
+				if value, ok := feature.Properties[attribute.name]; ok && value != nil {
+					fmt.Fprintf(&b, `<Data name="%s"><value>%s</value></Data>`, xmlEscape(attribute.name), xmlEscape(exportText(value)))
+				}
+			}
+			b.WriteString("</ExtendedData>")
+
+			if layer.polygons {
+				writeKMLPolygons(&b, feature.Geometry.Polygons())
+			} else {
+				fmt.Fprintf(&b, "<Point><coordinates>%s</coordinates></Point>", kmlCoordinates([]Position{feature.Geometry.Point}))
+			}
+			b.WriteString("</Placemark>")
+		}
+		b.WriteString("\n  </Folder>")
+	}
+
+	b.WriteString("\n</Document>\n</kml>\n")
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+func writeKMLPolygons(b *strings.Builder, polygons [][][]Position) {
+	if len(polygons) > 1 {
+		b.WriteString("<MultiGeometry>")
+	}
+	for _, polygon := range polygons {
+		b.WriteString("<Polygon>")
+		for i, ring := range polygon {
+			boundary := "innerBoundaryIs"
+			if i == 0 {
+				boundary = "outerBoundaryIs"
+			}
+			fmt.Fprintf(b, "<%s><LinearRing><coordinates>%s</coordinates></LinearRing></%s>", boundary, kmlCoordinates(ring), boundary)
+		}
+		b.WriteString("</Polygon>")
+	}
+	if len(polygons) > 1 {
+		b.WriteString("</MultiGeometry>")
+	}
+}
+
+// kmlCoordinates formats positions as KML lon,lat[,alt] tuples
+func kmlCoordinates(positions []Position) string {
+	tuples := make([]string, len(positions))
+	for i, position := range positions {
+		values := make([]string, len(position))
+		for j, value := range position {
+			values[j] = strconv.FormatFloat(value, 'f', -1, 64)
+		}
+		tuples[i] = strings.Join(values, ",")
+	}
+	return strings.Join(tuples, " ")
+}
+
+func xmlEscape(s string) string {
+	var b strings.Builder
+	xml.EscapeText(&b, []byte(s))
+	return b.String()
+}
+
+// writeKMZ writes the KML document as doc.kml in a zip archive, as Google Earth expects
+func writeKMZ(w io.Writer, layers []*exportLayer) error {
+	archive := zip.NewWriter(w)
+	entry, err := archive.Create("doc.kml")
+	if err != nil {
+		return err
+	}
+	if err := writeKML(entry, layers); err != nil {
+		return err
+	}
+	return archive.Close()
+}
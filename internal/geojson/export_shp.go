@@ -0,0 +1,375 @@
+package geojson
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// Shape types of the ESRI Shapefile specification
+const (
+	shapeNull    = 0
+	shapePoint   = 1
+	shapePolygon = 5
+)
+
+// wgs84WKT is the projection file content declaring WGS 84 longitude, latitude coordinates
+const wgs84WKT = `GEOGCS["GCS_WGS_1984",DATUM["D_WGS_1984",SPHEROID["WGS_1984",6378137.0,298.257223563]],PRIMEM["Greenwich",0.0],UNIT["Degree",0.0174532925199433]]`
+
+// dbfFieldNameLength is the longest field name a dBASE table can hold
+const dbfFieldNameLength = 10
+
+// writeShapefile writes a zip archive holding a shapefile per layer, each made of the .shp
+// geometries, the .shx index, the .dbf attribute table and the .prj and .cpg sidecar files.
+// Empty layers are left out.
+func writeShapefile(w io.Writer, layers []*exportLayer) error {
+	archive := zip.NewWriter(w)
+
+	for _, layer := range layers {
+		if len(layer.features) == 0 {
+			continue
+		}
+
+		shp, shx := encodeShapes(layer)
+		dbf, err := encodeDBF(layer)
+		if err != nil {
+			return fmt.Errorf("failed to encode %s attributes: %w", layer.name, err)
+		}
+
+		files := []struct {
+			extension string
+			data      []byte
+		}{
+			{"shp", shp},
+			{"shx", shx},
+			{"dbf", dbf},
+			{"prj", []byte(wgs84WKT)},
+			{"cpg", []byte("UTF-8")},
+		}
+		for _, file := range files {
+			entry, err := archive.Create(layer.name + "." + file.extension)
+			if err != nil {
+				return err
+			}
+			if _, err := entry.Write(file.data); err != nil {
+				return err
+			}
+		}
+	}
+
+	return archive.Close()
+}
+
+// encodeShapes returns the .shp and .shx files of a layer
+func encodeShapes(layer *exportLayer) (shp, shx []byte) {
+	shapeType := shapePoint
+	if layer.polygons {
+		shapeType = shapePolygon
+	}
+
+	var records [][]byte
+	bounds := [4]float64{math.Inf(1), math.Inf(1), math.Inf(-1), math.Inf(-1)}
+	for _, feature := range layer.features {
+		var content []byte
+		if layer.polygons {
+			content = encodeShapePolygon(feature.Geometry.Polygons(), &bounds)
+		} else {
+			content = encodeShapePoint(feature.Geometry.Point, &bounds)
+		}
+		records = append(records, content)
+	}
+	if len(records) == 0 {
+		bounds = [4]float64{}
+	}
+
+	var shpBody, shxBody bytes.Buffer
+	offset := 100
+	for i, content := range records {
+		// Record headers and the index use big endian 16-bit word counts
+		binary.Write(&shpBody, binary.BigEndian, int32(i+1))
+		binary.Write(&shpBody, binary.BigEndian, int32(len(content)/2))
+		shpBody.Write(content)
+
+		binary.Write(&shxBody, binary.BigEndian, int32(offset/2))
+		binary.Write(&shxBody, binary.BigEndian, int32(len(content)/2))
+		offset += 8 + len(content)
+	}
+
+	shp = append(shapeHeader(100+shpBody.Len(), shapeType, bounds), shpBody.Bytes()...)
+	shx = append(shapeHeader(100+shxBody.Len(), shapeType, bounds), shxBody.Bytes()...)
+	return shp, shx
+}
+
+// shapeHeader returns the 100 byte header shared by .shp and .shx files
+func shapeHeader(length, shapeType int, bounds [4]float64) []byte {
+	var header bytes.Buffer
+	binary.Write(&header, binary.BigEndian, int32(9994))
+	header.Write(make([]byte, 20))
+	binary.Write(&header, binary.BigEndian, int32(length/2))
+	binary.Write(&header, binary.LittleEndian, int32(1000))
+	binary.Write(&header, binary.LittleEndian, int32(shapeType))
+	binary.Write(&header, binary.LittleEndian, bounds)
+	// Z and M ranges are unused
+	header.Write(make([]byte, 32))
+	return header.Bytes()
+}
+
+func encodeShapePoint(position Position, bounds *[4]float64) []byte {
+	if len(position) < 2 {
+		var content bytes.Buffer
+		binary.Write(&content, binary.LittleEndian, int32(shapeNull))
+		return content.Bytes()
+	}
+
+	extendBounds(bounds, position)
+	var content bytes.Buffer
+	binary.Write(&content, binary.LittleEndian, int32(shapePoint))
+	binary.Write(&content, binary.LittleEndian, [2]float64{position.Lon(), position.Lat()})
+	return content.Bytes()
+}
+
+// encodeShapePolygon encodes all rings of the polygons as parts of one shape. Shapefiles tell
+// exterior rings from holes by orientation: exterior rings are clockwise and holes
+// counterclockwise, the opposite of RFC 7946.
+func encodeShapePolygon(polygons [][][]Position, bounds *[4]float64) []byte {
+	featureBounds := [4]float64{math.Inf(1), math.Inf(1), math.Inf(-1), math.Inf(-1)}
+	var parts []int32
+	var points [][2]float64
+	for _, polygon := range polygons {
+		for i, ring := range polygon {
+			exterior := i == 0
+			clockwise := ringArea(ring) < 0
+			parts = append(parts, int32(len(points)))
+			for j := range ring {
+				position := ring[j]
+				if clockwise != exterior {
+					position = ring[len(ring)-1-j]
+				}
+				extendBounds(&featureBounds, position)
+				points = append(points, [2]float64{position.Lon(), position.Lat()})
+			}
+		}
+	}
+
+	var content bytes.Buffer
+	if len(points) == 0 {
+		binary.Write(&content, binary.LittleEndian, int32(shapeNull))
+		return content.Bytes()
+	}
+
+	extendBounds(bounds, Position{featureBounds[0], featureBounds[1]})
+	extendBounds(bounds, Position{featureBounds[2], featureBounds[3]})
+
+	binary.Write(&content, binary.LittleEndian, int32(shapePolygon))
+	binary.Write(&content, binary.LittleEndian, featureBounds)
+	binary.Write(&content, binary.LittleEndian, int32(len(parts)))
+	binary.Write(&content, binary.LittleEndian, int32(len(points)))
+	binary.Write(&content, binary.LittleEndian, parts)
+	binary.Write(&content, binary.LittleEndian, points)
+	return content.Bytes()
+}
+
+func extendBounds(bounds *[4]float64, position Position) {
+	bounds[0] = math.Min(bounds[0], position.Lon())
+	bounds[1] = math.Min(bounds[1], position.Lat())
+	bounds[2] = math.Max(bounds[2], position.Lon())
+	bounds[3] = math.Max(bounds[3], position.Lat())
+}
+
+// dbfField is a column of a dBASE table
+type dbfField struct {
+	name      string
+	property  string
+	numeric   bool
+	length    int
+	decimals  int
+	formatted []string
+}
+
+// encodeDBF returns the dBASE III attribute table of a layer. Property names are truncated
+// to the 10 characters dBASE allows, numbers become N fields and everything else C fields.
+func encodeDBF(layer *exportLayer) ([]byte, error) {
+	fields := dbfFields(layer)
+	if len(fields) == 0 {
+		// A table needs at least one field
+		fields = []dbfField{{name: "id", property: "", numeric: true}}
+	}
+
+	// Format every value first to size the fields
+	for f := range fields {
+		field := &fields[f]
+		field.formatted = make([]string, len(layer.features))
+		for i, feature := range layer.features {
+			value := feature.Properties[field.property]
+			var text string
+			switch {
+			case field.property == "":
+				text = strconv.Itoa(i + 1)
+			case field.numeric && value != nil:
+				text = strconv.FormatFloat(value.(float64), 'f', -1, 64)
+			default:
+				text = exportText(value)
+			}
+			field.formatted[i] = text
+		}
+	}
+
+	recordLength := 1
+	for f := range fields {
+		field := &fields[f]
+		if field.numeric {
+			field.length, field.decimals = dbfNumericSize(field.formatted)
+		} else {
+			field.length = 1
+			for i, text := range field.formatted {
+				field.formatted[i] = truncateUTF8(text, 254)
+				if len(field.formatted[i]) > field.length {
+					field.length = len(field.formatted[i])
+				}
+			}
+		}
+		recordLength += field.length
+	}
+
+	var dbf bytes.Buffer
+	now := time.Now()
+	headerLength := 32 + 32*len(fields) + 1
+	dbf.Write([]byte{0x03, byte(now.Year() - 1900), byte(now.Month()), byte(now.Day())})
+	binary.Write(&dbf, binary.LittleEndian, uint32(len(layer.features)))
+	binary.Write(&dbf, binary.LittleEndian, uint16(headerLength))
+	binary.Write(&dbf, binary.LittleEndian, uint16(recordLength))
+	dbf.Write(make([]byte, 20))
+
+	for _, field := range fields {
+		name := make([]byte, 11)
+		copy(name, field.name)
+		dbf.Write(name)
+		if field.numeric {
+			dbf.WriteByte('N')
+		} else {
+			dbf.WriteByte('C')
+		}
+		dbf.Write(make([]byte, 4))
+		dbf.Write([]byte{byte(field.length), byte(field.decimals)})
+		dbf.Write(make([]byte, 14))
+	}
+	dbf.WriteByte(0x0D)
+
+	for i := range layer.features {
+		dbf.WriteByte(' ')
+		for _, field := range fields {
+			text := field.formatted[i]
+			if field.numeric {
+				text = dbfNumber(text, field.decimals)
+			}
+			if len(text) > field.length {
+				text = text[:field.length]
+			}
+			// Pad by bytes, as the field length counts bytes and not characters
+			padding := strings.Repeat(" ", field.length-len(text))
+			if field.numeric {
+				dbf.WriteString(padding + text)
+			} else {
+				dbf.WriteString(text + padding)
+			}
+		}
+	}
+	dbf.WriteByte(0x1A)
+
+	if dbf.Len() != headerLength+recordLength*len(layer.features)+1 {
+		return nil, fmt.Errorf("inconsistent record length")
+	}
+	return dbf.Bytes(), nil
+}
+
+// dbfFields maps the layer attributes to dBASE fields with unique names of up to 10 characters
+func dbfFields(layer *exportLayer) []dbfField {
+	used := make(map[string]bool)
+	var fields []dbfField
+	for _, attribute := range layer.attributes {
+		name := attribute.name
+		if len(name) > dbfFieldNameLength {
+			name = name[:dbfFieldNameLength]
+		}
+		for n := 1; used[name]; n++ {
+			suffix := strconv.Itoa(n)
+			base := attribute.name
+			if len(base) > dbfFieldNameLength-len(suffix) {
+				base = base[:dbfFieldNameLength-len(suffix)]
+			}
+			name = base + suffix
+		}
+		used[name] = true
+		fields = append(fields, dbfField{name: name, property: attribute.name, numeric: attribute.numeric})
+	}
+	return fields
+}
+
+// dbfNumericSize returns the field length and decimal count fitting every formatted number
+func dbfNumericSize(values []string) (length, decimals int) {
+	integer := 1
+	for _, text := range values {
+		if text == "" {
+			continue
+		}
+		whole, fraction := text, ""
+		for i := range text {
+			if text[i] == '.' {
+				whole, fraction = text[:i], text[i+1:]
+				break
+			}
+		}
+		if len(whole) > integer {
+			integer = len(whole)
+		}
+		if len(fraction) > decimals {
+			decimals = len(fraction)
+		}
+	}
+	// dBASE numbers are at most 19 characters wide; precision beyond that is dropped
+	if decimals > 15 {
+		decimals = 15
+	}
+	length = integer
+	if decimals > 0 {
+		length += 1 + decimals
+	}
+	if length > 19 {
+		decimals -= length - 19
+		if decimals < 0 {
+			decimals = 0
+		}
+		length = 19
+	}
+	return length, decimals
+}
+
+// dbfNumber formats a number with a fixed number of decimals; empty values stay empty
+func dbfNumber(text string, decimals int) string {
+	if text == "" {
+		return ""
+	}
+	value, err := strconv.ParseFloat(text, 64)
+	if err != nil {
+		return ""
+	}
+	return strconv.FormatFloat(value, 'f', decimals, 64)
+}
+
+// truncateUTF8 shortens s to at most n bytes without splitting a character
+func truncateUTF8(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return s[:n]
+}
@@ -0,0 +1,95 @@
+package geojson
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"logreason/internal/csvparser"
+	utilities "logreason/internal/utils"
+)
+
+// FileName returns the name of the file holding the isochrone of a location for a range,
+// in the form STATIONCODE-cityName-RANGE.json
+func FileName(location csvparser.Location, rangeValue int) string {
+	return fmt.Sprintf("%s-%d.json", StationFileName(location), rangeValue)
+}
+
+// StationFileName returns the range independent part of a file name, STATIONCODE-cityName
+func StationFileName(location csvparser.Location) string {
+	// Convert city name to camel case
+	return fmt.Sprintf("%s-%s", location.Name, utilities.ToCamelCase(location.City))
+}
+
+// ParseFileName splits a file name like APMPAD-padernoDugnano-600.json into its
+// station part and range. Files written before ranges were encoded in the name
+// have no range suffix and report a range of 0.
+func ParseFileName(name string) (station string, rangeValue int) {
+	base := strings.TrimSuffix(name, ".json")
+
+	sep := strings.LastIndex(base, "-")
+	if sep == -1 {
+		return base, 0
+	}
+
+	value, err := strconv.Atoi(base[sep+1:])
+	if err != nil || value <= 0 {
+		return base, 0
+	}
+	return base[:sep], value
+}
+
+// ListFiles returns the names of the GeoJSON files in dir, sorted by name.
+// When rangeValue is positive only files for that range are returned.
+// Hidden files, such as temporary or bookkeeping files, are skipped.
+func ListFiles(dir string, rangeValue int) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var names []string
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasSuffix(name, ".json") || strings.HasPrefix(name, ".") {
+			continue
+		}
+		if rangeValue > 0 {
+			if _, r := ParseFileName(name); r != rangeValue {
+				continue
+			}
+		}
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+	return names, nil
+}
+
+// DirSignature describes the name, size and modification time of every GeoJSON file in dir
+// and of the extra files, so that caches can tell when they need to be rebuilt.
+// Extra files that do not exist are ignored.
+func DirSignature(dir string, extra ...string) (string, error) {
+	names, err := ListFiles(dir, 0)
+	if err != nil {
+		return "", fmt.Errorf("failed to list isochrones: %w", err)
+	}
+
+	paths := append([]string{}, extra...)
+	for _, name := range names {
+		paths = append(paths, filepath.Join(dir, name))
+	}
+
+	var signature strings.Builder
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if err != nil {
+			continue
+		}
+		fmt.Fprintf(&signature, "%s %d %d\n", path, info.Size(), info.ModTime().UnixNano())
+	}
+	return signature.String(), nil
+}
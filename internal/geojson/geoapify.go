@@ -0,0 +1,61 @@
+package geojson
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// GeoapifyProvider computes isochrones with the Geoapify isoline API.
+// The base URL is a template whose {LAT}, {LON}, {RANGE}, {MODE}, {TYPE} and {API}
+// placeholders are substituted for every request.
+type GeoapifyProvider struct {
+	apiKey  string
+	baseURL string
+}
+
+// NewGeoapifyProvider creates a Geoapify provider from an API key and URL template
+func NewGeoapifyProvider(apiKey, baseURL string) *GeoapifyProvider {
+	return &GeoapifyProvider{apiKey: apiKey, baseURL: baseURL}
+}
+
+// Name returns the provider name
+func (p *GeoapifyProvider) Name() string {
+	return ProviderGeoapify
+}
+
+// Fingerprint returns the URL template, which never contains the API key itself
+func (p *GeoapifyProvider) Fingerprint() string {
+	return p.baseURL
+}
+
+// Supports checks that the URL template can express the mode and type.
+// A template without placeholders has them hard-coded, so only the defaults apply.
+func (p *GeoapifyProvider) Supports(mode Mode, isolineType IsolineType) error {
+	if mode != ModeDrive && !strings.Contains(p.baseURL, "{MODE}") {
+		return fmt.Errorf("GEOAPIFY_BASE_URL must contain a {MODE} placeholder to use travel mode %s", mode)
+	}
+	if isolineType != TypeTime && !strings.Contains(p.baseURL, "{TYPE}") {
+		return fmt.Errorf("GEOAPIFY_BASE_URL must contain a {TYPE} placeholder to use isoline type %s", isolineType)
+	}
+	return nil
+}
+
+// Isochrone fetches the isoline for the request; Geoapify already answers with a FeatureCollection
+func (p *GeoapifyProvider) Isochrone(ctx context.Context, fetcher Fetcher, req IsochroneRequest) ([]byte, error) {
+	// Build the URL with the location's coordinates, range, travel mode, isoline type and API key
+	url := strings.ReplaceAll(p.baseURL, "{LAT}", fmt.Sprintf("%f", req.Latitude))
+	url = strings.ReplaceAll(url, "{LON}", fmt.Sprintf("%f", req.Longitude))
+	url = strings.ReplaceAll(url, "{RANGE}", fmt.Sprintf("%d", req.Range))
+	url = strings.ReplaceAll(url, "{MODE}", string(req.Mode))
+	url = strings.ReplaceAll(url, "{TYPE}", string(req.Type))
+	url = strings.ReplaceAll(url, "{API}", p.apiKey)
+
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	return fetcher.Fetch(httpReq)
+}
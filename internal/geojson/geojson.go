@@ -1,44 +1,139 @@
-// Package geojson provides functionality for fetching and saving GeoJSON data from the Geoapify API.
+// Package geojson provides functionality for fetching isochrones from routing providers such as
+// Geoapify and saving them as GeoJSON data.
 package geojson
 
 import (
+	"context"
+	"encoding/json"
 	"fmt"
 	"io"
-	utilities "logreason/internal/utils"
+	"log"
 	"net/http"
 	"os"
 	"path/filepath"
-	"strings"
+	"runtime/debug"
+	"sync"
+	"time"
 
 	"logreason/internal/csvparser"
 	"logreason/internal/secrets"
 )
 
-// Constants for the Geoapify API
+// Constants for the isochrone providers
 const (
 	// DefaultOutputDir Default directory for saving GeoJSON files
 	DefaultOutputDir = "out/geojson"
+	// DefaultConcurrency Default number of locations processed in parallel
+	DefaultConcurrency = 4
+	// DefaultRateLimit Default maximum number of API requests per second (Geoapify free plan quota)
+	DefaultRateLimit = 5.0
+	// DefaultTimeout Default timeout for a single API request
+	DefaultTimeout = 30 * time.Second
+	// QuarantineDir Subdirectory of the output directory receiving payloads that failed validation
+	QuarantineDir = ".quarantine"
 )
 
+// Doer is the subset of *http.Client used by the Manager to perform API requests
+type Doer interface {
+	Do(req *http.Request) (*http.Response, error)
+}
+
 // Manager handles fetching and saving GeoJSON data
 type Manager struct {
 	secretsManager *secrets.Manager
-	apiKey         string
-	baseURL        string
+	provider       IsochroneProvider
 	outputDir      string
+	concurrency    int
+	limiter        *rateLimiter
+	retryPolicy    RetryPolicy
+	client         Doer
+	mode           Mode
+	isolineType    IsolineType
+	force          bool
+	simplify       SimplifyOptions
+	progress       func(Progress)
+}
+
+// Progress reports the outcome of one location and range handled by ProcessLocations
+type Progress struct {
+	Location csvparser.Location
+	Range    int
+	// Skipped is set when the isochrone was already up to date and no request was made
+	Skipped bool
+	Err     error
+	// Duration is the time spent on the isochrone, including retries and rate limiter waits
+	Duration time.Duration
+}
+
+// Option configures optional behaviour of a Manager
+type Option func(*Manager)
+
+// WithConcurrency sets how many locations are fetched in parallel by ProcessLocations.
+// Values lower than 1 are treated as 1.
+func WithConcurrency(workers int) Option {
+	return func(m *Manager) {
+		if workers < 1 {
+			workers = 1
+		}
+		m.concurrency = workers
+	}
+}
+
+// WithRateLimit limits outgoing API requests to rps requests per second.
+// A value of 0 or less disables rate limiting.
+func WithRateLimit(rps float64) Option {
+	return func(m *Manager) {
+		m.limiter = newRateLimiter(rps, 1)
+	}
+}
+
+// WithHTTPClient sets the client used to perform API requests, e.g. an *http.Client
+// with a custom transport or a fake in tests
+func WithHTTPClient(client Doer) Option {
+	return func(m *Manager) {
+		m.client = client
+	}
+}
+
+// WithProgress registers a callback invoked after every location and range handled by
+// ProcessLocations. It is called concurrently from the worker goroutines.
+func WithProgress(fn func(Progress)) Option {
+	return func(m *Manager) {
+		m.progress = fn
+	}
 }
 
 // NewManager creates a new GeoJSON manager
-func NewManager(secretsManager *secrets.Manager) (*Manager, error) {
-	// Get the API key and base URL from the secrets manager
-	apiKey, exists := secretsManager.Get("GEOAPIFY_API_KEY")
-	if !exists {
-		return nil, fmt.Errorf("GEOAPIFY_API_KEY not found in secrets")
+func NewManager(secretsManager *secrets.Manager, opts ...Option) (*Manager, error) {
+	m := &Manager{
+		secretsManager: secretsManager,
+		outputDir:      DefaultOutputDir,
+		concurrency:    DefaultConcurrency,
+		limiter:        newRateLimiter(DefaultRateLimit, 1),
+		retryPolicy:    DefaultRetryPolicy,
+		client:         &http.Client{Timeout: DefaultTimeout},
+		mode:           ModeDrive,
+		isolineType:    TypeTime,
+	}
+	for _, opt := range opts {
+		opt(m)
+	}
+
+	// Create the provider configured in the secrets unless one was given
+	if m.provider == nil {
+		provider, err := NewProvider(DefaultProviderName(secretsManager), secretsManager)
+		if err != nil {
+			return nil, err
+		}
+		m.provider = provider
+	}
+
+	if err := m.provider.Supports(m.mode, m.isolineType); err != nil {
+		return nil, err
 	}
 
-	baseURL, exists := secretsManager.Get("GEOAPIFY_BASE_URL")
-	if !exists {
-		return nil, fmt.Errorf("GEOAPIFY_BASE_URL not found in secrets")
+	if err := m.simplify.Validate(); err != nil {
+		return nil, err
 	}
 
 	// Create the output directory if it doesn't exist
@@ -46,12 +141,7 @@ func NewManager(secretsManager *secrets.Manager) (*Manager, error) {
 		return nil, fmt.Errorf("failed to create output directory: %w", err)
 	}
 
-	return &Manager{
-		secretsManager: secretsManager,
-		apiKey:         apiKey,
-		baseURL:        baseURL,
-		outputDir:      DefaultOutputDir,
-	}, nil
+	return m, nil
 }
 
 // SetOutputDir sets a custom output directory
@@ -65,64 +155,244 @@ func (m *Manager) SetOutputDir(dir string) error {
 
 // FetchAndSaveGeoJSON fetches GeoJSON data for a location and saves it to a file
 func (m *Manager) FetchAndSaveGeoJSON(location csvparser.Location, rangeValue int) error {
-	// Build the URL with the location's coordinates, range, and API key
-	url := strings.ReplaceAll(m.baseURL, "{LAT}", fmt.Sprintf("%f", location.Latitude))
-	url = strings.ReplaceAll(url, "{LON}", fmt.Sprintf("%f", location.Longitude))
-	url = strings.ReplaceAll(url, "{RANGE}", fmt.Sprintf("%d", rangeValue))
-	url = strings.ReplaceAll(url, "{API}", m.apiKey)
-
-	// Fetch the GeoJSON data
-	resp, err := http.Get(url)
-	if err != nil {
-		return fmt.Errorf("failed to fetch GeoJSON data: %w", err)
-	}
-	defer resp.Body.Close()
+	return m.FetchAndSaveGeoJSONContext(context.Background(), location, rangeValue)
+}
 
-	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("API request failed with status code: %d", resp.StatusCode)
+// FetchAndSaveGeoJSONContext is like FetchAndSaveGeoJSON but aborts in-flight requests,
+// retries and rate limiter waits as soon as the context is done
+func (m *Manager) FetchAndSaveGeoJSONContext(ctx context.Context, location csvparser.Location, rangeValue int) error {
+	request := IsochroneRequest{
+		Latitude:  location.Latitude,
+		Longitude: location.Longitude,
+		Range:     rangeValue,
+		Mode:      m.mode,
+		Type:      m.isolineType,
 	}
 
-	// Read the response body
-	body, err := io.ReadAll(resp.Body)
+	// Fetch the GeoJSON data from the provider, retrying transient failures
+	body, err := m.provider.Isochrone(ctx, fetcher{m}, request)
 	if err != nil {
-		return fmt.Errorf("failed to read response body: %w", err)
+		return err
 	}
 
 	// Create the output file
-	//filename := fmt.Sprintf("%s.json", location.Name)
-	//filePath := filepath.Join(m.outputDir, filename)
-	filePath := m.getOutputFileName(&location)
+	filePath := m.getOutputFileName(&location, rangeValue)
+
+	// Reject payloads that are not a valid isochrone, keeping a copy for inspection
+	featureCollection, err := ParseFeatureCollection(body)
+	if err != nil {
+		quarantinePath, qerr := m.quarantine(filePath, body)
+		if qerr != nil {
+			return fmt.Errorf("%w (failed to quarantine payload: %v)", err, qerr)
+		}
+		return fmt.Errorf("%w (payload quarantined as %s)", err, quarantinePath)
+	}
 
-	// Write the GeoJSON data to the file
-	if err := os.WriteFile(filePath, body, 0644); err != nil {
+	// Drop the vertices map clients do not need before adding the station point
+	if m.simplify.Enabled() {
+		featureCollection.Simplify(m.simplify)
+	}
+
+	// Record the parameters used to compute the isochrone and describe the station
+	metadata := Metadata{
+		Provider:  m.provider.Name(),
+		Mode:      m.mode,
+		Type:      m.isolineType,
+		Range:     rangeValue,
+		FetchedAt: time.Now().UTC().Truncate(time.Second),
+	}
+	featureCollection.Metadata = &metadata
+	enrich(featureCollection, location, metadata)
+
+	data, err := json.Marshal(featureCollection)
+	if err != nil {
+		return fmt.Errorf("failed to marshal GeoJSON data: %w", err)
+	}
+
+	// Write the GeoJSON data to the file through a temporary file and rename
+	if err := writeFileAtomic(filePath, data, 0644); err != nil {
 		return fmt.Errorf("failed to write GeoJSON file: %w", err)
 	}
 
 	return nil
 }
 
-func (m *Manager) getOutputFileName(location *csvparser.Location) string {
-	// Extract the station code (assuming it's before the parentheses)
-	stationCode := location.Name
+// quarantine saves a rejected payload under the quarantine directory and returns its path
+func (m *Manager) quarantine(filePath string, body []byte) (string, error) {
+	dir := filepath.Join(m.outputDir, QuarantineDir)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", err
+	}
 
-	// Convert city name to pascal case
-	cityNamePascal := utilities.ToCamelCase(location.City)
+	quarantinePath := filepath.Join(dir, filepath.Base(filePath))
+	if err := writeFileAtomic(quarantinePath, body, 0644); err != nil {
+		return "", err
+	}
+	return quarantinePath, nil
+}
 
-	// Construct filename: STATIONCODE-CityName.json
-	filename := fmt.Sprintf("%s-%s.json", stationCode, cityNamePascal)
+// fetcher exposes the Manager rate limit and retry policy to providers
+type fetcher struct {
+	m *Manager
+}
 
-	return filepath.Join(m.outputDir, filename)
+// Fetch performs the request, retrying transient failures according to the retry policy
+func (f fetcher) Fetch(req *http.Request) ([]byte, error) {
+	ctx := req.Context()
+	for attempt := 1; ; attempt++ {
+		body, err := f.m.fetchOnce(req)
+		if err == nil {
+			return body, nil
+		}
+
+		if attempt >= f.m.retryPolicy.MaxAttempts || !isRetryable(err) {
+			if attempt > 1 {
+				return nil, fmt.Errorf("giving up after %d attempts: %w", attempt, err)
+			}
+			return nil, err
+		}
+
+		if err := sleepContext(ctx, f.m.retryPolicy.delay(attempt, err)); err != nil {
+			return nil, err
+		}
+
+		// Rewind the request body for the next attempt
+		if req.GetBody != nil {
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, fmt.Errorf("failed to rewind request body: %w", err)
+			}
+			req = req.Clone(ctx)
+			req.Body = body
+		}
+	}
 }
 
-// ProcessLocations processes all locations and saves their GeoJSON data
-func (m *Manager) ProcessLocations(locations []csvparser.Location, rangeValue int) []error {
-	var errors []error
+// fetchOnce performs a single rate limited request and returns the response body
+func (m *Manager) fetchOnce(req *http.Request) ([]byte, error) {
+	if err := m.limiter.Wait(req.Context()); err != nil {
+		return nil, err
+	}
+
+	resp, err := m.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch GeoJSON data: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, &StatusError{
+			StatusCode: resp.StatusCode,
+			RetryAfter: parseRetryAfter(resp.Header.Get("Retry-After"), time.Now()),
+		}
+	}
+
+	// Read the response body
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response body: %w", err)
+	}
+
+	return body, nil
+}
+
+func (m *Manager) getOutputFileName(location *csvparser.Location, rangeValue int) string {
+	// Construct filename: STATIONCODE-cityName-RANGE.json
+	return filepath.Join(m.outputDir, FileName(*location, rangeValue))
+}
 
+// fetchRecovered fetches and saves an isochrone like FetchAndSaveGeoJSONContext, turning a
+// panic of the provider into an error so that one isochrone cannot crash the program
+func (m *Manager) fetchRecovered(ctx context.Context, location csvparser.Location, rangeValue int) (err error) {
+	defer func() {
+		if v := recover(); v != nil {
+			log.Printf("Warning: panic processing %s at range %d: %v\n%s", location.Name, rangeValue, v, debug.Stack())
+			err = fmt.Errorf("panic: %v", v)
+		}
+	}()
+	return m.FetchAndSaveGeoJSONContext(ctx, location, rangeValue)
+}
+
+// ProcessLocations processes all locations and saves their GeoJSON data, writing one file
+// per location and range. Isochrones recorded in the output directory manifest with the same
+// coordinates and parameters are skipped unless WithForce is set. Locations are fetched by a
+// pool of workers sized by WithConcurrency; the returned errors are reported in the same order
+// as the input locations.
+func (m *Manager) ProcessLocations(locations []csvparser.Location, ranges ...int) []error {
+	return m.ProcessLocationsContext(context.Background(), locations, ranges...)
+}
+
+// ProcessLocationsContext is like ProcessLocations but stops issuing requests once the
+// context is done; locations that were not fetched are reported with the context error
+func (m *Manager) ProcessLocationsContext(ctx context.Context, locations []csvparser.Location, ranges ...int) []error {
+	type task struct {
+		location   csvparser.Location
+		rangeValue int
+	}
+
+	manifest, err := LoadManifest(m.outputDir)
+	if err != nil {
+		return []error{err}
+	}
+
+	var tasks []task
 	for _, location := range locations {
-		if err := m.FetchAndSaveGeoJSON(location, rangeValue); err != nil {
-			errors = append(errors, fmt.Errorf("error processing location %s: %w", location.Name, err))
+		for _, rangeValue := range ranges {
+			tasks = append(tasks, task{location: location, rangeValue: rangeValue})
 		}
 	}
 
+	results := make([]error, len(tasks))
+
+	workers := m.concurrency
+	if workers > len(tasks) {
+		workers = len(tasks)
+	}
+
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				t := tasks[i]
+				name := FileName(t.location, t.rangeValue)
+				entry := m.manifestEntry(t.location, t.rangeValue)
+
+				start := time.Now()
+				skipped := !m.force && m.upToDate(manifest, name, entry)
+				if !skipped {
+					results[i] = m.fetchRecovered(ctx, t.location, t.rangeValue)
+					if results[i] == nil {
+						entry.FetchedAt = time.Now().UTC().Truncate(time.Second)
+						manifest.Set(name, entry)
+					}
+				}
+
+				if m.progress != nil {
+					m.progress(Progress{Location: t.location, Range: t.rangeValue, Skipped: skipped, Err: results[i], Duration: time.Since(start)})
+				}
+			}
+		}()
+	}
+
+	for i := range tasks {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+
+	var errors []error
+	for i, err := range results {
+		if err != nil {
+			errors = append(errors, fmt.Errorf("error processing location %s at range %d: %w", tasks[i].location.Name, tasks[i].rangeValue, err))
+		}
+	}
+
+	if err := manifest.Save(m.outputDir); err != nil {
+		errors = append(errors, err)
+	}
+
 	return errors
 }
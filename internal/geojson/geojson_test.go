@@ -0,0 +1,1110 @@
+package geojson
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"io"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"logreason/internal/csvparser"
+	"logreason/internal/secrets"
+)
+
+// testFeatureCollection is a minimal isochrone as returned by the API, with a clockwise ring
+const testFeatureCollection = `{"type":"FeatureCollection","features":[{"type":"Feature","properties":{},
+	"geometry":{"type":"Polygon","coordinates":[[[9.0,45.0],[9.0,45.1],[9.1,45.1],[9.1,45.0],[9.0,45.0]]]}}]}`
+
+// newTestManager creates a Manager pointed at the given test server, writing into a temporary directory
+func newTestManager(t *testing.T, serverURL string, opts ...Option) *Manager {
+	t.Helper()
+
+	tempDir := chdirTemp(t)
+
+	secretsManager := secrets.NewManager()
+	secretsManager.Set("GEOAPIFY_API_KEY", "test-key")
+	secretsManager.Set("GEOAPIFY_BASE_URL", serverURL+"/isoline?lat={LAT}&lon={LON}&type={TYPE}&mode={MODE}&range={RANGE}&apiKey={API}")
+
+	manager, err := NewManager(secretsManager, opts...)
+	if err != nil {
+		t.Fatalf("NewManager failed: %v", err)
+	}
+	if err := manager.SetOutputDir(filepath.Join(tempDir, "geojson")); err != nil {
+		t.Fatalf("SetOutputDir failed: %v", err)
+	}
+	return manager
+}
+
+// chdirTemp moves into a temporary directory for the duration of the test, since
+// NewManager creates the default output directory relative to the working directory
+func chdirTemp(t *testing.T) string {
+	t.Helper()
+
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("Failed to get working directory: %v", err)
+	}
+	tempDir := t.TempDir()
+	if err := os.Chdir(tempDir); err != nil {
+		t.Fatalf("Failed to change directory: %v", err)
+	}
+	t.Cleanup(func() { os.Chdir(wd) })
+
+	return tempDir
+}
+
+func testLocations(n int) []csvparser.Location {
+	locations := make([]csvparser.Location, n)
+	for i := range locations {
+		locations[i] = csvparser.Location{
+			Name:      "ST" + string(rune('A'+i)),
+			City:      "TEST CITY",
+			Latitude:  45 + float64(i)/100,
+			Longitude: 9,
+		}
+	}
+	return locations
+}
+
+func TestManager_ProcessLocationsConcurrently(t *testing.T) {
+	var inFlight, maxInFlight int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		current := atomic.AddInt32(&inFlight, 1)
+		defer atomic.AddInt32(&inFlight, -1)
+		for {
+			seen := atomic.LoadInt32(&maxInFlight)
+			if current <= seen || atomic.CompareAndSwapInt32(&maxInFlight, seen, current) {
+				break
+			}
+		}
+		time.Sleep(20 * time.Millisecond)
+
+		// Fail one location to check errors are still reported per location
+		if strings.HasPrefix(r.URL.Query().Get("lat"), "45.02") {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		w.Write([]byte(testFeatureCollection))
+	}))
+	defer server.Close()
+
+	manager := newTestManager(t, server.URL, WithConcurrency(3), WithRateLimit(0))
+	locations := testLocations(8)
+
+	errs := manager.ProcessLocations(locations, 600)
+	if len(errs) != 1 {
+		t.Fatalf("Expected 1 error, got %d: %v", len(errs), errs)
+	}
+	if !strings.Contains(errs[0].Error(), locations[2].Name) {
+		t.Errorf("Expected error for location %s, got %v", locations[2].Name, errs[0])
+	}
+
+	if maxInFlight < 2 || maxInFlight > 3 {
+		t.Errorf("Expected between 2 and 3 concurrent requests, got %d", maxInFlight)
+	}
+
+	names, err := ListFiles(manager.outputDir, 0)
+	if err != nil {
+		t.Fatalf("Failed to read output directory: %v", err)
+	}
+	if len(names) != len(locations)-1 {
+		t.Errorf("Expected %d files, got %d", len(locations)-1, len(names))
+	}
+}
+
+func TestRateLimiter(t *testing.T) {
+	if newRateLimiter(0, 1) != nil {
+		t.Error("Expected a nil limiter when rps is 0")
+	}
+
+	limiter := newRateLimiter(50, 1)
+	start := time.Now()
+	var wg sync.WaitGroup
+	for i := 0; i < 6; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			limiter.Wait(context.Background())
+		}()
+	}
+	wg.Wait()
+
+	// The first token is available immediately, the other five need 20ms each
+	if elapsed := time.Since(start); elapsed < 90*time.Millisecond {
+		t.Errorf("Expected rate limited calls to take at least 90ms, took %v", elapsed)
+	}
+}
+
+func TestManager_RetryPolicy(t *testing.T) {
+	fastRetry := RetryPolicy{MaxAttempts: 3, BaseDelay: time.Millisecond, MaxDelay: 10 * time.Millisecond}
+
+	tests := []struct {
+		name         string
+		statuses     []int
+		retryAfter   string
+		expectCalls  int32
+		expectError  bool
+		expectStatus int
+	}{
+		{"success after transient failures", []int{503, 502, 200}, "", 3, false, 0},
+		{"too many requests with retry-after", []int{429, 200}, "1", 2, false, 0},
+		{"unauthorized is permanent", []int{401, 200}, "", 1, true, 401},
+		{"bad request is permanent", []int{400, 200}, "", 1, true, 400},
+		{"gives up after max attempts", []int{500, 500, 500, 200}, "", 3, true, 500},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			var calls int32
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				call := atomic.AddInt32(&calls, 1)
+				status := tc.statuses[call-1]
+				if status != http.StatusOK {
+					if tc.retryAfter != "" {
+						w.Header().Set("Retry-After", tc.retryAfter)
+					}
+					w.WriteHeader(status)
+					return
+				}
+				w.Write([]byte(testFeatureCollection))
+			}))
+			defer server.Close()
+
+			manager := newTestManager(t, server.URL, WithRateLimit(0), WithRetryPolicy(fastRetry))
+			err := manager.FetchAndSaveGeoJSON(testLocations(1)[0], 600)
+
+			if (err != nil) != tc.expectError {
+				t.Fatalf("FetchAndSaveGeoJSON() error = %v, wantError = %v", err, tc.expectError)
+			}
+			if calls != tc.expectCalls {
+				t.Errorf("Expected %d calls, got %d", tc.expectCalls, calls)
+			}
+
+			var statusErr *StatusError
+			if tc.expectError && (!errors.As(err, &statusErr) || statusErr.StatusCode != tc.expectStatus) {
+				t.Errorf("Expected status error %d, got %v", tc.expectStatus, err)
+			}
+		})
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		input  string
+		expect time.Duration
+	}{
+		{"", 0},
+		{"5", 5 * time.Second},
+		{"-1", 0},
+		{"Mon, 01 Jan 2024 12:00:30 GMT", 30 * time.Second},
+		{"Mon, 01 Jan 2024 11:00:00 GMT", 0},
+		{"invalid", 0},
+	}
+
+	for _, tc := range tests {
+		if got := parseRetryAfter(tc.input, now); got != tc.expect {
+			t.Errorf("parseRetryAfter(%q) = %v, want %v", tc.input, got, tc.expect)
+		}
+	}
+}
+
+func TestRetryPolicy_Delay(t *testing.T) {
+	policy := RetryPolicy{MaxAttempts: 5, BaseDelay: 100 * time.Millisecond, MaxDelay: time.Second}
+
+	if d := policy.delay(1, nil); d != 100*time.Millisecond {
+		t.Errorf("Expected first delay of 100ms, got %v", d)
+	}
+	if d := policy.delay(3, nil); d != 400*time.Millisecond {
+		t.Errorf("Expected third delay of 400ms, got %v", d)
+	}
+	if d := policy.delay(10, nil); d != time.Second {
+		t.Errorf("Expected delay capped at 1s, got %v", d)
+	}
+
+	retryAfter := &StatusError{StatusCode: http.StatusTooManyRequests, RetryAfter: 700 * time.Millisecond}
+	if d := policy.delay(1, retryAfter); d != 700*time.Millisecond {
+		t.Errorf("Expected Retry-After delay of 700ms, got %v", d)
+	}
+
+	policy.Jitter = 0.5
+	for i := 0; i < 20; i++ {
+		if d := policy.delay(1, nil); d < 50*time.Millisecond || d > 150*time.Millisecond {
+			t.Fatalf("Expected jittered delay between 50ms and 150ms, got %v", d)
+		}
+	}
+}
+
+// recordingDoer is a Doer answering every request with a fixed body, without network access
+type recordingDoer struct {
+	mu       sync.Mutex
+	requests []*http.Request
+}
+
+func (d *recordingDoer) Do(req *http.Request) (*http.Response, error) {
+	d.mu.Lock()
+	d.requests = append(d.requests, req)
+	d.mu.Unlock()
+
+	recorder := httptest.NewRecorder()
+	recorder.WriteString(testFeatureCollection)
+	return recorder.Result(), nil
+}
+
+func TestManager_WithHTTPClient(t *testing.T) {
+	doer := &recordingDoer{}
+	manager := newTestManager(t, "http://isoline.invalid", WithHTTPClient(doer), WithRateLimit(0))
+
+	if errs := manager.ProcessLocations(testLocations(3), 900); len(errs) != 0 {
+		t.Fatalf("ProcessLocations failed: %v", errs)
+	}
+
+	if len(doer.requests) != 3 {
+		t.Fatalf("Expected 3 requests, got %d", len(doer.requests))
+	}
+	for _, req := range doer.requests {
+		if req.URL.Host != "isoline.invalid" || req.URL.Query().Get("range") != "900" {
+			t.Errorf("Unexpected request URL %s", req.URL)
+		}
+	}
+}
+
+func TestManager_ProcessLocationsContextCancel(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-release:
+		case <-r.Context().Done():
+		}
+	}))
+	defer server.Close()
+	defer close(release)
+
+	manager := newTestManager(t, server.URL, WithConcurrency(2), WithRateLimit(0))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(50*time.Millisecond, cancel)
+
+	start := time.Now()
+	errs := manager.ProcessLocationsContext(ctx, testLocations(5), 600)
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("Expected cancellation to abort quickly, took %v", elapsed)
+	}
+
+	if len(errs) != 5 {
+		t.Fatalf("Expected 5 errors, got %d", len(errs))
+	}
+	for _, err := range errs {
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("Expected context.Canceled, got %v", err)
+		}
+	}
+}
+
+func TestManager_ProcessLocationsMultipleRanges(t *testing.T) {
+	doer := &recordingDoer{}
+	manager := newTestManager(t, "http://isoline.invalid", WithHTTPClient(doer), WithRateLimit(0))
+	locations := testLocations(2)
+
+	if errs := manager.ProcessLocations(locations, 480, 720, 1200); len(errs) != 0 {
+		t.Fatalf("ProcessLocations failed: %v", errs)
+	}
+
+	for _, rangeValue := range []int{480, 720, 1200} {
+		names, err := ListFiles(manager.outputDir, rangeValue)
+		if err != nil {
+			t.Fatalf("ListFiles failed: %v", err)
+		}
+		if len(names) != len(locations) {
+			t.Errorf("Expected %d files for range %d, got %v", len(locations), rangeValue, names)
+		}
+	}
+}
+
+func TestFileNames(t *testing.T) {
+	location := csvparser.Location{Name: "APMPAD", City: "PADERNO DUGNANO"}
+
+	name := FileName(location, 600)
+	if name != "APMPAD-padernoDugnano-600.json" {
+		t.Errorf("FileName() = %q, want %q", name, "APMPAD-padernoDugnano-600.json")
+	}
+
+	tests := []struct {
+		input         string
+		expectStation string
+		expectRange   int
+	}{
+		{"APMPAD-padernoDugnano-600.json", "APMPAD-padernoDugnano", 600},
+		{"APMPAD-padernoDugnano.json", "APMPAD-padernoDugnano", 0},
+		{"APMPAD-.json", "APMPAD-", 0},
+		{"SIMPLE.json", "SIMPLE", 0},
+	}
+
+	for _, tc := range tests {
+		station, rangeValue := ParseFileName(tc.input)
+		if station != tc.expectStation || rangeValue != tc.expectRange {
+			t.Errorf("ParseFileName(%q) = %q, %d, want %q, %d", tc.input, station, rangeValue, tc.expectStation, tc.expectRange)
+		}
+	}
+}
+
+func TestManager_ModeAndType(t *testing.T) {
+	doer := &recordingDoer{}
+	manager := newTestManager(t, "http://isoline.invalid", WithHTTPClient(doer), WithRateLimit(0),
+		WithMode(ModeWalk), WithType(TypeDistance))
+	location := testLocations(1)[0]
+
+	if err := manager.FetchAndSaveGeoJSON(location, 2000); err != nil {
+		t.Fatalf("FetchAndSaveGeoJSON failed: %v", err)
+	}
+
+	query := doer.requests[0].URL.Query()
+	if query.Get("mode") != "walk" || query.Get("type") != "distance" {
+		t.Errorf("Expected mode=walk and type=distance, got %s", doer.requests[0].URL)
+	}
+
+	content, err := os.ReadFile(filepath.Join(manager.outputDir, FileName(location, 2000)))
+	if err != nil {
+		t.Fatalf("Failed to read output file: %v", err)
+	}
+	var document struct {
+		Metadata Metadata `json:"metadata"`
+	}
+	if err := json.Unmarshal(content, &document); err != nil {
+		t.Fatalf("Failed to parse output file: %v", err)
+	}
+	metadata := document.Metadata
+	if metadata.Mode != ModeWalk || metadata.Type != TypeDistance || metadata.Range != 2000 || metadata.FetchedAt.IsZero() {
+		t.Errorf("Unexpected metadata %+v", metadata)
+	}
+}
+
+func TestNewManager_RequiresPlaceholders(t *testing.T) {
+	secretsManager := secrets.NewManager()
+	secretsManager.Set("GEOAPIFY_API_KEY", "test-key")
+	secretsManager.Set("GEOAPIFY_BASE_URL", "http://isoline.invalid/isoline?lat={LAT}&lon={LON}&mode=drive&range={RANGE}&apiKey={API}")
+
+	chdirTemp(t)
+	if _, err := NewManager(secretsManager, WithMode(ModeBicycle)); err == nil {
+		t.Error("Expected an error for a template without {MODE} placeholder")
+	}
+	if _, err := NewManager(secretsManager); err != nil {
+		t.Errorf("Expected the default mode to work without placeholders, got %v", err)
+	}
+}
+
+func TestParseModeAndType(t *testing.T) {
+	if mode, err := ParseMode("bicycle"); err != nil || mode != ModeBicycle {
+		t.Errorf("ParseMode(bicycle) = %q, %v", mode, err)
+	}
+	if _, err := ParseMode("hovercraft"); err == nil {
+		t.Error("Expected an error for an unknown mode")
+	}
+	if isolineType, err := ParseIsolineType("distance"); err != nil || isolineType != TypeDistance {
+		t.Errorf("ParseIsolineType(distance) = %q, %v", isolineType, err)
+	}
+	if _, err := ParseIsolineType("energy"); err == nil {
+		t.Error("Expected an error for an unknown isoline type")
+	}
+}
+
+func TestParseFeatureCollection(t *testing.T) {
+	tests := []struct {
+		name       string
+		input      string
+		expectPath string
+	}{
+		{"valid isochrone", testFeatureCollection, ""},
+		{"error payload", `{"statusCode":401,"error":"Unauthorized"}`, "type"},
+		{"truncated body", `{"type":"FeatureCollection","features":[{"type":"Fea`, ""},
+		{"no features", `{"type":"FeatureCollection","features":[]}`, "features"},
+		{"only points", `{"type":"FeatureCollection","features":[{"type":"Feature","properties":null,
+			"geometry":{"type":"Point","coordinates":[9.0,45.0]}}]}`, "features"},
+		{"unclosed ring", `{"type":"FeatureCollection","features":[{"type":"Feature","properties":{},
+			"geometry":{"type":"Polygon","coordinates":[[[9.0,45.0],[9.1,45.0],[9.1,45.1],[9.0,45.1]]]}}]}`,
+			"features[0].geometry.coordinates[0]"},
+		{"latitude out of range", `{"type":"FeatureCollection","features":[{"type":"Feature","properties":{},
+			"geometry":{"type":"MultiPolygon","coordinates":[[[[9.0,45.0],[9.1,45.0],[9.1,95.1],[9.0,45.0]]]]}}]}`,
+			"features[0].geometry.coordinates[0][0][2]"},
+		{"unknown geometry", `{"type":"FeatureCollection","features":[{"type":"Feature","properties":{},
+			"geometry":{"type":"Circle","coordinates":[9.0,45.0]}}]}`, ""},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			fc, err := ParseFeatureCollection([]byte(tc.input))
+			valid := tc.name == "valid isochrone"
+			if (err == nil) != valid {
+				t.Fatalf("ParseFeatureCollection() error = %v, wantValid = %v", err, valid)
+			}
+			if valid {
+				ring := fc.Features[0].Geometry.Polygon[0]
+				if ringArea(ring) <= 0 {
+					t.Error("Expected the exterior ring to be rewound counterclockwise")
+				}
+				return
+			}
+
+			var validationErr *ValidationError
+			if !errors.As(err, &validationErr) {
+				t.Fatalf("Expected a ValidationError, got %T", err)
+			}
+			if tc.expectPath != "" && validationErr.Path != tc.expectPath {
+				t.Errorf("Expected error at %q, got %q", tc.expectPath, validationErr.Path)
+			}
+		})
+	}
+}
+
+// testCircle returns a closed counterclockwise ring of n vertices around a centre
+func testCircle(lon, lat, radius float64, n int) []Position {
+	ring := make([]Position, 0, n+1)
+	for i := 0; i < n; i++ {
+		angle := 2 * math.Pi * float64(i) / float64(n)
+		ring = append(ring, Position{lon + radius*math.Cos(angle), lat + radius*math.Sin(angle)})
+	}
+	return append(ring, Position{ring[0][0], ring[0][1]})
+}
+
+func TestFeatureCollection_Simplify(t *testing.T) {
+	for _, algorithm := range []SimplifyAlgorithm{AlgorithmDouglasPeucker, AlgorithmVisvalingam} {
+		t.Run(string(algorithm), func(t *testing.T) {
+			// The hole nearly touches the exterior ring, so a coarse outline would cross it
+			exterior := testCircle(9.0, 45.0, 0.02, 720)
+			hole := testCircle(9.0185, 45.0, 0.001, 90)
+			reverseRing(hole)
+			fc := &FeatureCollection{Type: TypeFeatureCollection, Features: []*Feature{{
+				Type:     TypeFeature,
+				Geometry: &Geometry{Type: TypePolygon, Polygon: [][]Position{exterior, hole}},
+			}}}
+
+			fc.Simplify(SimplifyOptions{Tolerance: 50, Algorithm: algorithm, Precision: 5})
+
+			polygon := fc.Features[0].Geometry.Polygon
+			if len(polygon[0]) >= len(exterior) || len(polygon[0]) < 4 {
+				t.Errorf("Expected the exterior ring to be simplified, got %d of %d positions", len(polygon[0]), len(exterior))
+			}
+			if err := fc.Validate(); err != nil {
+				t.Fatalf("Simplified collection is not valid: %v", err)
+			}
+			for i, ring := range polygon {
+				if ringSelfIntersects(ring) {
+					t.Errorf("Ring %d intersects itself", i)
+				}
+			}
+			if ringsIntersect(polygon[0], polygon[1]) {
+				t.Error("Expected the exterior ring not to cross the hole")
+			}
+			if ringArea(polygon[0]) <= 0 || ringArea(polygon[1]) >= 0 {
+				t.Error("Expected ring orientation to be preserved")
+			}
+			for _, position := range polygon[0] {
+				if rounded := math.Round(position.Lon()*1e5) / 1e5; rounded != position.Lon() {
+					t.Fatalf("Expected coordinates rounded to 5 digits, got %v", position.Lon())
+				}
+			}
+		})
+	}
+}
+
+func TestSimplifyOptions_Validate(t *testing.T) {
+	tests := []struct {
+		opts    SimplifyOptions
+		enabled bool
+		valid   bool
+	}{
+		{SimplifyOptions{}, false, true},
+		{SimplifyOptions{Tolerance: 10}, true, true},
+		{SimplifyOptions{Precision: 6, Algorithm: AlgorithmVisvalingam}, true, true},
+		{SimplifyOptions{Tolerance: -1}, false, false},
+		{SimplifyOptions{Precision: MaxPrecision + 1}, true, false},
+		{SimplifyOptions{Tolerance: 10, Algorithm: "topojson"}, true, false},
+	}
+
+	for _, tc := range tests {
+		if err := tc.opts.Validate(); (err == nil) != tc.valid {
+			t.Errorf("%+v.Validate() error = %v, wantValid %v", tc.opts, err, tc.valid)
+		}
+		if tc.opts.Enabled() != tc.enabled {
+			t.Errorf("%+v.Enabled() = %v, want %v", tc.opts, tc.opts.Enabled(), tc.enabled)
+		}
+	}
+}
+
+func TestMerge(t *testing.T) {
+	first, err := ParseFeatureCollection([]byte(testFeatureCollection))
+	if err != nil {
+		t.Fatalf("ParseFeatureCollection failed: %v", err)
+	}
+	enrich(first, csvparser.Location{Name: "STA", City: "A", Latitude: 45.05, Longitude: 9.05}, Metadata{Range: 600})
+	first.Metadata = &Metadata{Range: 600}
+
+	// Files written before station properties were recorded have no properties at all
+	second, err := ParseFeatureCollection([]byte(testFeatureCollection))
+	if err != nil {
+		t.Fatalf("ParseFeatureCollection failed: %v", err)
+	}
+	second.Features[0].Properties = nil
+
+	merged := Merge([]string{"STA-a-600", "STB-b-600"}, []*FeatureCollection{first, second})
+
+	if err := merged.Validate(); err != nil {
+		t.Fatalf("Merged collection is not valid: %v", err)
+	}
+	if merged.Metadata != nil {
+		t.Error("Expected the metadata of single files to be dropped")
+	}
+	if len(merged.Features) != 3 {
+		t.Fatalf("Expected 3 features, got %d", len(merged.Features))
+	}
+
+	sources := []string{"STA-a-600", "STA-a-600", "STB-b-600"}
+	for i, feature := range merged.Features {
+		if feature.Properties[PropertySource] != sources[i] {
+			t.Errorf("Feature %d source = %v, want %s", i, feature.Properties[PropertySource], sources[i])
+		}
+	}
+	if merged.Features[1].Properties[PropertyStation] != "STA" {
+		t.Errorf("Expected station properties to be kept, got %v", merged.Features[1].Properties)
+	}
+
+	if empty := Merge(nil, nil); empty.Features == nil || empty.Type != TypeFeatureCollection {
+		t.Errorf("Expected an empty FeatureCollection, got %+v", empty)
+	}
+}
+
+func TestExport(t *testing.T) {
+	fc, err := ParseFeatureCollection([]byte(testFeatureCollection))
+	if err != nil {
+		t.Fatalf("ParseFeatureCollection failed: %v", err)
+	}
+	enrich(fc, csvparser.Location{Name: "STA", City: "Città & co", Latitude: 45.05, Longitude: 9.05}, Metadata{Range: 600})
+	merged := Merge([]string{"STA-a-600"}, []*FeatureCollection{fc})
+
+	for _, format := range ExportFormats() {
+		var buf bytes.Buffer
+		if err := Export(&buf, format, merged); err != nil {
+			t.Fatalf("Export %s failed: %v", format, err)
+		}
+		data := buf.Bytes()
+
+		switch format {
+		case FormatKML, FormatGPX:
+			decoder := xml.NewDecoder(bytes.NewReader(data))
+			for {
+				if _, err := decoder.Token(); err == io.EOF {
+					break
+				} else if err != nil {
+					t.Fatalf("%s output is not well-formed XML: %v", format, err)
+				}
+			}
+			if !strings.Contains(buf.String(), "Città &amp; co") {
+				t.Errorf("Expected the escaped city in the %s output", format)
+			}
+		case FormatKMZ, FormatShapefile:
+			archive, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+			if err != nil {
+				t.Fatalf("%s output is not a zip archive: %v", format, err)
+			}
+			var names []string
+			for _, file := range archive.File {
+				names = append(names, file.Name)
+			}
+			want := "doc.kml"
+			if format == FormatShapefile {
+				want = "isochrones.dbf isochrones.prj isochrones.cpg isochrones.shp isochrones.shx stations.dbf"
+			}
+			for _, name := range strings.Fields(want) {
+				if !strings.Contains(strings.Join(names, " "), name) {
+					t.Errorf("Expected %s in the %s archive, got %v", name, format, names)
+				}
+			}
+		case FormatGeoPackage:
+			if !bytes.HasPrefix(data, []byte("SQLite format 3\x00")) {
+				t.Fatal("Expected an SQLite database")
+			}
+			if len(data)%4096 != 0 || int(binary.BigEndian.Uint32(data[28:32]))*4096 != len(data) {
+				t.Errorf("Database size %d does not match the page count in the header", len(data))
+			}
+			if id := binary.BigEndian.Uint32(data[68:72]); id != gpkgApplicationID {
+				t.Errorf("Application id = %#x, want GPKG", id)
+			}
+		}
+	}
+}
+
+func TestExportLayers_StationsOnce(t *testing.T) {
+	location := csvparser.Location{Name: "STA", City: "City", Latitude: 45.05, Longitude: 9.05}
+	var collections []*FeatureCollection
+	for _, rangeValue := range []int{600, 720} {
+		fc, err := ParseFeatureCollection([]byte(testFeatureCollection))
+		if err != nil {
+			t.Fatalf("ParseFeatureCollection failed: %v", err)
+		}
+		enrich(fc, location, Metadata{Range: rangeValue})
+		collections = append(collections, fc)
+	}
+	merged := Merge([]string{"STA-city-600", "STA-city-720"}, collections)
+
+	layers := exportLayers(merged)
+	if len(layers[1].features) != 1 {
+		t.Errorf("Expected the station once in the stations layer, got %d points", len(layers[1].features))
+	}
+	if len(layers[0].features) < 2 {
+		t.Errorf("Expected the isochrones of both ranges, got %d", len(layers[0].features))
+	}
+}
+
+func TestShapefile_Layout(t *testing.T) {
+	fc, err := ParseFeatureCollection([]byte(testFeatureCollection))
+	if err != nil {
+		t.Fatalf("ParseFeatureCollection failed: %v", err)
+	}
+	layers := exportLayers(fc)
+	shp, shx := encodeShapes(layers[0])
+
+	if code := binary.BigEndian.Uint32(shp[0:4]); code != 9994 {
+		t.Errorf("File code = %d, want 9994", code)
+	}
+	if length := int(binary.BigEndian.Uint32(shp[24:28])) * 2; length != len(shp) {
+		t.Errorf("Header length %d, file has %d bytes", length, len(shp))
+	}
+	if length := int(binary.BigEndian.Uint32(shx[24:28])) * 2; length != len(shx) || len(shx) != 100+8*len(layers[0].features) {
+		t.Errorf("Index length %d, file has %d bytes", length, len(shx))
+	}
+}
+
+func TestAppendSQLiteVarint(t *testing.T) {
+	tests := []struct {
+		value uint64
+		want  []byte
+	}{
+		{0, []byte{0x00}},
+		{127, []byte{0x7f}},
+		{128, []byte{0x81, 0x00}},
+		{16383, []byte{0xff, 0x7f}},
+		{16384, []byte{0x81, 0x80, 0x00}},
+		{math.MaxUint64, []byte{0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff}},
+	}
+	for _, tc := range tests {
+		if got := appendSQLiteVarint(nil, tc.value); !bytes.Equal(got, tc.want) {
+			t.Errorf("appendSQLiteVarint(%d) = %x, want %x", tc.value, got, tc.want)
+		}
+	}
+
+	// Integers use the smallest serial type holding them
+	record := sqliteRecord([]interface{}{nil, int64(0), int64(1), int64(300), 1.5, "ab"})
+	if want := []byte{7, 0, 8, 9, 2, 7, 17, 0x01, 0x2c, 0x3f, 0xf8, 0, 0, 0, 0, 0, 0, 'a', 'b'}; !bytes.Equal(record, want) {
+		t.Errorf("sqliteRecord = %x, want %x", record, want)
+	}
+}
+
+func TestManager_QuarantinesInvalidPayload(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"error":"quota exceeded"}`))
+	}))
+	defer server.Close()
+
+	manager := newTestManager(t, server.URL, WithRateLimit(0))
+	location := testLocations(1)[0]
+
+	if err := manager.FetchAndSaveGeoJSON(location, 600); err == nil {
+		t.Fatal("Expected an error for an invalid payload")
+	}
+
+	if _, err := os.Stat(filepath.Join(manager.outputDir, FileName(location, 600))); !os.IsNotExist(err) {
+		t.Error("Expected no GeoJSON file to be written for an invalid payload")
+	}
+	if _, err := os.Stat(filepath.Join(manager.outputDir, QuarantineDir, FileName(location, 600))); err != nil {
+		t.Errorf("Expected the payload to be quarantined: %v", err)
+	}
+}
+
+// panicProvider is a provider with a bug
+type panicProvider struct{}
+
+func (panicProvider) Name() string                     { return "panic" }
+func (panicProvider) Fingerprint() string              { return "panic" }
+func (panicProvider) Supports(Mode, IsolineType) error { return nil }
+func (panicProvider) Isochrone(context.Context, Fetcher, IsochroneRequest) ([]byte, error) {
+	panic("nil map")
+}
+
+func TestManager_RecoversProviderPanic(t *testing.T) {
+	manager := newTestManager(t, "http://isoline.invalid", WithProvider(panicProvider{}), WithRateLimit(0))
+
+	errs := manager.ProcessLocations(testLocations(2), 600)
+	if len(errs) != 2 || !strings.Contains(errs[0].Error(), "panic: nil map") {
+		t.Errorf("Expected the panics to be reported as errors, got %v", errs)
+	}
+}
+
+func TestManager_EnrichesFeatures(t *testing.T) {
+	doer := &recordingDoer{}
+	manager := newTestManager(t, "http://isoline.invalid", WithHTTPClient(doer), WithRateLimit(0))
+	location := csvparser.Location{Name: "APMPAD", City: "PADERNO DUGNANO", Latitude: 45.5752, Longitude: 9.15325}
+
+	if err := manager.FetchAndSaveGeoJSON(location, 600); err != nil {
+		t.Fatalf("FetchAndSaveGeoJSON failed: %v", err)
+	}
+
+	content, err := os.ReadFile(filepath.Join(manager.outputDir, FileName(location, 600)))
+	if err != nil {
+		t.Fatalf("Failed to read output file: %v", err)
+	}
+	fc, err := ParseFeatureCollection(content)
+	if err != nil {
+		t.Fatalf("Saved file is not valid: %v", err)
+	}
+
+	if len(fc.Features) != 2 {
+		t.Fatalf("Expected an isochrone and a station feature, got %d features", len(fc.Features))
+	}
+
+	isochrone, station := fc.Features[0], fc.Features[1]
+	if isochrone.Properties[PropertyFeatureType] != FeatureTypeIsochrone {
+		t.Errorf("Expected first feature to be the isochrone, got %v", isochrone.Properties[PropertyFeatureType])
+	}
+	if station.Properties[PropertyFeatureType] != FeatureTypeStation || station.Geometry.Type != TypePoint {
+		t.Errorf("Expected second feature to be the station point, got %v", station.Properties)
+	}
+	if station.Geometry.Point.Lon() != location.Longitude || station.Geometry.Point.Lat() != location.Latitude {
+		t.Errorf("Station point = %v, want [%v %v]", station.Geometry.Point, location.Longitude, location.Latitude)
+	}
+
+	for _, feature := range fc.Features {
+		properties := feature.Properties
+		if properties[PropertyStation] != "APMPAD" || properties[PropertyCity] != "PADERNO DUGNANO" {
+			t.Errorf("Unexpected station properties %v", properties)
+		}
+		if properties[PropertyRange] != 600.0 || properties[PropertyMode] != "drive" || properties[PropertyType] != "time" {
+			t.Errorf("Unexpected fetch properties %v", properties)
+		}
+		if properties[PropertyLatitude] != location.Latitude || properties[PropertyFetchedAt] == "" {
+			t.Errorf("Unexpected location properties %v", properties)
+		}
+	}
+}
+
+func TestManager_IncrementalRegeneration(t *testing.T) {
+	doer := &recordingDoer{}
+	var skipped int32
+	manager := newTestManager(t, "http://isoline.invalid", WithHTTPClient(doer), WithRateLimit(0),
+		WithProgress(func(p Progress) {
+			if p.Skipped {
+				atomic.AddInt32(&skipped, 1)
+			}
+		}))
+	locations := testLocations(3)
+
+	if errs := manager.ProcessLocations(locations, 600); len(errs) != 0 {
+		t.Fatalf("ProcessLocations failed: %v", errs)
+	}
+	if len(doer.requests) != 3 {
+		t.Fatalf("Expected 3 requests on the first run, got %d", len(doer.requests))
+	}
+
+	// Nothing changed: every isochrone is up to date
+	manager.ProcessLocations(locations, 600)
+	if len(doer.requests) != 3 || skipped != 3 {
+		t.Errorf("Expected no new requests and 3 skipped, got %d requests and %d skipped", len(doer.requests), skipped)
+	}
+
+	// Moving a station and adding a range only refetches what changed
+	locations[1].Latitude += 0.01
+	manager.ProcessLocations(locations, 600, 900)
+	if len(doer.requests) != 3+1+3 {
+		t.Errorf("Expected 4 new requests, got %d", len(doer.requests)-3)
+	}
+
+	// A file deleted by hand is refetched even though the manifest knows it
+	os.Remove(filepath.Join(manager.outputDir, FileName(locations[0], 600)))
+	manager.ProcessLocations(locations, 600)
+	if len(doer.requests) != 8 {
+		t.Errorf("Expected the deleted file to be refetched, got %d requests", len(doer.requests))
+	}
+
+	// Force refetches everything
+	WithForce(true)(manager)
+	manager.ProcessLocations(locations, 600)
+	if len(doer.requests) != 11 {
+		t.Errorf("Expected 3 forced requests, got %d", len(doer.requests)-8)
+	}
+}
+
+func TestManager_Prune(t *testing.T) {
+	doer := &recordingDoer{}
+	manager := newTestManager(t, "http://isoline.invalid", WithHTTPClient(doer), WithRateLimit(0))
+	locations := testLocations(3)
+
+	if errs := manager.ProcessLocations(locations, 600, 900); len(errs) != 0 {
+		t.Fatalf("ProcessLocations failed: %v", errs)
+	}
+
+	removed, err := manager.Prune(locations[:2])
+	if err != nil {
+		t.Fatalf("Prune failed: %v", err)
+	}
+	if len(removed) != 2 {
+		t.Errorf("Expected 2 files removed, got %v", removed)
+	}
+
+	names, _ := ListFiles(manager.outputDir, 0)
+	if len(names) != 4 {
+		t.Errorf("Expected 4 files left, got %v", names)
+	}
+
+	manifest, err := LoadManifest(manager.outputDir)
+	if err != nil {
+		t.Fatalf("LoadManifest failed: %v", err)
+	}
+	if len(manifest.Entries) != 4 {
+		t.Errorf("Expected 4 manifest entries left, got %d", len(manifest.Entries))
+	}
+}
+
+func TestWriteFileAtomic(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "station.json")
+
+	if err := writeFileAtomic(path, []byte("old"), 0644); err != nil {
+		t.Fatalf("writeFileAtomic failed: %v", err)
+	}
+	if err := writeFileAtomic(path, []byte("new"), 0644); err != nil {
+		t.Fatalf("writeFileAtomic failed: %v", err)
+	}
+
+	content, err := os.ReadFile(path)
+	if err != nil || string(content) != "new" {
+		t.Errorf("Expected new content, got %q, %v", content, err)
+	}
+
+	entries, _ := os.ReadDir(dir)
+	if len(entries) != 1 {
+		t.Errorf("Expected no temporary files left, got %d entries", len(entries))
+	}
+}
+
+func TestStaging(t *testing.T) {
+	target := filepath.Join(t.TempDir(), "geojson")
+	if err := os.MkdirAll(target, 0755); err != nil {
+		t.Fatalf("Failed to create target: %v", err)
+	}
+	os.WriteFile(filepath.Join(target, "kept.json"), []byte("kept"), 0644)
+	os.WriteFile(filepath.Join(target, "replaced.json"), []byte("old"), 0644)
+
+	staging, err := NewStaging(target)
+	if err != nil {
+		t.Fatalf("NewStaging failed: %v", err)
+	}
+
+	if err := writeFileAtomic(filepath.Join(staging.Dir(), "replaced.json"), []byte("new"), 0644); err != nil {
+		t.Fatalf("writeFileAtomic failed: %v", err)
+	}
+
+	// The live directory is untouched until commit
+	if content, _ := os.ReadFile(filepath.Join(target, "replaced.json")); string(content) != "old" {
+		t.Errorf("Expected live file to be unchanged before commit, got %q", content)
+	}
+
+	if err := staging.Commit(); err != nil {
+		t.Fatalf("Commit failed: %v", err)
+	}
+
+	for name, expected := range map[string]string{"kept.json": "kept", "replaced.json": "new"} {
+		if content, _ := os.ReadFile(filepath.Join(target, name)); string(content) != expected {
+			t.Errorf("Expected %s to contain %q, got %q", name, expected, content)
+		}
+	}
+
+	entries, _ := os.ReadDir(filepath.Dir(target))
+	if len(entries) != 1 {
+		t.Errorf("Expected only the output directory to remain, got %d entries", len(entries))
+	}
+}
+
+func TestProviders(t *testing.T) {
+	var lastBody []byte
+	var calls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lastBody, _ = io.ReadAll(r.Body)
+
+		// Fail the first call of every provider to exercise body replay on retry
+		if atomic.AddInt32(&calls, 1)%2 == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+
+		switch r.URL.Path {
+		case "/ors/v2/isochrones/cycling-regular":
+			if r.Header.Get("Authorization") != "ors-key" {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			w.Write([]byte(testFeatureCollection))
+		case "/valhalla/isochrone":
+			w.Write([]byte(testFeatureCollection))
+		case "/gh/isochrone":
+			if r.URL.Query().Get("profile") != "bike" || r.URL.Query().Get("time_limit") != "600" {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			var fc struct {
+				Features []json.RawMessage `json:"features"`
+			}
+			json.Unmarshal([]byte(testFeatureCollection), &fc)
+			json.NewEncoder(w).Encode(map[string]interface{}{"polygons": fc.Features})
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		provider   IsochroneProvider
+		expectBody string
+	}{
+		{NewOpenRouteServiceProvider(server.URL+"/ors/", "ors-key"), `"range_type":"time"`},
+		{NewValhallaProvider(server.URL + "/valhalla"), `"costing":"bicycle"`},
+		{NewGraphHopperProvider(server.URL+"/gh", ""), ``},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.provider.Name(), func(t *testing.T) {
+			fastRetry := RetryPolicy{MaxAttempts: 2, BaseDelay: time.Millisecond}
+			manager := newTestManager(t, server.URL, WithProvider(tc.provider), WithRateLimit(0),
+				WithRetryPolicy(fastRetry), WithMode(ModeBicycle))
+			location := testLocations(1)[0]
+
+			if err := manager.FetchAndSaveGeoJSON(location, 600); err != nil {
+				t.Fatalf("FetchAndSaveGeoJSON failed: %v", err)
+			}
+			if !strings.Contains(string(lastBody), tc.expectBody) {
+				t.Errorf("Expected request body to contain %s, got %s", tc.expectBody, lastBody)
+			}
+
+			content, err := os.ReadFile(filepath.Join(manager.outputDir, FileName(location, 600)))
+			if err != nil {
+				t.Fatalf("Failed to read output file: %v", err)
+			}
+			fc, err := ParseFeatureCollection(content)
+			if err != nil {
+				t.Fatalf("Saved file is not valid: %v", err)
+			}
+			if fc.Metadata.Provider != tc.provider.Name() {
+				t.Errorf("Expected provider %s in metadata, got %s", tc.provider.Name(), fc.Metadata.Provider)
+			}
+		})
+	}
+}
+
+func TestNewProvider(t *testing.T) {
+	secretsManager := secrets.NewManager()
+
+	if _, err := NewProvider(ProviderGeoapify, secretsManager); err == nil {
+		t.Error("Expected an error for Geoapify without API key")
+	}
+	for _, name := range []string{ProviderOpenRouteService, ProviderValhalla, ProviderGraphHopper} {
+		provider, err := NewProvider(name, secretsManager)
+		if err != nil || provider.Name() != name {
+			t.Errorf("NewProvider(%s) = %v, %v", name, provider, err)
+		}
+	}
+	if _, err := NewProvider("unknown", secretsManager); err == nil {
+		t.Error("Expected an error for an unknown provider")
+	}
+
+	if err := NewOpenRouteServiceProvider("", "").Supports(ModeApproximatedTransit, TypeTime); err == nil {
+		t.Error("Expected OpenRouteService to reject approximated transit")
+	}
+}
+
+// testRoadNetwork is a straight 30 km/h road along latitude 45 from 9.0 to 9.2 E,
+// crossed at 9.1 E by a oneway motorway heading north
+const testRoadNetwork = `{"type":"FeatureCollection","features":[
+	{"type":"Feature","properties":{"highway":"residential"},
+	 "geometry":{"type":"LineString","coordinates":[[9.0,45.0],[9.05,45.0],[9.1,45.0],[9.15,45.0],[9.2,45.0]]}},
+	{"type":"Feature","properties":{"highway":"motorway","maxspeed":"130"},
+	 "geometry":{"type":"LineString","coordinates":[[9.1,44.9],[9.1,45.0],[9.1,45.1]]}},
+	{"type":"Feature","properties":{"name":"not a road"},
+	 "geometry":{"type":"LineString","coordinates":[[8.0,44.0],[8.1,44.0]]}}]}`
+
+func TestOfflineProvider(t *testing.T) {
+	tempDir := chdirTemp(t)
+	graphPath := filepath.Join(tempDir, "roads.geojson")
+	if err := os.WriteFile(graphPath, []byte(testRoadNetwork), 0644); err != nil {
+		t.Fatalf("Failed to write road network: %v", err)
+	}
+
+	// Without a Geoapify key the offline provider is selected from the graph path alone
+	secretsManager := secrets.NewManager()
+	secretsManager.Set("OFFLINE_ROAD_GRAPH", graphPath)
+	if name := DefaultProviderName(secretsManager); name != ProviderOffline {
+		t.Fatalf("Expected default provider %s, got %s", ProviderOffline, name)
+	}
+
+	manager, err := NewManager(secretsManager)
+	if err != nil {
+		t.Fatalf("NewManager failed: %v", err)
+	}
+	location := csvparser.Location{Name: "OFF", City: "TEST CITY", Latitude: 45.0, Longitude: 9.1}
+
+	bounds := func(rangeValue int) (minLon, minLat, maxLon, maxLat float64) {
+		t.Helper()
+		if err := manager.FetchAndSaveGeoJSON(location, rangeValue); err != nil {
+			t.Fatalf("FetchAndSaveGeoJSON failed: %v", err)
+		}
+		content, err := os.ReadFile(filepath.Join(manager.outputDir, FileName(location, rangeValue)))
+		if err != nil {
+			t.Fatalf("Failed to read output file: %v", err)
+		}
+		fc, err := ParseFeatureCollection(content)
+		if err != nil {
+			t.Fatalf("Saved file is not valid: %v", err)
+		}
+
+		minLon, minLat, maxLon, maxLat = 180, 90, -180, -90
+		for _, polygon := range fc.Features[0].Geometry.Polygons() {
+			for _, p := range polygon[0] {
+				minLon, maxLon = min(minLon, p.Lon()), max(maxLon, p.Lon())
+				minLat, maxLat = min(minLat, p.Lat()), max(maxLat, p.Lat())
+			}
+		}
+		return minLon, minLat, maxLon, maxLat
+	}
+
+	// 10 minutes at 30 km/h cover 5 km, about 0.064 degrees of longitude, plus the 200 m buffer
+	minLon, _, maxLon, _ := bounds(600)
+	if maxLon < 9.16 || maxLon > 9.175 || minLon > 9.04 || minLon < 9.025 {
+		t.Errorf("Unexpected residential reach %f..%f", minLon, maxLon)
+	}
+
+	// 5 minutes at 130 km/h cover almost 11 km of motorway, but only northwards
+	_, minLat, _, maxLat := bounds(300)
+	if maxLat < 45.09 || minLat < 44.995 {
+		t.Errorf("Unexpected motorway reach %f..%f", minLat, maxLat)
+	}
+
+	far := csvparser.Location{Name: "FAR", City: "TEST CITY", Latitude: 46, Longitude: 10}
+	if err := manager.FetchAndSaveGeoJSON(far, 600); err == nil {
+		t.Error("Expected an error for a station far from any road")
+	}
+
+	if err := manager.provider.Supports(ModeApproximatedTransit, TypeTime); err == nil {
+		t.Error("Expected the offline provider to reject approximated transit")
+	}
+}
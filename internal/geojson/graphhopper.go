@@ -0,0 +1,100 @@
+package geojson
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// DefaultGraphHopperURL is the address a self-hosted GraphHopper instance listens on by default
+const DefaultGraphHopperURL = "http://localhost:8989"
+
+// GraphHopperProvider computes isochrones with the GraphHopper isochrone API
+type GraphHopperProvider struct {
+	baseURL string
+	apiKey  string
+}
+
+// NewGraphHopperProvider creates a GraphHopper provider. The API key may be empty for
+// self-hosted instances.
+func NewGraphHopperProvider(baseURL, apiKey string) *GraphHopperProvider {
+	return &GraphHopperProvider{baseURL: strings.TrimRight(baseURL, "/"), apiKey: apiKey}
+}
+
+// Name returns the provider name
+func (p *GraphHopperProvider) Name() string {
+	return ProviderGraphHopper
+}
+
+// Fingerprint returns the provider name and endpoint
+func (p *GraphHopperProvider) Fingerprint() string {
+	return ProviderGraphHopper + " " + p.baseURL
+}
+
+// profile maps a travel mode to a GraphHopper profile
+func (p *GraphHopperProvider) profile(mode Mode) (string, error) {
+	switch mode {
+	case ModeDrive:
+		return "car", nil
+	case ModeTruck:
+		return "truck", nil
+	case ModeWalk:
+		return "foot", nil
+	case ModeBicycle:
+		return "bike", nil
+	}
+	return "", unsupportedModeError(ProviderGraphHopper, mode)
+}
+
+// Supports checks that the mode maps to a GraphHopper profile
+func (p *GraphHopperProvider) Supports(mode Mode, isolineType IsolineType) error {
+	_, err := p.profile(mode)
+	return err
+}
+
+// Isochrone fetches the isochrone and wraps the returned polygons into a FeatureCollection
+func (p *GraphHopperProvider) Isochrone(ctx context.Context, fetcher Fetcher, req IsochroneRequest) ([]byte, error) {
+	profile, err := p.profile(req.Mode)
+	if err != nil {
+		return nil, err
+	}
+
+	query := url.Values{}
+	query.Set("point", fmt.Sprintf("%f,%f", req.Latitude, req.Longitude))
+	query.Set("profile", profile)
+	if req.Type == TypeDistance {
+		query.Set("distance_limit", fmt.Sprintf("%d", req.Range))
+	} else {
+		query.Set("time_limit", fmt.Sprintf("%d", req.Range))
+	}
+	if p.apiKey != "" {
+		query.Set("key", p.apiKey)
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodGet, p.baseURL+"/isochrone?"+query.Encode(), nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	body, err := fetcher.Fetch(httpReq)
+	if err != nil {
+		return nil, err
+	}
+
+	// GraphHopper returns {"polygons": [Feature, ...]} rather than a FeatureCollection.
+	// Unexpected payloads are passed through so the Manager quarantines them.
+	var response struct {
+		Polygons []json.RawMessage `json:"polygons"`
+	}
+	if err := json.Unmarshal(body, &response); err != nil || response.Polygons == nil {
+		return body, nil
+	}
+
+	return json.Marshal(map[string]interface{}{
+		"type":     TypeFeatureCollection,
+		"features": response.Polygons,
+	})
+}
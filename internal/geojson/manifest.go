@@ -0,0 +1,184 @@
+package geojson
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"logreason/internal/csvparser"
+)
+
+// ManifestFileName is the name of the manifest file kept in the output directory.
+// It is hidden so that it is not listed as an isochrone by ListFiles.
+const ManifestFileName = ".manifest.json"
+
+// ManifestEntry records the request an isochrone file was generated from
+type ManifestEntry struct {
+	Station   string      `json:"station"`
+	City      string      `json:"city,omitempty"`
+	Latitude  float64     `json:"latitude"`
+	Longitude float64     `json:"longitude"`
+	Range     int         `json:"range"`
+	Provider  string      `json:"provider"`
+	Mode      Mode        `json:"mode"`
+	Type      IsolineType `json:"type"`
+	Hash      string      `json:"hash"`
+	FetchedAt time.Time   `json:"fetched_at"`
+}
+
+// Manifest maps the isochrone file names of an output directory to the request they were generated from
+type Manifest struct {
+	mu      sync.Mutex
+	Entries map[string]ManifestEntry `json:"entries"`
+}
+
+// LoadManifest reads the manifest of an output directory. A missing manifest yields an empty one.
+func LoadManifest(dir string) (*Manifest, error) {
+	manifest := &Manifest{Entries: make(map[string]ManifestEntry)}
+
+	data, err := os.ReadFile(filepath.Join(dir, ManifestFileName))
+	if os.IsNotExist(err) {
+		return manifest, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read manifest: %w", err)
+	}
+
+	if err := json.Unmarshal(data, manifest); err != nil {
+		return nil, fmt.Errorf("failed to parse manifest: %w", err)
+	}
+	if manifest.Entries == nil {
+		manifest.Entries = make(map[string]ManifestEntry)
+	}
+
+	return manifest, nil
+}
+
+// Save writes the manifest to the output directory
+func (mf *Manifest) Save(dir string) error {
+	mf.mu.Lock()
+	defer mf.mu.Unlock()
+
+	data, err := json.MarshalIndent(mf, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal manifest: %w", err)
+	}
+
+	if err := writeFileAtomic(filepath.Join(dir, ManifestFileName), data, 0644); err != nil {
+		return fmt.Errorf("failed to write manifest: %w", err)
+	}
+	return nil
+}
+
+// Get returns the entry recorded for a file name
+func (mf *Manifest) Get(name string) (ManifestEntry, bool) {
+	mf.mu.Lock()
+	defer mf.mu.Unlock()
+
+	entry, exists := mf.Entries[name]
+	return entry, exists
+}
+
+// Set records the entry for a file name
+func (mf *Manifest) Set(name string, entry ManifestEntry) {
+	mf.mu.Lock()
+	defer mf.mu.Unlock()
+
+	mf.Entries[name] = entry
+}
+
+// Delete removes the entry for a file name
+func (mf *Manifest) Delete(name string) {
+	mf.mu.Lock()
+	defer mf.mu.Unlock()
+
+	delete(mf.Entries, name)
+}
+
+// WithForce makes ProcessLocations refetch every isochrone, even those the manifest reports as up to date
+func WithForce(force bool) Option {
+	return func(m *Manager) {
+		m.force = force
+	}
+}
+
+// manifestEntry describes the request the Manager issues for a location and range
+func (m *Manager) manifestEntry(location csvparser.Location, rangeValue int) ManifestEntry {
+	entry := ManifestEntry{
+		Station:   location.Name,
+		City:      location.City,
+		Latitude:  location.Latitude,
+		Longitude: location.Longitude,
+		Range:     rangeValue,
+		Provider:  m.provider.Name(),
+		Mode:      m.mode,
+		Type:      m.isolineType,
+	}
+
+	// Fingerprints never contain API keys, so they can safely be hashed into the manifest
+	hash := sha256.New()
+	fmt.Fprintf(hash, "%s\n%f\n%f\n%d\n%s\n%s", m.provider.Fingerprint(), location.Latitude, location.Longitude, rangeValue, m.mode, m.isolineType)
+	// Only hash simplification when enabled, so files saved before it existed stay up to date
+	if m.simplify.Enabled() {
+		fmt.Fprintf(hash, "\n%s\n%f\n%d", m.simplify.Algorithm, m.simplify.Tolerance, m.simplify.Precision)
+	}
+	entry.Hash = hex.EncodeToString(hash.Sum(nil))
+
+	return entry
+}
+
+// upToDate reports whether the file for a request exists and was generated with the same parameters
+func (m *Manager) upToDate(manifest *Manifest, name string, entry ManifestEntry) bool {
+	recorded, exists := manifest.Get(name)
+	if !exists || recorded.Hash != entry.Hash {
+		return false
+	}
+
+	_, err := os.Stat(filepath.Join(m.outputDir, name))
+	return err == nil
+}
+
+// Prune deletes the isochrone files of stations that are no longer in locations, together
+// with their manifest entries, and returns the names of the deleted files
+func (m *Manager) Prune(locations []csvparser.Location) ([]string, error) {
+	keep := make(map[string]bool, len(locations))
+	for _, location := range locations {
+		keep[StationFileName(location)] = true
+	}
+
+	manifest, err := LoadManifest(m.outputDir)
+	if err != nil {
+		return nil, err
+	}
+
+	names, err := ListFiles(m.outputDir, 0)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read output directory: %w", err)
+	}
+
+	var removed []string
+	for _, name := range names {
+		if station, _ := ParseFileName(name); keep[station] {
+			continue
+		}
+		if err := os.Remove(filepath.Join(m.outputDir, name)); err != nil {
+			return removed, fmt.Errorf("failed to remove %s: %w", name, err)
+		}
+		manifest.Delete(name)
+		removed = append(removed, name)
+	}
+
+	// Drop entries whose file was already deleted by hand
+	for name := range manifest.Entries {
+		if station, _ := ParseFileName(name); !keep[station] {
+			manifest.Delete(name)
+		}
+	}
+
+	return removed, manifest.Save(m.outputDir)
+}
@@ -0,0 +1,26 @@
+package geojson
+
+// PropertySource is the property naming the file a merged feature comes from,
+// e.g. APMPAD-padernoDugnano-600
+const PropertySource = "source"
+
+// Merge flattens collections into a single FeatureCollection, tagging every feature with the
+// source at the same index of sources. Foreign members of the collections, such as metadata,
+// are dropped since they describe a single file; the fetch parameters remain available in the
+// feature properties.
+func Merge(sources []string, collections []*FeatureCollection) *FeatureCollection {
+	merged := &FeatureCollection{Type: TypeFeatureCollection, Features: []*Feature{}}
+	for i, fc := range collections {
+		for _, feature := range fc.Features {
+			if feature == nil {
+				continue
+			}
+			if feature.Properties == nil {
+				feature.Properties = make(map[string]interface{})
+			}
+			feature.Properties[PropertySource] = sources[i]
+			merged.Features = append(merged.Features, feature)
+		}
+	}
+	return merged
+}
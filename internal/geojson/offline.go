@@ -0,0 +1,179 @@
+package geojson
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+
+	"logreason/internal/raster"
+	"logreason/internal/roadgraph"
+)
+
+// Defaults of the offline provider
+const (
+	// DefaultOfflineCellSize Default resolution in meters of the isochrone outline
+	DefaultOfflineCellSize = 100.0
+	// DefaultOfflineBuffer Default distance in meters the isochrone extends around reachable roads
+	DefaultOfflineBuffer = 200.0
+	// DefaultOfflineMaxSnap Default maximum distance in meters between a station and the nearest road
+	DefaultOfflineMaxSnap = 1000.0
+)
+
+// OfflineProvider approximates isochrones from a local road graph without any network access.
+// It runs a travel time or distance bounded Dijkstra search from the road node nearest to the
+// station, samples the reachable roads and outlines them with a raster concave hull: the
+// samples are buffered, enclosed gaps are filled and the resulting region is traced.
+type OfflineProvider struct {
+	fingerprint string
+	graph       *roadgraph.Graph
+	cellSize    float64
+	buffer      float64
+	maxSnap     float64
+}
+
+// NewOfflineProvider loads the road graph at path, a GeoJSON road network as described by
+// roadgraph.Load
+func NewOfflineProvider(path string) (*OfflineProvider, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open road graph: %w", err)
+	}
+
+	graph, err := roadgraph.Load(path)
+	if err != nil {
+		return nil, err
+	}
+
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		absPath = path
+	}
+
+	return &OfflineProvider{
+		fingerprint: fmt.Sprintf("%s %s %d %d", ProviderOffline, absPath, info.Size(), info.ModTime().Unix()),
+		graph:       graph,
+		cellSize:    DefaultOfflineCellSize,
+		buffer:      DefaultOfflineBuffer,
+		maxSnap:     DefaultOfflineMaxSnap,
+	}, nil
+}
+
+// Name returns the provider name
+func (p *OfflineProvider) Name() string {
+	return ProviderOffline
+}
+
+// Fingerprint returns the path, size and modification time of the road graph, so that
+// isochrones are regenerated when the graph is updated
+func (p *OfflineProvider) Fingerprint() string {
+	return p.fingerprint
+}
+
+// profile maps a travel mode to a road graph profile
+func (p *OfflineProvider) profile(mode Mode) (roadgraph.Profile, error) {
+	switch mode {
+	case ModeDrive:
+		return roadgraph.Car, nil
+	case ModeTruck:
+		return roadgraph.Truck, nil
+	case ModeWalk:
+		return roadgraph.Foot, nil
+	case ModeBicycle:
+		return roadgraph.Bicycle, nil
+	}
+	return roadgraph.Profile{}, unsupportedModeError(ProviderOffline, mode)
+}
+
+// Supports checks that the mode maps to a road graph profile; transit is not available offline
+func (p *OfflineProvider) Supports(mode Mode, isolineType IsolineType) error {
+	_, err := p.profile(mode)
+	return err
+}
+
+// Isochrone computes the isochrone locally; the fetcher is not used
+func (p *OfflineProvider) Isochrone(ctx context.Context, _ Fetcher, req IsochroneRequest) ([]byte, error) {
+	profile, err := p.profile(req.Mode)
+	if err != nil {
+		return nil, err
+	}
+
+	cost := roadgraph.CostFunc(profile.TravelTime)
+	if req.Type == TypeDistance {
+		cost = profile.TravelDistance
+	}
+
+	source, snap := p.graph.Nearest(req.Latitude, req.Longitude, cost)
+	if source < 0 || snap > p.maxSnap {
+		return nil, fmt.Errorf("no road within %.0f m of %f,%f", p.maxSnap, req.Latitude, req.Longitude)
+	}
+
+	// Reaching the road from the station costs the walk to the nearest node
+	initial := snap
+	if req.Type == TypeTime {
+		initial = snap / (profile.AccessSpeed / 3.6)
+	}
+
+	budget := float64(req.Range)
+	costs, err := p.graph.Reach(ctx, source, initial, budget, cost)
+	if err != nil {
+		return nil, err
+	}
+
+	points := p.graph.ReachablePoints(costs, budget, cost, p.cellSize/2)
+	points = append(points, [2]float64{req.Longitude, req.Latitude})
+
+	geometry := p.hull(points)
+	fc := FeatureCollection{
+		Type: TypeFeatureCollection,
+		Features: []*Feature{{
+			Type:       TypeFeature,
+			Geometry:   geometry,
+			Properties: map[string]interface{}{},
+		}},
+	}
+	return json.Marshal(fc)
+}
+
+// hull outlines the points buffered by the provider buffer distance
+func (p *OfflineProvider) hull(points [][2]float64) *Geometry {
+	minLon, minLat := math.Inf(1), math.Inf(1)
+	maxLon, maxLat := math.Inf(-1), math.Inf(-1)
+	for _, point := range points {
+		minLon, maxLon = math.Min(minLon, point[0]), math.Max(maxLon, point[0])
+		minLat, maxLat = math.Min(minLat, point[1]), math.Max(maxLat, point[1])
+	}
+
+	// Pad the grid so the buffer never touches its border
+	padLat := 2 * p.buffer / raster.MetersPerDegree
+	padLon := padLat / math.Cos((minLat+maxLat)/2*math.Pi/180)
+	grid := raster.NewGrid(minLon-padLon, minLat-padLat, maxLon+padLon, maxLat+padLat, p.cellSize)
+
+	for _, point := range points {
+		if col, row, ok := grid.Cell(point[0], point[1]); ok {
+			grid.Set(col, row, 1)
+		}
+	}
+	grid.Dilate(int(math.Ceil(p.buffer / p.cellSize)))
+	grid.FillHoles()
+
+	var polygons [][][]Position
+	for _, polygon := range grid.Polygons(func(value int32) bool { return value != 0 }) {
+		var rings [][]Position
+		for _, ring := range polygon {
+			positions := make([]Position, len(ring))
+			for i, point := range ring {
+				positions[i] = Position{point[0], point[1]}
+			}
+			rings = append(rings, positions)
+		}
+		polygons = append(polygons, rings)
+	}
+
+	if len(polygons) == 1 {
+		return &Geometry{Type: TypePolygon, Polygon: polygons[0]}
+	}
+	return &Geometry{Type: TypeMultiPolygon, MultiPolygon: polygons}
+}
@@ -0,0 +1,86 @@
+package geojson
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// DefaultOpenRouteServiceURL is the public OpenRouteService API; self-hosted instances
+// usually listen on http://localhost:8080/ors
+const DefaultOpenRouteServiceURL = "https://api.openrouteservice.org"
+
+// OpenRouteServiceProvider computes isochrones with the OpenRouteService isochrones API
+type OpenRouteServiceProvider struct {
+	baseURL string
+	apiKey  string
+}
+
+// NewOpenRouteServiceProvider creates an OpenRouteService provider. The API key may be
+// empty for self-hosted instances.
+func NewOpenRouteServiceProvider(baseURL, apiKey string) *OpenRouteServiceProvider {
+	return &OpenRouteServiceProvider{baseURL: strings.TrimRight(baseURL, "/"), apiKey: apiKey}
+}
+
+// Name returns the provider name
+func (p *OpenRouteServiceProvider) Name() string {
+	return ProviderOpenRouteService
+}
+
+// Fingerprint returns the provider name and endpoint
+func (p *OpenRouteServiceProvider) Fingerprint() string {
+	return ProviderOpenRouteService + " " + p.baseURL
+}
+
+// profile maps a travel mode to an OpenRouteService profile
+func (p *OpenRouteServiceProvider) profile(mode Mode) (string, error) {
+	switch mode {
+	case ModeDrive:
+		return "driving-car", nil
+	case ModeTruck:
+		return "driving-hgv", nil
+	case ModeWalk:
+		return "foot-walking", nil
+	case ModeBicycle:
+		return "cycling-regular", nil
+	}
+	return "", unsupportedModeError(ProviderOpenRouteService, mode)
+}
+
+// Supports checks that the mode maps to an OpenRouteService profile
+func (p *OpenRouteServiceProvider) Supports(mode Mode, isolineType IsolineType) error {
+	_, err := p.profile(mode)
+	return err
+}
+
+// Isochrone posts an isochrones request; OpenRouteService answers with a FeatureCollection
+func (p *OpenRouteServiceProvider) Isochrone(ctx context.Context, fetcher Fetcher, req IsochroneRequest) ([]byte, error) {
+	profile, err := p.profile(req.Mode)
+	if err != nil {
+		return nil, err
+	}
+
+	body, err := json.Marshal(map[string]interface{}{
+		"locations":  [][]float64{{req.Longitude, req.Latitude}},
+		"range":      []int{req.Range},
+		"range_type": string(req.Type),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal request: %w", err)
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, p.baseURL+"/v2/isochrones/"+profile, bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	httpReq.Header.Set("Accept", "application/geo+json")
+	if p.apiKey != "" {
+		httpReq.Header.Set("Authorization", p.apiKey)
+	}
+
+	return fetcher.Fetch(httpReq)
+}
@@ -0,0 +1,70 @@
+package geojson
+
+import (
+	"fmt"
+	"time"
+)
+
+// Mode is the travel mode used to compute isochrones
+type Mode string
+
+// Travel modes supported by the Geoapify isoline API
+const (
+	ModeDrive               Mode = "drive"
+	ModeTruck               Mode = "truck"
+	ModeWalk                Mode = "walk"
+	ModeBicycle             Mode = "bicycle"
+	ModeApproximatedTransit Mode = "approximated_transit"
+)
+
+// IsolineType selects whether the range is a travel time or a travel distance
+type IsolineType string
+
+// Isoline types supported by the Geoapify isoline API
+const (
+	// TypeTime interprets the range in seconds
+	TypeTime IsolineType = "time"
+	// TypeDistance interprets the range in meters
+	TypeDistance IsolineType = "distance"
+)
+
+// ParseMode converts a string into a Mode, rejecting unknown travel modes
+func ParseMode(s string) (Mode, error) {
+	switch mode := Mode(s); mode {
+	case ModeDrive, ModeTruck, ModeWalk, ModeBicycle, ModeApproximatedTransit:
+		return mode, nil
+	}
+	return "", fmt.Errorf("unknown travel mode %q", s)
+}
+
+// ParseIsolineType converts a string into an IsolineType, rejecting unknown types
+func ParseIsolineType(s string) (IsolineType, error) {
+	switch isolineType := IsolineType(s); isolineType {
+	case TypeTime, TypeDistance:
+		return isolineType, nil
+	}
+	return "", fmt.Errorf("unknown isoline type %q", s)
+}
+
+// WithMode sets the travel mode substituted for the {MODE} placeholder
+func WithMode(mode Mode) Option {
+	return func(m *Manager) {
+		m.mode = mode
+	}
+}
+
+// WithType sets the isoline type substituted for the {TYPE} placeholder
+func WithType(isolineType IsolineType) Option {
+	return func(m *Manager) {
+		m.isolineType = isolineType
+	}
+}
+
+// Metadata records the parameters an isochrone file was generated with
+type Metadata struct {
+	Provider  string      `json:"provider"`
+	Mode      Mode        `json:"mode"`
+	Type      IsolineType `json:"type"`
+	Range     int         `json:"range"`
+	FetchedAt time.Time   `json:"fetched_at"`
+}
@@ -0,0 +1,122 @@
+package geojson
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"logreason/internal/secrets"
+)
+
+// Names of the built-in isochrone providers
+const (
+	ProviderGeoapify         = "geoapify"
+	ProviderOpenRouteService = "openrouteservice"
+	ProviderValhalla         = "valhalla"
+	ProviderGraphHopper      = "graphhopper"
+	ProviderOffline          = "offline"
+)
+
+// IsochroneRequest describes one isochrone to compute
+type IsochroneRequest struct {
+	Latitude  float64
+	Longitude float64
+	Range     int
+	Mode      Mode
+	Type      IsolineType
+}
+
+// Fetcher performs HTTP requests on behalf of a provider, applying the Manager rate limit
+// and retry policy. It returns the body of a 200 OK response, or a *StatusError.
+// Requests with a body must be replayable through GetBody, as http.NewRequest sets up
+// for bytes and strings readers.
+type Fetcher interface {
+	Fetch(req *http.Request) ([]byte, error)
+}
+
+// IsochroneProvider computes isochrones for the Manager
+type IsochroneProvider interface {
+	// Name identifies the provider in file metadata and the manifest
+	Name() string
+	// Fingerprint identifies the provider configuration, such as its endpoint.
+	// Isochrones generated with a different fingerprint are considered out of date.
+	Fingerprint() string
+	// Supports reports an error if the provider cannot compute isochrones for a mode and type
+	Supports(mode Mode, isolineType IsolineType) error
+	// Isochrone returns the isochrone as a GeoJSON FeatureCollection, which the Manager
+	// validates before saving
+	Isochrone(ctx context.Context, fetcher Fetcher, req IsochroneRequest) ([]byte, error)
+}
+
+// ProviderNames lists the providers accepted by NewProvider
+func ProviderNames() []string {
+	return []string{ProviderGeoapify, ProviderOpenRouteService, ProviderValhalla, ProviderGraphHopper, ProviderOffline}
+}
+
+// NewProvider creates a built-in provider by name, reading its configuration from the secrets manager:
+//   - geoapify: GEOAPIFY_API_KEY and GEOAPIFY_BASE_URL
+//   - openrouteservice: ORS_BASE_URL and, for the public API, ORS_API_KEY
+//   - valhalla: VALHALLA_BASE_URL
+//   - graphhopper: GRAPHHOPPER_BASE_URL and, for the public API, GRAPHHOPPER_API_KEY
+//   - offline: OFFLINE_ROAD_GRAPH, the path of a GeoJSON road network
+func NewProvider(name string, secretsManager *secrets.Manager) (IsochroneProvider, error) {
+	switch name {
+	case ProviderGeoapify:
+		apiKey, exists := secretsManager.Get("GEOAPIFY_API_KEY")
+		if !exists {
+			return nil, fmt.Errorf("GEOAPIFY_API_KEY not found in secrets")
+		}
+		baseURL, exists := secretsManager.Get("GEOAPIFY_BASE_URL")
+		if !exists {
+			return nil, fmt.Errorf("GEOAPIFY_BASE_URL not found in secrets")
+		}
+		return NewGeoapifyProvider(apiKey, baseURL), nil
+	case ProviderOpenRouteService:
+		return NewOpenRouteServiceProvider(
+			secretsManager.GetOrDefault("ORS_BASE_URL", DefaultOpenRouteServiceURL),
+			secretsManager.GetOrDefault("ORS_API_KEY", ""),
+		), nil
+	case ProviderValhalla:
+		return NewValhallaProvider(secretsManager.GetOrDefault("VALHALLA_BASE_URL", DefaultValhallaURL)), nil
+	case ProviderGraphHopper:
+		return NewGraphHopperProvider(
+			secretsManager.GetOrDefault("GRAPHHOPPER_BASE_URL", DefaultGraphHopperURL),
+			secretsManager.GetOrDefault("GRAPHHOPPER_API_KEY", ""),
+		), nil
+	case ProviderOffline:
+		path, exists := secretsManager.Get("OFFLINE_ROAD_GRAPH")
+		if !exists {
+			return nil, fmt.Errorf("OFFLINE_ROAD_GRAPH not found in secrets")
+		}
+		return NewOfflineProvider(path)
+	}
+	return nil, fmt.Errorf("unknown isochrone provider %q", name)
+}
+
+// DefaultProviderName returns the provider named by the ISOCHRONE_PROVIDER secret. When it is
+// not set, Geoapify is used unless there is no Geoapify API key but an offline road graph is
+// configured, so that air-gapped installations work without extra settings.
+func DefaultProviderName(secretsManager *secrets.Manager) string {
+	if name, exists := secretsManager.Get("ISOCHRONE_PROVIDER"); exists {
+		return name
+	}
+	_, hasAPIKey := secretsManager.Get("GEOAPIFY_API_KEY")
+	_, hasGraph := secretsManager.Get("OFFLINE_ROAD_GRAPH")
+	if !hasAPIKey && hasGraph {
+		return ProviderOffline
+	}
+	return ProviderGeoapify
+}
+
+// WithProvider sets the provider used to compute isochrones. Without it, NewManager
+// creates the provider returned by DefaultProviderName.
+func WithProvider(provider IsochroneProvider) Option {
+	return func(m *Manager) {
+		m.provider = provider
+	}
+}
+
+// unsupportedModeError is returned by providers that have no profile for a travel mode
+func unsupportedModeError(provider string, mode Mode) error {
+	return fmt.Errorf("travel mode %s is not supported by the %s provider", mode, provider)
+}
@@ -0,0 +1,120 @@
+package geojson
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// RetryPolicy controls how failed API requests are retried
+type RetryPolicy struct {
+	// MaxAttempts is the total number of attempts, including the first one; 1 disables retries
+	MaxAttempts int
+	// BaseDelay is the delay before the first retry, doubled on every following attempt
+	BaseDelay time.Duration
+	// MaxDelay caps a single delay, including one requested by a Retry-After header
+	MaxDelay time.Duration
+	// Jitter is the fraction (0 to 1) by which each delay is randomly spread to avoid retry storms
+	Jitter float64
+}
+
+// DefaultRetryPolicy is the retry policy used unless WithRetryPolicy is given
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts: 4,
+	BaseDelay:   500 * time.Millisecond,
+	MaxDelay:    30 * time.Second,
+	Jitter:      0.2,
+}
+
+// WithRetryPolicy sets the policy used to retry transient API failures
+func WithRetryPolicy(policy RetryPolicy) Option {
+	return func(m *Manager) {
+		if policy.MaxAttempts < 1 {
+			policy.MaxAttempts = 1
+		}
+		m.retryPolicy = policy
+	}
+}
+
+// StatusError is returned when the API answers with a status code other than 200 OK
+type StatusError struct {
+	StatusCode int
+	// RetryAfter is the delay requested by the server through the Retry-After header, if any
+	RetryAfter time.Duration
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("API request failed with status code: %d", e.StatusCode)
+}
+
+// Retryable reports whether the status code denotes a transient failure
+func (e *StatusError) Retryable() bool {
+	switch e.StatusCode {
+	case http.StatusRequestTimeout, http.StatusTooManyRequests,
+		http.StatusInternalServerError, http.StatusBadGateway,
+		http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+// isRetryable reports whether a failed request is worth another attempt.
+// Transport errors (timeouts, resets, refused connections) are considered transient,
+// while client errors such as 400, 401 and 403 and cancelled contexts are permanent.
+func isRetryable(err error) bool {
+	if errors.Is(err, context.Canceled) {
+		return false
+	}
+
+	var statusErr *StatusError
+	if errors.As(err, &statusErr) {
+		return statusErr.Retryable()
+	}
+	return true
+}
+
+// delay returns how long to wait before the attempt following the given one
+func (p RetryPolicy) delay(attempt int, err error) time.Duration {
+	d := p.BaseDelay << (attempt - 1)
+	if d <= 0 || (p.MaxDelay > 0 && d > p.MaxDelay) {
+		d = p.MaxDelay
+	}
+
+	if p.Jitter > 0 {
+		d = time.Duration(float64(d) * (1 + p.Jitter*(2*rand.Float64()-1)))
+	}
+
+	// The server knows best how long it needs: honour Retry-After when it asks for more
+	var statusErr *StatusError
+	if errors.As(err, &statusErr) && statusErr.RetryAfter > d {
+		d = statusErr.RetryAfter
+	}
+
+	if p.MaxDelay > 0 && d > p.MaxDelay {
+		d = p.MaxDelay
+	}
+	return d
+}
+
+// parseRetryAfter parses a Retry-After header expressed either in seconds or as an HTTP date
+func parseRetryAfter(value string, now time.Time) time.Duration {
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(value); err == nil {
+		if seconds < 0 {
+			return 0
+		}
+		return time.Duration(seconds) * time.Second
+	}
+	if date, err := http.ParseTime(value); err == nil {
+		if d := date.Sub(now); d > 0 {
+			return d
+		}
+	}
+	return 0
+}
@@ -0,0 +1,469 @@
+package geojson
+
+import (
+	"container/heap"
+	"fmt"
+	"math"
+)
+
+// SimplifyAlgorithm selects how vertices are removed by Simplify
+type SimplifyAlgorithm string
+
+// Simplification algorithms
+const (
+	// AlgorithmDouglasPeucker keeps the vertices farther than the tolerance from the simplified line
+	AlgorithmDouglasPeucker SimplifyAlgorithm = "douglas-peucker"
+	// AlgorithmVisvalingam removes the vertices forming the smallest triangles with their neighbours,
+	// which gives smoother outlines than Douglas-Peucker at the same vertex count
+	AlgorithmVisvalingam SimplifyAlgorithm = "visvalingam"
+)
+
+// MaxPrecision is the largest number of decimal digits accepted by SimplifyOptions;
+// 15 digits already exceed the resolution of a float64 coordinate
+const MaxPrecision = 15
+
+// metersPerDegree is the length of a degree of latitude, used to project rings on a local plane
+const metersPerDegree = 111320.0
+
+// SimplifyOptions configures the simplification and precision reduction of geometries.
+// The zero value leaves geometries untouched.
+type SimplifyOptions struct {
+	// Tolerance is the largest distance in meters a simplified outline may deviate from the
+	// original one. With Visvalingam, vertices whose triangle is smaller than Tolerance² are removed.
+	// A value of 0 disables simplification.
+	Tolerance float64
+	// Algorithm defaults to Douglas-Peucker
+	Algorithm SimplifyAlgorithm
+	// Precision is the number of decimal digits kept in coordinates; 6 digits are about 10 cm.
+	// A value of 0 keeps full precision.
+	Precision int
+}
+
+// ParseSimplifyAlgorithm converts a string into a SimplifyAlgorithm; an empty string selects Douglas-Peucker
+func ParseSimplifyAlgorithm(s string) (SimplifyAlgorithm, error) {
+	switch algorithm := SimplifyAlgorithm(s); algorithm {
+	case "":
+		return AlgorithmDouglasPeucker, nil
+	case AlgorithmDouglasPeucker, AlgorithmVisvalingam:
+		return algorithm, nil
+	}
+	return "", fmt.Errorf("unknown simplification algorithm %q", s)
+}
+
+// Validate reports an error for a negative tolerance, an unknown algorithm or a precision out of range
+func (o SimplifyOptions) Validate() error {
+	if o.Tolerance < 0 || math.IsNaN(o.Tolerance) || math.IsInf(o.Tolerance, 0) {
+		return fmt.Errorf("invalid simplification tolerance %v", o.Tolerance)
+	}
+	if _, err := ParseSimplifyAlgorithm(string(o.Algorithm)); err != nil {
+		return err
+	}
+	if o.Precision < 0 || o.Precision > MaxPrecision {
+		return fmt.Errorf("precision must be between 0 and %d digits", MaxPrecision)
+	}
+	return nil
+}
+
+// Enabled reports whether the options change geometries at all
+func (o SimplifyOptions) Enabled() bool {
+	return o.Tolerance > 0 || o.Precision > 0
+}
+
+// WithSimplify simplifies the isochrones and reduces their coordinate precision before they are saved
+func WithSimplify(opts SimplifyOptions) Option {
+	return func(m *Manager) {
+		m.simplify = opts
+	}
+}
+
+// Simplify removes vertices from the lines and polygon rings of every feature and then rounds
+// all coordinates to the requested precision. Topology is preserved: a ring is only replaced
+// by its simplified version when it keeps at least four positions, does not cross itself and
+// does not cross the other rings of the geometry; otherwise the tolerance is halved and the
+// ring simplified again, keeping the original ring as a last resort.
+func (fc *FeatureCollection) Simplify(opts SimplifyOptions) {
+	for _, feature := range fc.Features {
+		if feature != nil {
+			feature.Geometry.simplify(opts)
+		}
+	}
+	fc.Normalize()
+}
+
+func (g *Geometry) simplify(opts SimplifyOptions) {
+	if g == nil {
+		return
+	}
+
+	if opts.Tolerance > 0 {
+		switch g.Type {
+		case TypeLineString:
+			g.LineString = simplifyLine(g.LineString, opts, 2)
+		case TypeMultiLineString:
+			for i, line := range g.MultiLineString {
+				g.MultiLineString[i] = simplifyLine(line, opts, 2)
+			}
+		case TypePolygon, TypeMultiPolygon:
+			simplifyRings(g.Polygons(), opts)
+		}
+	}
+
+	if opts.Precision > 0 {
+		g.roundCoordinates(opts.Precision)
+	}
+
+	if g.Type == TypeGeometryCollection {
+		for _, child := range g.Geometries {
+			child.simplify(opts)
+		}
+	}
+}
+
+// simplifyRings simplifies every ring of the polygons in place. Each candidate is checked against
+// the rings already simplified and the original version of the rings still to come, so that the
+// original ring used as a fallback can never cross an accepted one.
+func simplifyRings(polygons [][][]Position, opts SimplifyOptions) {
+	type ringRef struct{ polygon, ring int }
+
+	var refs []ringRef
+	var accepted [][]Position
+	for p, polygon := range polygons {
+		for r, ring := range polygon {
+			refs = append(refs, ringRef{p, r})
+			accepted = append(accepted, ring)
+		}
+	}
+
+	for i, ref := range refs {
+		original := accepted[i]
+		if len(original) <= 4 {
+			continue
+		}
+		for tolerance := opts.Tolerance; tolerance >= opts.Tolerance/16; tolerance /= 2 {
+			candidate := simplifyPositions(original, SimplifyOptions{Tolerance: tolerance, Algorithm: opts.Algorithm}, 4)
+			if len(candidate) == len(original) {
+				break
+			}
+			if validSimplifiedRing(candidate, i, accepted) {
+				accepted[i] = candidate
+				break
+			}
+		}
+		polygons[ref.polygon][ref.ring] = accepted[i]
+	}
+}
+
+// validSimplifiedRing reports whether a candidate for ring index is a simple ring that does not
+// cross any of the other rings
+func validSimplifiedRing(candidate []Position, index int, rings [][]Position) bool {
+	if len(candidate) < 4 || ringArea(candidate) == 0 || ringSelfIntersects(candidate) {
+		return false
+	}
+	for j, other := range rings {
+		if j != index && ringsIntersect(candidate, other) {
+			return false
+		}
+	}
+	return true
+}
+
+// simplifyLine returns the positions kept by the selected algorithm, or the original line
+// when fewer than minimum positions would be left
+func simplifyLine(line []Position, opts SimplifyOptions, minimum int) []Position {
+	if len(line) <= minimum {
+		return line
+	}
+
+	simplified := simplifyPositions(line, opts, minimum)
+	if len(simplified) < minimum {
+		return line
+	}
+	return simplified
+}
+
+// simplifyPositions returns the positions kept by the selected algorithm. Rings are simplified
+// as lines whose first and last positions coincide and are always kept.
+func simplifyPositions(line []Position, opts SimplifyOptions, minimum int) []Position {
+	points := project(line)
+	var keep []bool
+	if opts.Algorithm == AlgorithmVisvalingam {
+		keep = visvalingam(points, opts.Tolerance*opts.Tolerance, minimum)
+	} else {
+		keep = douglasPeucker(points, opts.Tolerance)
+	}
+
+	var simplified []Position
+	for i, kept := range keep {
+		if kept {
+			simplified = append(simplified, line[i])
+		}
+	}
+	return simplified
+}
+
+// point is a position projected on a local plane, in meters
+type point struct{ x, y float64 }
+
+// project maps positions on an equirectangular plane centred on the first position,
+// which is accurate enough at the scale of an isochrone
+func project(line []Position) []point {
+	lon0, lat0 := line[0].Lon(), line[0].Lat()
+	scale := math.Cos(lat0 * math.Pi / 180)
+
+	points := make([]point, len(line))
+	for i, position := range line {
+		points[i] = point{
+			x: (position.Lon() - lon0) * scale * metersPerDegree,
+			y: (position.Lat() - lat0) * metersPerDegree,
+		}
+	}
+	return points
+}
+
+// douglasPeucker marks the points kept by the Douglas-Peucker algorithm
+func douglasPeucker(points []point, tolerance float64) []bool {
+	keep := make([]bool, len(points))
+	keep[0], keep[len(points)-1] = true, true
+
+	type span struct{ first, last int }
+	stack := []span{{0, len(points) - 1}}
+	for len(stack) > 0 {
+		s := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+
+		farthest, distance := -1, tolerance
+		for i := s.first + 1; i < s.last; i++ {
+			if d := segmentDistance(points[i], points[s.first], points[s.last]); d > distance {
+				farthest, distance = i, d
+			}
+		}
+		if farthest != -1 {
+			keep[farthest] = true
+			stack = append(stack, span{s.first, farthest}, span{farthest, s.last})
+		}
+	}
+
+	return keep
+}
+
+// segmentDistance returns the distance from p to the segment a-b
+func segmentDistance(p, a, b point) float64 {
+	dx, dy := b.x-a.x, b.y-a.y
+	if dx == 0 && dy == 0 {
+		return math.Hypot(p.x-a.x, p.y-a.y)
+	}
+
+	t := ((p.x-a.x)*dx + (p.y-a.y)*dy) / (dx*dx + dy*dy)
+	t = math.Max(0, math.Min(1, t))
+	return math.Hypot(p.x-(a.x+t*dx), p.y-(a.y+t*dy))
+}
+
+// visvalingam marks the points kept by the Visvalingam-Whyatt algorithm, removing the point
+// with the smallest effective area until every remaining area reaches the threshold or only
+// minimum points are left
+func visvalingam(points []point, threshold float64, minimum int) []bool {
+	n := len(points)
+	prev := make([]int, n)
+	next := make([]int, n)
+	keep := make([]bool, n)
+	for i := range points {
+		prev[i], next[i], keep[i] = i-1, i+1, true
+	}
+
+	queue := &areaQueue{index: make([]int, n)}
+	for i := 1; i < n-1; i++ {
+		heap.Push(queue, &vertex{i: i, area: triangleArea(points[i-1], points[i], points[i+1])})
+	}
+
+	remaining := n
+	for queue.Len() > 0 && remaining > minimum {
+		v := heap.Pop(queue).(*vertex)
+		if v.area >= threshold {
+			break
+		}
+		keep[v.i] = false
+		remaining--
+
+		// Relink the neighbours and update their areas, never below the removed area
+		// so that the removal order stays monotonic
+		p, q := prev[v.i], next[v.i]
+		next[p], prev[q] = q, p
+		for _, j := range []int{p, q} {
+			if j == 0 || j == n-1 {
+				continue
+			}
+			area := math.Max(v.area, triangleArea(points[prev[j]], points[j], points[next[j]]))
+			queue.update(j, area)
+		}
+	}
+
+	return keep
+}
+
+func triangleArea(a, b, c point) float64 {
+	return math.Abs((b.x-a.x)*(c.y-a.y)-(c.x-a.x)*(b.y-a.y)) / 2
+}
+
+// vertex is an entry of the Visvalingam priority queue
+type vertex struct {
+	i    int
+	area float64
+	pos  int
+}
+
+// areaQueue is a min-heap of vertices by effective area; index maps point indexes to vertices
+type areaQueue struct {
+	items []*vertex
+	index []int
+}
+
+func (q *areaQueue) Len() int           { return len(q.items) }
+func (q *areaQueue) Less(i, j int) bool { return q.items[i].area < q.items[j].area }
+
+func (q *areaQueue) Swap(i, j int) {
+	q.items[i], q.items[j] = q.items[j], q.items[i]
+	q.items[i].pos, q.items[j].pos = i, j
+	q.index[q.items[i].i], q.index[q.items[j].i] = i, j
+}
+
+func (q *areaQueue) Push(x interface{}) {
+	v := x.(*vertex)
+	v.pos = len(q.items)
+	q.index[v.i] = v.pos
+	q.items = append(q.items, v)
+}
+
+func (q *areaQueue) Pop() interface{} {
+	v := q.items[len(q.items)-1]
+	q.items = q.items[:len(q.items)-1]
+	return v
+}
+
+// update changes the area of the vertex of point i
+func (q *areaQueue) update(i int, area float64) {
+	v := q.items[q.index[i]]
+	v.area = area
+	heap.Fix(q, v.pos)
+}
+
+// ringSelfIntersects reports whether two non-adjacent edges of a closed ring touch or cross
+func ringSelfIntersects(ring []Position) bool {
+	edges := len(ring) - 1
+	for i := 0; i < edges; i++ {
+		for j := i + 2; j < edges; j++ {
+			// The first and last edges share the closing position
+			if i == 0 && j == edges-1 {
+				continue
+			}
+			if segmentsIntersect(ring[i], ring[i+1], ring[j], ring[j+1]) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// ringsIntersect reports whether any edge of a touches or crosses any edge of b
+func ringsIntersect(a, b []Position) bool {
+	if !boundsOverlap(ringBounds(a), ringBounds(b)) {
+		return false
+	}
+	for i := 0; i < len(a)-1; i++ {
+		for j := 0; j < len(b)-1; j++ {
+			if segmentsIntersect(a[i], a[i+1], b[j], b[j+1]) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func ringBounds(ring []Position) [4]float64 {
+	bounds := [4]float64{math.Inf(1), math.Inf(1), math.Inf(-1), math.Inf(-1)}
+	for _, position := range ring {
+		bounds[0] = math.Min(bounds[0], position.Lon())
+		bounds[1] = math.Min(bounds[1], position.Lat())
+		bounds[2] = math.Max(bounds[2], position.Lon())
+		bounds[3] = math.Max(bounds[3], position.Lat())
+	}
+	return bounds
+}
+
+func boundsOverlap(a, b [4]float64) bool {
+	return a[0] <= b[2] && b[0] <= a[2] && a[1] <= b[3] && b[1] <= a[3]
+}
+
+// segmentsIntersect reports whether the segments p1-p2 and q1-q2 touch or cross
+func segmentsIntersect(p1, p2, q1, q2 Position) bool {
+	d1 := orientation(q1, q2, p1)
+	d2 := orientation(q1, q2, p2)
+	d3 := orientation(p1, p2, q1)
+	d4 := orientation(p1, p2, q2)
+
+	if ((d1 > 0 && d2 < 0) || (d1 < 0 && d2 > 0)) && ((d3 > 0 && d4 < 0) || (d3 < 0 && d4 > 0)) {
+		return true
+	}
+	return (d1 == 0 && onSegment(q1, q2, p1)) || (d2 == 0 && onSegment(q1, q2, p2)) ||
+		(d3 == 0 && onSegment(p1, p2, q1)) || (d4 == 0 && onSegment(p1, p2, q2))
+}
+
+// orientation returns the sign of the cross product of a-b and a-c
+func orientation(a, b, c Position) float64 {
+	return (b.Lon()-a.Lon())*(c.Lat()-a.Lat()) - (b.Lat()-a.Lat())*(c.Lon()-a.Lon())
+}
+
+// onSegment reports whether c, collinear with a-b, lies within the segment
+func onSegment(a, b, c Position) bool {
+	return math.Min(a.Lon(), b.Lon()) <= c.Lon() && c.Lon() <= math.Max(a.Lon(), b.Lon()) &&
+		math.Min(a.Lat(), b.Lat()) <= c.Lat() && c.Lat() <= math.Max(a.Lat(), b.Lat())
+}
+
+// roundCoordinates rounds every coordinate to digits decimals and drops the consecutive
+// duplicate positions this creates, as long as lines and rings stay valid
+func (g *Geometry) roundCoordinates(digits int) {
+	switch g.Type {
+	case TypePoint:
+		roundPosition(g.Point, digits)
+	case TypeMultiPoint:
+		for _, position := range g.MultiPoint {
+			roundPosition(position, digits)
+		}
+	case TypeLineString:
+		g.LineString = roundLine(g.LineString, digits, 2)
+	case TypeMultiLineString:
+		for i, line := range g.MultiLineString {
+			g.MultiLineString[i] = roundLine(line, digits, 2)
+		}
+	case TypePolygon, TypeMultiPolygon:
+		for _, polygon := range g.Polygons() {
+			for i, ring := range polygon {
+				polygon[i] = roundLine(ring, digits, 4)
+			}
+		}
+	}
+}
+
+func roundLine(line []Position, digits, minimum int) []Position {
+	for _, position := range line {
+		roundPosition(position, digits)
+	}
+
+	deduplicated := make([]Position, 0, len(line))
+	for i, position := range line {
+		if i > 0 && position.Lon() == line[i-1].Lon() && position.Lat() == line[i-1].Lat() {
+			continue
+		}
+		deduplicated = append(deduplicated, position)
+	}
+	if len(deduplicated) < minimum {
+		return line
+	}
+	return deduplicated
+}
+
+func roundPosition(position Position, digits int) {
+	factor := math.Pow(10, float64(digits))
+	for i, value := range position {
+		position[i] = math.Round(value*factor) / factor
+	}
+}
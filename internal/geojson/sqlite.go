@@ -0,0 +1,433 @@
+package geojson
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"sort"
+)
+
+// sqlitePageSize is the page size of the databases written by sqliteWriter
+const sqlitePageSize = 4096
+
+// sqliteTable is a table to write, with its rows in rowid order. Values are nil, int64,
+// float64, string or []byte; the INTEGER PRIMARY KEY column, if any, must be nil since
+// SQLite stores it as the rowid.
+type sqliteTable struct {
+	name string
+	sql  string
+	rows [][]interface{}
+	// rowids are the ascending rowids of the rows; by default rows are numbered from 1
+	rowids []int64
+	// indexes are the automatic indexes SQLite creates for PRIMARY KEY and UNIQUE constraints
+	// on other columns, in declaration order
+	indexes [][]int
+}
+
+// writeSQLite builds a SQLite 3 database file holding the tables. It only supports writing
+// a fresh database at once: rows are packed into B-tree pages, large values spill into
+// overflow pages and automatic indexes must fit a single page, which is plenty for the
+// metadata tables they are used on.
+func writeSQLite(tables []sqliteTable, applicationID, userVersion uint32) ([]byte, error) {
+	w := &sqliteWriter{}
+	// Page 1 holds the database header and the schema table, written last
+	w.allocate()
+
+	var schema [][]interface{}
+	for _, table := range tables {
+		rowids := table.rowids
+		if rowids == nil {
+			rowids = make([]int64, len(table.rows))
+			for i := range rowids {
+				rowids[i] = int64(i + 1)
+			}
+		}
+
+		cells := make([]sqliteCell, len(table.rows))
+		for i, row := range table.rows {
+			cells[i] = sqliteCell{rowid: rowids[i], payload: sqliteRecord(row)}
+		}
+		root := w.writeTableTree(cells, 0)
+		schema = append(schema, []interface{}{"table", table.name, table.name, int64(root), table.sql})
+
+		for n, columns := range table.indexes {
+			root, err := w.writeIndex(table.rows, rowids, columns)
+			if err != nil {
+				return nil, fmt.Errorf("failed to write index of %s: %w", table.name, err)
+			}
+			name := fmt.Sprintf("sqlite_autoindex_%s_%d", table.name, n+1)
+			schema = append(schema, []interface{}{"index", name, table.name, int64(root), nil})
+		}
+	}
+
+	cells := make([]sqliteCell, len(schema))
+	for i, row := range schema {
+		cells[i] = sqliteCell{rowid: int64(i + 1), payload: sqliteRecord(row)}
+	}
+	w.writeTableTree(cells, 1)
+
+	// Database header
+	page := w.pages[0]
+	copy(page, "SQLite format 3\x00")
+	binary.BigEndian.PutUint16(page[16:], sqlitePageSize)
+	page[18], page[19] = 1, 1
+	page[20] = 0
+	page[21], page[22], page[23] = 64, 32, 32
+	binary.BigEndian.PutUint32(page[24:], 1)
+	binary.BigEndian.PutUint32(page[28:], uint32(len(w.pages)))
+	binary.BigEndian.PutUint32(page[40:], 1)
+	binary.BigEndian.PutUint32(page[44:], 4)
+	binary.BigEndian.PutUint32(page[56:], 1)
+	binary.BigEndian.PutUint32(page[60:], userVersion)
+	binary.BigEndian.PutUint32(page[68:], applicationID)
+	binary.BigEndian.PutUint32(page[92:], 1)
+	binary.BigEndian.PutUint32(page[96:], 3045000)
+
+	data := make([]byte, 0, len(w.pages)*sqlitePageSize)
+	for _, page := range w.pages {
+		data = append(data, page...)
+	}
+	return data, nil
+}
+
+// B-tree page types
+const (
+	sqliteInteriorTable = 0x05
+	sqliteLeafIndex     = 0x0a
+	sqliteLeafTable     = 0x0d
+)
+
+type sqliteWriter struct {
+	pages [][]byte
+}
+
+// sqliteCell is a table row ready to be stored
+type sqliteCell struct {
+	rowid   int64
+	payload []byte
+}
+
+// allocate appends an empty page and returns its number
+func (w *sqliteWriter) allocate() uint32 {
+	w.pages = append(w.pages, make([]byte, sqlitePageSize))
+	return uint32(len(w.pages))
+}
+
+// headerOffset returns where the B-tree page header starts, after the database header on page 1
+func headerOffset(page uint32) int {
+	if page == 1 {
+		return 100
+	}
+	return 0
+}
+
+// writeTableTree stores the cells in a table B-tree and returns its root page. A root of 0
+// allocates a new page for the root.
+func (w *sqliteWriter) writeTableTree(cells []sqliteCell, root uint32) uint32 {
+	encoded := make([][]byte, len(cells))
+	for i, cell := range cells {
+		encoded[i] = w.leafTableCell(cell)
+	}
+
+	// Pack the leaves, keeping the last page for the root when everything fits in one
+	groups := packCells(encoded, 8, root)
+	if len(groups) == 1 {
+		if root == 0 {
+			root = w.allocate()
+		}
+		w.writePage(root, sqliteLeafTable, encoded, 0)
+		return root
+	}
+
+	type child struct {
+		page     uint32
+		maxRowid int64
+	}
+	var children []child
+	for _, group := range groups {
+		page := w.allocate()
+		w.writePage(page, sqliteLeafTable, encoded[group[0]:group[1]], 0)
+		children = append(children, child{page: page, maxRowid: cells[group[1]-1].rowid})
+	}
+
+	// Add interior levels until a single page points to every child
+	for {
+		interior := make([][]byte, len(children)-1)
+		for i, c := range children[:len(children)-1] {
+			interior[i] = interiorTableCell(c.page, c.maxRowid)
+		}
+
+		groups := packCells(interior, 12, root)
+		if len(groups) == 1 {
+			if root == 0 {
+				root = w.allocate()
+			}
+			w.writePage(root, sqliteInteriorTable, interior, children[len(children)-1].page)
+			return root
+		}
+
+		// Each interior page takes the child following its last cell as right-most pointer
+		var parents []child
+		for _, group := range groups {
+			page := w.allocate()
+			right := children[group[1]]
+			w.writePage(page, sqliteInteriorTable, interior[group[0]:group[1]], right.page)
+			parents = append(parents, child{page: page, maxRowid: right.maxRowid})
+		}
+		children = parents
+	}
+}
+
+// packCells splits cells into [start, end) groups filling pages with the given header size.
+// Interior levels use one cell per group boundary as the divider, so callers skip it.
+func packCells(cells [][]byte, headerSize int, root uint32) [][2]int {
+	var groups [][2]int
+	capacity := sqlitePageSize - headerSize
+	if root == 1 {
+		capacity -= 100
+	}
+
+	start, used := 0, 0
+	for i, cell := range cells {
+		size := len(cell) + 2
+		if used+size > capacity && i > start {
+			groups = append(groups, [2]int{start, i})
+			start, used = i, 0
+			if headerSize == 12 {
+				// The cell at the boundary becomes the right-most pointer of the page
+				start, used = i+1, 0
+				continue
+			}
+		}
+		used += size
+	}
+	groups = append(groups, [2]int{start, len(cells)})
+
+	// An interior page needs at least one cell: take the divider of the previous page instead
+	if n := len(groups); headerSize == 12 && n > 1 && groups[n-1][0] == groups[n-1][1] {
+		groups[n-2][1]--
+		groups[n-1][0] = groups[n-2][1] + 1
+	}
+	return groups
+}
+
+// writePage lays out a B-tree page: header, cell pointer array and cells packed at the end
+func (w *sqliteWriter) writePage(number uint32, pageType byte, cells [][]byte, rightMost uint32) {
+	page := w.pages[number-1]
+	offset := headerOffset(number)
+
+	headerSize := 8
+	if pageType == sqliteInteriorTable {
+		headerSize = 12
+		binary.BigEndian.PutUint32(page[offset+8:], rightMost)
+	}
+
+	content := sqlitePageSize
+	for i, cell := range cells {
+		content -= len(cell)
+		copy(page[content:], cell)
+		binary.BigEndian.PutUint16(page[offset+headerSize+2*i:], uint16(content))
+	}
+
+	page[offset] = pageType
+	binary.BigEndian.PutUint16(page[offset+3:], uint16(len(cells)))
+	binary.BigEndian.PutUint16(page[offset+5:], uint16(content%65536))
+}
+
+// leafTableCell encodes a row, moving the part of the payload that does not fit the page
+// into a chain of overflow pages
+func (w *sqliteWriter) leafTableCell(cell sqliteCell) []byte {
+	var out []byte
+	out = appendSQLiteVarint(out, uint64(len(cell.payload)))
+	out = appendSQLiteVarint(out, uint64(cell.rowid))
+
+	local := localPayload(len(cell.payload), sqlitePageSize-35)
+	out = append(out, cell.payload[:local]...)
+	if local < len(cell.payload) {
+		out = binary.BigEndian.AppendUint32(out, w.writeOverflow(cell.payload[local:]))
+	}
+	return out
+}
+
+// localPayload returns how many bytes of a payload are stored in the cell, following the
+// rules of the SQLite file format with maxLocal the largest payload kept entirely
+func localPayload(size, maxLocal int) int {
+	if size <= maxLocal {
+		return size
+	}
+	usable := sqlitePageSize
+	minLocal := (usable-12)*32/255 - 23
+	local := minLocal + (size-minLocal)%(usable-4)
+	if local > maxLocal {
+		local = minLocal
+	}
+	return local
+}
+
+// writeOverflow stores data in a chain of overflow pages and returns the first page
+func (w *sqliteWriter) writeOverflow(data []byte) uint32 {
+	var first, previous uint32
+	for len(data) > 0 {
+		page := w.allocate()
+		if previous == 0 {
+			first = page
+		} else {
+			binary.BigEndian.PutUint32(w.pages[previous-1], page)
+		}
+		n := copy(w.pages[page-1][4:], data)
+		data = data[n:]
+		previous = page
+	}
+	return first
+}
+
+func interiorTableCell(child uint32, rowid int64) []byte {
+	out := binary.BigEndian.AppendUint32(nil, child)
+	return appendSQLiteVarint(out, uint64(rowid))
+}
+
+// writeIndex stores an index on the columns of the rows, sorted by key then rowid, in a
+// single leaf page
+func (w *sqliteWriter) writeIndex(rows [][]interface{}, rowids []int64, columns []int) (uint32, error) {
+	type entry struct {
+		key    []interface{}
+		record []byte
+	}
+	entries := make([]entry, len(rows))
+	for i, row := range rows {
+		key := make([]interface{}, 0, len(columns)+1)
+		for _, column := range columns {
+			key = append(key, row[column])
+		}
+		key = append(key, rowids[i])
+		entries[i] = entry{key: key, record: sqliteRecord(key)}
+	}
+	sort.SliceStable(entries, func(i, j int) bool {
+		return compareSQLiteKeys(entries[i].key, entries[j].key) < 0
+	})
+
+	var cells [][]byte
+	size := 8
+	for _, e := range entries {
+		if len(e.record) > (sqlitePageSize-12)*64/255-23 {
+			return 0, fmt.Errorf("index key too large")
+		}
+		cell := appendSQLiteVarint(nil, uint64(len(e.record)))
+		cell = append(cell, e.record...)
+		size += len(cell) + 2
+		cells = append(cells, cell)
+	}
+	if size > sqlitePageSize {
+		return 0, fmt.Errorf("index does not fit a single page")
+	}
+
+	page := w.allocate()
+	w.writePage(page, sqliteLeafIndex, cells, 0)
+	return page, nil
+}
+
+// compareSQLiteKeys orders index keys of text and integer values with the BINARY collation
+func compareSQLiteKeys(a, b []interface{}) int {
+	for i := range a {
+		switch x := a[i].(type) {
+		case string:
+			if y := b[i].(string); x != y {
+				if x < y {
+					return -1
+				}
+				return 1
+			}
+		case int64:
+			if y := b[i].(int64); x != y {
+				if x < y {
+					return -1
+				}
+				return 1
+			}
+		}
+	}
+	return 0
+}
+
+// sqliteRecord encodes values in the SQLite record format
+func sqliteRecord(values []interface{}) []byte {
+	var header, body []byte
+	for _, value := range values {
+		switch v := value.(type) {
+		case nil:
+			header = appendSQLiteVarint(header, 0)
+		case int64:
+			switch {
+			case v == 0:
+				header = appendSQLiteVarint(header, 8)
+			case v == 1:
+				header = appendSQLiteVarint(header, 9)
+			case v >= math.MinInt8 && v <= math.MaxInt8:
+				header = appendSQLiteVarint(header, 1)
+				body = append(body, byte(v))
+			case v >= math.MinInt16 && v <= math.MaxInt16:
+				header = appendSQLiteVarint(header, 2)
+				body = binary.BigEndian.AppendUint16(body, uint16(v))
+			case v >= math.MinInt32 && v <= math.MaxInt32:
+				header = appendSQLiteVarint(header, 4)
+				body = binary.BigEndian.AppendUint32(body, uint32(v))
+			default:
+				header = appendSQLiteVarint(header, 6)
+				body = binary.BigEndian.AppendUint64(body, uint64(v))
+			}
+		case float64:
+			header = appendSQLiteVarint(header, 7)
+			body = binary.BigEndian.AppendUint64(body, math.Float64bits(v))
+		case string:
+			header = appendSQLiteVarint(header, uint64(len(v))*2+13)
+			body = append(body, v...)
+		case []byte:
+			header = appendSQLiteVarint(header, uint64(len(v))*2+12)
+			body = append(body, v...)
+		default:
+			panic(fmt.Sprintf("unsupported SQLite value %T", value))
+		}
+	}
+
+	// The header size includes its own varint, which grows with the header
+	size := len(header) + 1
+	for len(appendSQLiteVarint(nil, uint64(size)))+len(header) != size {
+		size++
+	}
+	record := appendSQLiteVarint(nil, uint64(size))
+	record = append(record, header...)
+	return append(record, body...)
+}
+
+// appendSQLiteVarint appends a big-endian SQLite varint of up to 9 bytes
+func appendSQLiteVarint(out []byte, v uint64) []byte {
+	if v > 0x00ffffffffffffff {
+		var buf [9]byte
+		buf[8] = byte(v)
+		v >>= 8
+		for i := 7; i >= 0; i-- {
+			buf[i] = byte(v&0x7f) | 0x80
+			v >>= 7
+		}
+		return append(out, buf[:]...)
+	}
+
+	var buf [8]byte
+	n := 0
+	for {
+		buf[n] = byte(v & 0x7f)
+		n++
+		v >>= 7
+		if v == 0 {
+			break
+		}
+	}
+	for i := n - 1; i >= 0; i-- {
+		b := buf[i]
+		if i > 0 {
+			b |= 0x80
+		}
+		out = append(out, b)
+	}
+	return out
+}
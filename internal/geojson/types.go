@@ -0,0 +1,155 @@
+package geojson
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// GeoJSON object types defined by RFC 7946
+const (
+	TypeFeatureCollection  = "FeatureCollection"
+	TypeFeature            = "Feature"
+	TypePoint              = "Point"
+	TypeMultiPoint         = "MultiPoint"
+	TypeLineString         = "LineString"
+	TypeMultiLineString    = "MultiLineString"
+	TypePolygon            = "Polygon"
+	TypeMultiPolygon       = "MultiPolygon"
+	TypeGeometryCollection = "GeometryCollection"
+)
+
+// Position is a longitude, latitude and optional altitude triple
+type Position []float64
+
+// Lon returns the longitude of the position
+func (p Position) Lon() float64 { return p[0] }
+
+// Lat returns the latitude of the position
+func (p Position) Lat() float64 { return p[1] }
+
+// FeatureCollection is a GeoJSON FeatureCollection as written to the output directory
+type FeatureCollection struct {
+	Type     string     `json:"type"`
+	Features []*Feature `json:"features"`
+	BBox     []float64  `json:"bbox,omitempty"`
+	// Metadata is a foreign member recording the parameters the isochrone was generated with
+	Metadata *Metadata `json:"metadata,omitempty"`
+}
+
+// Feature is a GeoJSON Feature
+type Feature struct {
+	Type       string                 `json:"type"`
+	ID         interface{}            `json:"id,omitempty"`
+	BBox       []float64              `json:"bbox,omitempty"`
+	Geometry   *Geometry              `json:"geometry"`
+	Properties map[string]interface{} `json:"properties"`
+}
+
+// Geometry is a GeoJSON geometry. Only the field matching Type is populated.
+type Geometry struct {
+	Type            string
+	Point           Position
+	MultiPoint      []Position
+	LineString      []Position
+	MultiLineString [][]Position
+	Polygon         [][]Position
+	MultiPolygon    [][][]Position
+	Geometries      []*Geometry
+}
+
+// Polygons returns the polygons making up a Polygon, MultiPolygon or GeometryCollection.
+// Other geometry types have no area and return nil.
+func (g *Geometry) Polygons() [][][]Position {
+	if g == nil {
+		return nil
+	}
+
+	switch g.Type {
+	case TypePolygon:
+		return [][][]Position{g.Polygon}
+	case TypeMultiPolygon:
+		return g.MultiPolygon
+	case TypeGeometryCollection:
+		var polygons [][][]Position
+		for _, child := range g.Geometries {
+			polygons = append(polygons, child.Polygons()...)
+		}
+		return polygons
+	}
+	return nil
+}
+
+// rawGeometry is the wire representation of a Geometry
+type rawGeometry struct {
+	Type        string          `json:"type"`
+	Coordinates json.RawMessage `json:"coordinates,omitempty"`
+	Geometries  []*Geometry     `json:"geometries,omitempty"`
+}
+
+// MarshalJSON encodes the geometry with the coordinates matching its type
+func (g *Geometry) MarshalJSON() ([]byte, error) {
+	var coordinates interface{}
+	switch g.Type {
+	case TypePoint:
+		coordinates = g.Point
+	case TypeMultiPoint:
+		coordinates = g.MultiPoint
+	case TypeLineString:
+		coordinates = g.LineString
+	case TypeMultiLineString:
+		coordinates = g.MultiLineString
+	case TypePolygon:
+		coordinates = g.Polygon
+	case TypeMultiPolygon:
+		coordinates = g.MultiPolygon
+	case TypeGeometryCollection:
+		return json.Marshal(rawGeometry{Type: g.Type, Geometries: g.Geometries})
+	default:
+		return nil, fmt.Errorf("unknown geometry type %q", g.Type)
+	}
+
+	raw, err := json.Marshal(coordinates)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(rawGeometry{Type: g.Type, Coordinates: raw})
+}
+
+// UnmarshalJSON decodes the coordinates according to the geometry type
+func (g *Geometry) UnmarshalJSON(data []byte) error {
+	var raw rawGeometry
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+
+	*g = Geometry{Type: raw.Type}
+
+	var target interface{}
+	switch raw.Type {
+	case TypePoint:
+		target = &g.Point
+	case TypeMultiPoint:
+		target = &g.MultiPoint
+	case TypeLineString:
+		target = &g.LineString
+	case TypeMultiLineString:
+		target = &g.MultiLineString
+	case TypePolygon:
+		target = &g.Polygon
+	case TypeMultiPolygon:
+		target = &g.MultiPolygon
+	case TypeGeometryCollection:
+		g.Geometries = raw.Geometries
+		return nil
+	default:
+		return fmt.Errorf("unknown geometry type %q", raw.Type)
+	}
+
+	if len(raw.Coordinates) == 0 {
+		return fmt.Errorf("%s geometry has no coordinates", raw.Type)
+	}
+	if err := json.Unmarshal(raw.Coordinates, target); err != nil {
+		return fmt.Errorf("invalid %s coordinates: %w", raw.Type, err)
+	}
+	return nil
+}
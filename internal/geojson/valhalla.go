@@ -0,0 +1,88 @@
+package geojson
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// DefaultValhallaURL is the address a self-hosted Valhalla instance listens on by default
+const DefaultValhallaURL = "http://localhost:8002"
+
+// ValhallaProvider computes isochrones with the Valhalla isochrone service
+type ValhallaProvider struct {
+	baseURL string
+}
+
+// NewValhallaProvider creates a Valhalla provider
+func NewValhallaProvider(baseURL string) *ValhallaProvider {
+	return &ValhallaProvider{baseURL: strings.TrimRight(baseURL, "/")}
+}
+
+// Name returns the provider name
+func (p *ValhallaProvider) Name() string {
+	return ProviderValhalla
+}
+
+// Fingerprint returns the provider name and endpoint
+func (p *ValhallaProvider) Fingerprint() string {
+	return ProviderValhalla + " " + p.baseURL
+}
+
+// costing maps a travel mode to a Valhalla costing model
+func (p *ValhallaProvider) costing(mode Mode) (string, error) {
+	switch mode {
+	case ModeDrive:
+		return "auto", nil
+	case ModeTruck:
+		return "truck", nil
+	case ModeWalk:
+		return "pedestrian", nil
+	case ModeBicycle:
+		return "bicycle", nil
+	case ModeApproximatedTransit:
+		return "multimodal", nil
+	}
+	return "", unsupportedModeError(ProviderValhalla, mode)
+}
+
+// Supports checks that the mode maps to a Valhalla costing model
+func (p *ValhallaProvider) Supports(mode Mode, isolineType IsolineType) error {
+	_, err := p.costing(mode)
+	return err
+}
+
+// Isochrone posts an isochrone request. Valhalla expresses contours in minutes or
+// kilometers and answers with a FeatureCollection when polygons are requested.
+func (p *ValhallaProvider) Isochrone(ctx context.Context, fetcher Fetcher, req IsochroneRequest) ([]byte, error) {
+	costing, err := p.costing(req.Mode)
+	if err != nil {
+		return nil, err
+	}
+
+	contour := map[string]float64{"time": float64(req.Range) / 60}
+	if req.Type == TypeDistance {
+		contour = map[string]float64{"distance": float64(req.Range) / 1000}
+	}
+
+	body, err := json.Marshal(map[string]interface{}{
+		"locations": []map[string]float64{{"lat": req.Latitude, "lon": req.Longitude}},
+		"costing":   costing,
+		"contours":  []map[string]float64{contour},
+		"polygons":  true,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal request: %w", err)
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, p.baseURL+"/isochrone", bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+
+	return fetcher.Fetch(httpReq)
+}
@@ -0,0 +1,229 @@
+package geojson
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+)
+
+// ValidationError describes why a GeoJSON document was rejected
+type ValidationError struct {
+	// Path locates the offending member, e.g. features[0].geometry.coordinates[1]
+	Path    string
+	Message string
+}
+
+func (e *ValidationError) Error() string {
+	if e.Path == "" {
+		return fmt.Sprintf("invalid GeoJSON: %s", e.Message)
+	}
+	return fmt.Sprintf("invalid GeoJSON at %s: %s", e.Path, e.Message)
+}
+
+// ParseFeatureCollection decodes an isochrone response into a FeatureCollection,
+// validates it against RFC 7946 and normalises polygon ring orientation.
+// The collection must contain at least one Polygon or MultiPolygon feature.
+func ParseFeatureCollection(data []byte) (*FeatureCollection, error) {
+	var fc FeatureCollection
+	if err := json.Unmarshal(data, &fc); err != nil {
+		return nil, &ValidationError{Message: err.Error()}
+	}
+
+	if err := fc.Validate(); err != nil {
+		return nil, err
+	}
+
+	hasArea := false
+	for _, feature := range fc.Features {
+		if len(feature.Geometry.Polygons()) > 0 {
+			hasArea = true
+			break
+		}
+	}
+	if !hasArea {
+		return nil, &ValidationError{Path: "features", Message: "no Polygon or MultiPolygon feature found"}
+	}
+
+	fc.Normalize()
+	return &fc, nil
+}
+
+// Validate checks the collection and every feature geometry against RFC 7946
+func (fc *FeatureCollection) Validate() error {
+	if fc.Type != TypeFeatureCollection {
+		return &ValidationError{Path: "type", Message: fmt.Sprintf("expected %s, got %q", TypeFeatureCollection, fc.Type)}
+	}
+	if fc.Features == nil {
+		return &ValidationError{Path: "features", Message: "member is missing"}
+	}
+
+	for i, feature := range fc.Features {
+		path := fmt.Sprintf("features[%d]", i)
+		if feature == nil || feature.Type != TypeFeature {
+			return &ValidationError{Path: path + ".type", Message: fmt.Sprintf("expected %s", TypeFeature)}
+		}
+		// A feature without geometry is allowed by the RFC
+		if feature.Geometry == nil {
+			continue
+		}
+		if err := feature.Geometry.validate(path + ".geometry"); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// validate checks the geometry coordinates, reporting errors relative to path
+func (g *Geometry) validate(path string) error {
+	coordinates := path + ".coordinates"
+
+	switch g.Type {
+	case TypePoint:
+		return validatePosition(coordinates, g.Point)
+	case TypeMultiPoint:
+		return validatePositions(coordinates, g.MultiPoint, 0)
+	case TypeLineString:
+		return validatePositions(coordinates, g.LineString, 2)
+	case TypeMultiLineString:
+		for i, line := range g.MultiLineString {
+			if err := validatePositions(fmt.Sprintf("%s[%d]", coordinates, i), line, 2); err != nil {
+				return err
+			}
+		}
+	case TypePolygon:
+		return validatePolygon(coordinates, g.Polygon)
+	case TypeMultiPolygon:
+		for i, polygon := range g.MultiPolygon {
+			if err := validatePolygon(fmt.Sprintf("%s[%d]", coordinates, i), polygon); err != nil {
+				return err
+			}
+		}
+	case TypeGeometryCollection:
+		for i, child := range g.Geometries {
+			if child == nil {
+				return &ValidationError{Path: fmt.Sprintf("%s.geometries[%d]", path, i), Message: "geometry is null"}
+			}
+			if err := child.validate(fmt.Sprintf("%s.geometries[%d]", path, i)); err != nil {
+				return err
+			}
+		}
+	default:
+		return &ValidationError{Path: path + ".type", Message: fmt.Sprintf("unknown geometry type %q", g.Type)}
+	}
+
+	return nil
+}
+
+// validatePolygon checks that every ring is a closed linear ring with at least four positions
+func validatePolygon(path string, polygon [][]Position) error {
+	if len(polygon) == 0 {
+		return &ValidationError{Path: path, Message: "polygon has no rings"}
+	}
+
+	for i, ring := range polygon {
+		ringPath := fmt.Sprintf("%s[%d]", path, i)
+		if err := validatePositions(ringPath, ring, 4); err != nil {
+			return err
+		}
+
+		first, last := ring[0], ring[len(ring)-1]
+		if first.Lon() != last.Lon() || first.Lat() != last.Lat() {
+			return &ValidationError{Path: ringPath, Message: "linear ring is not closed"}
+		}
+	}
+
+	return nil
+}
+
+// validatePositions checks a list of positions holding at least minimum entries
+func validatePositions(path string, positions []Position, minimum int) error {
+	if len(positions) < minimum {
+		return &ValidationError{Path: path, Message: fmt.Sprintf("expected at least %d positions, got %d", minimum, len(positions))}
+	}
+
+	for i, position := range positions {
+		if err := validatePosition(fmt.Sprintf("%s[%d]", path, i), position); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// validatePosition checks that a position holds a finite longitude and latitude within range
+func validatePosition(path string, position Position) error {
+	if len(position) < 2 || len(position) > 3 {
+		return &ValidationError{Path: path, Message: fmt.Sprintf("expected 2 or 3 values, got %d", len(position))}
+	}
+
+	for _, value := range position {
+		if math.IsNaN(value) || math.IsInf(value, 0) {
+			return &ValidationError{Path: path, Message: "coordinate is not a finite number"}
+		}
+	}
+
+	if position.Lon() < -180 || position.Lon() > 180 {
+		return &ValidationError{Path: path, Message: fmt.Sprintf("longitude %f out of range", position.Lon())}
+	}
+	if position.Lat() < -90 || position.Lat() > 90 {
+		return &ValidationError{Path: path, Message: fmt.Sprintf("latitude %f out of range", position.Lat())}
+	}
+
+	return nil
+}
+
+// Normalize rewinds polygon rings to the orientation required by RFC 7946:
+// exterior rings counterclockwise and holes clockwise
+func (fc *FeatureCollection) Normalize() {
+	for _, feature := range fc.Features {
+		if feature != nil {
+			feature.Geometry.normalize()
+		}
+	}
+}
+
+func (g *Geometry) normalize() {
+	if g == nil {
+		return
+	}
+
+	switch g.Type {
+	case TypePolygon:
+		rewindPolygon(g.Polygon)
+	case TypeMultiPolygon:
+		for _, polygon := range g.MultiPolygon {
+			rewindPolygon(polygon)
+		}
+	case TypeGeometryCollection:
+		for _, child := range g.Geometries {
+			child.normalize()
+		}
+	}
+}
+
+// rewindPolygon reverses rings whose orientation does not match RFC 7946
+func rewindPolygon(polygon [][]Position) {
+	for i, ring := range polygon {
+		exterior := i == 0
+		if (ringArea(ring) > 0) != exterior {
+			reverseRing(ring)
+		}
+	}
+}
+
+// ringArea returns the planar signed area of a ring in square degrees;
+// positive for counterclockwise rings
+func ringArea(ring []Position) float64 {
+	area := 0.0
+	for i := 0; i < len(ring)-1; i++ {
+		area += ring[i].Lon()*ring[i+1].Lat() - ring[i+1].Lon()*ring[i].Lat()
+	}
+	return area / 2
+}
+
+func reverseRing(ring []Position) {
+	for i, j := 0, len(ring)-1; i < j; i, j = i+1, j-1 {
+		ring[i], ring[j] = ring[j], ring[i]
+	}
+}
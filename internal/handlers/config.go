@@ -0,0 +1,20 @@
+package handlers
+
+import (
+	"log"
+
+	"logreason/internal/secrets"
+)
+
+// secretsFile holds the API keys and provider settings, as used by procgeojson
+const secretsFile = "config/secret.json"
+
+// loadSecrets reads the secrets file; self-hosted providers may need none, so a missing or
+// invalid file is only logged
+func loadSecrets() *secrets.Manager {
+	secretsManager := secrets.NewManager()
+	if err := secretsManager.LoadFromFile(secretsFile); err != nil {
+		log.Printf("Warning: Error loading secrets: %v", err)
+	}
+	return secretsManager
+}
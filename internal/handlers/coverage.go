@@ -0,0 +1,151 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/gofiber/fiber/v2"
+
+	"logreason/internal/coverage"
+)
+
+// MinCoverageCellSize is the finest grid resolution accepted by the coverage endpoints, which
+// bounds the memory and time a single request can use
+const MinCoverageCellSize = 25.0
+
+// GetCoverage combines the isochrones of a range into a GeoJSON FeatureCollection holding the
+// union of all stations, the areas reached by 1, 2 and 3+ stations and the overlap of every
+// pair of stations, told apart by the layer property
+func GetCoverage(c *fiber.Ctx) error {
+	dirPath := "out/geojson"
+
+	// Check if directory exists
+	if _, err := os.Stat(dirPath); os.IsNotExist(err) {
+		return c.Status(fiber.StatusNotFound).SendString("GeoJSON directory not found")
+	}
+
+	cellSize := c.QueryFloat("cell", coverage.DefaultCellSize)
+	if cellSize < MinCoverageCellSize {
+		return c.Status(fiber.StatusBadRequest).SendString(fmt.Sprintf("Cell size must be at least %.0f meters", MinCoverageCellSize))
+	}
+
+	levels, fiberErr := coverageLevels(c)
+	if fiberErr != nil {
+		return c.Status(fiberErr.Code).SendString(fiberErr.Message)
+	}
+
+	isochrones, fiberErr := loadCoverageIsochrones(dirPath, c.QueryInt("range", 0))
+	if fiberErr != nil {
+		return c.Status(fiberErr.Code).SendString(fiberErr.Message)
+	}
+
+	result := coverage.Analyze(isochrones, coverage.Options{
+		CellSize: cellSize,
+		MaxLevel: levels,
+	})
+
+	return c.JSON(result.FeatureCollection())
+}
+
+// GetCoverageGaps returns the parts of the operating territory in locations/boundary.geojson
+// that no station reaches within a range, as a GeoJSON FeatureCollection of gap polygons with
+// their area in km², largest first. A summary member compares covered and boundary areas.
+func GetCoverageGaps(c *fiber.Ctx) error {
+	dirPath := "out/geojson"
+	boundaryPath := "locations/boundary.geojson"
+
+	// Check if directory and boundary exist
+	if _, err := os.Stat(dirPath); os.IsNotExist(err) {
+		return c.Status(fiber.StatusNotFound).SendString("GeoJSON directory not found")
+	}
+	if _, err := os.Stat(boundaryPath); os.IsNotExist(err) {
+		return c.Status(fiber.StatusNotFound).SendString("Boundary file not found")
+	}
+
+	cellSize := c.QueryFloat("cell", coverage.DefaultCellSize)
+	if cellSize < MinCoverageCellSize {
+		return c.Status(fiber.StatusBadRequest).SendString(fmt.Sprintf("Cell size must be at least %.0f meters", MinCoverageCellSize))
+	}
+
+	boundary, err := coverage.LoadBoundary(boundaryPath)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).SendString(fmt.Sprintf("Error loading boundary: %v", err))
+	}
+
+	isochrones, fiberErr := loadCoverageIsochrones(dirPath, c.QueryInt("range", 0))
+	if fiberErr != nil {
+		return c.Status(fiberErr.Code).SendString(fiberErr.Message)
+	}
+
+	result := coverage.Gaps(isochrones, boundary, coverage.Options{CellSize: cellSize}, c.QueryFloat("min_area", 0))
+
+	return c.JSON(result.FeatureCollection())
+}
+
+// GetCoveragePopulation returns the residents reached within a range by every station and by
+// all stations together, using the population grid in locations/population.csv or
+// locations/population.geojson
+func GetCoveragePopulation(c *fiber.Ctx) error {
+	dirPath := "out/geojson"
+
+	// Check if directory exists
+	if _, err := os.Stat(dirPath); os.IsNotExist(err) {
+		return c.Status(fiber.StatusNotFound).SendString("GeoJSON directory not found")
+	}
+
+	// Use the first population grid found
+	populationPath := ""
+	for _, candidate := range []string{"locations/population.csv", "locations/population.geojson"} {
+		if _, err := os.Stat(candidate); err == nil {
+			populationPath = candidate
+			break
+		}
+	}
+	if populationPath == "" {
+		return c.Status(fiber.StatusNotFound).SendString("Population grid not found")
+	}
+
+	levels, fiberErr := coverageLevels(c)
+	if fiberErr != nil {
+		return c.Status(fiberErr.Code).SendString(fiberErr.Message)
+	}
+
+	cells, err := coverage.LoadPopulation(populationPath)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).SendString(fmt.Sprintf("Error loading population grid: %v", err))
+	}
+
+	isochrones, fiberErr := loadCoverageIsochrones(dirPath, c.QueryInt("range", 0))
+	if fiberErr != nil {
+		return c.Status(fiberErr.Code).SendString(fiberErr.Message)
+	}
+
+	return c.JSON(coverage.PopulationCoverage(isochrones, cells, levels))
+}
+
+// coverageLevels returns the levels query parameter, which must lie between 1 and
+// coverage.MaxLevelLimit
+func coverageLevels(c *fiber.Ctx) (int, *fiber.Error) {
+	levels := c.QueryInt("levels", coverage.DefaultMaxLevel)
+	if levels < 1 || levels > coverage.MaxLevelLimit {
+		return 0, fiber.NewError(fiber.StatusBadRequest, fmt.Sprintf("Levels must be between 1 and %d", coverage.MaxLevelLimit))
+	}
+	return levels, nil
+}
+
+// loadCoverageIsochrones loads the isochrones of a range. A range without isochrones is
+// not found and several ranges without a selection are a bad request; any other failure to
+// read the files is an internal error.
+func loadCoverageIsochrones(dir string, rangeValue int) ([]coverage.Isochrone, *fiber.Error) {
+	isochrones, err := coverage.Load(dir, rangeValue)
+	switch {
+	case err == nil:
+		return isochrones, nil
+	case errors.Is(err, coverage.ErrNoIsochrones):
+		return nil, fiber.NewError(fiber.StatusNotFound, fmt.Sprintf("Error loading isochrones: %v", err))
+	case errors.Is(err, coverage.ErrMixedRanges):
+		return nil, fiber.NewError(fiber.StatusBadRequest, fmt.Sprintf("Error loading isochrones: %v", err))
+	}
+	return nil, fiber.NewError(fiber.StatusInternalServerError, fmt.Sprintf("Error loading isochrones: %v", err))
+}
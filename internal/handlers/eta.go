@@ -0,0 +1,108 @@
+package handlers
+
+import (
+	"fmt"
+	"os"
+	"sync"
+
+	"github.com/gofiber/fiber/v2"
+
+	"logreason/internal/csvparser"
+	"logreason/internal/geojson"
+	"logreason/internal/routing"
+)
+
+// MaxETAIncidents is the largest number of incidents accepted by one ETA request, which
+// bounds the routing work a single request can cause
+const MaxETAIncidents = 25
+
+// etaMatrix is the cached travel time matrix shared by the ETA requests. It is created on
+// the first request, and again after a failure, from the secrets file.
+var etaMatrix struct {
+	mu     sync.Mutex
+	matrix routing.TravelTimeMatrix
+}
+
+// travelTimeMatrix returns the shared travel time matrix, creating it if needed
+func travelTimeMatrix() (routing.TravelTimeMatrix, error) {
+	etaMatrix.mu.Lock()
+	defer etaMatrix.mu.Unlock()
+
+	if etaMatrix.matrix == nil {
+		matrix, err := routing.NewMatrix(loadSecrets())
+		if err != nil {
+			return nil, err
+		}
+		etaMatrix.matrix = routing.NewCache(matrix, routing.DefaultCacheSize, routing.DefaultCacheTTL)
+	}
+	return etaMatrix.matrix, nil
+}
+
+// etaRequest is the body of an ETA request
+type etaRequest struct {
+	Incidents []routing.Point `json:"incidents"`
+	Mode      string          `json:"mode"`
+	Limit     int             `json:"limit"`
+}
+
+// PostETA ranks the stations of locations/input.csv by travel time to one or more incidents.
+// The body lists the incidents and optionally the travel mode (default drive) and the number
+// of stations returned per incident; every station comes with its travel time in seconds and
+// distance in meters, unreachable stations last.
+func PostETA(c *fiber.Ctx) error {
+	var req etaRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).SendString(fmt.Sprintf("Invalid request body: %v", err))
+	}
+	if len(req.Incidents) == 0 {
+		return c.Status(fiber.StatusBadRequest).SendString("At least one incident is required")
+	}
+	if len(req.Incidents) > MaxETAIncidents {
+		return c.Status(fiber.StatusBadRequest).SendString(fmt.Sprintf("At most %d incidents are accepted per request", MaxETAIncidents))
+	}
+	for i, incident := range req.Incidents {
+		if !incident.Valid() {
+			return c.Status(fiber.StatusBadRequest).SendString(fmt.Sprintf("Incident %d has invalid coordinates", i+1))
+		}
+	}
+	if req.Limit < 0 {
+		return c.Status(fiber.StatusBadRequest).SendString("Limit must not be negative")
+	}
+
+	mode := geojson.ModeDrive
+	if req.Mode != "" {
+		parsed, err := geojson.ParseMode(req.Mode)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).SendString(err.Error())
+		}
+		mode = parsed
+	}
+
+	// Check if file exists
+	if _, err := os.Stat(locationsFile); os.IsNotExist(err) {
+		return c.Status(fiber.StatusNotFound).SendString("CSV file not found")
+	}
+
+	result := csvparser.NewParser().ParseFile(locationsFile)
+	if len(result.Locations) == 0 {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"success": false,
+			"errors":  result.Errors,
+		})
+	}
+
+	matrix, err := travelTimeMatrix()
+	if err != nil {
+		return c.Status(fiber.StatusServiceUnavailable).SendString(fmt.Sprintf("Routing is not available: %v", err))
+	}
+
+	ranked, err := routing.Rank(c.UserContext(), matrix, result.Locations, req.Incidents, mode, req.Limit)
+	if err != nil {
+		return c.Status(fiber.StatusBadGateway).SendString(fmt.Sprintf("Error computing travel times: %v", err))
+	}
+
+	return c.JSON(fiber.Map{
+		"mode":      mode,
+		"incidents": ranked,
+	})
+}
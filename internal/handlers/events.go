@@ -0,0 +1,333 @@
+package handlers
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/websocket/v2"
+
+	"logreason/internal/csvparser"
+	"logreason/internal/events"
+	"logreason/internal/geojson"
+	"logreason/internal/jobs"
+)
+
+// eventsKeepAlive is the delay between two keep-alive messages on an idle event stream
+const eventsKeepAlive = 15 * time.Second
+
+// Limits of a WebSocket event stream
+const (
+	// webSocketReadLimit Largest message accepted from a client; events only flow to the client
+	webSocketReadLimit = 4096
+	// webSocketWriteTimeout Time allowed to write a message before the connection is considered dead
+	webSocketWriteTimeout = 10 * time.Second
+)
+
+// EventsOriginsSetting is the secret or environment variable listing, comma-separated, the
+// origins of other sites allowed to open a WebSocket on GET /api/events, or * for any
+const EventsOriginsSetting = "EVENTS_ALLOWED_ORIGINS"
+
+// Keys of the request locals passed to streamWebSocket
+const (
+	localEventTypes  = "eventTypes"
+	localLastEventID = "lastEventID"
+)
+
+// eventBroker delivers the dataset change notifications to the clients of GET /api/events
+var eventBroker = events.NewBroker(events.DefaultHistory)
+
+// isochroneEvent is the data of an isochrone.regenerated event
+type isochroneEvent struct {
+	Station string `json:"station"`
+	City    string `json:"city,omitempty"`
+	Range   int    `json:"range"`
+	File    string `json:"file"`
+}
+
+// GetEvents streams the dataset change notifications, as Server-Sent Events or, when the
+// request asks for an upgrade, over a WebSocket
+func GetEvents(c *fiber.Ctx) error {
+	types, err := events.ParseTypes(c.Query("types"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).SendString(fmt.Sprintf("Invalid types: %v", err))
+	}
+
+	// EventSource sends the id of the last event received when it reconnects
+	lastEventID := c.Get("Last-Event-ID", c.Query("lastEventId"))
+	var lastID int64
+	if lastEventID != "" {
+		lastID, err = strconv.ParseInt(lastEventID, 10, 64)
+		if err != nil || lastID < 0 {
+			return c.Status(fiber.StatusBadRequest).SendString(fmt.Sprintf("Invalid last event id: %s", lastEventID))
+		}
+	}
+
+	if websocket.IsWebSocketUpgrade(c) {
+		if !allowedOrigin(c) {
+			return c.Status(fiber.StatusForbidden).SendString(fmt.Sprintf("Origin not allowed: %s", c.Get(fiber.HeaderOrigin)))
+		}
+		c.Locals(localEventTypes, types)
+		c.Locals(localLastEventID, lastID)
+		return eventsWebSocket(c)
+	}
+	return streamSSE(c, lastID, types)
+}
+
+// streamSSE writes the events as a text/event-stream until the client disconnects
+func streamSSE(c *fiber.Ctx, lastID int64, types []events.Type) error {
+	c.Set(fiber.HeaderContentType, "text/event-stream")
+	c.Set(fiber.HeaderCacheControl, "no-cache")
+	c.Set(fiber.HeaderConnection, "keep-alive")
+	// Keep reverse proxies such as nginx from buffering the stream
+	c.Set("X-Accel-Buffering", "no")
+
+	subscription, missed := eventBroker.Subscribe(lastID, types...)
+	c.Context().SetBodyStreamWriter(func(w *bufio.Writer) {
+		defer subscription.Close()
+
+		// Ask clients to wait a few seconds before reconnecting
+		fmt.Fprintf(w, "retry: %d\n\n", (3 * time.Second).Milliseconds())
+		for _, event := range missed {
+			writeSSE(w, event)
+		}
+		if err := w.Flush(); err != nil {
+			return
+		}
+
+		keepAlive := time.NewTicker(eventsKeepAlive)
+		defer keepAlive.Stop()
+
+		for {
+			select {
+			case event, ok := <-subscription.C:
+				// A closed channel means the client fell behind; it reconnects and replays
+				if !ok {
+					return
+				}
+				writeSSE(w, event)
+			case <-keepAlive.C:
+				fmt.Fprint(w, ": keep-alive\n\n")
+			}
+			// Writing to a disconnected client fails, which ends the stream
+			if err := w.Flush(); err != nil {
+				return
+			}
+		}
+	})
+	return nil
+}
+
+// writeSSE writes one event in the text/event-stream format
+func writeSSE(w *bufio.Writer, event events.Event) {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return
+	}
+	fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", event.ID, event.Type, data)
+}
+
+// eventsWebSocket upgrades the connection and streams the events over it; the upgrade
+// itself, framing and control frames are handled by the websocket middleware
+var eventsWebSocket = websocket.New(streamWebSocket)
+
+// streamWebSocket sends every event as a JSON text message until the client disconnects.
+// The types and last event id are passed by GetEvents in the locals of the request.
+func streamWebSocket(conn *websocket.Conn) {
+	types, _ := conn.Locals(localEventTypes).([]events.Type)
+	lastID, _ := conn.Locals(localLastEventID).(int64)
+
+	subscription, missed := eventBroker.Subscribe(lastID, types...)
+	defer subscription.Close()
+
+	// Messages sent by the client are ignored, but reading them answers pings and notices
+	// when the client goes away. The connection is released once the handler returns, so
+	// the reader must have stopped by then.
+	conn.SetReadLimit(webSocketReadLimit)
+	closed := make(chan struct{})
+	go func() {
+		defer close(closed)
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}()
+	defer func() {
+		conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""),
+			time.Now().Add(webSocketWriteTimeout))
+		conn.Close()
+		<-closed
+	}()
+
+	send := func(event events.Event) bool {
+		data, err := json.Marshal(event)
+		if err != nil {
+			return false
+		}
+		conn.SetWriteDeadline(time.Now().Add(webSocketWriteTimeout))
+		return conn.WriteMessage(websocket.TextMessage, data) == nil
+	}
+	for _, event := range missed {
+		if !send(event) {
+			return
+		}
+	}
+
+	keepAlive := time.NewTicker(eventsKeepAlive)
+	defer keepAlive.Stop()
+
+	for {
+		select {
+		case <-closed:
+			return
+		case event, ok := <-subscription.C:
+			if !ok || !send(event) {
+				return
+			}
+		case <-keepAlive.C:
+			if conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(webSocketWriteTimeout)) != nil {
+				return
+			}
+		}
+	}
+}
+
+// allowedOrigin reports whether a WebSocket upgrade may proceed. Browsers send the Origin of
+// the page opening the connection and do not apply CORS to WebSockets, so any site could
+// otherwise read the stream of a visitor. Clients sending no Origin, such as command line
+// tools, pages served by this host and the origins listed in EventsOriginsSetting are allowed.
+func allowedOrigin(c *fiber.Ctx) bool {
+	origin := c.Get(fiber.HeaderOrigin)
+	if origin == "" {
+		return true
+	}
+	if u, err := url.Parse(origin); err == nil && strings.EqualFold(u.Host, c.Hostname()) {
+		return true
+	}
+	for _, allowed := range eventsOrigins() {
+		if allowed == "*" || strings.EqualFold(allowed, origin) {
+			return true
+		}
+	}
+	return false
+}
+
+// eventsOrigins reads the origins listed in EventsOriginsSetting once
+var eventsOrigins = sync.OnceValue(func() []string {
+	secretsManager := loadSecrets()
+	secretsManager.LoadFromEnvVar(EventsOriginsSetting)
+
+	value, _ := secretsManager.Get(EventsOriginsSetting)
+	var origins []string
+	for _, origin := range strings.Split(value, ",") {
+		if origin = strings.TrimRight(strings.TrimSpace(origin), "/"); origin != "" {
+			origins = append(origins, origin)
+		}
+	}
+	return origins
+})
+
+// publishedLocations is the version of the locations whose changes were last published. It
+// is shared by the location endpoints and WatchLocations, which both see an edit made through
+// the API, so that the edit is published once.
+var publishedLocations struct {
+	sync.Mutex
+	locations []csvparser.Location
+	known     bool
+}
+
+// publishLocationChanges publishes the stations added, modified or removed in current since
+// the last version published, or since previous when none was
+func publishLocationChanges(previous, current []csvparser.Location) {
+	publishedLocations.Lock()
+	defer publishedLocations.Unlock()
+
+	if publishedLocations.known {
+		previous = publishedLocations.locations
+	}
+	publishStationChanges(csvparser.DiffLocations(previous, current))
+	publishedLocations.locations = current
+	publishedLocations.known = true
+}
+
+// publishStationChanges publishes an event per station added, modified or removed
+func publishStationChanges(diff csvparser.Diff) {
+	for _, location := range diff.Added {
+		eventBroker.Publish(events.TypeStationAdded, location)
+	}
+	for _, location := range diff.Modified {
+		eventBroker.Publish(events.TypeStationModified, location)
+	}
+	for _, location := range diff.Removed {
+		eventBroker.Publish(events.TypeStationRemoved, location)
+	}
+}
+
+// publishedIsochrones records when the jobs of this server published each isochrone file, so
+// that WatchIsochrones does not publish it again once the job saves the manifest
+var publishedIsochrones = struct {
+	sync.Mutex
+	at map[string]time.Time
+}{at: make(map[string]time.Time)}
+
+// publishIsochrone publishes an event when the isochrone of a progress report was written
+func publishIsochrone(p geojson.Progress) {
+	if p.Skipped || p.Err != nil {
+		return
+	}
+	file := geojson.FileName(p.Location, p.Range)
+
+	publishedIsochrones.Lock()
+	publishedIsochrones.at[file] = time.Now()
+	publishedIsochrones.Unlock()
+
+	eventBroker.Publish(events.TypeIsochroneRegenerated, isochroneEvent{
+		Station: p.Location.Name,
+		City:    p.Location.City,
+		Range:   p.Range,
+		File:    file,
+	})
+}
+
+// publishManifestChanges publishes an event for every isochrone fetched again between two
+// versions of the output directory manifest, unless a job of this server published it already
+func publishManifestChanges(previous, current *geojson.Manifest) {
+	publishedIsochrones.Lock()
+	defer publishedIsochrones.Unlock()
+
+	var files []string
+	for file := range current.Entries {
+		files = append(files, file)
+	}
+	sort.Strings(files)
+
+	for _, file := range files {
+		entry := current.Entries[file]
+		if old, ok := previous.Entries[file]; ok && !entry.FetchedAt.After(old.FetchedAt) {
+			continue
+		}
+		// The manifest truncates the fetch time to the second, before the job published it
+		if at, ok := publishedIsochrones.at[file]; ok && !at.Before(entry.FetchedAt) {
+			continue
+		}
+		eventBroker.Publish(events.TypeIsochroneRegenerated, isochroneEvent{
+			Station: entry.Station,
+			City:    entry.City,
+			Range:   entry.Range,
+			File:    file,
+		})
+	}
+}
+
+// publishJob publishes an event when a regeneration job finished
+func publishJob(job jobs.Job) {
+	eventBroker.Publish(events.TypeJobFinished, job)
+}
@@ -2,19 +2,45 @@
 package handlers
 
 import (
+	"bytes"
 	"encoding/json"
 	"fmt"
 	"log"
 	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
 
 	"github.com/gofiber/fiber/v2"
+
+	"logreason/internal/geojson"
 )
 
-// GetAllGeoJson returns all GeoJSON files from out/geojson directory as a combined JSON array
+// GetAllGeoJson returns all GeoJSON files from out/geojson directory as a combined JSON array,
+// as a single FeatureCollection with format=featurecollection, or as a KML, GPX, Shapefile or
+// GeoPackage download (see geoJsonFormat).
+// An optional range query parameter restricts the result to one travel-time band, while the
+// simplify and precision parameters lighten the geometries (see simplifyOptions).
 func GetAllGeoJson(c *fiber.Ctx) error {
+	return allGeoJson(c, formatArray)
+}
+
+// allGeoJson implements GetAllGeoJson with the format used when none is requested
+func allGeoJson(c *fiber.Ctx, defaultFormat string) error {
 	dirPath := "out/geojson"
+	rangeValue, fiberErr := rangeQuery(c)
+	if fiberErr != nil {
+		return c.Status(fiberErr.Code).SendString(fiberErr.Message)
+	}
+
+	opts, err := simplifyOptions(c)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).SendString(err.Error())
+	}
+	format, err := geoJsonFormat(c, defaultFormat)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).SendString(err.Error())
+	}
 
 	// Check if directory exists
 	if _, err := os.Stat(dirPath); os.IsNotExist(err) {
@@ -22,88 +48,122 @@ func GetAllGeoJson(c *fiber.Ctx) error {
 	}
 
 	// Read all files in the directory
-	entries, err := os.ReadDir(dirPath)
+	names, err := geojson.ListFiles(dirPath, rangeValue)
 	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).SendString(fmt.Sprintf("Error reading directory: %v", err))
 	}
 
-	// Combine all GeoJSON files
-	var result []json.RawMessage
-
-	for _, entry := range entries {
-		if !entry.IsDir() && strings.HasSuffix(entry.Name(), ".json") {
-			filePath := filepath.Join(dirPath, entry.Name())
-
-			// Read file content
-			content, err := os.ReadFile(filePath)
-			if err != nil {
-				log.Printf("Error reading file %s: %v", filePath, err)
-				continue
-			}
+	var filePaths []string
+	for _, name := range names {
+		filePaths = append(filePaths, filepath.Join(dirPath, name))
+	}
 
-			// Parse JSON
-			var jsonData json.RawMessage
-			if err := json.Unmarshal(content, &jsonData); err != nil {
-				log.Printf("Error parsing JSON from file %s: %v", filePath, err)
-				continue
-			}
+	// Combine all GeoJSON files
+	result, _ := combineGeoJson(filePaths, opts, format)
 
-			result = append(result, jsonData)
-		}
+	if exportFormat, ok := asExportFormat(format); ok {
+		return sendExport(c, exportFormat, result.(*geojson.FeatureCollection), exportName("isochrones", rangeValue))
 	}
-
 	return c.JSON(result)
 }
 
-// GetGeoJsonByName returns a specific GeoJSON file by name as a JSON object
+// GetGeoJsonCollection returns the GeoJSON files as a single RFC 7946 FeatureCollection, every
+// feature tagged with the file it comes from in the source property. Like GetFilteredGeoJson it
+// accepts a names parameter, without which every file is included, and a range parameter.
+func GetGeoJsonCollection(c *fiber.Ctx) error {
+	if c.Query("names") != "" {
+		return filteredGeoJson(c, formatFeatureCollection)
+	}
+	return allGeoJson(c, formatFeatureCollection)
+}
+
+// GetGeoJsonByName returns a specific GeoJSON file by name as a JSON object, or converted to
+// an export format when one is requested.
+// The name either includes the range (APMPAD-padernoDugnano-600) or is combined
+// with the range query parameter (APMPAD-padernoDugnano?range=600).
 func GetGeoJsonByName(c *fiber.Ctx) error {
 	name := c.Params("name")
 	if name == "" {
 		return c.Status(fiber.StatusBadRequest).SendString("Name parameter is required")
 	}
 
-	filePath := filepath.Join("out/geojson", name+".json")
+	opts, err := simplifyOptions(c)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).SendString(err.Error())
+	}
+	format, err := geoJsonFormat(c, formatArray)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).SendString(err.Error())
+	}
+
+	rangeValue, fiberErr := rangeQuery(c)
+	if fiberErr != nil {
+		return c.Status(fiberErr.Code).SendString(fiberErr.Message)
+	}
+
+	filePath := geoJsonFilePath("out/geojson", name, rangeValue)
 
 	// Check if file exists
 	if _, err := os.Stat(filePath); os.IsNotExist(err) {
 		return c.Status(fiber.StatusNotFound).SendString(fmt.Sprintf("GeoJSON file %s not found", name))
 	}
 
-	// Read file content
-	content, err := os.ReadFile(filePath)
-	if err != nil {
-		return c.Status(fiber.StatusInternalServerError).SendString(fmt.Sprintf("Error reading file: %v", err))
+	if exportFormat, ok := asExportFormat(format); ok {
+		fc, err := readFeatureCollection(filePath, opts)
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).SendString(fmt.Sprintf("Error reading GeoJSON: %v", err))
+		}
+		source := strings.TrimSuffix(filepath.Base(filePath), ".json")
+		merged := geojson.Merge([]string{source}, []*geojson.FeatureCollection{fc})
+		return sendExport(c, exportFormat, merged, source)
 	}
 
-	// Parse JSON
-	var jsonData json.RawMessage
-	if err := json.Unmarshal(content, &jsonData); err != nil {
-		return c.Status(fiber.StatusInternalServerError).SendString(fmt.Sprintf("Error parsing JSON: %v", err))
+	jsonData, err := readGeoJson(filePath, opts)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).SendString(fmt.Sprintf("Error reading GeoJSON: %v", err))
 	}
 
 	return c.JSON(jsonData)
 }
 
-// GetFilteredGeoJson returns multiple specific GeoJSON files as a combined JSON array
+// GetFilteredGeoJson returns multiple specific GeoJSON files as a combined JSON array,
+// as a single FeatureCollection with format=featurecollection, or in an export format.
+// An optional range query parameter selects the travel-time band for every name.
 func GetFilteredGeoJson(c *fiber.Ctx) error {
+	return filteredGeoJson(c, formatArray)
+}
+
+// filteredGeoJson implements GetFilteredGeoJson with the format used when none is requested
+func filteredGeoJson(c *fiber.Ctx, defaultFormat string) error {
 	namesParam := c.Query("names")
 	if namesParam == "" {
 		return c.Status(fiber.StatusBadRequest).SendString("Names parameter is required")
 	}
+	rangeValue, fiberErr := rangeQuery(c)
+	if fiberErr != nil {
+		return c.Status(fiberErr.Code).SendString(fiberErr.Message)
+	}
+
+	opts, err := simplifyOptions(c)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).SendString(err.Error())
+	}
+	format, err := geoJsonFormat(c, defaultFormat)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).SendString(err.Error())
+	}
 
 	// Split names by comma
 	names := strings.Split(namesParam, ",")
 
-	// Combine specified GeoJSON files
-	var result []json.RawMessage
-
+	var filePaths []string
 	for _, name := range names {
 		name = strings.TrimSpace(name)
 		if name == "" {
 			continue
 		}
 
-		filePath := filepath.Join("out/geojson", name+".json")
+		filePath := geoJsonFilePath("out/geojson", name, rangeValue)
 
 		// Check if file exists
 		if _, err := os.Stat(filePath); os.IsNotExist(err) {
@@ -111,26 +171,202 @@ func GetFilteredGeoJson(c *fiber.Ctx) error {
 			continue
 		}
 
-		// Read file content
-		content, err := os.ReadFile(filePath)
+		filePaths = append(filePaths, filePath)
+	}
+
+	// Combine specified GeoJSON files
+	result, count := combineGeoJson(filePaths, opts, format)
+	if count == 0 {
+		return c.Status(fiber.StatusNotFound).SendString("No valid GeoJSON files found for the specified names")
+	}
+
+	if exportFormat, ok := asExportFormat(format); ok {
+		return sendExport(c, exportFormat, result.(*geojson.FeatureCollection), exportName("isochrones", rangeValue))
+	}
+	return c.JSON(result)
+}
+
+// rangeQuery reads the optional range query parameter, 0 when it is missing. A range that is
+// present must be a positive number of seconds, rather than silently selecting every band.
+func rangeQuery(c *fiber.Ctx) (int, *fiber.Error) {
+	value := c.Query("range")
+	if value == "" {
+		return 0, nil
+	}
+	rangeValue, err := strconv.Atoi(value)
+	if err != nil || rangeValue <= 0 {
+		return 0, fiber.NewError(fiber.StatusBadRequest, fmt.Sprintf("Invalid range value %s", value))
+	}
+	return rangeValue, nil
+}
+
+// geoJsonFilePath returns the path of the file for a name, appending the range when one is given
+func geoJsonFilePath(dirPath, name string, rangeValue int) string {
+	if rangeValue > 0 {
+		name = fmt.Sprintf("%s-%d", name, rangeValue)
+	}
+	return filepath.Join(dirPath, filepath.Base(name)+".json")
+}
+
+// simplifyOptions reads the simplify (tolerance in meters), algorithm and precision (decimal
+// digits) query parameters shared by the GeoJSON endpoints
+func simplifyOptions(c *fiber.Ctx) (geojson.SimplifyOptions, error) {
+	algorithm, err := geojson.ParseSimplifyAlgorithm(c.Query("algorithm"))
+	if err != nil {
+		return geojson.SimplifyOptions{}, err
+	}
+
+	opts := geojson.SimplifyOptions{
+		Tolerance: c.QueryFloat("simplify", 0),
+		Algorithm: algorithm,
+		Precision: c.QueryInt("precision", 0),
+	}
+	return opts, opts.Validate()
+}
+
+// Formats of the combined GeoJSON endpoints
+const (
+	// formatArray is a JSON array holding one GeoJSON document per file
+	formatArray = "array"
+	// formatFeatureCollection is a single FeatureCollection holding the features of every file
+	formatFeatureCollection = "featurecollection"
+)
+
+// geoJsonFormat reads the format query parameter of the GeoJSON endpoints: array,
+// featurecollection or one of the export formats (kml, kmz, gpx, shp, gpkg). Without the
+// parameter the format is negotiated from the Accept header, GeoJSON being preferred.
+func geoJsonFormat(c *fiber.Ctx, defaultFormat string) (string, error) {
+	format := strings.ToLower(c.Query("format"))
+	if format == "" {
+		return acceptedFormat(c, defaultFormat), nil
+	}
+
+	switch format {
+	case formatArray, formatFeatureCollection:
+		return format, nil
+	}
+	if exportFormat, err := geojson.ParseExportFormat(format); err == nil {
+		return string(exportFormat), nil
+	}
+
+	formats := []string{formatArray, formatFeatureCollection}
+	for _, exportFormat := range geojson.ExportFormats() {
+		formats = append(formats, string(exportFormat))
+	}
+	return "", fmt.Errorf("unknown format %q, expected one of %s", format, strings.Join(formats, ", "))
+}
+
+// acceptedFormat picks the format matching the Accept header of the request
+func acceptedFormat(c *fiber.Ctx, defaultFormat string) string {
+	offers := []string{fiber.MIMEApplicationJSON, "application/geo+json"}
+	for _, exportFormat := range geojson.ExportFormats() {
+		offers = append(offers, exportFormat.ContentType())
+	}
+
+	accepted := c.Accepts(offers...)
+	for _, exportFormat := range geojson.ExportFormats() {
+		if accepted == exportFormat.ContentType() {
+			return string(exportFormat)
+		}
+	}
+	return defaultFormat
+}
+
+// asExportFormat reports whether a format returned by geoJsonFormat is an export format
+func asExportFormat(format string) (geojson.ExportFormat, bool) {
+	if format == formatArray || format == formatFeatureCollection {
+		return "", false
+	}
+	exportFormat, err := geojson.ParseExportFormat(format)
+	return exportFormat, err == nil
+}
+
+// exportName returns the name of a downloaded file, without extension
+func exportName(name string, rangeValue int) string {
+	if rangeValue > 0 {
+		return fmt.Sprintf("%s-%d", name, rangeValue)
+	}
+	return name
+}
+
+// sendExport sends the features as an attachment in an export format
+func sendExport(c *fiber.Ctx, format geojson.ExportFormat, fc *geojson.FeatureCollection, name string) error {
+	var buf bytes.Buffer
+	if err := geojson.Export(&buf, format, fc); err != nil {
+		return c.Status(fiber.StatusInternalServerError).SendString(fmt.Sprintf("Error exporting %s: %v", format, err))
+	}
+
+	c.Attachment(name + "." + format.Extension())
+	c.Set(fiber.HeaderContentType, format.ContentType())
+	return c.Send(buf.Bytes())
+}
+
+// combineGeoJson reads the files as a JSON array of documents or, in the featurecollection
+// and export formats, as one FeatureCollection tagging every feature with the file it comes from.
+// Files that cannot be read are skipped; the number of files combined is returned.
+func combineGeoJson(filePaths []string, opts geojson.SimplifyOptions, format string) (interface{}, int) {
+	if format != formatArray {
+		var sources []string
+		var collections []*geojson.FeatureCollection
+		for _, filePath := range filePaths {
+			fc, err := readFeatureCollection(filePath, opts)
+			if err != nil {
+				log.Printf("Error reading GeoJSON file %s: %v", filePath, err)
+				continue
+			}
+			sources = append(sources, strings.TrimSuffix(filepath.Base(filePath), ".json"))
+			collections = append(collections, fc)
+		}
+		return geojson.Merge(sources, collections), len(collections)
+	}
+
+	var result []json.RawMessage
+	for _, filePath := range filePaths {
+		jsonData, err := readGeoJson(filePath, opts)
 		if err != nil {
-			log.Printf("Error reading file %s: %v", filePath, err)
+			log.Printf("Error reading GeoJSON file %s: %v", filePath, err)
 			continue
 		}
+		result = append(result, jsonData)
+	}
+	return result, len(result)
+}
 
-		// Parse JSON
+// readGeoJson reads a GeoJSON file, simplifying its geometries when the options ask for it
+func readGeoJson(filePath string, opts geojson.SimplifyOptions) (json.RawMessage, error) {
+	// Serve the file as stored unless it needs to be simplified
+	if !opts.Enabled() {
+		content, err := os.ReadFile(filePath)
+		if err != nil {
+			return nil, err
+		}
 		var jsonData json.RawMessage
 		if err := json.Unmarshal(content, &jsonData); err != nil {
-			log.Printf("Error parsing JSON from file %s: %v", filePath, err)
-			continue
+			return nil, err
 		}
+		return jsonData, nil
+	}
 
-		result = append(result, jsonData)
+	fc, err := readFeatureCollection(filePath, opts)
+	if err != nil {
+		return nil, err
 	}
+	return json.Marshal(fc)
+}
 
-	if len(result) == 0 {
-		return c.Status(fiber.StatusNotFound).SendString("No valid GeoJSON files found for the specified names")
+// readFeatureCollection decodes a GeoJSON file and simplifies it according to the options
+func readFeatureCollection(filePath string, opts geojson.SimplifyOptions) (*geojson.FeatureCollection, error) {
+	content, err := os.ReadFile(filePath)
+	if err != nil {
+		return nil, err
 	}
 
-	return c.JSON(result)
+	var fc geojson.FeatureCollection
+	if err := json.Unmarshal(content, &fc); err != nil {
+		return nil, err
+	}
+	if opts.Enabled() {
+		fc.Simplify(opts)
+	}
+	return &fc, nil
 }
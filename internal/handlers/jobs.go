@@ -0,0 +1,200 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+
+	"logreason/internal/csvparser"
+	"logreason/internal/geojson"
+	"logreason/internal/jobs"
+)
+
+// DefaultRegenerateRange is the range regenerated when none is given and the output
+// directory holds no isochrones yet, as for procgeojson
+const DefaultRegenerateRange = 600
+
+// outputLockTimeout is how long a job waits for a procgeojson run, or a job of another
+// server, writing to the output directory to finish
+const outputLockTimeout = 15 * time.Minute
+
+// jobRunner runs the regeneration jobs one at a time, publishing an event as each finishes
+var jobRunner = jobs.NewRunner(jobs.WithOnFinish(publishJob))
+
+// regenerateRequest is the body of a regeneration request; every field is optional
+type regenerateRequest struct {
+	Stations []string `json:"stations"`
+	Ranges   []int    `json:"ranges"`
+	Mode     string   `json:"mode"`
+	Type     string   `json:"type"`
+	Force    bool     `json:"force"`
+}
+
+// PostRegenerateJob starts regenerating the isochrones of locations/input.csv into out/geojson
+// in the background and returns the job with 202 Accepted. The body may restrict the job to
+// some stations and ranges; without ranges, those already in out/geojson are regenerated.
+// Only one job runs at a time: while one is running, 409 Conflict is returned with it.
+func PostRegenerateJob(c *fiber.Ctx) error {
+	var req regenerateRequest
+	if len(c.Body()) > 0 {
+		if err := c.BodyParser(&req); err != nil {
+			return c.Status(fiber.StatusBadRequest).SendString(fmt.Sprintf("Invalid request body: %v", err))
+		}
+	}
+
+	opts := []geojson.Option{geojson.WithForce(req.Force)}
+	if req.Mode != "" {
+		mode, err := geojson.ParseMode(req.Mode)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).SendString(err.Error())
+		}
+		opts = append(opts, geojson.WithMode(mode))
+	}
+	if req.Type != "" {
+		isolineType, err := geojson.ParseIsolineType(req.Type)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).SendString(err.Error())
+		}
+		opts = append(opts, geojson.WithType(isolineType))
+	}
+	for _, rangeValue := range req.Ranges {
+		if rangeValue <= 0 {
+			return c.Status(fiber.StatusBadRequest).SendString(fmt.Sprintf("Invalid range value %d", rangeValue))
+		}
+	}
+
+	// Check if file exists
+	if _, err := os.Stat(locationsFile); os.IsNotExist(err) {
+		return c.Status(fiber.StatusNotFound).SendString("CSV file not found")
+	}
+	result := csvparser.NewParser().ParseFile(locationsFile)
+	if len(result.Locations) == 0 {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"success": false,
+			"errors":  result.Errors,
+		})
+	}
+
+	locations, missing := selectLocations(result.Locations, req.Stations)
+	if len(missing) > 0 {
+		return c.Status(fiber.StatusBadRequest).SendString(fmt.Sprintf("Unknown stations: %s", strings.Join(missing, ", ")))
+	}
+
+	// Repeated stations or ranges would have two workers write the same file
+	ranges := uniqueRanges(req.Ranges)
+	if len(ranges) == 0 {
+		ranges = savedRanges(geojson.DefaultOutputDir)
+	}
+	var stations []string
+	if len(req.Stations) > 0 {
+		for _, location := range locations {
+			stations = append(stations, location.Name)
+		}
+	}
+
+	params := jobs.Params{Stations: stations, Ranges: ranges, Total: len(locations) * len(ranges)}
+	job, err := jobRunner.Start(params, regenerateTask(locations, ranges, opts))
+	if errors.Is(err, jobs.ErrRunning) {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"message": err.Error(),
+			"job":     job,
+		})
+	}
+
+	c.Set(fiber.HeaderLocation, "/api/jobs/"+job.ID)
+	return c.Status(fiber.StatusAccepted).JSON(job)
+}
+
+// GetJob returns the progress of a regeneration job: the isochrones processed so far with
+// their errors and duration, and the job timing
+func GetJob(c *fiber.Ctx) error {
+	job, ok := jobRunner.Get(c.Params("id"))
+	if !ok {
+		return c.Status(fiber.StatusNotFound).SendString(fmt.Sprintf("Job %s not found", c.Params("id")))
+	}
+	return c.JSON(job)
+}
+
+// regenerateTask returns a job task fetching the isochrones of the locations with a Manager
+// configured from the secrets file
+func regenerateTask(locations []csvparser.Location, ranges []int, opts []geojson.Option) jobs.Task {
+	return func(ctx context.Context, progress func(geojson.Progress)) []error {
+		notify := func(p geojson.Progress) {
+			progress(p)
+			publishIsochrone(p)
+		}
+		manager, err := geojson.NewManager(loadSecrets(), append(opts, geojson.WithProgress(notify))...)
+		if err != nil {
+			return []error{fmt.Errorf("failed to create GeoJSON manager: %w", err)}
+		}
+
+		// The runner only keeps jobs of this process apart; the lock keeps procgeojson and
+		// other servers from writing the same files and manifest at the same time
+		lock, err := csvparser.LockFile(geojson.DefaultOutputDir, outputLockTimeout)
+		if err != nil {
+			return []error{fmt.Errorf("failed to lock the output directory: %w", err)}
+		}
+		defer lock.Unlock()
+
+		return manager.ProcessLocationsContext(ctx, locations, ranges...)
+	}
+}
+
+// selectLocations returns the locations with the given names, compared case-insensitively,
+// or every location without names, along with the names not found. A location named more
+// than once is selected once.
+func selectLocations(locations []csvparser.Location, names []string) ([]csvparser.Location, []string) {
+	if len(names) == 0 {
+		return locations, nil
+	}
+
+	var selected []csvparser.Location
+	var missing []string
+	seen := make(map[int]bool)
+	for _, name := range names {
+		i := findLocation(locations, strings.TrimSpace(name))
+		if i < 0 {
+			missing = append(missing, name)
+			continue
+		}
+		if !seen[i] {
+			seen[i] = true
+			selected = append(selected, locations[i])
+		}
+	}
+	return selected, missing
+}
+
+// uniqueRanges returns the ranges sorted without repetitions
+func uniqueRanges(ranges []int) []int {
+	unique := append([]int(nil), ranges...)
+	sort.Ints(unique)
+	return slices.Compact(unique)
+}
+
+// savedRanges returns the ranges of the isochrone files in dir, or the default range when
+// there are none
+func savedRanges(dir string) []int {
+	names, err := geojson.ListFiles(dir, 0)
+	if err != nil {
+		return []int{DefaultRegenerateRange}
+	}
+
+	var ranges []int
+	for _, name := range names {
+		if _, rangeValue := geojson.ParseFileName(name); rangeValue > 0 {
+			ranges = append(ranges, rangeValue)
+		}
+	}
+	if len(ranges) == 0 {
+		return []int{DefaultRegenerateRange}
+	}
+	return uniqueRanges(ranges)
+}
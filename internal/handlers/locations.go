@@ -2,31 +2,35 @@
 package handlers
 
 import (
+	"errors"
+	"fmt"
+	"net/url"
 	"os"
+	"strings"
 
 	"github.com/gofiber/fiber/v2"
 
 	"logreason/internal/csvparser"
 )
 
+// locationsFile is the CSV file of the stations, read by every endpoint and edited by the
+// location endpoints
+const locationsFile = "locations/input.csv"
+
 // GetLocationsCsv returns the locations/input.csv file as an attachment
 func GetLocationsCsv(c *fiber.Ctx) error {
-	filePath := "locations/input.csv"
-
 	// Check if file exists
-	if _, err := os.Stat(filePath); os.IsNotExist(err) {
+	if _, err := os.Stat(locationsFile); os.IsNotExist(err) {
 		return c.Status(fiber.StatusNotFound).SendString("CSV file not found")
 	}
 
-	return c.Download(filePath, "input.csv")
+	return c.Download(locationsFile, "input.csv")
 }
 
 // GetLocationsJson returns the parsed content of locations/input.csv as a JSON array
 func GetLocationsJson(c *fiber.Ctx) error {
-	filePath := "locations/input.csv"
-
 	// Check if file exists
-	if _, err := os.Stat(filePath); os.IsNotExist(err) {
+	if _, err := os.Stat(locationsFile); os.IsNotExist(err) {
 		return c.Status(fiber.StatusNotFound).SendString("CSV file not found")
 	}
 
@@ -34,7 +38,7 @@ func GetLocationsJson(c *fiber.Ctx) error {
 	parser := csvparser.NewParser()
 
 	// Parse the CSV file
-	result := parser.ParseFile(filePath)
+	result := parser.ParseFile(locationsFile)
 
 	// Check if parsing was successful
 	if !result.Success && len(result.Locations) == 0 {
@@ -45,4 +49,186 @@ func GetLocationsJson(c *fiber.Ctx) error {
 	}
 
 	return c.JSON(result.Locations)
-}
\ No newline at end of file
+}
+
+// PostLocation adds the location in the request body to locations/input.csv and returns the
+// updated list. Names must be unique.
+func PostLocation(c *fiber.Ctx) error {
+	body, fiberErr := locationFromBody(c)
+	if fiberErr != nil {
+		return c.Status(fiberErr.Code).SendString(fiberErr.Message)
+	}
+	if body.Latitude == nil || body.Longitude == nil {
+		return c.Status(fiber.StatusBadRequest).SendString("Invalid location: latitude and longitude are required")
+	}
+	location, fiberErr := body.apply(csvparser.Location{})
+	if fiberErr != nil {
+		return c.Status(fiberErr.Code).SendString(fiberErr.Message)
+	}
+
+	return updateLocations(c, fiber.StatusCreated, func(locations []csvparser.Location) ([]csvparser.Location, error) {
+		if findLocation(locations, location.Name) >= 0 {
+			return nil, fiber.NewError(fiber.StatusConflict, fmt.Sprintf("Location %s already exists", location.Name))
+		}
+		return append(locations, location), nil
+	})
+}
+
+// PutLocation updates the location with the given name with the fields of the request body,
+// which may rename it, and returns the updated list. Fields missing from the body keep their
+// current value.
+func PutLocation(c *fiber.Ctx) error {
+	name, fiberErr := locationName(c)
+	if fiberErr != nil {
+		return c.Status(fiberErr.Code).SendString(fiberErr.Message)
+	}
+	body, fiberErr := locationFromBody(c)
+	if fiberErr != nil {
+		return c.Status(fiberErr.Code).SendString(fiberErr.Message)
+	}
+
+	return updateLocations(c, fiber.StatusOK, func(locations []csvparser.Location) ([]csvparser.Location, error) {
+		i := findLocation(locations, name)
+		if i < 0 {
+			return nil, fiber.NewError(fiber.StatusNotFound, fmt.Sprintf("Location %s not found", name))
+		}
+		location, fiberErr := body.apply(locations[i])
+		if fiberErr != nil {
+			return nil, fiberErr
+		}
+		if j := findLocation(locations, location.Name); j >= 0 && j != i {
+			return nil, fiber.NewError(fiber.StatusConflict, fmt.Sprintf("Location %s already exists", location.Name))
+		}
+		locations[i] = location
+		return locations, nil
+	})
+}
+
+// DeleteLocation removes the location with the given name and returns the updated list
+func DeleteLocation(c *fiber.Ctx) error {
+	name, fiberErr := locationName(c)
+	if fiberErr != nil {
+		return c.Status(fiberErr.Code).SendString(fiberErr.Message)
+	}
+
+	return updateLocations(c, fiber.StatusOK, func(locations []csvparser.Location) ([]csvparser.Location, error) {
+		i := findLocation(locations, name)
+		if i < 0 {
+			return nil, fiber.NewError(fiber.StatusNotFound, fmt.Sprintf("Location %s not found", name))
+		}
+		return append(locations[:i], locations[i+1:]...), nil
+	})
+}
+
+// updateLocations applies a change to the locations of the CSV file while holding its lock,
+// saves them, publishes the stations changed to GET /api/events and sends the list read back
+// from the file. The change returns a *fiber.Error when the request cannot be applied. Files
+// with parse errors are not rewritten, as the rows in error would be lost.
+func updateLocations(c *fiber.Ctx, status int, change func([]csvparser.Location) ([]csvparser.Location, error)) error {
+	// Check if file exists
+	if _, err := os.Stat(locationsFile); os.IsNotExist(err) {
+		return c.Status(fiber.StatusNotFound).SendString("CSV file not found")
+	}
+
+	lock, err := csvparser.LockFile(locationsFile, csvparser.DefaultLockTimeout)
+	if err != nil {
+		return c.Status(fiber.StatusServiceUnavailable).SendString(fmt.Sprintf("Error locking CSV file: %v", err))
+	}
+	defer lock.Unlock()
+
+	parser := csvparser.NewParser()
+	result := parser.ParseFile(locationsFile)
+	if !result.Success {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"success": false,
+			"message": "The CSV file has errors; fix them before editing locations",
+			"errors":  result.Errors,
+		})
+	}
+
+	locations, err := change(result.Locations)
+	if err != nil {
+		var fiberErr *fiber.Error
+		if errors.As(err, &fiberErr) {
+			return c.Status(fiberErr.Code).SendString(fiberErr.Message)
+		}
+		return c.Status(fiber.StatusInternalServerError).SendString(err.Error())
+	}
+
+	if err := parser.UpdateFile(locationsFile, locations); err != nil {
+		return c.Status(fiber.StatusInternalServerError).SendString(fmt.Sprintf("Error writing CSV file: %v", err))
+	}
+
+	updated := parser.ParseFile(locationsFile)
+	if updated.Locations == nil {
+		updated.Locations = []csvparser.Location{}
+	}
+	publishLocationChanges(result.Locations, updated.Locations)
+	return c.Status(status).JSON(updated.Locations)
+}
+
+// locationBody is a location in a request body; fields left out of the body are nil, so
+// that a missing coordinate is not mistaken for 0
+type locationBody struct {
+	Name      *string  `json:"name" form:"name"`
+	City      *string  `json:"city" form:"city"`
+	Latitude  *float64 `json:"latitude" form:"latitude"`
+	Longitude *float64 `json:"longitude" form:"longitude"`
+}
+
+// locationFromBody reads the location in the request body
+func locationFromBody(c *fiber.Ctx) (locationBody, *fiber.Error) {
+	var body locationBody
+	if err := c.BodyParser(&body); err != nil {
+		return body, fiber.NewError(fiber.StatusBadRequest, fmt.Sprintf("Invalid request body: %v", err))
+	}
+	return body, nil
+}
+
+// apply sets the fields given in the body on a location and validates the result
+func (b locationBody) apply(location csvparser.Location) (csvparser.Location, *fiber.Error) {
+	if b.Name != nil {
+		location.Name = *b.Name
+	}
+	if b.City != nil {
+		location.City = *b.City
+	}
+	if b.Latitude != nil {
+		location.Latitude = *b.Latitude
+	}
+	if b.Longitude != nil {
+		location.Longitude = *b.Longitude
+	}
+	location = normalizeLocation(location)
+	if err := location.Validate(); err != nil {
+		return location, fiber.NewError(fiber.StatusBadRequest, fmt.Sprintf("Invalid location: %v", err))
+	}
+	return location, nil
+}
+
+// locationName returns the unescaped name path parameter
+func locationName(c *fiber.Ctx) (string, *fiber.Error) {
+	name, err := url.PathUnescape(c.Params("name"))
+	if err != nil || strings.TrimSpace(name) == "" {
+		return "", fiber.NewError(fiber.StatusBadRequest, "Name parameter is required")
+	}
+	return strings.TrimSpace(name), nil
+}
+
+// normalizeLocation trims the name and city, as the CSV parser does when reading them back
+func normalizeLocation(location csvparser.Location) csvparser.Location {
+	location.Name = strings.TrimSpace(location.Name)
+	location.City = strings.TrimSpace(location.City)
+	return location
+}
+
+// findLocation returns the index of the location with a name, compared case-insensitively,
+// or -1
+func findLocation(locations []csvparser.Location, name string) int {
+	for i, location := range locations {
+		if strings.EqualFold(location.Name, name) {
+			return i
+		}
+	}
+	return -1
+}
@@ -0,0 +1,45 @@
+package handlers
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+
+	"github.com/gofiber/fiber/v2"
+
+	"logreason/internal/reach"
+)
+
+// reachCache keeps the isochrone index between requests, rebuilding it when files change
+var reachCache = reach.NewCache(reachDir, locationsFile)
+
+const reachDir = "out/geojson"
+
+// GetReach returns the stations whose isochrones contain a point, grouped by range band
+// with the shortest range first
+func GetReach(c *fiber.Ctx) error {
+	lat, err := strconv.ParseFloat(c.Query("lat"), 64)
+	if err != nil || lat < -90 || lat > 90 {
+		return c.Status(fiber.StatusBadRequest).SendString("A valid lat parameter is required")
+	}
+	lon, err := strconv.ParseFloat(c.Query("lon"), 64)
+	if err != nil || lon < -180 || lon > 180 {
+		return c.Status(fiber.StatusBadRequest).SendString("A valid lon parameter is required")
+	}
+
+	// Check if directory exists
+	if _, err := os.Stat(reachDir); os.IsNotExist(err) {
+		return c.Status(fiber.StatusNotFound).SendString("GeoJSON directory not found")
+	}
+
+	index, err := reachCache.Index()
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).SendString(fmt.Sprintf("Error loading isochrones: %v", err))
+	}
+
+	return c.JSON(fiber.Map{
+		"latitude":  lat,
+		"longitude": lon,
+		"bands":     index.Bands(lat, lon),
+	})
+}
@@ -0,0 +1,47 @@
+package handlers
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+
+	"github.com/gofiber/fiber/v2"
+
+	"logreason/internal/tiles"
+)
+
+// tileCache keeps the projected isochrones and the most recently served tiles between requests,
+// discarding them when files change
+var tileCache = tiles.NewCache(tilesDir, tiles.DefaultCacheSize)
+
+const tilesDir = "out/geojson"
+
+// GetTile returns the isochrones and station points of a tile as a Mapbox Vector Tile with an
+// isochrones and a stations layer. An optional range query parameter restricts the isochrones
+// to one travel-time band. Tiles without features are answered with 204 No Content.
+func GetTile(c *fiber.Ctx) error {
+	var tile tiles.TileID
+	var errZ, errX, errY error
+	tile.Z, errZ = strconv.Atoi(c.Params("z"))
+	tile.X, errX = strconv.Atoi(c.Params("x"))
+	tile.Y, errY = strconv.Atoi(c.Params("y"))
+	if errZ != nil || errX != nil || errY != nil || !tile.Valid() {
+		return c.Status(fiber.StatusBadRequest).SendString(fmt.Sprintf("Invalid tile coordinates, zoom must be between 0 and %d", tiles.MaxZoom))
+	}
+
+	// Check if directory exists
+	if _, err := os.Stat(tilesDir); os.IsNotExist(err) {
+		return c.Status(fiber.StatusNotFound).SendString("GeoJSON directory not found")
+	}
+
+	data, err := tileCache.Tile(tile, c.QueryInt("range", 0))
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).SendString(fmt.Sprintf("Error rendering tile %s: %v", tile, err))
+	}
+	if len(data) == 0 {
+		return c.SendStatus(fiber.StatusNoContent)
+	}
+
+	c.Set(fiber.HeaderContentType, tiles.ContentType)
+	return c.Send(data)
+}
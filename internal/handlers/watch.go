@@ -0,0 +1,187 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"log"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"logreason/internal/csvparser"
+	"logreason/internal/geojson"
+	"logreason/internal/jobs"
+	"logreason/internal/watch"
+)
+
+// watchRetryInterval is the delay before trying again to start a regeneration that was
+// refused because another job was running
+const watchRetryInterval = 5 * time.Second
+
+// WatchSetting is the secret or environment variable enabling WatchLocations: true watches the
+// file with file system notifications and polling polls it. Watching is off by default, since
+// every edit of the file then spends provider quota.
+const WatchSetting = "WATCH_LOCATIONS"
+
+// watchOptions returns the watcher options selected by WatchSetting, the environment taking
+// precedence over the secrets file, and whether watching is enabled
+func watchOptions() (watch.Options, bool) {
+	secretsManager := loadSecrets()
+	secretsManager.LoadFromEnvVar(WatchSetting)
+
+	value, _ := secretsManager.Get(WatchSetting)
+	value = strings.ToLower(strings.TrimSpace(value))
+	if value == "" {
+		return watch.Options{}, false
+	}
+	if value == watch.MethodPolling {
+		return watch.Options{Polling: true}, true
+	}
+	enabled, err := strconv.ParseBool(value)
+	if err != nil {
+		log.Printf("Warning: invalid %s value %q, expected true, false or polling", WatchSetting, value)
+		return watch.Options{}, false
+	}
+	return watch.Options{}, enabled
+}
+
+// WatchLocations watches locations/input.csv until the context is done and, when it changes,
+// regenerates in the background the isochrones of the stations added or moved, for the ranges
+// already in out/geojson. Every change is logged and, unless the location endpoints made it,
+// published to GET /api/events; the files of removed stations are kept until procgeojson
+// -prune deletes them. Versions of the file with parse errors are ignored. It returns at once
+// unless WatchSetting enables it.
+func WatchLocations(ctx context.Context) {
+	opts, enabled := watchOptions()
+	if !enabled {
+		log.Printf("Not watching %s; set %s to true or polling to regenerate edited stations", locationsFile, WatchSetting)
+		return
+	}
+
+	watcher := watch.File(ctx, locationsFile, opts)
+	log.Printf("Watching %s for changes using %s", locationsFile, watcher.Method)
+
+	parser := csvparser.NewParser()
+	previous := parser.ParseFile(locationsFile).Locations
+
+	// Names of the stations waiting to be regenerated
+	pending := make(map[string]bool)
+
+	retry := time.NewTicker(watchRetryInterval)
+	defer retry.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-watcher.C:
+			result := parser.ParseFile(locationsFile)
+			if !result.Success {
+				log.Printf("Warning: ignoring change to %s with %d errors", locationsFile, len(result.Errors))
+				continue
+			}
+
+			diff := csvparser.DiffLocations(previous, result.Locations)
+			if diff.Empty() {
+				continue
+			}
+			logLocationChanges(diff)
+			// Edits made through the location endpoints were published already
+			publishLocationChanges(previous, result.Locations)
+			previous = result.Locations
+			for _, location := range diff.Changed() {
+				pending[location.Name] = true
+			}
+		case <-retry.C:
+		}
+
+		if len(pending) > 0 {
+			startWatchJob(ctx, previous, pending)
+		}
+	}
+}
+
+// WatchIsochrones publishes an isochrone.regenerated event for every isochrone written to
+// out/geojson by procgeojson, or by the jobs of another server, until the context is done. The
+// isochrones are found in the manifest saved at the end of every run; those written by the
+// jobs of this server were published as they were written and are not published again.
+func WatchIsochrones(ctx context.Context) {
+	manifestPath := filepath.Join(geojson.DefaultOutputDir, geojson.ManifestFileName)
+	// Staging runs replace the whole directory, which notifications on the old one would miss
+	watcher := watch.File(ctx, manifestPath, watch.Options{Polling: true})
+
+	previous, err := geojson.LoadManifest(geojson.DefaultOutputDir)
+	if err != nil {
+		log.Printf("Warning: %v; isochrones already listed in it may be reported again", err)
+		previous = &geojson.Manifest{Entries: make(map[string]geojson.ManifestEntry)}
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-watcher.C:
+			current, err := geojson.LoadManifest(geojson.DefaultOutputDir)
+			if err != nil {
+				log.Printf("Warning: ignoring change to %s: %v", manifestPath, err)
+				continue
+			}
+			publishManifestChanges(previous, current)
+			previous = current
+		}
+	}
+}
+
+// startWatchJob starts regenerating the pending stations, clearing them unless another job
+// is running
+func startWatchJob(ctx context.Context, locations []csvparser.Location, pending map[string]bool) {
+	var selected []csvparser.Location
+	var names []string
+	for _, location := range locations {
+		if pending[location.Name] {
+			selected = append(selected, location)
+			names = append(names, location.Name)
+		}
+	}
+
+	// Stations removed since they changed have nothing left to regenerate
+	if len(selected) == 0 {
+		clear(pending)
+		return
+	}
+
+	ranges := savedRanges(geojson.DefaultOutputDir)
+	params := jobs.Params{Stations: names, Ranges: ranges, Total: len(selected) * len(ranges)}
+	job, err := jobRunner.Start(params, regenerateTask(selected, ranges, nil))
+	if errors.Is(err, jobs.ErrRunning) {
+		return
+	}
+	clear(pending)
+
+	log.Printf("Regenerating %d stations at ranges %v in job %s", len(selected), ranges, job.ID)
+	go func() {
+		finished, err := jobRunner.Wait(ctx, job.ID)
+		if err != nil {
+			return
+		}
+		log.Printf("Job %s %s in %.1fs: %d isochrones processed, %d failed", finished.ID, finished.Status, finished.Elapsed, finished.Completed, finished.Failed)
+		for _, message := range finished.Errors {
+			log.Printf("  %s", message)
+		}
+	}()
+}
+
+// logLocationChanges logs the stations added, modified and removed
+func logLocationChanges(diff csvparser.Diff) {
+	log.Printf("%s changed: %d added, %d modified, %d removed", locationsFile, len(diff.Added), len(diff.Modified), len(diff.Removed))
+	for _, location := range diff.Added {
+		log.Printf("  added %s (%s) at %.5f, %.5f", location.Name, location.City, location.Latitude, location.Longitude)
+	}
+	for _, location := range diff.Modified {
+		log.Printf("  modified %s (%s), now at %.5f, %.5f", location.Name, location.City, location.Latitude, location.Longitude)
+	}
+	for _, location := range diff.Removed {
+		log.Printf("  removed %s (%s); run procgeojson -prune to delete its isochrones", location.Name, location.City)
+	}
+}
@@ -0,0 +1,273 @@
+// Package jobs runs isochrone regenerations in the background and keeps track of their
+// progress, so that the API can start one and report on it while it runs.
+package jobs
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"runtime/debug"
+	"sync"
+	"time"
+
+	"logreason/internal/geojson"
+)
+
+// MaxHistory is the number of finished jobs kept for lookups
+const MaxHistory = 50
+
+// Status is the state of a job
+type Status string
+
+// Job states
+const (
+	StatusRunning   Status = "running"
+	StatusSucceeded Status = "succeeded"
+	// StatusFailed is reported when at least one isochrone or the job itself failed
+	StatusFailed Status = "failed"
+)
+
+// ErrRunning is returned by Start while another job is running
+var ErrRunning = errors.New("a regeneration job is already running")
+
+// Params describes what a job regenerates
+type Params struct {
+	// Stations lists the station names the job is restricted to, empty for every station
+	Stations []string `json:"stations,omitempty"`
+	Ranges   []int    `json:"ranges"`
+	// Total is the number of isochrones to process
+	Total int `json:"total"`
+}
+
+// Result is the outcome of one isochrone
+type Result struct {
+	Station string `json:"station"`
+	City    string `json:"city,omitempty"`
+	Range   int    `json:"range"`
+	// Skipped is set when the isochrone was already up to date
+	Skipped  bool    `json:"skipped"`
+	Error    string  `json:"error,omitempty"`
+	Duration float64 `json:"duration_seconds"`
+}
+
+// Job is a snapshot of a regeneration job
+type Job struct {
+	ID     string `json:"id"`
+	Status Status `json:"status"`
+	Params
+	Completed int `json:"completed"`
+	Skipped   int `json:"skipped"`
+	Failed    int `json:"failed"`
+	// Progress is the share of the isochrones processed, from 0 to 1
+	Progress float64 `json:"progress"`
+	// Results lists the isochrones in the order they were processed
+	Results []Result `json:"results"`
+	// Errors lists every error returned by the job, including the ones not tied to an
+	// isochrone such as a failure to save the manifest
+	Errors     []string   `json:"errors,omitempty"`
+	StartedAt  time.Time  `json:"started_at"`
+	FinishedAt *time.Time `json:"finished_at,omitempty"`
+	// Elapsed is the running time of the job so far, or its total duration once finished
+	Elapsed float64 `json:"elapsed_seconds"`
+}
+
+// Task runs a regeneration, calling progress once per isochrone processed, possibly from
+// several goroutines, and returns the errors encountered
+type Task func(ctx context.Context, progress func(geojson.Progress)) []error
+
+// Runner runs one job at a time and remembers the most recent ones
+type Runner struct {
+	mu       sync.Mutex
+	jobs     map[string]*entry
+	finished []string
+	running  string
+	now      func() time.Time
+	onFinish func(Job)
+}
+
+// entry is the mutable state of a job, guarded by the runner mutex
+type entry struct {
+	job  Job
+	done chan struct{}
+}
+
+// Option configures optional behaviour of a Runner
+type Option func(*Runner)
+
+// WithOnFinish sets a function called with every job once it has finished, from the
+// goroutine that ran it
+func WithOnFinish(fn func(Job)) Option {
+	return func(r *Runner) {
+		r.onFinish = fn
+	}
+}
+
+// NewRunner creates a runner without any job
+func NewRunner(opts ...Option) *Runner {
+	r := &Runner{jobs: make(map[string]*entry), now: time.Now}
+	for _, opt := range opts {
+		opt(r)
+	}
+	return r
+}
+
+// Start runs the task in a background goroutine and returns the new job. While another job
+// is running it returns ErrRunning together with the running job, so that two
+// regenerations never write to the output directory at the same time.
+func (r *Runner) Start(params Params, task Task) (Job, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.running != "" {
+		return r.snapshot(r.jobs[r.running]), ErrRunning
+	}
+
+	e := &entry{
+		job: Job{
+			ID:        newID(),
+			Status:    StatusRunning,
+			Params:    params,
+			Results:   []Result{},
+			StartedAt: r.now(),
+		},
+		done: make(chan struct{}),
+	}
+	r.jobs[e.job.ID] = e
+	r.running = e.job.ID
+
+	go r.run(e, task)
+
+	return r.snapshot(e), nil
+}
+
+// run executes the task and records its outcome
+func (r *Runner) run(e *entry, task Task) {
+	errs := runRecovered(task, func(p geojson.Progress) {
+		r.record(e, p)
+	})
+
+	r.mu.Lock()
+	finishedAt := r.now()
+	e.job.FinishedAt = &finishedAt
+	e.job.Status = StatusSucceeded
+	for _, err := range errs {
+		e.job.Errors = append(e.job.Errors, err.Error())
+		e.job.Status = StatusFailed
+	}
+	r.running = ""
+
+	r.finished = append(r.finished, e.job.ID)
+	for len(r.finished) > MaxHistory {
+		delete(r.jobs, r.finished[0])
+		r.finished = r.finished[1:]
+	}
+	job := r.snapshot(e)
+	r.mu.Unlock()
+
+	close(e.done)
+	if r.onFinish != nil {
+		r.onFinish(job)
+	}
+}
+
+// runRecovered runs the task, turning a panic into an error of the job so that a failing
+// regeneration cannot crash the server and the runner can start the next job
+func runRecovered(task Task, progress func(geojson.Progress)) (errs []error) {
+	defer func() {
+		if v := recover(); v != nil {
+			log.Printf("Warning: regeneration job panicked: %v\n%s", v, debug.Stack())
+			errs = append(errs, fmt.Errorf("job panicked: %v", v))
+		}
+	}()
+	return task(context.Background(), progress)
+}
+
+// record adds the outcome of one isochrone to a job
+func (r *Runner) record(e *entry, p geojson.Progress) {
+	result := Result{
+		Station:  p.Location.Name,
+		City:     p.Location.City,
+		Range:    p.Range,
+		Skipped:  p.Skipped,
+		Duration: p.Duration.Seconds(),
+	}
+	if p.Err != nil {
+		result.Error = p.Err.Error()
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	e.job.Results = append(e.job.Results, result)
+	e.job.Completed++
+	if p.Skipped {
+		e.job.Skipped++
+	}
+	if p.Err != nil {
+		e.job.Failed++
+	}
+}
+
+// Get returns the job with an id, if it is running or among the recent ones
+func (r *Runner) Get(id string) (Job, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	e, ok := r.jobs[id]
+	if !ok {
+		return Job{}, false
+	}
+	return r.snapshot(e), true
+}
+
+// Wait blocks until the job with an id has finished or the context is done, and returns it
+func (r *Runner) Wait(ctx context.Context, id string) (Job, error) {
+	r.mu.Lock()
+	e, ok := r.jobs[id]
+	r.mu.Unlock()
+	if !ok {
+		return Job{}, errors.New("job not found")
+	}
+
+	select {
+	case <-e.done:
+	case <-ctx.Done():
+		return Job{}, ctx.Err()
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.snapshot(e), nil
+}
+
+// snapshot copies a job so that it can be read without the mutex
+func (r *Runner) snapshot(e *entry) Job {
+	job := e.job
+	job.Results = append([]Result{}, e.job.Results...)
+	job.Errors = append([]string(nil), e.job.Errors...)
+
+	if job.Total > 0 {
+		job.Progress = float64(job.Completed) / float64(job.Total)
+	} else if job.FinishedAt != nil {
+		job.Progress = 1
+	}
+
+	end := r.now()
+	if job.FinishedAt != nil {
+		end = *job.FinishedAt
+	}
+	job.Elapsed = end.Sub(job.StartedAt).Seconds()
+	return job
+}
+
+// newID returns a random job identifier
+func newID() string {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return time.Now().UTC().Format("20060102T150405.000000000")
+	}
+	return hex.EncodeToString(b)
+}
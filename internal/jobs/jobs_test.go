@@ -0,0 +1,139 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"logreason/internal/csvparser"
+	"logreason/internal/geojson"
+)
+
+func TestRunner(t *testing.T) {
+	runner := NewRunner()
+	release := make(chan struct{})
+
+	job, err := runner.Start(Params{Ranges: []int{600}, Total: 2}, func(ctx context.Context, progress func(geojson.Progress)) []error {
+		progress(geojson.Progress{Location: csvparser.Location{Name: "STA"}, Range: 600, Duration: 2 * time.Second})
+		<-release
+		failure := errors.New("provider unavailable")
+		progress(geojson.Progress{Location: csvparser.Location{Name: "STB"}, Range: 600, Err: failure})
+		return []error{failure}
+	})
+	if err != nil {
+		t.Fatalf("Start failed: %v", err)
+	}
+	if job.Status != StatusRunning || job.ID == "" {
+		t.Fatalf("Unexpected new job %+v", job)
+	}
+
+	// A second job is refused while the first one runs
+	running, err := runner.Start(Params{}, func(context.Context, func(geojson.Progress)) []error { return nil })
+	if !errors.Is(err, ErrRunning) || running.ID != job.ID {
+		t.Fatalf("Expected ErrRunning with the running job, got %v and %+v", err, running)
+	}
+
+	close(release)
+	finished, err := runner.Wait(context.Background(), job.ID)
+	if err != nil {
+		t.Fatalf("Wait failed: %v", err)
+	}
+
+	if finished.Status != StatusFailed || finished.FinishedAt == nil {
+		t.Errorf("Expected a finished failed job, got %+v", finished)
+	}
+	if finished.Completed != 2 || finished.Failed != 1 || finished.Progress != 1 {
+		t.Errorf("Unexpected counts %+v", finished)
+	}
+	if len(finished.Results) != 2 || finished.Results[0].Duration != 2 || finished.Results[1].Error != "provider unavailable" {
+		t.Errorf("Unexpected results %+v", finished.Results)
+	}
+	if len(finished.Errors) != 1 {
+		t.Errorf("Expected the returned error to be listed, got %v", finished.Errors)
+	}
+
+	// Once finished, a new job can start
+	next, err := runner.Start(Params{Total: 0}, func(context.Context, func(geojson.Progress)) []error { return nil })
+	if err != nil {
+		t.Fatalf("Expected a new job after the first finished, got %v", err)
+	}
+	if done, _ := runner.Wait(context.Background(), next.ID); done.Status != StatusSucceeded || done.Progress != 1 {
+		t.Errorf("Expected an empty job to succeed, got %+v", done)
+	}
+
+	if _, ok := runner.Get("unknown"); ok {
+		t.Error("Expected an unknown job not to be found")
+	}
+}
+
+func TestRunner_History(t *testing.T) {
+	runner := NewRunner()
+
+	var first string
+	for i := 0; i < MaxHistory+1; i++ {
+		job, err := runner.Start(Params{}, func(context.Context, func(geojson.Progress)) []error { return nil })
+		if err != nil {
+			t.Fatalf("Start failed: %v", err)
+		}
+		if i == 0 {
+			first = job.ID
+		}
+		if _, err := runner.Wait(context.Background(), job.ID); err != nil {
+			t.Fatalf("Wait failed: %v", err)
+		}
+	}
+
+	if _, ok := runner.Get(first); ok {
+		t.Errorf("Expected the oldest job to be forgotten after %d jobs", MaxHistory+1)
+	}
+}
+
+func TestRunner_OnFinish(t *testing.T) {
+	finished := make(chan Job, 1)
+	runner := NewRunner(WithOnFinish(func(job Job) { finished <- job }))
+
+	job, err := runner.Start(Params{Total: 1}, func(ctx context.Context, progress func(geojson.Progress)) []error {
+		progress(geojson.Progress{Location: csvparser.Location{Name: "STA"}, Range: 600})
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Start failed: %v", err)
+	}
+
+	select {
+	case got := <-finished:
+		if got.ID != job.ID || got.Status != StatusSucceeded || got.Completed != 1 {
+			t.Errorf("Unexpected finished job %+v", got)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("OnFinish was not called")
+	}
+}
+
+func TestRunner_RecoversPanic(t *testing.T) {
+	runner := NewRunner()
+
+	job, err := runner.Start(Params{Total: 2}, func(ctx context.Context, progress func(geojson.Progress)) []error {
+		progress(geojson.Progress{Location: csvparser.Location{Name: "STA"}, Range: 600})
+		panic("provider bug")
+	})
+	if err != nil {
+		t.Fatalf("Start failed: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	finished, err := runner.Wait(ctx, job.ID)
+	if err != nil {
+		t.Fatalf("Wait failed: %v", err)
+	}
+	if finished.Status != StatusFailed || finished.Completed != 1 || len(finished.Errors) != 1 || finished.Errors[0] != "job panicked: provider bug" {
+		t.Errorf("Expected a failed job recording the panic, got %+v", finished)
+	}
+
+	// The runner is free for the next job
+	if _, err := runner.Start(Params{}, func(context.Context, func(geojson.Progress)) []error { return nil }); err != nil {
+		t.Errorf("Expected a new job after the panic, got %v", err)
+	}
+}
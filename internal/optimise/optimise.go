@@ -0,0 +1,366 @@
+// Package optimise chooses station sites among candidates to cover as much demand as
+// possible: the maximal covering location problem (pick K sites), solved greedily and
+// refined by local search, and the set cover problem (pick the fewest sites reaching a
+// target share of the demand).
+package optimise
+
+import (
+	"math"
+
+	"logreason/internal/coverage"
+	"logreason/internal/raster"
+)
+
+// DefaultMaxSwaps Default limit of improving swaps made by LocalSearch
+const DefaultMaxSwaps = 1000
+
+// Problem describes the demand points each candidate site covers
+type Problem struct {
+	// Weights is the demand of every point, e.g. its population
+	Weights []float64
+	// Covers lists, for every candidate, the indices of the demand points it covers
+	Covers [][]int
+	// Fixed counts, for every demand point, the stations that are kept in any solution
+	Fixed []int
+}
+
+// NewProblem builds a problem by testing every demand point against the isochrones of the
+// candidates and of the fixed stations
+func NewProblem(candidates, fixed []coverage.Isochrone, demand []coverage.PopulationCell) *Problem {
+	p := &Problem{
+		Weights: make([]float64, len(demand)),
+		Covers:  make([][]int, len(candidates)),
+		Fixed:   make([]int, len(demand)),
+	}
+	for d, cell := range demand {
+		p.Weights[d] = cell.Population
+	}
+
+	for c, candidate := range candidates {
+		p.Covers[c] = covered(candidate.Polygons, demand)
+	}
+	for _, station := range fixed {
+		for _, d := range covered(station.Polygons, demand) {
+			p.Fixed[d]++
+		}
+	}
+	return p
+}
+
+// covered returns the indices of the demand points inside the polygons
+func covered(polygons [][][]raster.Point, demand []coverage.PopulationCell) []int {
+	var indices []int
+	for d, cell := range demand {
+		for _, polygon := range polygons {
+			if raster.PolygonContains(polygon, cell.Lon, cell.Lat) {
+				indices = append(indices, d)
+				break
+			}
+		}
+	}
+	return indices
+}
+
+// AreaDemand spreads demand uniformly over the area covered by the isochrones, one point
+// per grid cell weighted by its area in km², for planning without a population grid
+func AreaDemand(isochrones []coverage.Isochrone, cellSize float64) []coverage.PopulationCell {
+	var all [][][]raster.Point
+	for _, isochrone := range isochrones {
+		all = append(all, isochrone.Polygons...)
+	}
+	grid := coverage.NewGrid(all, cellSize, 0)
+	for _, polygon := range all {
+		grid.FillPolygon(polygon)
+	}
+
+	var demand []coverage.PopulationCell
+	for row := 0; row < grid.Rows; row++ {
+		for col := 0; col < grid.Cols; col++ {
+			if grid.Get(col, row) == 0 {
+				continue
+			}
+			lon, lat := grid.Center(col, row)
+			demand = append(demand, coverage.PopulationCell{Lon: lon, Lat: lat, Population: grid.CellArea(row)})
+		}
+	}
+	return demand
+}
+
+// Solution is a set of chosen candidate sites
+type Solution struct {
+	// Sites are candidate indices, in decreasing order of the demand they add
+	Sites []int
+	// Gains is the demand each site adds to the fixed stations and the sites before it
+	Gains []float64
+	// Baseline is the demand covered by the fixed stations alone
+	Baseline float64
+	// Covered is the demand covered by the fixed stations and the chosen sites
+	Covered float64
+	// Total is the demand of all points
+	Total float64
+}
+
+// Gain returns the demand covered by the chosen sites in addition to the fixed stations
+func (s *Solution) Gain() float64 {
+	return s.Covered - s.Baseline
+}
+
+// Share returns the fraction of the total demand covered
+func (s *Solution) Share() float64 {
+	if s.Total == 0 {
+		return 0
+	}
+	return s.Covered / s.Total
+}
+
+// state tracks how many chosen sites and fixed stations cover every demand point
+type state struct {
+	p      *Problem
+	counts []int
+	chosen []bool
+}
+
+func (p *Problem) newState() *state {
+	s := &state{p: p, counts: append([]int(nil), p.Fixed...), chosen: make([]bool, len(p.Covers))}
+	if len(s.counts) < len(p.Weights) {
+		s.counts = append(s.counts, make([]int, len(p.Weights)-len(s.counts))...)
+	}
+	return s
+}
+
+// gain returns the demand a candidate would add
+func (s *state) gain(c int) float64 {
+	gain := 0.0
+	for _, d := range s.p.Covers[c] {
+		if s.counts[d] == 0 {
+			gain += s.p.Weights[d]
+		}
+	}
+	return gain
+}
+
+func (s *state) add(c int) {
+	s.chosen[c] = true
+	for _, d := range s.p.Covers[c] {
+		s.counts[d]++
+	}
+}
+
+func (s *state) remove(c int) {
+	s.chosen[c] = false
+	for _, d := range s.p.Covers[c] {
+		s.counts[d]--
+	}
+}
+
+func (s *state) covered() float64 {
+	covered := 0.0
+	for d, count := range s.counts {
+		if count > 0 {
+			covered += s.p.Weights[d]
+		}
+	}
+	return covered
+}
+
+// solution describes the sites chosen in the state
+func (s *state) solution(sites []int, gains []float64) *Solution {
+	solution := &Solution{Sites: sites, Gains: gains, Covered: s.covered()}
+	for d, weight := range s.p.Weights {
+		solution.Total += weight
+		if d < len(s.p.Fixed) && s.p.Fixed[d] > 0 {
+			solution.Baseline += weight
+		}
+	}
+	return solution
+}
+
+// best returns the unchosen candidate adding the most demand, or -1 when none adds any
+func (s *state) best() (int, float64) {
+	best, bestGain := -1, 0.0
+	for c := range s.p.Covers {
+		if s.chosen[c] {
+			continue
+		}
+		if gain := s.gain(c); gain > bestGain {
+			best, bestGain = c, gain
+		}
+	}
+	return best, bestGain
+}
+
+// Greedy picks up to k sites, each time the one adding the most uncovered demand.
+// It stops early when no candidate adds any demand.
+func (p *Problem) Greedy(k int) *Solution {
+	s := p.newState()
+	var sites []int
+	var gains []float64
+	for len(sites) < k {
+		c, gain := s.best()
+		if c < 0 {
+			break
+		}
+		s.add(c)
+		sites = append(sites, c)
+		gains = append(gains, gain)
+	}
+	return s.solution(sites, gains)
+}
+
+// LocalSearch improves a solution by swapping a chosen site for an unchosen candidate
+// while a swap increases the covered demand, making the best swap first and at most
+// maxSwaps swaps (DefaultMaxSwaps when 0 or less)
+func (p *Problem) LocalSearch(initial *Solution, maxSwaps int) *Solution {
+	if maxSwaps <= 0 {
+		maxSwaps = DefaultMaxSwaps
+	}
+
+	s := p.newState()
+	sites := append([]int(nil), initial.Sites...)
+	for _, c := range sites {
+		s.add(c)
+	}
+
+	for swaps := 0; swaps < maxSwaps; swaps++ {
+		bestIn, bestOut, bestDelta := -1, -1, 1e-9
+
+		for i, out := range sites {
+			s.remove(out)
+			loss := s.gain(out)
+			for in := range p.Covers {
+				if s.chosen[in] || in == out {
+					continue
+				}
+				if delta := s.gain(in) - loss; delta > bestDelta {
+					bestIn, bestOut, bestDelta = in, i, delta
+				}
+			}
+			s.add(out)
+		}
+
+		if bestIn < 0 {
+			break
+		}
+		s.remove(sites[bestOut])
+		s.add(bestIn)
+		sites[bestOut] = bestIn
+	}
+
+	// Order the sites as greedy would have picked them to report their gains
+	return p.order(sites)
+}
+
+// Move replaces a current station by a candidate site
+type Move struct {
+	// From and To are candidate indices
+	From int
+	To   int
+	// Gain is the demand the move adds
+	Gain float64
+}
+
+// Relocation is the outcome of Relocate
+type Relocation struct {
+	// Solution is the network after the moves, the stations kept and the sites moved to
+	*Solution
+	// Before is the demand covered by the current stations
+	Before float64
+	Moves  []Move
+}
+
+// Relocate moves at most k of the current stations, given as candidate indices, to other
+// candidates that are not current stations. Each step makes the move increasing the covered
+// demand the most, and no station is moved twice; it stops early when no move improves the
+// coverage. The other current stations stay where they are.
+func (p *Problem) Relocate(current []int, k int) *Relocation {
+	s := p.newState()
+	sites := append([]int(nil), current...)
+	isCurrent := make([]bool, len(p.Covers))
+	for _, c := range sites {
+		isCurrent[c] = true
+		s.add(c)
+	}
+	relocation := &Relocation{Before: s.covered()}
+
+	moved := make([]bool, len(sites))
+	for len(relocation.Moves) < k {
+		bestIn, bestOut, bestDelta := -1, -1, 1e-9
+
+		for i, out := range sites {
+			if moved[i] {
+				continue
+			}
+			s.remove(out)
+			loss := s.gain(out)
+			for in := range p.Covers {
+				if s.chosen[in] || isCurrent[in] {
+					continue
+				}
+				if delta := s.gain(in) - loss; delta > bestDelta {
+					bestIn, bestOut, bestDelta = in, i, delta
+				}
+			}
+			s.add(out)
+		}
+
+		if bestIn < 0 {
+			break
+		}
+		relocation.Moves = append(relocation.Moves, Move{From: sites[bestOut], To: bestIn, Gain: bestDelta})
+		s.remove(sites[bestOut])
+		s.add(bestIn)
+		sites[bestOut] = bestIn
+		moved[bestOut] = true
+	}
+
+	relocation.Solution = p.order(sites)
+	return relocation
+}
+
+// order sorts the sites by picking, each time, the one adding the most demand
+func (p *Problem) order(sites []int) *Solution {
+	s := p.newState()
+	remaining := append([]int(nil), sites...)
+	var ordered []int
+	var gains []float64
+	for len(remaining) > 0 {
+		best, bestGain := 0, -1.0
+		for i, c := range remaining {
+			if gain := s.gain(c); gain > bestGain {
+				best, bestGain = i, gain
+			}
+		}
+		s.add(remaining[best])
+		ordered = append(ordered, remaining[best])
+		gains = append(gains, bestGain)
+		remaining = append(remaining[:best], remaining[best+1:]...)
+	}
+	return s.solution(ordered, gains)
+}
+
+// SetCover picks sites greedily until the covered demand reaches the target share of the
+// total demand, or no candidate adds any demand. The share is clamped to 1.
+func (p *Problem) SetCover(targetShare float64) *Solution {
+	s := p.newState()
+
+	total := 0.0
+	for _, weight := range p.Weights {
+		total += weight
+	}
+	target := math.Min(targetShare, 1) * total
+
+	var sites []int
+	var gains []float64
+	covered := s.covered()
+	for covered < target-1e-9 {
+		c, gain := s.best()
+		if c < 0 {
+			break
+		}
+		s.add(c)
+		sites = append(sites, c)
+		gains = append(gains, gain)
+		covered += gain
+	}
+	return s.solution(sites, gains)
+}
@@ -0,0 +1,145 @@
+package optimise
+
+import (
+	"testing"
+
+	"logreason/internal/coverage"
+	"logreason/internal/raster"
+)
+
+// trapProblem has a large candidate overlapping two smaller ones
+func trapProblem() *Problem {
+	return &Problem{
+		Weights: []float64{10, 10, 10, 10, 1, 1},
+		Covers: [][]int{
+			{1, 2, 3, 4, 5}, // 32
+			{0, 1, 4},       // 21
+			{2, 3, 5},       // 21
+			{0},             // 10
+		},
+	}
+}
+
+func TestGreedy(t *testing.T) {
+	p := trapProblem()
+
+	greedy := p.Greedy(2)
+	// After the large candidate, 1 and 3 both add the last uncovered point; ties keep the first
+	if len(greedy.Sites) != 2 || greedy.Sites[0] != 0 || greedy.Sites[1] != 1 {
+		t.Fatalf("Greedy sites = %v, want [0 1]", greedy.Sites)
+	}
+	if greedy.Gains[0] != 32 || greedy.Gains[1] != 10 {
+		t.Errorf("Greedy gains = %v, want [32 10]", greedy.Gains)
+	}
+	if greedy.Covered != 42 || greedy.Total != 42 || greedy.Share() != 1 {
+		t.Errorf("Greedy covered %v of %v", greedy.Covered, greedy.Total)
+	}
+
+	// Greedy stops once no candidate adds demand
+	if all := p.Greedy(10); len(all.Sites) != 2 {
+		t.Errorf("Greedy(10) picked %v", all.Sites)
+	}
+}
+
+func TestLocalSearchEscapesGreedyTrap(t *testing.T) {
+	// The four corners are worth 10 each; a central site covers two corners and the
+	// centre (5), each side site covers two corners. Greedy picks the centre first.
+	p := &Problem{
+		Weights: []float64{10, 10, 10, 10, 5},
+		Covers: [][]int{
+			{1, 2, 4}, // centre: 25
+			{0, 1},    // left: 20
+			{2, 3},    // right: 20
+		},
+	}
+
+	greedy := p.Greedy(2)
+	if greedy.Covered != 35 {
+		t.Fatalf("Greedy covered %v, want 35", greedy.Covered)
+	}
+	improved := p.LocalSearch(greedy, 0)
+	if improved.Covered != 40 {
+		t.Errorf("LocalSearch covered %v, want 40", improved.Covered)
+	}
+	if len(improved.Gains) != 2 || improved.Gains[0] != 20 || improved.Gains[1] != 20 {
+		t.Errorf("LocalSearch gains = %v, want [20 20]", improved.Gains)
+	}
+}
+
+func TestSetCoverAndFixedStations(t *testing.T) {
+	p := trapProblem()
+	p.Fixed = []int{1, 0, 0, 0, 0, 0}
+
+	solution := p.SetCover(1)
+	if solution.Baseline != 10 || solution.Covered != 42 || solution.Gain() != 32 {
+		t.Errorf("SetCover = %+v, want baseline 10 and full coverage", solution)
+	}
+	if len(solution.Sites) != 1 || solution.Sites[0] != 0 {
+		t.Errorf("SetCover sites = %v, want [0]", solution.Sites)
+	}
+
+	if solution := p.SetCover(0.1); len(solution.Sites) != 0 {
+		t.Errorf("SetCover(0.1) picked %v, the fixed stations already reach the target", solution.Sites)
+	}
+}
+
+func TestRelocate(t *testing.T) {
+	// Stations 0 to 2 exist; 0 and 1 cover the same points, so moving one of them to the
+	// candidate 3 adds its points. Candidate 4 adds less.
+	p := &Problem{
+		Weights: []float64{10, 10, 10, 10, 5, 1},
+		Covers: [][]int{
+			{0, 1}, // current
+			{0, 1}, // current, duplicates 0
+			{2},    // current
+			{3, 4}, // candidate: 15
+			{5},    // candidate: 1
+		},
+	}
+
+	relocation := p.Relocate([]int{0, 1, 2}, 1)
+	if relocation.Before != 30 || relocation.Covered != 45 {
+		t.Errorf("Covered %v before and %v after, want 30 and 45", relocation.Before, relocation.Covered)
+	}
+	if len(relocation.Moves) != 1 || relocation.Moves[0].From != 0 || relocation.Moves[0].To != 3 || relocation.Moves[0].Gain != 15 {
+		t.Errorf("Moves = %+v, want 0 moved to 3", relocation.Moves)
+	}
+	if len(relocation.Sites) != 3 {
+		t.Errorf("Expected the network to keep 3 stations, got %v", relocation.Sites)
+	}
+
+	// Moving more stations than useful stops once no move adds demand
+	if all := p.Relocate([]int{0, 1, 2}, 3); len(all.Moves) != 1 {
+		t.Errorf("Relocate(3) made moves %+v, want only the improving one", all.Moves)
+	}
+	if none := p.Relocate([]int{0, 1, 2}, 0); len(none.Moves) != 0 || none.Covered != none.Before {
+		t.Errorf("Relocate(0) = %+v, want the current network", none)
+	}
+}
+
+func TestNewProblem(t *testing.T) {
+	square := func(lon, lat float64) [][][]raster.Point {
+		return [][][]raster.Point{{{{lon, lat}, {lon + 0.1, lat}, {lon + 0.1, lat + 0.1}, {lon, lat + 0.1}, {lon, lat}}}}
+	}
+	candidates := []coverage.Isochrone{{Name: "A", Polygons: square(9.0, 45.0)}, {Name: "B", Polygons: square(9.2, 45.0)}}
+	fixed := []coverage.Isochrone{{Name: "F", Polygons: square(9.05, 45.0)}}
+	demand := []coverage.PopulationCell{
+		{Lon: 9.01, Lat: 45.05, Population: 100},
+		{Lon: 9.08, Lat: 45.05, Population: 50},
+		{Lon: 9.25, Lat: 45.05, Population: 30},
+	}
+
+	p := NewProblem(candidates, fixed, demand)
+	if len(p.Covers[0]) != 2 || len(p.Covers[1]) != 1 || p.Fixed[1] != 1 {
+		t.Errorf("Unexpected problem %+v", p)
+	}
+
+	solution := p.Greedy(1)
+	if solution.Sites[0] != 0 || solution.Gain() != 100 {
+		t.Errorf("Greedy = %+v, want site A gaining 100", solution)
+	}
+
+	if cells := AreaDemand(candidates, 1000); len(cells) < 150 || len(cells) > 200 {
+		t.Errorf("AreaDemand returned %d cells, want about 176", len(cells))
+	}
+}
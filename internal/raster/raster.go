@@ -0,0 +1,305 @@
+// Package raster provides a lon/lat grid of cell counters and converts regions of cells
+// back into polygons. It is used to approximate polygon operations (hulls, unions,
+// overlaps, differences) with a resolution chosen in meters.
+package raster
+
+import (
+	"math"
+	"sort"
+)
+
+// MetersPerDegree is the length of one degree of latitude in meters
+const MetersPerDegree = 111320.0
+
+// Point is a longitude, latitude pair
+type Point [2]float64
+
+// Grid is a regular lon/lat grid holding a counter per cell.
+// Rows grow northwards from MinLat and columns grow eastwards from MinLon.
+type Grid struct {
+	MinLon  float64
+	MinLat  float64
+	CellLon float64
+	CellLat float64
+	Cols    int
+	Rows    int
+	Cells   []int32
+}
+
+// NewGrid creates an empty grid covering the bounding box with square cells of roughly
+// cellMeters on each side, measured at the latitude of the box centre
+func NewGrid(minLon, minLat, maxLon, maxLat, cellMeters float64) *Grid {
+	cellLat := cellMeters / MetersPerDegree
+	cellLon := cellMeters / (MetersPerDegree * math.Cos((minLat+maxLat)/2*math.Pi/180))
+
+	cols := int(math.Ceil((maxLon-minLon)/cellLon)) + 1
+	rows := int(math.Ceil((maxLat-minLat)/cellLat)) + 1
+
+	return &Grid{
+		MinLon:  minLon,
+		MinLat:  minLat,
+		CellLon: cellLon,
+		CellLat: cellLat,
+		Cols:    cols,
+		Rows:    rows,
+		Cells:   make([]int32, cols*rows),
+	}
+}
+
+// Empty returns a grid with the same extent and resolution and all counters at zero
+func (g *Grid) Empty() *Grid {
+	empty := *g
+	empty.Cells = make([]int32, len(g.Cells))
+	return &empty
+}
+
+// Window returns an empty grid aligned with g covering cols by rows cells from the cell at
+// col, row, so that work on a small region does not scan the whole grid
+func (g *Grid) Window(col, row, cols, rows int) *Grid {
+	return &Grid{
+		MinLon:  g.MinLon + float64(col)*g.CellLon,
+		MinLat:  g.MinLat + float64(row)*g.CellLat,
+		CellLon: g.CellLon,
+		CellLat: g.CellLat,
+		Cols:    cols,
+		Rows:    rows,
+		Cells:   make([]int32, cols*rows),
+	}
+}
+
+// Cell returns the column and row containing a point and whether it lies inside the grid
+func (g *Grid) Cell(lon, lat float64) (col, row int, ok bool) {
+	col = int(math.Floor((lon - g.MinLon) / g.CellLon))
+	row = int(math.Floor((lat - g.MinLat) / g.CellLat))
+	return col, row, col >= 0 && row >= 0 && col < g.Cols && row < g.Rows
+}
+
+// Center returns the longitude and latitude of the centre of a cell
+func (g *Grid) Center(col, row int) (lon, lat float64) {
+	return g.MinLon + (float64(col)+0.5)*g.CellLon, g.MinLat + (float64(row)+0.5)*g.CellLat
+}
+
+// Get returns the counter of a cell, or 0 outside the grid
+func (g *Grid) Get(col, row int) int32 {
+	if col < 0 || row < 0 || col >= g.Cols || row >= g.Rows {
+		return 0
+	}
+	return g.Cells[row*g.Cols+col]
+}
+
+// Set sets the counter of a cell; cells outside the grid are ignored
+func (g *Grid) Set(col, row int, value int32) {
+	if col < 0 || row < 0 || col >= g.Cols || row >= g.Rows {
+		return
+	}
+	g.Cells[row*g.Cols+col] = value
+}
+
+// CellArea returns the area of a cell of the given row in square kilometers
+func (g *Grid) CellArea(row int) float64 {
+	_, lat := g.Center(0, row)
+	height := g.CellLat * MetersPerDegree
+	width := g.CellLon * MetersPerDegree * math.Cos(lat*math.Pi/180)
+	return height * width / 1e6
+}
+
+// Area returns the area in square kilometers of the cells matching the predicate
+func (g *Grid) Area(include func(value int32) bool) float64 {
+	area := 0.0
+	for row := 0; row < g.Rows; row++ {
+		count := 0
+		for col := 0; col < g.Cols; col++ {
+			if include(g.Cells[row*g.Cols+col]) {
+				count++
+			}
+		}
+		area += float64(count) * g.CellArea(row)
+	}
+	return area
+}
+
+// FillPolygon increments the counter of every cell whose centre lies inside the polygon.
+// The polygon is a list of rings, the first being the exterior and the others holes.
+func (g *Grid) FillPolygon(polygon [][]Point) {
+	if len(polygon) == 0 || len(polygon[0]) == 0 {
+		return
+	}
+
+	// Only scan the rows covered by the exterior ring
+	_, minLat, _, maxLat := bounds(polygon[0])
+	_, firstRow, _ := g.Cell(g.MinLon, minLat)
+	_, lastRow, _ := g.Cell(g.MinLon, maxLat)
+	if firstRow < 0 {
+		firstRow = 0
+	}
+	if lastRow > g.Rows-1 {
+		lastRow = g.Rows - 1
+	}
+
+	// Fill the spans between pairs of ring crossings along the centre line of each row,
+	// which is equivalent to an even-odd point-in-polygon test of every cell centre
+	var crossings []float64
+	for row := firstRow; row <= lastRow; row++ {
+		_, lat := g.Center(0, row)
+
+		crossings = crossings[:0]
+		for _, ring := range polygon {
+			for i, j := 0, len(ring)-1; i < len(ring); j, i = i, i+1 {
+				xi, yi := ring[i][0], ring[i][1]
+				xj, yj := ring[j][0], ring[j][1]
+				if (yi > lat) != (yj > lat) {
+					crossings = append(crossings, (xj-xi)*(lat-yi)/(yj-yi)+xi)
+				}
+			}
+		}
+		sort.Float64s(crossings)
+
+		for k := 0; k+1 < len(crossings); k += 2 {
+			first := int(math.Ceil((crossings[k]-g.MinLon)/g.CellLon - 0.5))
+			last := int(math.Ceil((crossings[k+1]-g.MinLon)/g.CellLon-0.5)) - 1
+			if first < 0 {
+				first = 0
+			}
+			if last > g.Cols-1 {
+				last = g.Cols - 1
+			}
+			for col := first; col <= last; col++ {
+				g.Cells[row*g.Cols+col]++
+			}
+		}
+	}
+}
+
+// Dilate grows the region of non-zero cells by radius cells in every direction,
+// setting newly covered cells to 1
+func (g *Grid) Dilate(radius int) {
+	if radius <= 0 {
+		return
+	}
+
+	source := make([]int32, len(g.Cells))
+	copy(source, g.Cells)
+
+	for row := 0; row < g.Rows; row++ {
+		for col := 0; col < g.Cols; col++ {
+			if source[row*g.Cols+col] == 0 {
+				continue
+			}
+			for dr := -radius; dr <= radius; dr++ {
+				for dc := -radius; dc <= radius; dc++ {
+					if dr*dr+dc*dc > radius*radius {
+						continue
+					}
+					if g.Get(col+dc, row+dr) == 0 {
+						g.Set(col+dc, row+dr, 1)
+					}
+				}
+			}
+		}
+	}
+}
+
+// FillHoles sets to 1 every zero cell that cannot be reached from the grid border
+// through other zero cells, i.e. the holes enclosed by the region
+func (g *Grid) FillHoles() {
+	outside := make([]bool, len(g.Cells))
+	var stack []int
+
+	push := func(col, row int) {
+		if col < 0 || row < 0 || col >= g.Cols || row >= g.Rows {
+			return
+		}
+		i := row*g.Cols + col
+		if outside[i] || g.Cells[i] != 0 {
+			return
+		}
+		outside[i] = true
+		stack = append(stack, i)
+	}
+
+	for col := 0; col < g.Cols; col++ {
+		push(col, 0)
+		push(col, g.Rows-1)
+	}
+	for row := 0; row < g.Rows; row++ {
+		push(0, row)
+		push(g.Cols-1, row)
+	}
+
+	for len(stack) > 0 {
+		i := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		col, row := i%g.Cols, i/g.Cols
+		push(col+1, row)
+		push(col-1, row)
+		push(col, row+1)
+		push(col, row-1)
+	}
+
+	for i, value := range g.Cells {
+		if value == 0 && !outside[i] {
+			g.Cells[i] = 1
+		}
+	}
+}
+
+// PolygonContains reports whether a point lies inside a polygon made of an exterior
+// ring followed by holes, using the even-odd rule
+func PolygonContains(polygon [][]Point, lon, lat float64) bool {
+	inside := false
+	for _, ring := range polygon {
+		if ringContains(ring, lon, lat) {
+			inside = !inside
+		}
+	}
+	return inside
+}
+
+// ringContains is a ray casting point-in-ring test
+func ringContains(ring []Point, lon, lat float64) bool {
+	inside := false
+	for i, j := 0, len(ring)-1; i < len(ring); j, i = i, i+1 {
+		xi, yi := ring[i][0], ring[i][1]
+		xj, yj := ring[j][0], ring[j][1]
+		if (yi > lat) != (yj > lat) && lon < (xj-xi)*(lat-yi)/(yj-yi)+xi {
+			inside = !inside
+		}
+	}
+	return inside
+}
+
+func bounds(ring []Point) (minLon, minLat, maxLon, maxLat float64) {
+	minLon, minLat = math.Inf(1), math.Inf(1)
+	maxLon, maxLat = math.Inf(-1), math.Inf(-1)
+	for _, p := range ring {
+		minLon, maxLon = math.Min(minLon, p[0]), math.Max(maxLon, p[0])
+		minLat, maxLat = math.Min(minLat, p[1]), math.Max(maxLat, p[1])
+	}
+	return minLon, minLat, maxLon, maxLat
+}
+
+// PolygonArea returns the area of a polygon in square kilometers, holes excluded. Rings are
+// projected with the sinusoidal equal-area projection, so the result holds for polygons of
+// any extent; the ring orientation does not matter.
+func PolygonArea(polygon [][]Point) float64 {
+	area := 0.0
+	for i, ring := range polygon {
+		ringArea := 0.0
+		for j := 0; j+1 < len(ring); j++ {
+			x1, y1 := sinusoidal(ring[j])
+			x2, y2 := sinusoidal(ring[j+1])
+			ringArea += x1*y2 - x2*y1
+		}
+		ringArea = math.Abs(ringArea) / 2
+		if i == 0 {
+			area += ringArea
+		} else {
+			area -= ringArea
+		}
+	}
+	return area / 1e6
+}
+
+func sinusoidal(p Point) (x, y float64) {
+	return p[0] * MetersPerDegree * math.Cos(p[1]*math.Pi/180), p[1] * MetersPerDegree
+}
@@ -0,0 +1,173 @@
+package raster
+
+import (
+	"math"
+	"testing"
+)
+
+// newTestGrid returns a grid of unit cells starting at the origin
+func newTestGrid(cols, rows int) *Grid {
+	return &Grid{CellLon: 1, CellLat: 1, Cols: cols, Rows: rows, Cells: make([]int32, cols*rows)}
+}
+
+func nonZero(value int32) bool { return value != 0 }
+
+func ringArea(ring []Point) float64 {
+	area := 0.0
+	for i := 0; i < len(ring)-1; i++ {
+		area += ring[i][0]*ring[i+1][1] - ring[i+1][0]*ring[i][1]
+	}
+	return area / 2
+}
+
+func TestFillPolygon(t *testing.T) {
+	g := newTestGrid(10, 10)
+	square := [][]Point{{{2, 2}, {8, 2}, {8, 8}, {2, 8}, {2, 2}}}
+	hole := []Point{{4, 4}, {4, 6}, {6, 6}, {6, 4}, {4, 4}}
+
+	g.FillPolygon(append(square, hole))
+
+	count := 0
+	for _, value := range g.Cells {
+		if value != 0 {
+			count++
+		}
+	}
+	if count != 36-4 {
+		t.Errorf("filled %d cells, want %d", count, 32)
+	}
+	if g.Get(4, 4) != 0 {
+		t.Error("cell inside the hole was filled")
+	}
+
+	g.FillPolygon(square)
+	if g.Get(2, 2) != 2 || g.Get(4, 4) != 1 {
+		t.Errorf("counters = %d, %d, want 2, 1", g.Get(2, 2), g.Get(4, 4))
+	}
+}
+
+func TestDilateAndFillHoles(t *testing.T) {
+	g := newTestGrid(9, 9)
+	g.Set(4, 4, 1)
+	g.Dilate(1)
+
+	for _, cell := range [][2]int{{4, 4}, {3, 4}, {5, 4}, {4, 3}, {4, 5}} {
+		if g.Get(cell[0], cell[1]) == 0 {
+			t.Errorf("cell %v not covered after Dilate", cell)
+		}
+	}
+	if g.Get(3, 3) != 0 {
+		t.Error("diagonal cell covered by Dilate(1)")
+	}
+
+	// A ring of cells enclosing an empty centre
+	g = newTestGrid(5, 5)
+	for col := 1; col <= 3; col++ {
+		for row := 1; row <= 3; row++ {
+			if col != 2 || row != 2 {
+				g.Set(col, row, 1)
+			}
+		}
+	}
+	g.FillHoles()
+	if g.Get(2, 2) != 1 {
+		t.Error("enclosed cell not filled")
+	}
+	if g.Get(0, 0) != 0 {
+		t.Error("outside cell filled")
+	}
+}
+
+func TestPolygons(t *testing.T) {
+	g := newTestGrid(10, 6)
+
+	// A 5x5 block with a 1x1 hole, and a separate 2x1 block
+	for col := 0; col < 5; col++ {
+		for row := 0; row < 5; row++ {
+			g.Set(col, row, 1)
+		}
+	}
+	g.Set(2, 2, 0)
+	g.Set(7, 3, 1)
+	g.Set(8, 3, 1)
+
+	polygons := g.Polygons(nonZero)
+	if len(polygons) != 2 {
+		t.Fatalf("got %d polygons, want 2", len(polygons))
+	}
+
+	var block, bar [][]Point
+	for _, polygon := range polygons {
+		if len(polygon) == 2 {
+			block = polygon
+		} else {
+			bar = polygon
+		}
+	}
+	if block == nil || len(bar) != 1 {
+		t.Fatalf("unexpected ring counts: %v", polygons)
+	}
+
+	if area := ringArea(block[0]); area != 25 {
+		t.Errorf("exterior area = %v, want 25", area)
+	}
+	if area := ringArea(block[1]); area != -1 {
+		t.Errorf("hole area = %v, want -1", area)
+	}
+	if area := ringArea(bar[0]); area != 2 {
+		t.Errorf("bar area = %v, want 2", area)
+	}
+
+	// Collinear corners are removed, leaving rectangles with four corners
+	if len(bar[0]) != 5 {
+		t.Errorf("bar ring has %d positions, want 5", len(bar[0]))
+	}
+	first, last := bar[0][0], bar[0][len(bar[0])-1]
+	if first != last {
+		t.Error("ring is not closed")
+	}
+}
+
+func TestPolygonsDiagonalCells(t *testing.T) {
+	g := newTestGrid(3, 3)
+	g.Set(0, 0, 1)
+	g.Set(1, 1, 1)
+
+	polygons := g.Polygons(nonZero)
+	if len(polygons) != 2 {
+		t.Fatalf("got %d polygons, want 2", len(polygons))
+	}
+	for _, polygon := range polygons {
+		if area := ringArea(polygon[0]); area != 1 {
+			t.Errorf("area = %v, want 1", area)
+		}
+	}
+}
+
+func TestArea(t *testing.T) {
+	g := NewGrid(9.0, 45.0, 9.1, 45.1, 100)
+	for i := range g.Cells {
+		g.Cells[i] = 1
+	}
+
+	// The grid covers at least the requested box, about 7.9 km by 11.1 km
+	area := g.Area(nonZero)
+	if area < 87 || area > 92 {
+		t.Errorf("area = %.2f km², want about 88", area)
+	}
+	if cellArea := g.CellArea(0); math.Abs(cellArea-0.01) > 0.0005 {
+		t.Errorf("cell area = %f km², want 0.01", cellArea)
+	}
+}
+
+func TestPolygonArea(t *testing.T) {
+	// One degree square at the equator, with a hole of a quarter of its area
+	polygon := [][]Point{
+		{{0, 0}, {1, 0}, {1, 1}, {0, 1}, {0, 0}},
+		{{0.25, 0.25}, {0.25, 0.75}, {0.75, 0.75}, {0.75, 0.25}, {0.25, 0.25}},
+	}
+	want := 0.75 * MetersPerDegree * MetersPerDegree / 1e6
+	if area := PolygonArea(polygon); math.Abs(area-want) > want*0.001 {
+		t.Errorf("area = %.1f km², want %.1f", area, want)
+	}
+}
@@ -0,0 +1,175 @@
+package raster
+
+import "math"
+
+// edge is a unit step between two grid corners with the traced region on its left
+type edge struct {
+	x, y   int
+	dx, dy int
+	used   bool
+}
+
+// Polygons traces the outline of the cells matching the predicate and returns one polygon
+// per connected region. Each polygon is a list of closed rings, the first being the
+// counterclockwise exterior and the others clockwise holes. Cells touching only by a corner
+// belong to different regions.
+func (g *Grid) Polygons(include func(value int32) bool) [][][]Point {
+	inside := func(col, row int) bool {
+		if col < 0 || row < 0 || col >= g.Cols || row >= g.Rows {
+			return false
+		}
+		return include(g.Cells[row*g.Cols+col])
+	}
+
+	// Collect the boundary edges, keyed by their starting corner
+	width := g.Cols + 1
+	outgoing := make(map[int][]*edge)
+	var edges []*edge
+	add := func(x, y, dx, dy int) {
+		e := &edge{x: x, y: y, dx: dx, dy: dy}
+		key := y*width + x
+		outgoing[key] = append(outgoing[key], e)
+		edges = append(edges, e)
+	}
+
+	for row := 0; row < g.Rows; row++ {
+		for col := 0; col < g.Cols; col++ {
+			if !inside(col, row) {
+				continue
+			}
+			if !inside(col, row-1) {
+				add(col, row, 1, 0)
+			}
+			if !inside(col+1, row) {
+				add(col+1, row, 0, 1)
+			}
+			if !inside(col, row+1) {
+				add(col+1, row+1, -1, 0)
+			}
+			if !inside(col-1, row) {
+				add(col, row+1, 0, -1)
+			}
+		}
+	}
+
+	// Link the edges into rings, turning left where two regions meet at a corner
+	var exteriors, holes [][]corner
+	for _, start := range edges {
+		if start.used {
+			continue
+		}
+
+		var ring []corner
+		e := start
+		for {
+			e.used = true
+			ring = append(ring, corner{e.x, e.y})
+			e = nextEdge(outgoing[(e.y+e.dy)*width+e.x+e.dx], e.dx, e.dy)
+			if e == nil || e == start {
+				break
+			}
+		}
+
+		ring = dropCollinear(ring)
+		if cornerArea(ring) > 0 {
+			exteriors = append(exteriors, ring)
+		} else {
+			holes = append(holes, ring)
+		}
+	}
+
+	polygons := make([][][]Point, len(exteriors))
+	for i, ring := range exteriors {
+		polygons[i] = [][]Point{g.points(ring)}
+	}
+
+	// Attach every hole to the smallest exterior containing the empty cell next to it
+	for _, hole := range holes {
+		x := float64(hole[0].x+hole[1].x)/2 + float64(sign(hole[1].y-hole[0].y))/2
+		y := float64(hole[0].y+hole[1].y)/2 - float64(sign(hole[1].x-hole[0].x))/2
+
+		best, bestArea := -1, math.Inf(1)
+		for i, ring := range exteriors {
+			area := cornerArea(ring)
+			if area < bestArea && cornerRingContains(ring, x, y) {
+				best, bestArea = i, area
+			}
+		}
+		if best >= 0 {
+			polygons[best] = append(polygons[best], g.points(hole))
+		}
+	}
+
+	return polygons
+}
+
+// corner is a grid corner; corner (x, y) is the south-west corner of cell (x, y)
+type corner struct {
+	x, y int
+}
+
+// nextEdge picks the outgoing edge turning left, then straight on, then right
+func nextEdge(candidates []*edge, dx, dy int) *edge {
+	for _, turn := range [][2]int{{-dy, dx}, {dx, dy}, {dy, -dx}} {
+		for _, e := range candidates {
+			if e.dx == turn[0] && e.dy == turn[1] {
+				return e
+			}
+		}
+	}
+	return nil
+}
+
+// dropCollinear removes the corners where the ring keeps going in the same direction
+func dropCollinear(ring []corner) []corner {
+	var result []corner
+	n := len(ring)
+	for i, c := range ring {
+		prev, next := ring[(i+n-1)%n], ring[(i+1)%n]
+		if (c.x-prev.x)*(next.y-c.y) != (c.y-prev.y)*(next.x-c.x) {
+			result = append(result, c)
+		}
+	}
+	return result
+}
+
+// cornerArea returns the signed area of a ring in cells; positive for counterclockwise rings
+func cornerArea(ring []corner) float64 {
+	area := 0
+	for i, c := range ring {
+		next := ring[(i+1)%len(ring)]
+		area += c.x*next.y - next.x*c.y
+	}
+	return float64(area) / 2
+}
+
+func cornerRingContains(ring []corner, x, y float64) bool {
+	inside := false
+	for i, j := 0, len(ring)-1; i < len(ring); j, i = i, i+1 {
+		xi, yi := float64(ring[i].x), float64(ring[i].y)
+		xj, yj := float64(ring[j].x), float64(ring[j].y)
+		if (yi > y) != (yj > y) && x < (xj-xi)*(y-yi)/(yj-yi)+xi {
+			inside = !inside
+		}
+	}
+	return inside
+}
+
+// points converts a ring of corners to a closed ring of lon/lat points
+func (g *Grid) points(ring []corner) []Point {
+	points := make([]Point, 0, len(ring)+1)
+	for _, c := range ring {
+		points = append(points, Point{g.MinLon + float64(c.x)*g.CellLon, g.MinLat + float64(c.y)*g.CellLat})
+	}
+	return append(points, points[0])
+}
+
+func sign(v int) int {
+	switch {
+	case v > 0:
+		return 1
+	case v < 0:
+		return -1
+	}
+	return 0
+}
@@ -0,0 +1,198 @@
+// Package reach answers which stations reach a point within their isochrones, using an
+// R-tree over the isochrone bounding boxes followed by exact point-in-polygon tests.
+package reach
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"logreason/internal/coverage"
+	"logreason/internal/csvparser"
+	"logreason/internal/geojson"
+	"logreason/internal/raster"
+	"logreason/internal/rtree"
+)
+
+// Isochrone is the area a station reaches within a range
+type Isochrone struct {
+	File     string
+	Location csvparser.Location
+	Range    int
+	Polygons [][][]raster.Point
+}
+
+// Band lists the stations reaching a point within a range
+type Band struct {
+	Range     int                  `json:"range"`
+	Locations []csvparser.Location `json:"locations"`
+}
+
+// Index finds the isochrones containing a point
+type Index struct {
+	isochrones []Isochrone
+	// polygons maps the values of the tree items to an isochrone and one of its polygons
+	polygons [][2]int
+	tree     *rtree.Tree
+}
+
+// Build loads every isochrone file of dir into an index. The station of each file is read
+// from the station properties saved with it; older files without them are matched to the
+// given locations by file name. Files that cannot be parsed are skipped with a warning.
+func Build(dir string, locations []csvparser.Location) (*Index, error) {
+	names, err := geojson.ListFiles(dir, 0)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list isochrones: %w", err)
+	}
+
+	byFileName := make(map[string]csvparser.Location, len(locations))
+	for _, location := range locations {
+		byFileName[geojson.StationFileName(location)] = location
+	}
+
+	var isochrones []Isochrone
+	for _, name := range names {
+		content, err := os.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read isochrone: %w", err)
+		}
+		fc, err := geojson.ParseFeatureCollection(content)
+		if err != nil {
+			log.Printf("Warning: skipping %s: %v", name, err)
+			continue
+		}
+
+		station, rangeValue := geojson.ParseFileName(name)
+		location, ok := fc.StationLocation()
+		if !ok {
+			if location, ok = byFileName[station]; !ok {
+				location = csvparser.Location{Name: station}
+			}
+		}
+
+		isochrones = append(isochrones, Isochrone{File: strings.TrimSuffix(name, ".json"), Location: location, Range: rangeValue, Polygons: coverage.Polygons(fc)})
+	}
+
+	return NewIndex(isochrones), nil
+}
+
+// NewIndex indexes the isochrones
+func NewIndex(isochrones []Isochrone) *Index {
+	index := &Index{isochrones: isochrones}
+
+	var items []rtree.Item
+	for i, isochrone := range isochrones {
+		for p, polygon := range isochrone.Polygons {
+			items = append(items, rtree.Item{Rect: bounds(polygon[0]), Value: len(index.polygons)})
+			index.polygons = append(index.polygons, [2]int{i, p})
+		}
+	}
+	index.tree = rtree.New(items)
+
+	return index
+}
+
+// Len returns the number of indexed isochrones
+func (index *Index) Len() int {
+	return len(index.isochrones)
+}
+
+// Lookup returns the isochrones containing the point, ordered by range and station name
+func (index *Index) Lookup(lat, lon float64) []Isochrone {
+	seen := make(map[int]bool)
+	var matches []Isochrone
+
+	index.tree.SearchPoint(lon, lat, func(item rtree.Item) bool {
+		ref := index.polygons[item.Value]
+		if seen[ref[0]] {
+			return true
+		}
+		isochrone := index.isochrones[ref[0]]
+		if raster.PolygonContains(isochrone.Polygons[ref[1]], lon, lat) {
+			seen[ref[0]] = true
+			matches = append(matches, isochrone)
+		}
+		return true
+	})
+
+	sort.Slice(matches, func(i, j int) bool {
+		if matches[i].Range != matches[j].Range {
+			return matches[i].Range < matches[j].Range
+		}
+		return matches[i].Location.Name < matches[j].Location.Name
+	})
+	return matches
+}
+
+// Bands groups the stations reaching the point by range band, shortest range first.
+// A station reaching the point within a range also appears in the larger bands it was
+// computed for.
+func (index *Index) Bands(lat, lon float64) []Band {
+	bands := []Band{}
+	for _, isochrone := range index.Lookup(lat, lon) {
+		if len(bands) == 0 || bands[len(bands)-1].Range != isochrone.Range {
+			bands = append(bands, Band{Range: isochrone.Range})
+		}
+		band := &bands[len(bands)-1]
+		band.Locations = append(band.Locations, isochrone.Location)
+	}
+	return bands
+}
+
+func bounds(ring []raster.Point) rtree.Rect {
+	r := rtree.Rect{MinX: math.Inf(1), MinY: math.Inf(1), MaxX: math.Inf(-1), MaxY: math.Inf(-1)}
+	for _, point := range ring {
+		r.MinX, r.MaxX = math.Min(r.MinX, point[0]), math.Max(r.MaxX, point[0])
+		r.MinY, r.MaxY = math.Min(r.MinY, point[1]), math.Max(r.MaxY, point[1])
+	}
+	return r
+}
+
+// Cache keeps the index of a directory and rebuilds it when the isochrone files or the
+// locations file change
+type Cache struct {
+	dir          string
+	locationsCSV string
+
+	mu        sync.Mutex
+	signature string
+	index     *Index
+}
+
+// NewCache creates a cache for the isochrones in dir, falling back to the stations of the
+// locations CSV file for files without station properties
+func NewCache(dir, locationsCSV string) *Cache {
+	return &Cache{dir: dir, locationsCSV: locationsCSV}
+}
+
+// Index returns the index, rebuilding it when a file was added, removed or modified
+func (c *Cache) Index() (*Index, error) {
+	signature, err := geojson.DirSignature(c.dir, c.locationsCSV)
+	if err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.index != nil && signature == c.signature {
+		return c.index, nil
+	}
+
+	var locations []csvparser.Location
+	if _, err := os.Stat(c.locationsCSV); err == nil {
+		locations = csvparser.NewParser().ParseFile(c.locationsCSV).Locations
+	}
+
+	index, err := Build(c.dir, locations)
+	if err != nil {
+		return nil, err
+	}
+	c.index, c.signature = index, signature
+	return index, nil
+}
@@ -0,0 +1,69 @@
+package reach
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"logreason/internal/csvparser"
+	"logreason/internal/raster"
+)
+
+func square(lon, lat, size float64) [][][]raster.Point {
+	return [][][]raster.Point{{{{lon, lat}, {lon + size, lat}, {lon + size, lat + size}, {lon, lat + size}, {lon, lat}}}}
+}
+
+func TestIndexBands(t *testing.T) {
+	a := csvparser.Location{Name: "STA", City: "A", Latitude: 45.05, Longitude: 9.05}
+	b := csvparser.Location{Name: "STB", City: "B", Latitude: 45.05, Longitude: 9.15}
+
+	// An L-shaped isochrone whose bounding box contains points outside of it
+	lShape := [][][]raster.Point{{{{9.0, 45.0}, {9.2, 45.0}, {9.2, 45.05}, {9.05, 45.05}, {9.05, 45.2}, {9.0, 45.2}, {9.0, 45.0}}}}
+
+	index := NewIndex([]Isochrone{
+		{File: "STB-b-720", Location: b, Range: 720, Polygons: square(9.0, 45.0, 0.3)},
+		{File: "STA-a-480", Location: a, Range: 480, Polygons: square(9.0, 45.0, 0.1)},
+		{File: "STA-a-720", Location: a, Range: 720, Polygons: square(9.0, 45.0, 0.2)},
+		{File: "STB-b-480", Location: b, Range: 480, Polygons: lShape},
+	})
+
+	bands := index.Bands(45.02, 9.02)
+	if len(bands) != 2 || bands[0].Range != 480 || bands[1].Range != 720 {
+		t.Fatalf("Unexpected bands %+v", bands)
+	}
+	if len(bands[0].Locations) != 2 || bands[0].Locations[0].Name != "STA" || bands[0].Locations[1].Name != "STB" {
+		t.Errorf("Unexpected 480 band %+v", bands[0].Locations)
+	}
+
+	// Inside the bounding box of the L shape but not inside the polygon
+	bands = index.Bands(45.15, 9.15)
+	if len(bands) != 1 || bands[0].Range != 720 || len(bands[0].Locations) != 2 {
+		t.Errorf("Unexpected bands %+v", bands)
+	}
+
+	if bands := index.Bands(46, 10); len(bands) != 0 {
+		t.Errorf("Expected no bands, got %+v", bands)
+	}
+}
+
+func TestBuildMatchesLegacyFiles(t *testing.T) {
+	dir := t.TempDir()
+	legacy := `{"type":"FeatureCollection","features":[{"type":"Feature","properties":{},
+		"geometry":{"type":"Polygon","coordinates":[[[9.0,45.0],[9.1,45.0],[9.1,45.1],[9.0,45.1],[9.0,45.0]]]}}]}`
+	os.WriteFile(filepath.Join(dir, "APMPAD-padernoDugnano-600.json"), []byte(legacy), 0644)
+	os.WriteFile(filepath.Join(dir, "BROKEN-city-600.json"), []byte("{"), 0644)
+
+	location := csvparser.Location{Name: "APMPAD", City: "PADERNO DUGNANO", Latitude: 45.05, Longitude: 9.05}
+	index, err := Build(dir, []csvparser.Location{location})
+	if err != nil {
+		t.Fatalf("Build failed: %v", err)
+	}
+	if index.Len() != 1 {
+		t.Fatalf("Indexed %d isochrones, want 1", index.Len())
+	}
+
+	matches := index.Lookup(45.05, 9.05)
+	if len(matches) != 1 || matches[0].Location != location || matches[0].Range != 600 {
+		t.Errorf("Unexpected matches %+v", matches)
+	}
+}
@@ -0,0 +1,99 @@
+package roadgraph
+
+import "math"
+
+// CostFunc returns the cost of traversing an edge, or +Inf when it cannot be used
+type CostFunc func(e Edge) float64
+
+// DefaultSpeeds are the car speeds in km/h used for each OSM highway class when a road
+// has no maxspeed tag
+var DefaultSpeeds = map[string]float64{
+	"motorway":       110,
+	"motorway_link":  60,
+	"trunk":          90,
+	"trunk_link":     50,
+	"primary":        70,
+	"primary_link":   40,
+	"secondary":      60,
+	"secondary_link": 40,
+	"tertiary":       50,
+	"tertiary_link":  30,
+	"unclassified":   40,
+	"residential":    30,
+	"living_street":  10,
+	"service":        20,
+	"road":           30,
+}
+
+// Profile describes how a vehicle or pedestrian moves on the road network
+type Profile struct {
+	// Speeds maps highway classes to speeds in km/h; classes missing from the map are not accessible
+	Speeds map[string]float64
+	// UseMaxSpeed prefers the posted speed limit over the class speed
+	UseMaxSpeed bool
+	// MaxSpeed caps the speed in km/h, 0 for no cap
+	MaxSpeed float64
+	// IgnoreOneway allows travelling against the direction of oneway roads
+	IgnoreOneway bool
+	// AccessSpeed is the speed in km/h used to reach the nearest road from the origin
+	AccessSpeed float64
+}
+
+// Built-in profiles
+var (
+	Car = Profile{Speeds: DefaultSpeeds, UseMaxSpeed: true, AccessSpeed: 5}
+	// Truck follows car roads, with speeds capped at the Italian limit for heavy vehicles
+	Truck   = Profile{Speeds: DefaultSpeeds, UseMaxSpeed: true, MaxSpeed: 80, AccessSpeed: 5}
+	Foot    = Profile{Speeds: uniformSpeeds(5, "motorway", "motorway_link", "trunk", "trunk_link"), IgnoreOneway: true, AccessSpeed: 5}
+	Bicycle = Profile{Speeds: uniformSpeeds(15, "motorway", "motorway_link", "trunk", "trunk_link", "footway", "steps"), AccessSpeed: 5}
+)
+
+// uniformSpeeds returns the same speed for every road class except the excluded ones
+func uniformSpeeds(speed float64, excluded ...string) map[string]float64 {
+	speeds := map[string]float64{
+		"path": speed, "footway": speed, "pedestrian": speed, "cycleway": speed,
+		"track": speed, "steps": speed,
+	}
+	for class := range DefaultSpeeds {
+		speeds[class] = speed
+	}
+	for _, class := range excluded {
+		delete(speeds, class)
+	}
+	return speeds
+}
+
+// Speed returns the speed in km/h on an edge, or 0 when the edge is not accessible
+func (p Profile) Speed(e Edge) float64 {
+	if e.Reverse && !p.IgnoreOneway {
+		return 0
+	}
+	speed := p.Speeds[e.Class]
+	if speed == 0 {
+		return 0
+	}
+	if p.UseMaxSpeed && e.MaxSpeed > 0 {
+		speed = e.MaxSpeed
+	}
+	if p.MaxSpeed > 0 && speed > p.MaxSpeed {
+		speed = p.MaxSpeed
+	}
+	return speed
+}
+
+// TravelTime is a cost function returning the time in seconds to traverse an edge
+func (p Profile) TravelTime(e Edge) float64 {
+	speed := p.Speed(e)
+	if speed == 0 {
+		return math.Inf(1)
+	}
+	return e.Length / (speed / 3.6)
+}
+
+// TravelDistance is a cost function returning the length in meters of accessible edges
+func (p Profile) TravelDistance(e Edge) float64 {
+	if p.Speed(e) == 0 {
+		return math.Inf(1)
+	}
+	return e.Length
+}
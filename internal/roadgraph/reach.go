@@ -0,0 +1,135 @@
+package roadgraph
+
+import (
+	"container/heap"
+	"context"
+	"math"
+)
+
+// Reach runs a Dijkstra search from source, starting with the given initial cost, and
+// returns the cost of reaching every node. Nodes beyond the budget are left at +Inf.
+// The search stops early with the context error when the context is done.
+func (g *Graph) Reach(ctx context.Context, source int, initial, budget float64, cost CostFunc) ([]float64, error) {
+	costs := make([]float64, len(g.Nodes))
+	for i := range costs {
+		costs[i] = math.Inf(1)
+	}
+	if initial > budget {
+		return costs, nil
+	}
+
+	costs[source] = initial
+	queue := &priorityQueue{{node: source, cost: initial}}
+
+	for steps := 0; queue.Len() > 0; steps++ {
+		if steps%4096 == 0 && ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+
+		item := heap.Pop(queue).(queueItem)
+		if item.cost > costs[item.node] {
+			continue
+		}
+
+		for _, e := range g.Edges[item.node] {
+			next := item.cost + cost(e)
+			if next <= budget && next < costs[e.To] {
+				costs[e.To] = next
+				heap.Push(queue, queueItem{node: e.To, cost: next})
+			}
+		}
+	}
+
+	return costs, nil
+}
+
+// Paths runs an unbounded Dijkstra search from source like Reach and returns, for every
+// node, the cost of the cheapest path and its length in meters. Unreachable nodes are
+// left at +Inf in both slices.
+func (g *Graph) Paths(ctx context.Context, source int, initial float64, cost CostFunc) (costs, lengths []float64, err error) {
+	costs = make([]float64, len(g.Nodes))
+	lengths = make([]float64, len(g.Nodes))
+	for i := range costs {
+		costs[i] = math.Inf(1)
+		lengths[i] = math.Inf(1)
+	}
+
+	costs[source], lengths[source] = initial, 0
+	queue := &priorityQueue{{node: source, cost: initial}}
+
+	for steps := 0; queue.Len() > 0; steps++ {
+		if steps%4096 == 0 && ctx.Err() != nil {
+			return nil, nil, ctx.Err()
+		}
+
+		item := heap.Pop(queue).(queueItem)
+		if item.cost > costs[item.node] {
+			continue
+		}
+
+		for _, e := range g.Edges[item.node] {
+			next := item.cost + cost(e)
+			if next < costs[e.To] {
+				costs[e.To] = next
+				lengths[e.To] = lengths[item.node] + e.Length
+				heap.Push(queue, queueItem{node: e.To, cost: next})
+			}
+		}
+	}
+
+	return costs, lengths, nil
+}
+
+// ReachablePoints samples the reachable part of the network every step meters, given the
+// node costs returned by Reach. Edges leaving a reached node are followed for the share
+// of their length the remaining budget allows, so the result extends past the last
+// reachable junction. Points are returned as longitude, latitude pairs.
+func (g *Graph) ReachablePoints(costs []float64, budget float64, cost CostFunc, step float64) [][2]float64 {
+	var points [][2]float64
+	for from, c := range costs {
+		if math.IsInf(c, 1) {
+			continue
+		}
+		a := g.Nodes[from]
+		points = append(points, [2]float64{a.Lon, a.Lat})
+
+		for _, e := range g.Edges[from] {
+			edgeCost := cost(e)
+			if math.IsInf(edgeCost, 1) {
+				continue
+			}
+
+			share := 1.0
+			if edgeCost > 0 {
+				share = math.Min(1, (budget-c)/edgeCost)
+			}
+
+			b := g.Nodes[e.To]
+			samples := int(math.Ceil(e.Length * share / step))
+			for i := 1; i <= samples; i++ {
+				t := share * float64(i) / float64(samples)
+				points = append(points, [2]float64{a.Lon + (b.Lon-a.Lon)*t, a.Lat + (b.Lat-a.Lat)*t})
+			}
+		}
+	}
+	return points
+}
+
+type queueItem struct {
+	node int
+	cost float64
+}
+
+// priorityQueue is a min-heap of nodes ordered by cost
+type priorityQueue []queueItem
+
+func (q priorityQueue) Len() int            { return len(q) }
+func (q priorityQueue) Less(i, j int) bool  { return q[i].cost < q[j].cost }
+func (q priorityQueue) Swap(i, j int)       { q[i], q[j] = q[j], q[i] }
+func (q *priorityQueue) Push(x interface{}) { *q = append(*q, x.(queueItem)) }
+func (q *priorityQueue) Pop() interface{} {
+	old := *q
+	item := old[len(old)-1]
+	*q = old[:len(old)-1]
+	return item
+}
@@ -0,0 +1,271 @@
+// Package roadgraph loads a road network extracted from OpenStreetMap and computes which
+// parts of it can be reached from a point within a travel time or distance budget.
+package roadgraph
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// EarthRadius is the mean Earth radius in meters
+const EarthRadius = 6371008.8
+
+// Node is a road junction or shape point
+type Node struct {
+	Lat float64
+	Lon float64
+}
+
+// Edge is a directed road segment between two consecutive nodes
+type Edge struct {
+	To int
+	// Length of the segment in meters
+	Length float64
+	// Class is the OSM highway tag, e.g. motorway or residential
+	Class string
+	// MaxSpeed is the posted speed limit in km/h, or 0 when unknown
+	MaxSpeed float64
+	// Reverse marks the opposite direction of a oneway road, usable only on foot
+	Reverse bool
+}
+
+// Graph is a road network stored as adjacency lists
+type Graph struct {
+	Nodes []Node
+	Edges [][]Edge
+}
+
+// wireFeature is the subset of a GeoJSON feature read by Load
+type wireFeature struct {
+	Geometry *struct {
+		Type        string          `json:"type"`
+		Coordinates json.RawMessage `json:"coordinates"`
+	} `json:"geometry"`
+	Properties map[string]interface{} `json:"properties"`
+}
+
+// Load reads a road network from a GeoJSON FeatureCollection of LineString and
+// MultiLineString features tagged with the OSM highway, maxspeed, oneway and junction
+// properties, as produced by `osmium export` or `ogr2ogr` from a PBF extract.
+// Features without a highway property are ignored. Lines sharing a coordinate are
+// connected at that coordinate.
+func Load(path string) (*Graph, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open road graph: %w", err)
+	}
+	defer file.Close()
+
+	g, err := Read(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read road graph %s: %w", path, err)
+	}
+	return g, nil
+}
+
+// Read decodes a road network like Load, streaming the features one at a time
+func Read(r io.Reader) (*Graph, error) {
+	b := newBuilder()
+	decoder := json.NewDecoder(r)
+
+	if err := expectDelim(decoder, '{'); err != nil {
+		return nil, err
+	}
+	for decoder.More() {
+		token, err := decoder.Token()
+		if err != nil {
+			return nil, err
+		}
+
+		if token != "features" {
+			var skip json.RawMessage
+			if err := decoder.Decode(&skip); err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		if err := expectDelim(decoder, '['); err != nil {
+			return nil, err
+		}
+		for decoder.More() {
+			var feature wireFeature
+			if err := decoder.Decode(&feature); err != nil {
+				return nil, err
+			}
+			if err := b.addFeature(&feature); err != nil {
+				return nil, err
+			}
+		}
+		if err := expectDelim(decoder, ']'); err != nil {
+			return nil, err
+		}
+	}
+
+	if len(b.graph.Nodes) == 0 {
+		return nil, fmt.Errorf("no roads found")
+	}
+	return b.graph, nil
+}
+
+func expectDelim(decoder *json.Decoder, delim json.Delim) error {
+	token, err := decoder.Token()
+	if err != nil {
+		return err
+	}
+	if token != delim {
+		return fmt.Errorf("expected %q, got %v", delim, token)
+	}
+	return nil
+}
+
+// builder merges the nodes of the lines added to a graph
+type builder struct {
+	graph *Graph
+	index map[[2]int64]int
+}
+
+func newBuilder() *builder {
+	return &builder{graph: &Graph{}, index: make(map[[2]int64]int)}
+}
+
+// node returns the node at a coordinate, creating it if needed. Coordinates are
+// merged at 1e-7 degrees, the precision of OSM.
+func (b *builder) node(lon, lat float64) int {
+	key := [2]int64{int64(math.Round(lon * 1e7)), int64(math.Round(lat * 1e7))}
+	if i, ok := b.index[key]; ok {
+		return i
+	}
+	i := len(b.graph.Nodes)
+	b.graph.Nodes = append(b.graph.Nodes, Node{Lat: lat, Lon: lon})
+	b.graph.Edges = append(b.graph.Edges, nil)
+	b.index[key] = i
+	return i
+}
+
+func (b *builder) addFeature(feature *wireFeature) error {
+	class, _ := feature.Properties["highway"].(string)
+	if class == "" || feature.Geometry == nil {
+		return nil
+	}
+
+	var lines [][][]float64
+	switch feature.Geometry.Type {
+	case "LineString":
+		var line [][]float64
+		if err := json.Unmarshal(feature.Geometry.Coordinates, &line); err != nil {
+			return fmt.Errorf("invalid LineString coordinates: %w", err)
+		}
+		lines = append(lines, line)
+	case "MultiLineString":
+		if err := json.Unmarshal(feature.Geometry.Coordinates, &lines); err != nil {
+			return fmt.Errorf("invalid MultiLineString coordinates: %w", err)
+		}
+	default:
+		return nil
+	}
+
+	maxSpeed := parseMaxSpeed(feature.Properties["maxspeed"])
+	oneway := onewayDirection(feature.Properties)
+
+	for _, line := range lines {
+		previous := -1
+		for _, position := range line {
+			if len(position) < 2 {
+				return fmt.Errorf("invalid position %v", position)
+			}
+			current := b.node(position[0], position[1])
+			if previous >= 0 && previous != current {
+				b.addSegment(previous, current, class, maxSpeed, oneway)
+			}
+			previous = current
+		}
+	}
+	return nil
+}
+
+// addSegment adds both directions of a segment; oneway is 1 for a road open only from
+// a to b, -1 for a road open only from b to a and 0 for a two-way road
+func (b *builder) addSegment(from, to int, class string, maxSpeed float64, oneway int) {
+	a, c := b.graph.Nodes[from], b.graph.Nodes[to]
+	length := Distance(a.Lat, a.Lon, c.Lat, c.Lon)
+
+	b.graph.Edges[from] = append(b.graph.Edges[from], Edge{To: to, Length: length, Class: class, MaxSpeed: maxSpeed, Reverse: oneway < 0})
+	b.graph.Edges[to] = append(b.graph.Edges[to], Edge{To: from, Length: length, Class: class, MaxSpeed: maxSpeed, Reverse: oneway > 0})
+}
+
+// parseMaxSpeed reads an OSM maxspeed value such as 50, "50" or "30 mph" in km/h
+func parseMaxSpeed(value interface{}) float64 {
+	switch v := value.(type) {
+	case float64:
+		return v
+	case string:
+		fields := strings.Fields(v)
+		if len(fields) == 0 {
+			return 0
+		}
+		speed, err := strconv.ParseFloat(fields[0], 64)
+		if err != nil {
+			return 0
+		}
+		if len(fields) > 1 && fields[1] == "mph" {
+			speed *= 1.609344
+		}
+		return speed
+	}
+	return 0
+}
+
+// onewayDirection reads the OSM oneway tag, treating roundabouts and motorways as oneway
+func onewayDirection(properties map[string]interface{}) int {
+	switch fmt.Sprint(properties["oneway"]) {
+	case "yes", "true", "1":
+		return 1
+	case "-1", "reverse":
+		return -1
+	case "no", "false", "0":
+		return 0
+	}
+	if properties["junction"] == "roundabout" || properties["highway"] == "motorway" {
+		return 1
+	}
+	return 0
+}
+
+// Distance returns the great-circle distance in meters between two points
+func Distance(lat1, lon1, lat2, lon2 float64) float64 {
+	const rad = math.Pi / 180
+	dLat := (lat2 - lat1) * rad
+	dLon := (lon2 - lon1) * rad
+	h := math.Sin(dLat/2)*math.Sin(dLat/2) + math.Cos(lat1*rad)*math.Cos(lat2*rad)*math.Sin(dLon/2)*math.Sin(dLon/2)
+	return 2 * EarthRadius * math.Asin(math.Sqrt(h))
+}
+
+// Nearest returns the node closest to a point that the cost function can leave through
+// at least one edge, and its distance in meters. It returns -1 for an empty graph.
+func (g *Graph) Nearest(lat, lon float64, cost CostFunc) (int, float64) {
+	best, bestDistance := -1, math.Inf(1)
+	for i, node := range g.Nodes {
+		if !g.usable(i, cost) {
+			continue
+		}
+		if d := Distance(lat, lon, node.Lat, node.Lon); d < bestDistance {
+			best, bestDistance = i, d
+		}
+	}
+	return best, bestDistance
+}
+
+func (g *Graph) usable(node int, cost CostFunc) bool {
+	for _, e := range g.Edges[node] {
+		if !math.IsInf(cost(e), 1) {
+			return true
+		}
+	}
+	return false
+}
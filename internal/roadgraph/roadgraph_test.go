@@ -0,0 +1,211 @@
+package roadgraph
+
+import (
+	"context"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// testNetwork is a two-way residential street from node 0 to node 2, a oneway primary road
+// leaving its end northwards (node 3) and a tertiary road open only towards node 0 (from
+// node 4), along with a footpath without a highway tag that must be ignored
+const testNetwork = `{"type": "FeatureCollection", "name": "roads", "features": [
+	{"type": "Feature", "properties": {"highway": "residential"},
+	 "geometry": {"type": "LineString", "coordinates": [[9.00, 45.00], [9.01, 45.00], [9.02, 45.00]]}},
+	{"type": "Feature", "properties": {"highway": "primary", "oneway": "yes", "maxspeed": "50"},
+	 "geometry": {"type": "LineString", "coordinates": [[9.02, 45.00], [9.02, 45.01]]}},
+	{"type": "Feature", "properties": {"highway": "tertiary", "oneway": "-1"},
+	 "geometry": {"type": "MultiLineString", "coordinates": [[[9.00, 45.00], [9.00, 45.01]]]}},
+	{"type": "Feature", "properties": {"name": "not a road"},
+	 "geometry": {"type": "LineString", "coordinates": [[8.90, 45.00], [8.91, 45.00]]}}
+]}`
+
+func loadTestNetwork(t *testing.T) *Graph {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "roads.geojson")
+	if err := os.WriteFile(path, []byte(testNetwork), 0644); err != nil {
+		t.Fatalf("Failed to write road network: %v", err)
+	}
+	g, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	return g
+}
+
+// edge returns the edge from one node to another, failing the test when there is none
+func edge(t *testing.T, g *Graph, from, to int) Edge {
+	t.Helper()
+	for _, e := range g.Edges[from] {
+		if e.To == to {
+			return e
+		}
+	}
+	t.Fatalf("No edge from node %d to node %d", from, to)
+	return Edge{}
+}
+
+func TestLoad(t *testing.T) {
+	g := loadTestNetwork(t)
+
+	// Lines sharing a coordinate are connected and untagged lines are ignored
+	if len(g.Nodes) != 5 {
+		t.Fatalf("Expected 5 nodes, got %d: %v", len(g.Nodes), g.Nodes)
+	}
+	if len(g.Edges[0]) != 2 || len(g.Edges[2]) != 2 {
+		t.Errorf("Expected the junctions to join two roads, got %d and %d edges", len(g.Edges[0]), len(g.Edges[2]))
+	}
+
+	e := edge(t, g, 0, 1)
+	if e.Class != "residential" || e.MaxSpeed != 0 {
+		t.Errorf("Unexpected residential edge %+v", e)
+	}
+	if want := Distance(45, 9, 45, 9.01); math.Abs(e.Length-want) > 1e-6 {
+		t.Errorf("Edge length = %f, want %f", e.Length, want)
+	}
+	if e := edge(t, g, 2, 3); e.MaxSpeed != 50 {
+		t.Errorf("Expected maxspeed 50, got %f", e.MaxSpeed)
+	}
+
+	if _, err := Load(filepath.Join(t.TempDir(), "missing.geojson")); err == nil {
+		t.Error("Expected an error for a missing file")
+	}
+	if _, err := Read(strings.NewReader(`{"type": "FeatureCollection", "features": []}`)); err == nil {
+		t.Error("Expected an error for a network without roads")
+	}
+	if _, err := Read(strings.NewReader(`[]`)); err == nil {
+		t.Error("Expected an error for a document that is not a FeatureCollection")
+	}
+}
+
+func TestLoad_Oneway(t *testing.T) {
+	g := loadTestNetwork(t)
+
+	// oneway=yes is open from the first to the last coordinate
+	if edge(t, g, 2, 3).Reverse || !edge(t, g, 3, 2).Reverse {
+		t.Error("Expected the oneway=yes road to be open only from node 2 to node 3")
+	}
+	// oneway=-1 is open from the last to the first coordinate
+	if !edge(t, g, 0, 4).Reverse || edge(t, g, 4, 0).Reverse {
+		t.Error("Expected the oneway=-1 road to be open only from node 4 to node 0")
+	}
+	if edge(t, g, 0, 1).Reverse || edge(t, g, 1, 0).Reverse {
+		t.Error("Expected the residential street to be two-way")
+	}
+
+	reverse := edge(t, g, 3, 2)
+	if Car.Speed(reverse) != 0 {
+		t.Error("Expected cars not to travel against a oneway road")
+	}
+	if Foot.Speed(reverse) == 0 {
+		t.Error("Expected pedestrians to walk against a oneway road")
+	}
+
+	for _, tt := range []struct {
+		properties map[string]interface{}
+		want       int
+	}{
+		{map[string]interface{}{"highway": "residential"}, 0},
+		{map[string]interface{}{"highway": "residential", "oneway": "true"}, 1},
+		{map[string]interface{}{"highway": "residential", "oneway": "reverse"}, -1},
+		{map[string]interface{}{"highway": "residential", "junction": "roundabout"}, 1},
+		{map[string]interface{}{"highway": "motorway"}, 1},
+		{map[string]interface{}{"highway": "motorway", "oneway": "no"}, 0},
+	} {
+		if got := onewayDirection(tt.properties); got != tt.want {
+			t.Errorf("onewayDirection(%v) = %d, want %d", tt.properties, got, tt.want)
+		}
+	}
+}
+
+func TestParseMaxSpeed(t *testing.T) {
+	for _, tt := range []struct {
+		value interface{}
+		want  float64
+	}{
+		{50.0, 50},
+		{"70", 70},
+		{"30 mph", 30 * 1.609344},
+		{"signals", 0},
+		{"", 0},
+		{nil, 0},
+	} {
+		if got := parseMaxSpeed(tt.value); math.Abs(got-tt.want) > 1e-9 {
+			t.Errorf("parseMaxSpeed(%v) = %f, want %f", tt.value, got, tt.want)
+		}
+	}
+}
+
+func TestNearest(t *testing.T) {
+	g := loadTestNetwork(t)
+
+	// Node 3 only has the reverse edge of the oneway road, which cars cannot leave through
+	if node, _ := g.Nearest(45.0101, 9.02, Car.TravelTime); node != 2 {
+		t.Errorf("Expected node 2 for a car, got %d", node)
+	}
+	node, distance := g.Nearest(45.0101, 9.02, Foot.TravelTime)
+	if node != 3 {
+		t.Errorf("Expected node 3 on foot, got %d", node)
+	}
+	if want := Distance(45.0101, 9.02, 45.01, 9.02); math.Abs(distance-want) > 1e-6 {
+		t.Errorf("Distance = %f, want %f", distance, want)
+	}
+
+	if node, distance := (&Graph{}).Nearest(45, 9, Car.TravelTime); node != -1 || !math.IsInf(distance, 1) {
+		t.Errorf("Expected -1 for an empty graph, got %d at %f", node, distance)
+	}
+}
+
+func TestPaths(t *testing.T) {
+	g := loadTestNetwork(t)
+
+	costs, lengths, err := g.Paths(context.Background(), 0, 10, Car.TravelTime)
+	if err != nil {
+		t.Fatalf("Paths failed: %v", err)
+	}
+
+	street := edge(t, g, 0, 1).Length + edge(t, g, 1, 2).Length
+	primary := edge(t, g, 2, 3).Length
+	if math.Abs(lengths[3]-(street+primary)) > 1e-6 {
+		t.Errorf("Length to node 3 = %f, want %f", lengths[3], street+primary)
+	}
+	// The initial cost is added, then 30 km/h on the street and the 50 km/h limit on the primary road
+	if want := 10 + street/(30/3.6) + primary/(50/3.6); math.Abs(costs[3]-want) > 1e-6 {
+		t.Errorf("Cost to node 3 = %f, want %f", costs[3], want)
+	}
+	if costs[0] != 10 || lengths[0] != 0 {
+		t.Errorf("Expected the source to cost the initial cost, got %f and %f", costs[0], lengths[0])
+	}
+
+	// Node 4 is only reachable against the oneway=-1 road
+	if !math.IsInf(costs[4], 1) || !math.IsInf(lengths[4], 1) {
+		t.Errorf("Expected node 4 to be unreachable by car, got %f", costs[4])
+	}
+	_, lengths, err = g.Paths(context.Background(), 0, 0, Foot.TravelTime)
+	if err != nil {
+		t.Fatalf("Paths failed: %v", err)
+	}
+	if math.IsInf(lengths[4], 1) {
+		t.Error("Expected node 4 to be reachable on foot")
+	}
+
+	// Nothing can be reached by car from the end of the oneway road
+	costs, _, err = g.Paths(context.Background(), 3, 0, Car.TravelTime)
+	if err != nil {
+		t.Fatalf("Paths failed: %v", err)
+	}
+	for node := 0; node < 3; node++ {
+		if !math.IsInf(costs[node], 1) {
+			t.Errorf("Expected node %d to be unreachable from node 3, got %f", node, costs[node])
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, _, err := g.Paths(ctx, 0, 0, Car.TravelTime); err == nil {
+		t.Error("Expected an error for a cancelled context")
+	}
+}
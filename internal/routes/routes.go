@@ -21,9 +21,34 @@ func SetupRoutes(app *fiber.App) {
 	// CSV routes
 	apiGroup.Get("/locations/csv", handlers.GetLocationsCsv)
 	apiGroup.Get("/locations/json", handlers.GetLocationsJson)
+	apiGroup.Post("/locations", handlers.PostLocation)
+	apiGroup.Put("/locations/:name", handlers.PutLocation)
+	apiGroup.Delete("/locations/:name", handlers.DeleteLocation)
 
 	// GeoJSON routes
 	apiGroup.Get("/geojson", handlers.GetAllGeoJson)
 	apiGroup.Get("/geojson/filter", handlers.GetFilteredGeoJson)
+	apiGroup.Get("/geojson/collection", handlers.GetGeoJsonCollection)
 	apiGroup.Get("/geojson/:name", handlers.GetGeoJsonByName)
+
+	// Coverage analysis routes
+	apiGroup.Get("/coverage", handlers.GetCoverage)
+	apiGroup.Get("/coverage/gaps", handlers.GetCoverageGaps)
+	apiGroup.Get("/coverage/population", handlers.GetCoveragePopulation)
+
+	// Point lookup routes
+	apiGroup.Get("/reach", handlers.GetReach)
+
+	// Routing routes
+	apiGroup.Post("/eta", handlers.PostETA)
+
+	// Background job routes
+	apiGroup.Post("/jobs/regenerate", handlers.PostRegenerateJob)
+	apiGroup.Get("/jobs/:id", handlers.GetJob)
+
+	// Event stream routes
+	apiGroup.Get("/events", handlers.GetEvents)
+
+	// Vector tile routes
+	apiGroup.Get("/tiles/:z/:x/:y.mvt", handlers.GetTile)
 }
\ No newline at end of file
@@ -0,0 +1,165 @@
+package routing
+
+import (
+	"container/list"
+	"context"
+	"math"
+	"sync"
+	"time"
+
+	"logreason/internal/geojson"
+)
+
+// Defaults of the route cache
+const (
+	// DefaultCacheSize Default number of origin and destination pairs kept in memory
+	DefaultCacheSize = 100000
+	// DefaultCacheTTL Default time a route is reused before it is requested again
+	DefaultCacheTTL = 24 * time.Hour
+)
+
+// Cache is a TravelTimeMatrix remembering the route of every origin and destination pair it
+// has computed, so that only the pairs it has not seen recently are asked of the underlying
+// matrix. Points are matched to about 10 cm.
+type Cache struct {
+	matrix TravelTimeMatrix
+	size   int
+	ttl    time.Duration
+	now    func() time.Time
+
+	mu     sync.Mutex
+	routes map[pairKey]*list.Element
+	order  *list.List
+}
+
+type pairKey struct {
+	mode     geojson.Mode
+	from, to [2]int64
+}
+
+type cacheEntry struct {
+	key     pairKey
+	route   Route
+	expires time.Time
+}
+
+// NewCache wraps a matrix with a cache of up to size pairs kept for ttl
+func NewCache(matrix TravelTimeMatrix, size int, ttl time.Duration) *Cache {
+	if size < 1 {
+		size = 1
+	}
+	return &Cache{
+		matrix: matrix,
+		size:   size,
+		ttl:    ttl,
+		now:    time.Now,
+		routes: make(map[pairKey]*list.Element),
+		order:  list.New(),
+	}
+}
+
+// Name returns the name of the underlying matrix
+func (c *Cache) Name() string {
+	return c.matrix.Name()
+}
+
+// Matrix returns the cached routes, requesting the missing pairs as one smaller matrix of
+// the sources and targets involved
+func (c *Cache) Matrix(ctx context.Context, sources, targets []Point, mode geojson.Mode) ([][]Route, error) {
+	routes := make([][]Route, len(sources))
+	var missingSources, missingTargets []int
+	targetMissing := make([]bool, len(targets))
+
+	c.mu.Lock()
+	now := c.now()
+	for s, source := range sources {
+		routes[s] = make([]Route, len(targets))
+		sourceMissing := false
+		for t, target := range targets {
+			route, ok := c.get(pairKey{mode: mode, from: pointKey(source), to: pointKey(target)}, now)
+			if !ok {
+				sourceMissing = true
+				targetMissing[t] = true
+				continue
+			}
+			routes[s][t] = route
+		}
+		if sourceMissing {
+			missingSources = append(missingSources, s)
+		}
+	}
+	c.mu.Unlock()
+
+	if len(missingSources) == 0 {
+		return routes, nil
+	}
+	for t, missing := range targetMissing {
+		if missing {
+			missingTargets = append(missingTargets, t)
+		}
+	}
+
+	subSources := make([]Point, len(missingSources))
+	for i, s := range missingSources {
+		subSources[i] = sources[s]
+	}
+	subTargets := make([]Point, len(missingTargets))
+	for i, t := range missingTargets {
+		subTargets[i] = targets[t]
+	}
+
+	computed, err := c.matrix.Matrix(ctx, subSources, subTargets, mode)
+	if err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	expires := c.now().Add(c.ttl)
+	for i, s := range missingSources {
+		for j, t := range missingTargets {
+			route := computed[i][j]
+			routes[s][t] = route
+			c.put(pairKey{mode: mode, from: pointKey(sources[s]), to: pointKey(targets[t])}, route, expires)
+		}
+	}
+	return routes, nil
+}
+
+// get returns a cached route that has not expired, marking it as recently used
+func (c *Cache) get(key pairKey, now time.Time) (Route, bool) {
+	element, ok := c.routes[key]
+	if !ok {
+		return Route{}, false
+	}
+	entry := element.Value.(*cacheEntry)
+	if now.After(entry.expires) {
+		c.order.Remove(element)
+		delete(c.routes, key)
+		return Route{}, false
+	}
+	c.order.MoveToFront(element)
+	return entry.route, true
+}
+
+// put stores a route, evicting the least recently used ones beyond the cache size
+func (c *Cache) put(key pairKey, route Route, expires time.Time) {
+	if element, ok := c.routes[key]; ok {
+		entry := element.Value.(*cacheEntry)
+		entry.route, entry.expires = route, expires
+		c.order.MoveToFront(element)
+		return
+	}
+
+	c.routes[key] = c.order.PushFront(&cacheEntry{key: key, route: route, expires: expires})
+	for c.order.Len() > c.size {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.routes, oldest.Value.(*cacheEntry).key)
+	}
+}
+
+// pointKey rounds a point to 1e-6 degrees
+func pointKey(p Point) [2]int64 {
+	return [2]int64{int64(math.Round(p.Latitude * 1e6)), int64(math.Round(p.Longitude * 1e6))}
+}
@@ -0,0 +1,166 @@
+package routing
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"time"
+
+	"logreason/internal/geojson"
+)
+
+// Defaults of the Geoapify route matrix
+const (
+	// DefaultGeoapifyMatrixURL Default endpoint of the Geoapify route matrix API
+	DefaultGeoapifyMatrixURL = "https://api.geoapify.com/v1/routematrix"
+	// DefaultGeoapifyMaxCells Default number of source and target pairs sent in one request
+	DefaultGeoapifyMaxCells = 1000
+	// DefaultGeoapifyTimeout Default timeout of a route matrix request
+	DefaultGeoapifyTimeout = 30 * time.Second
+)
+
+// GeoapifyMatrix computes routes with the Geoapify route matrix API. Large matrices are split
+// into requests of at most maxCells pairs.
+type GeoapifyMatrix struct {
+	apiKey   string
+	baseURL  string
+	client   *http.Client
+	maxCells int
+}
+
+// NewGeoapifyMatrix creates a Geoapify route matrix from an API key and endpoint
+func NewGeoapifyMatrix(apiKey, baseURL string) *GeoapifyMatrix {
+	return &GeoapifyMatrix{
+		apiKey:   apiKey,
+		baseURL:  baseURL,
+		client:   &http.Client{Timeout: DefaultGeoapifyTimeout},
+		maxCells: DefaultGeoapifyMaxCells,
+	}
+}
+
+// Name returns the matrix name
+func (m *GeoapifyMatrix) Name() string {
+	return geojson.ProviderGeoapify
+}
+
+type geoapifyWaypoint struct {
+	Location [2]float64 `json:"location"`
+}
+
+type geoapifyMatrixRequest struct {
+	Mode    string             `json:"mode"`
+	Sources []geoapifyWaypoint `json:"sources"`
+	Targets []geoapifyWaypoint `json:"targets"`
+}
+
+type geoapifyMatrixResponse struct {
+	SourcesToTargets [][]struct {
+		Distance    *float64 `json:"distance"`
+		Time        *float64 `json:"time"`
+		SourceIndex int      `json:"source_index"`
+		TargetIndex int      `json:"target_index"`
+	} `json:"sources_to_targets"`
+}
+
+// Matrix requests the routes, splitting the sources so that each request stays within the
+// API limit
+func (m *GeoapifyMatrix) Matrix(ctx context.Context, sources, targets []Point, mode geojson.Mode) ([][]Route, error) {
+	routes := make([][]Route, len(sources))
+	if len(targets) == 0 {
+		return routes, nil
+	}
+
+	batch := m.maxCells / len(targets)
+	if batch < 1 {
+		return nil, fmt.Errorf("too many targets: %d exceeds the limit of %d", len(targets), m.maxCells)
+	}
+
+	for start := 0; start < len(sources); start += batch {
+		end := start + batch
+		if end > len(sources) {
+			end = len(sources)
+		}
+		if err := m.request(ctx, sources[start:end], targets, mode, routes[start:end]); err != nil {
+			return nil, err
+		}
+	}
+	return routes, nil
+}
+
+// request fills routes with the answer for a batch of sources
+func (m *GeoapifyMatrix) request(ctx context.Context, sources, targets []Point, mode geojson.Mode, routes [][]Route) error {
+	body := geoapifyMatrixRequest{Mode: string(mode)}
+	for _, p := range sources {
+		body.Sources = append(body.Sources, geoapifyWaypoint{Location: [2]float64{p.Longitude, p.Latitude}})
+	}
+	for _, p := range targets {
+		body.Targets = append(body.Targets, geoapifyWaypoint{Location: [2]float64{p.Longitude, p.Latitude}})
+	}
+	payload, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+
+	endpoint, err := url.Parse(m.baseURL)
+	if err != nil {
+		return fmt.Errorf("invalid route matrix URL: %w", err)
+	}
+	query := endpoint.Query()
+	query.Set("apiKey", m.apiKey)
+	endpoint.RawQuery = query.Encode()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint.String(), bytes.NewReader(payload))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := m.client.Do(req)
+	if err != nil {
+		// The URL holds the API key, so only the underlying error is reported
+		if urlErr, ok := err.(*url.Error); ok {
+			err = urlErr.Err
+		}
+		return fmt.Errorf("route matrix request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("failed to read route matrix response: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("route matrix API returned status %d: %s", resp.StatusCode, truncate(string(data), 200))
+	}
+
+	var result geoapifyMatrixResponse
+	if err := json.Unmarshal(data, &result); err != nil {
+		return fmt.Errorf("invalid route matrix response: %w", err)
+	}
+	if len(result.SourcesToTargets) != len(sources) {
+		return fmt.Errorf("route matrix response has %d rows, expected %d", len(result.SourcesToTargets), len(sources))
+	}
+
+	for s, row := range result.SourcesToTargets {
+		routes[s] = make([]Route, len(targets))
+		for _, cell := range row {
+			if cell.TargetIndex < 0 || cell.TargetIndex >= len(targets) || cell.Time == nil || cell.Distance == nil {
+				continue
+			}
+			routes[s][cell.TargetIndex] = Route{Time: *cell.Time, Distance: *cell.Distance, Reachable: true}
+		}
+	}
+	return nil
+}
+
+// truncate shortens error bodies quoted in messages
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	return s[:n] + "..."
+}
@@ -0,0 +1,118 @@
+package routing
+
+import (
+	"context"
+	"fmt"
+	"math"
+
+	"logreason/internal/geojson"
+	"logreason/internal/roadgraph"
+)
+
+// DefaultMaxSnap Default maximum distance in meters between a point and the nearest road
+const DefaultMaxSnap = 1000.0
+
+// GraphMatrix computes routes on a local road graph without any network access, running a
+// Dijkstra search from every source. Points are joined to the nearest road at the access
+// speed of the profile; points farther than maxSnap from a road are unreachable.
+type GraphMatrix struct {
+	graph   *roadgraph.Graph
+	maxSnap float64
+}
+
+// NewGraphMatrix loads the road graph at path, a GeoJSON road network as described by
+// roadgraph.Load
+func NewGraphMatrix(path string) (*GraphMatrix, error) {
+	graph, err := roadgraph.Load(path)
+	if err != nil {
+		return nil, err
+	}
+	return NewGraphMatrixFromGraph(graph), nil
+}
+
+// NewGraphMatrixFromGraph creates a matrix over an already loaded road graph
+func NewGraphMatrixFromGraph(graph *roadgraph.Graph) *GraphMatrix {
+	return &GraphMatrix{graph: graph, maxSnap: DefaultMaxSnap}
+}
+
+// Name returns the matrix name
+func (m *GraphMatrix) Name() string {
+	return geojson.ProviderOffline
+}
+
+// profile maps a travel mode to a road graph profile
+func profile(mode geojson.Mode) (roadgraph.Profile, error) {
+	switch mode {
+	case geojson.ModeDrive:
+		return roadgraph.Car, nil
+	case geojson.ModeTruck:
+		return roadgraph.Truck, nil
+	case geojson.ModeWalk:
+		return roadgraph.Foot, nil
+	case geojson.ModeBicycle:
+		return roadgraph.Bicycle, nil
+	}
+	return roadgraph.Profile{}, fmt.Errorf("travel mode %s is not supported by the road graph", mode)
+}
+
+// snapPoint is a point joined to the road graph
+type snapPoint struct {
+	node     int
+	distance float64
+}
+
+// Matrix returns the fastest routes and their length along the road graph, including the
+// access to the nearest road at both ends
+func (m *GraphMatrix) Matrix(ctx context.Context, sources, targets []Point, mode geojson.Mode) ([][]Route, error) {
+	p, err := profile(mode)
+	if err != nil {
+		return nil, err
+	}
+	cost := roadgraph.CostFunc(p.TravelTime)
+	accessSpeed := p.AccessSpeed / 3.6
+
+	// Targets are joined to roads that can be driven into, which include the end of oneway roads
+	arrival := func(e roadgraph.Edge) float64 {
+		e.Reverse = false
+		return cost(e)
+	}
+	targetSnaps := make([]snapPoint, len(targets))
+	for i, target := range targets {
+		targetSnaps[i] = m.snap(target, arrival)
+	}
+
+	routes := make([][]Route, len(sources))
+	for s, source := range sources {
+		routes[s] = make([]Route, len(targets))
+		from := m.snap(source, cost)
+		if from.node < 0 {
+			continue
+		}
+
+		costs, lengths, err := m.graph.Paths(ctx, from.node, from.distance/accessSpeed, cost)
+		if err != nil {
+			return nil, err
+		}
+
+		for t, to := range targetSnaps {
+			if to.node < 0 || math.IsInf(costs[to.node], 1) {
+				continue
+			}
+			routes[s][t] = Route{
+				Time:      costs[to.node] + to.distance/accessSpeed,
+				Distance:  from.distance + lengths[to.node] + to.distance,
+				Reachable: true,
+			}
+		}
+	}
+	return routes, nil
+}
+
+// snap returns the nearest usable node of a point, with node -1 when no road is close enough
+func (m *GraphMatrix) snap(p Point, cost roadgraph.CostFunc) snapPoint {
+	node, distance := m.graph.Nearest(p.Latitude, p.Longitude, cost)
+	if node < 0 || distance > m.maxSnap {
+		return snapPoint{node: -1}
+	}
+	return snapPoint{node: node, distance: distance}
+}
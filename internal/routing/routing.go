@@ -0,0 +1,154 @@
+// Package routing computes travel times and distances between stations and arbitrary points,
+// so that stations can be ranked by how fast they reach an incident rather than by whether
+// an isochrone of a fixed range contains it.
+package routing
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+
+	"logreason/internal/csvparser"
+	"logreason/internal/geojson"
+	"logreason/internal/secrets"
+)
+
+// Point is a position in WGS 84 degrees
+type Point struct {
+	Latitude  float64 `json:"latitude"`
+	Longitude float64 `json:"longitude"`
+}
+
+// Valid reports whether the point lies within the latitude and longitude ranges
+func (p Point) Valid() bool {
+	return p.Latitude >= -90 && p.Latitude <= 90 && p.Longitude >= -180 && p.Longitude <= 180
+}
+
+// Route is the travel time and distance of the fastest route between two points
+type Route struct {
+	// Time is the travel time in seconds
+	Time float64 `json:"time"`
+	// Distance is the length of the route in meters
+	Distance float64 `json:"distance"`
+	// Reachable is false when no route connects the points; Time and Distance are then 0
+	Reachable bool `json:"reachable"`
+}
+
+// TravelTimeMatrix computes the routes from every source to every target
+type TravelTimeMatrix interface {
+	// Name identifies the implementation in logs and responses
+	Name() string
+	// Matrix returns the routes indexed by source then target
+	Matrix(ctx context.Context, sources, targets []Point, mode geojson.Mode) ([][]Route, error)
+}
+
+// fallbackMatrix tries its matrices in order until one succeeds
+type fallbackMatrix struct {
+	matrices []TravelTimeMatrix
+}
+
+// Fallback returns a matrix asking each of the matrices in turn, moving on to the next one
+// when a matrix fails, e.g. because the routing API is unreachable or does not support the mode
+func Fallback(matrices ...TravelTimeMatrix) TravelTimeMatrix {
+	if len(matrices) == 1 {
+		return matrices[0]
+	}
+	return &fallbackMatrix{matrices: matrices}
+}
+
+// Name returns the name of the first matrix
+func (f *fallbackMatrix) Name() string {
+	return f.matrices[0].Name()
+}
+
+// Matrix returns the routes of the first matrix that succeeds
+func (f *fallbackMatrix) Matrix(ctx context.Context, sources, targets []Point, mode geojson.Mode) ([][]Route, error) {
+	var lastErr error
+	for i, matrix := range f.matrices {
+		routes, err := matrix.Matrix(ctx, sources, targets, mode)
+		if err == nil {
+			return routes, nil
+		}
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		lastErr = fmt.Errorf("%s: %w", matrix.Name(), err)
+		if i < len(f.matrices)-1 {
+			log.Printf("Warning: %s travel time matrix failed, falling back to %s: %v", matrix.Name(), f.matrices[i+1].Name(), err)
+		}
+	}
+	return nil, lastErr
+}
+
+// NewMatrix creates the travel time matrix configured in the secrets manager: the Geoapify
+// route matrix API when GEOAPIFY_API_KEY is set (GEOAPIFY_MATRIX_URL overrides its endpoint)
+// and the local road graph at OFFLINE_ROAD_GRAPH, used as a fallback when both are set
+func NewMatrix(secretsManager *secrets.Manager) (TravelTimeMatrix, error) {
+	var matrices []TravelTimeMatrix
+	if apiKey, exists := secretsManager.Get("GEOAPIFY_API_KEY"); exists {
+		matrices = append(matrices, NewGeoapifyMatrix(apiKey, secretsManager.GetOrDefault("GEOAPIFY_MATRIX_URL", DefaultGeoapifyMatrixURL)))
+	}
+	if path, exists := secretsManager.Get("OFFLINE_ROAD_GRAPH"); exists {
+		graph, err := NewGraphMatrix(path)
+		if err != nil {
+			return nil, err
+		}
+		matrices = append(matrices, graph)
+	}
+
+	if len(matrices) == 0 {
+		return nil, fmt.Errorf("no routing configured: set GEOAPIFY_API_KEY or OFFLINE_ROAD_GRAPH in the secrets")
+	}
+	return Fallback(matrices...), nil
+}
+
+// ETA is the route from a station to an incident
+type ETA struct {
+	csvparser.Location
+	Route
+}
+
+// IncidentETAs lists the stations by increasing travel time to an incident
+type IncidentETAs struct {
+	Point
+	Stations []ETA `json:"stations"`
+}
+
+// Rank computes the routes from every location to every incident and sorts the stations of
+// each incident by travel time, unreachable stations last. A positive limit keeps only the
+// fastest stations.
+func Rank(ctx context.Context, matrix TravelTimeMatrix, locations []csvparser.Location, incidents []Point, mode geojson.Mode, limit int) ([]IncidentETAs, error) {
+	sources := make([]Point, len(locations))
+	for i, location := range locations {
+		sources[i] = Point{Latitude: location.Latitude, Longitude: location.Longitude}
+	}
+
+	routes, err := matrix.Matrix(ctx, sources, incidents, mode)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]IncidentETAs, len(incidents))
+	for t, incident := range incidents {
+		stations := make([]ETA, len(locations))
+		for s, location := range locations {
+			stations[s] = ETA{Location: location, Route: routes[s][t]}
+		}
+		sort.SliceStable(stations, func(i, j int) bool {
+			a, b := stations[i], stations[j]
+			if a.Reachable != b.Reachable {
+				return a.Reachable
+			}
+			if a.Time != b.Time {
+				return a.Time < b.Time
+			}
+			return a.Distance < b.Distance
+		})
+		if limit > 0 && len(stations) > limit {
+			stations = stations[:limit]
+		}
+		result[t] = IncidentETAs{Point: incident, Stations: stations}
+	}
+	return result, nil
+}
@@ -0,0 +1,234 @@
+package routing
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"logreason/internal/csvparser"
+	"logreason/internal/geojson"
+	"logreason/internal/roadgraph"
+)
+
+// stubMatrix returns the distance between the points as both time and distance, and
+// records the size of every matrix it is asked for
+type stubMatrix struct {
+	name  string
+	err   error
+	calls [][2]int
+}
+
+func (m *stubMatrix) Name() string { return m.name }
+
+func (m *stubMatrix) Matrix(_ context.Context, sources, targets []Point, _ geojson.Mode) ([][]Route, error) {
+	m.calls = append(m.calls, [2]int{len(sources), len(targets)})
+	if m.err != nil {
+		return nil, m.err
+	}
+	routes := make([][]Route, len(sources))
+	for s, source := range sources {
+		routes[s] = make([]Route, len(targets))
+		for t, target := range targets {
+			// Stations west of 0 cannot reach anything
+			if source.Longitude < 0 {
+				continue
+			}
+			d := roadgraph.Distance(source.Latitude, source.Longitude, target.Latitude, target.Longitude)
+			routes[s][t] = Route{Time: d, Distance: d, Reachable: true}
+		}
+	}
+	return routes, nil
+}
+
+func TestRank(t *testing.T) {
+	locations := []csvparser.Location{
+		{Name: "FAR", Latitude: 45.5, Longitude: 9.5},
+		{Name: "NONE", Latitude: 45.1, Longitude: -1},
+		{Name: "NEAR", Latitude: 45.1, Longitude: 9.1},
+	}
+	incidents := []Point{{Latitude: 45.1, Longitude: 9.11}}
+
+	ranked, err := Rank(context.Background(), &stubMatrix{}, locations, incidents, geojson.ModeDrive, 0)
+	if err != nil {
+		t.Fatalf("Rank failed: %v", err)
+	}
+	var names []string
+	for _, eta := range ranked[0].Stations {
+		names = append(names, eta.Name)
+	}
+	if got := strings.Join(names, ","); got != "NEAR,FAR,NONE" {
+		t.Errorf("Stations ranked %s, want NEAR,FAR,NONE", got)
+	}
+
+	limited, err := Rank(context.Background(), &stubMatrix{}, locations, incidents, geojson.ModeDrive, 1)
+	if err != nil {
+		t.Fatalf("Rank failed: %v", err)
+	}
+	if len(limited[0].Stations) != 1 || limited[0].Stations[0].Name != "NEAR" {
+		t.Errorf("Expected only the nearest station with a limit, got %+v", limited[0].Stations)
+	}
+
+	// The location and route fields are flattened in the JSON output
+	data, err := json.Marshal(limited[0])
+	if err != nil {
+		t.Fatalf("Marshal failed: %v", err)
+	}
+	for _, field := range []string{`"latitude":45.1`, `"name":"NEAR"`, `"time":`, `"reachable":true`} {
+		if !strings.Contains(string(data), field) {
+			t.Errorf("Expected %s in %s", field, data)
+		}
+	}
+}
+
+func TestFallback(t *testing.T) {
+	failing := &stubMatrix{name: "failing", err: errors.New("unavailable")}
+	working := &stubMatrix{name: "working"}
+
+	routes, err := Fallback(failing, working).Matrix(context.Background(), []Point{{45, 9}}, []Point{{45, 9.01}}, geojson.ModeDrive)
+	if err != nil {
+		t.Fatalf("Expected the second matrix to answer, got %v", err)
+	}
+	if !routes[0][0].Reachable || len(failing.calls) != 1 || len(working.calls) != 1 {
+		t.Errorf("Unexpected fallback behaviour: routes %v, calls %v %v", routes, failing.calls, working.calls)
+	}
+
+	if _, err := Fallback(failing, failing).Matrix(context.Background(), []Point{{45, 9}}, []Point{{45, 9.01}}, geojson.ModeDrive); err == nil {
+		t.Error("Expected an error when every matrix fails")
+	}
+}
+
+func TestCache(t *testing.T) {
+	stub := &stubMatrix{name: "stub"}
+	cache := NewCache(stub, 10, time.Hour)
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	cache.now = func() time.Time { return now }
+
+	sources := []Point{{45, 9}, {45.1, 9.1}}
+	first, err := cache.Matrix(context.Background(), sources, []Point{{45.2, 9.2}}, geojson.ModeDrive)
+	if err != nil {
+		t.Fatalf("Matrix failed: %v", err)
+	}
+
+	// A second incident only asks for the new pairs
+	second, err := cache.Matrix(context.Background(), sources, []Point{{45.2, 9.2}, {45.3, 9.3}}, geojson.ModeDrive)
+	if err != nil {
+		t.Fatalf("Matrix failed: %v", err)
+	}
+	if len(stub.calls) != 2 || stub.calls[1] != [2]int{2, 1} {
+		t.Errorf("Expected a 2x1 request for the new incident, got %v", stub.calls)
+	}
+	if second[1][0] != first[1][0] || !second[1][1].Reachable {
+		t.Errorf("Unexpected cached routes %v", second)
+	}
+
+	// Other modes are cached separately
+	if _, err := cache.Matrix(context.Background(), sources[:1], []Point{{45.2, 9.2}}, geojson.ModeWalk); err != nil {
+		t.Fatalf("Matrix failed: %v", err)
+	}
+	if len(stub.calls) != 3 {
+		t.Errorf("Expected the walk mode to be requested, got %v", stub.calls)
+	}
+
+	// Everything cached is reused until it expires
+	if _, err := cache.Matrix(context.Background(), sources, []Point{{45.3, 9.3}}, geojson.ModeDrive); err != nil || len(stub.calls) != 3 {
+		t.Errorf("Expected cached routes, got calls %v and error %v", stub.calls, err)
+	}
+	now = now.Add(2 * time.Hour)
+	if _, err := cache.Matrix(context.Background(), sources, []Point{{45.3, 9.3}}, geojson.ModeDrive); err != nil || len(stub.calls) != 4 {
+		t.Errorf("Expected expired routes to be requested again, got calls %v and error %v", stub.calls, err)
+	}
+}
+
+func TestGeoapifyMatrix(t *testing.T) {
+	var requests []geoapifyMatrixRequest
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.URL.Query().Get("apiKey") != "key" {
+			http.Error(w, "bad request", http.StatusBadRequest)
+			return
+		}
+		var req geoapifyMatrixRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		requests = append(requests, req)
+
+		// The first target is reachable in 60 s per source index, the second one never
+		rows := make([][]map[string]interface{}, len(req.Sources))
+		for s := range req.Sources {
+			rows[s] = []map[string]interface{}{
+				{"distance": 1000.0, "time": 60.0 * float64(s+1), "source_index": s, "target_index": 0},
+				{"distance": nil, "time": nil, "source_index": s, "target_index": 1},
+			}
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"sources_to_targets": rows})
+	}))
+	defer server.Close()
+
+	matrix := NewGeoapifyMatrix("key", server.URL)
+	matrix.maxCells = 4
+
+	sources := []Point{{45, 9}, {45.1, 9.1}, {45.2, 9.2}}
+	routes, err := matrix.Matrix(context.Background(), sources, []Point{{45.5, 9.5}, {46, 10}}, geojson.ModeTruck)
+	if err != nil {
+		t.Fatalf("Matrix failed: %v", err)
+	}
+
+	if len(requests) != 2 || len(requests[0].Sources) != 2 || len(requests[1].Sources) != 1 {
+		t.Fatalf("Expected the sources to be split in batches of 2, got %d requests", len(requests))
+	}
+	if requests[0].Mode != "truck" || requests[0].Sources[1].Location != [2]float64{9.1, 45.1} {
+		t.Errorf("Unexpected request %+v", requests[0])
+	}
+	if want := (Route{Time: 60, Distance: 1000, Reachable: true}); routes[2][0] != want {
+		t.Errorf("Route of the last source = %+v, want %+v", routes[2][0], want)
+	}
+	if routes[0][1].Reachable {
+		t.Error("Expected a route without time to be unreachable")
+	}
+
+	failing := NewGeoapifyMatrix("wrong", server.URL)
+	if _, err := failing.Matrix(context.Background(), sources, []Point{{45.5, 9.5}}, geojson.ModeDrive); err == nil || strings.Contains(err.Error(), "wrong") {
+		t.Errorf("Expected an error without the API key, got %v", err)
+	}
+}
+
+func TestGraphMatrix(t *testing.T) {
+	// A oneway residential street 0.01 degrees long, driven at 36 km/h
+	graph, err := roadgraph.Read(strings.NewReader(`{"type": "FeatureCollection", "features": [
+		{"type": "Feature", "properties": {"highway": "residential", "maxspeed": "36", "oneway": "yes"},
+		 "geometry": {"type": "LineString", "coordinates": [[9.0, 45.0], [9.005, 45.0], [9.01, 45.0]]}}
+	]}`))
+	if err != nil {
+		t.Fatalf("Read failed: %v", err)
+	}
+	matrix := NewGraphMatrixFromGraph(graph)
+
+	start, end, far := Point{45, 9}, Point{45, 9.01}, Point{46, 10}
+	routes, err := matrix.Matrix(context.Background(), []Point{start, end}, []Point{end, far, start}, geojson.ModeDrive)
+	if err != nil {
+		t.Fatalf("Matrix failed: %v", err)
+	}
+
+	length := roadgraph.Distance(45, 9, 45, 9.01)
+	route := routes[0][0]
+	if !route.Reachable || math.Abs(route.Distance-length) > 1 || math.Abs(route.Time-length/10) > 0.5 {
+		t.Errorf("Route along the street = %+v, want %.0f m in %.0f s", route, length, length/10)
+	}
+	if routes[0][1].Reachable {
+		t.Error("Expected a point far from the roads to be unreachable")
+	}
+	if routes[1][2].Reachable {
+		t.Errorf("Expected the oneway street not to be driven backwards, got %+v", routes[1][2])
+	}
+
+	if _, err := matrix.Matrix(context.Background(), []Point{start}, []Point{end}, geojson.ModeApproximatedTransit); err == nil {
+		t.Error("Expected transit to be rejected by the road graph")
+	}
+}
@@ -0,0 +1,130 @@
+// Package rtree provides a static R-tree over rectangles, bulk loaded with the
+// Sort-Tile-Recursive algorithm, for finding the rectangles containing a point.
+package rtree
+
+import (
+	"math"
+	"sort"
+)
+
+// DefaultNodeCapacity is the number of children of every node
+const DefaultNodeCapacity = 16
+
+// Rect is an axis aligned rectangle; X is the longitude and Y the latitude for geographic data
+type Rect struct {
+	MinX, MinY, MaxX, MaxY float64
+}
+
+// ContainsPoint reports whether the point lies inside the rectangle or on its border
+func (r Rect) ContainsPoint(x, y float64) bool {
+	return x >= r.MinX && x <= r.MaxX && y >= r.MinY && y <= r.MaxY
+}
+
+// Intersects reports whether two rectangles share at least one point
+func (r Rect) Intersects(o Rect) bool {
+	return r.MinX <= o.MaxX && o.MinX <= r.MaxX && r.MinY <= o.MaxY && o.MinY <= r.MaxY
+}
+
+// extend grows the rectangle to include another one
+func (r Rect) extend(o Rect) Rect {
+	return Rect{math.Min(r.MinX, o.MinX), math.Min(r.MinY, o.MinY), math.Max(r.MaxX, o.MaxX), math.Max(r.MaxY, o.MaxY)}
+}
+
+// Item is a rectangle indexed in the tree with a caller defined value, typically an index
+// into a slice holding the indexed objects
+type Item struct {
+	Rect  Rect
+	Value int
+}
+
+type node struct {
+	rect     Rect
+	children []*node
+	// item is set on leaf entries
+	item *Item
+}
+
+// Tree is an immutable R-tree
+type Tree struct {
+	root *node
+	size int
+}
+
+// New bulk loads a tree from the items
+func New(items []Item) *Tree {
+	if len(items) == 0 {
+		return &Tree{}
+	}
+
+	level := make([]*node, len(items))
+	for i := range items {
+		level[i] = &node{rect: items[i].Rect, item: &items[i]}
+	}
+	for len(level) > 1 {
+		level = pack(level, DefaultNodeCapacity)
+	}
+	return &Tree{root: level[0], size: len(items)}
+}
+
+// Len returns the number of items in the tree
+func (t *Tree) Len() int {
+	return t.size
+}
+
+// pack groups the nodes of a level into parents of at most capacity children, sorting
+// them into vertical slices by x and then into runs by y within every slice
+func pack(nodes []*node, capacity int) []*node {
+	parents := int(math.Ceil(float64(len(nodes)) / float64(capacity)))
+	slices := int(math.Ceil(math.Sqrt(float64(parents))))
+	sliceSize := slices * capacity
+
+	sort.Slice(nodes, func(i, j int) bool { return centerX(nodes[i].rect) < centerX(nodes[j].rect) })
+
+	var result []*node
+	for start := 0; start < len(nodes); start += sliceSize {
+		slice := nodes[start:min(start+sliceSize, len(nodes))]
+		sort.Slice(slice, func(i, j int) bool { return centerY(slice[i].rect) < centerY(slice[j].rect) })
+
+		for first := 0; first < len(slice); first += capacity {
+			children := append([]*node(nil), slice[first:min(first+capacity, len(slice))]...)
+			parent := &node{rect: children[0].rect, children: children}
+			for _, child := range children[1:] {
+				parent.rect = parent.rect.extend(child.rect)
+			}
+			result = append(result, parent)
+		}
+	}
+	return result
+}
+
+// SearchPoint calls fn with every item whose rectangle contains the point, stopping early
+// when fn returns false
+func (t *Tree) SearchPoint(x, y float64, fn func(item Item) bool) {
+	t.Search(Rect{x, y, x, y}, fn)
+}
+
+// Search calls fn with every item whose rectangle intersects r, stopping early when fn
+// returns false
+func (t *Tree) Search(r Rect, fn func(item Item) bool) {
+	if t.root != nil {
+		search(t.root, r, fn)
+	}
+}
+
+func search(n *node, r Rect, fn func(item Item) bool) bool {
+	if !n.rect.Intersects(r) {
+		return true
+	}
+	if n.item != nil {
+		return fn(*n.item)
+	}
+	for _, child := range n.children {
+		if !search(child, r, fn) {
+			return false
+		}
+	}
+	return true
+}
+
+func centerX(r Rect) float64 { return (r.MinX + r.MaxX) / 2 }
+func centerY(r Rect) float64 { return (r.MinY + r.MaxY) / 2 }
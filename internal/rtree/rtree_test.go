@@ -0,0 +1,66 @@
+package rtree
+
+import (
+	"math/rand"
+	"sort"
+	"testing"
+)
+
+func TestSearchMatchesLinearScan(t *testing.T) {
+	random := rand.New(rand.NewSource(1))
+
+	items := make([]Item, 1000)
+	for i := range items {
+		x, y := random.Float64()*10, random.Float64()*10
+		items[i] = Item{Rect: Rect{x, y, x + random.Float64(), y + random.Float64()}, Value: i}
+	}
+	tree := New(append([]Item(nil), items...))
+
+	if tree.Len() != len(items) {
+		t.Fatalf("Len() = %d, want %d", tree.Len(), len(items))
+	}
+
+	for q := 0; q < 200; q++ {
+		x, y := random.Float64()*11, random.Float64()*11
+
+		var want, got []int
+		for _, item := range items {
+			if item.Rect.ContainsPoint(x, y) {
+				want = append(want, item.Value)
+			}
+		}
+		tree.SearchPoint(x, y, func(item Item) bool {
+			got = append(got, item.Value)
+			return true
+		})
+
+		sort.Ints(got)
+		if len(got) != len(want) {
+			t.Fatalf("SearchPoint(%f, %f) found %d items, want %d", x, y, len(got), len(want))
+		}
+		for i := range want {
+			if got[i] != want[i] {
+				t.Fatalf("SearchPoint(%f, %f) = %v, want %v", x, y, got, want)
+			}
+		}
+	}
+}
+
+func TestSearchStopsEarly(t *testing.T) {
+	items := []Item{{Rect{0, 0, 1, 1}, 0}, {Rect{0, 0, 2, 2}, 1}, {Rect{0, 0, 3, 3}, 2}}
+	tree := New(items)
+
+	calls := 0
+	tree.SearchPoint(0.5, 0.5, func(item Item) bool {
+		calls++
+		return false
+	})
+	if calls != 1 {
+		t.Errorf("fn called %d times, want 1", calls)
+	}
+
+	New(nil).SearchPoint(0, 0, func(item Item) bool {
+		t.Error("fn called on an empty tree")
+		return true
+	})
+}
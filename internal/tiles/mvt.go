@@ -0,0 +1,230 @@
+package tiles
+
+import (
+	"math"
+	"sort"
+)
+
+// Geometry types of the Mapbox Vector Tile specification
+const (
+	geomPoint      = 1
+	geomLineString = 2
+	geomPolygon    = 3
+)
+
+// Drawing commands of the Mapbox Vector Tile specification
+const (
+	cmdMoveTo    = 1
+	cmdLineTo    = 2
+	cmdClosePath = 7
+)
+
+// layer is a tile layer ready to be encoded
+type layer struct {
+	name     string
+	features []feature
+}
+
+// feature is a tile feature with its geometry already encoded as drawing commands
+type feature struct {
+	id         uint64
+	geomType   int
+	geometry   []uint32
+	properties map[string]interface{}
+}
+
+// encodeTile encodes the layers as a Mapbox Vector Tile (version 2) protobuf message,
+// skipping layers without features
+func encodeTile(layers []layer) []byte {
+	var tile protoBuffer
+	for _, l := range layers {
+		if len(l.features) > 0 {
+			tile.bytes(3, encodeLayer(l))
+		}
+	}
+	return tile
+}
+
+func encodeLayer(l layer) []byte {
+	var keys []string
+	keyIndex := make(map[string]uint32)
+	var values []interface{}
+	valueIndex := make(map[interface{}]uint32)
+
+	var buf protoBuffer
+	buf.varint(15, 2)
+	buf.bytes(1, []byte(l.name))
+
+	for _, f := range l.features {
+		// Encode properties in a stable order so that identical tiles are byte for byte equal
+		names := make([]string, 0, len(f.properties))
+		for name := range f.properties {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		var tags []uint32
+		for _, name := range names {
+			value, ok := tileValue(f.properties[name])
+			if !ok {
+				continue
+			}
+			k, exists := keyIndex[name]
+			if !exists {
+				k = uint32(len(keys))
+				keyIndex[name] = k
+				keys = append(keys, name)
+			}
+			v, exists := valueIndex[value]
+			if !exists {
+				v = uint32(len(values))
+				valueIndex[value] = v
+				values = append(values, value)
+			}
+			tags = append(tags, k, v)
+		}
+
+		var fb protoBuffer
+		if f.id != 0 {
+			fb.varint(1, f.id)
+		}
+		fb.packed(2, tags)
+		fb.varint(3, uint64(f.geomType))
+		fb.packed(4, f.geometry)
+		buf.bytes(2, fb)
+	}
+
+	for _, key := range keys {
+		buf.bytes(3, []byte(key))
+	}
+	for _, value := range values {
+		buf.bytes(4, encodeValue(value))
+	}
+	buf.varint(5, Extent)
+
+	return buf
+}
+
+// tileValue converts a GeoJSON property into a value the tile can hold. Integral numbers
+// are stored as integers; objects and arrays are dropped.
+func tileValue(value interface{}) (interface{}, bool) {
+	switch v := value.(type) {
+	case string, bool, int64:
+		return v, true
+	case int:
+		return int64(v), true
+	case float64:
+		if v == math.Trunc(v) && math.Abs(v) < 1<<53 {
+			return int64(v), true
+		}
+		return v, true
+	}
+	return nil, false
+}
+
+func encodeValue(value interface{}) []byte {
+	var buf protoBuffer
+	switch v := value.(type) {
+	case string:
+		buf.bytes(1, []byte(v))
+	case float64:
+		buf.fixed64(3, math.Float64bits(v))
+	case int64:
+		buf.varint(6, zigzag(v))
+	case bool:
+		b := uint64(0)
+		if v {
+			b = 1
+		}
+		buf.varint(7, b)
+	}
+	return buf
+}
+
+// geometryEncoder builds the drawing commands of a feature, tracking the cursor position
+type geometryEncoder struct {
+	commands []uint32
+	x, y     int64
+}
+
+func command(id, count int) uint32 {
+	return uint32(id&0x7) | uint32(count)<<3
+}
+
+// moveTo appends a MoveTo command for one position
+func (e *geometryEncoder) moveTo(p tilePoint) {
+	e.commands = append(e.commands, command(cmdMoveTo, 1))
+	e.delta(p)
+}
+
+// lineTo appends a LineTo command for the positions
+func (e *geometryEncoder) lineTo(points []tilePoint) {
+	e.commands = append(e.commands, command(cmdLineTo, len(points)))
+	for _, p := range points {
+		e.delta(p)
+	}
+}
+
+func (e *geometryEncoder) closePath() {
+	e.commands = append(e.commands, command(cmdClosePath, 1))
+}
+
+func (e *geometryEncoder) delta(p tilePoint) {
+	e.commands = append(e.commands, uint32(zigzag(p.x-e.x)), uint32(zigzag(p.y-e.y)))
+	e.x, e.y = p.x, p.y
+}
+
+// ring appends a closed ring given without its closing position
+func (e *geometryEncoder) ring(points []tilePoint) {
+	e.moveTo(points[0])
+	e.lineTo(points[1:])
+	e.closePath()
+}
+
+func zigzag(n int64) uint64 {
+	return uint64((n << 1) ^ (n >> 63))
+}
+
+// protoBuffer appends protobuf fields to a byte slice
+type protoBuffer []byte
+
+func (b *protoBuffer) key(field, wireType int) {
+	b.rawVarint(uint64(field<<3 | wireType))
+}
+
+func (b *protoBuffer) rawVarint(v uint64) {
+	for v >= 0x80 {
+		*b = append(*b, byte(v)|0x80)
+		v >>= 7
+	}
+	*b = append(*b, byte(v))
+}
+
+func (b *protoBuffer) varint(field int, v uint64) {
+	b.key(field, 0)
+	b.rawVarint(v)
+}
+
+func (b *protoBuffer) fixed64(field int, v uint64) {
+	b.key(field, 1)
+	for i := 0; i < 8; i++ {
+		*b = append(*b, byte(v>>(8*i)))
+	}
+}
+
+func (b *protoBuffer) bytes(field int, data []byte) {
+	b.key(field, 2)
+	b.rawVarint(uint64(len(data)))
+	*b = append(*b, data...)
+}
+
+func (b *protoBuffer) packed(field int, values []uint32) {
+	if len(values) == 0 {
+		return
+	}
+	var packed protoBuffer
+	for _, v := range values {
+		packed.rawVarint(uint64(v))
+	}
+	b.bytes(field, packed)
+}
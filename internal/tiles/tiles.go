@@ -0,0 +1,433 @@
+// Package tiles renders the saved isochrones and station points as Mapbox Vector Tiles,
+// clipping and encoding them on demand so that map clients only download what they show.
+package tiles
+
+import (
+	"container/list"
+	"fmt"
+	"log"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+
+	"logreason/internal/geojson"
+	"logreason/internal/rtree"
+)
+
+// Tile parameters
+const (
+	// Extent is the size of a tile in tile coordinates
+	Extent = 4096
+	// Buffer is the margin, in tile coordinates, polygons extend beyond the tile edges so that
+	// outlines do not show seams between tiles
+	Buffer = 64
+	// MaxZoom is the deepest zoom level served
+	MaxZoom = 22
+	// ContentType is the media type of an encoded tile
+	ContentType = "application/vnd.mapbox-vector-tile"
+	// DefaultCacheSize Default number of encoded tiles kept in memory
+	DefaultCacheSize = 1024
+)
+
+// Names of the tile layers
+const (
+	LayerIsochrones = "isochrones"
+	LayerStations   = "stations"
+)
+
+// maxLatitude is the latitude at which the Web Mercator projection is cut off
+const maxLatitude = 85.0511287798
+
+// TileID identifies a tile in the XYZ scheme, with y growing southwards
+type TileID struct {
+	Z, X, Y int
+}
+
+// Valid reports whether the tile exists at its zoom level
+func (t TileID) Valid() bool {
+	if t.Z < 0 || t.Z > MaxZoom {
+		return false
+	}
+	n := 1 << uint(t.Z)
+	return t.X >= 0 && t.X < n && t.Y >= 0 && t.Y < n
+}
+
+func (t TileID) String() string {
+	return fmt.Sprintf("%d/%d/%d", t.Z, t.X, t.Y)
+}
+
+// worldPoint is a position projected with Web Mercator on the unit square, y growing southwards
+type worldPoint struct{ x, y float64 }
+
+func mercator(position geojson.Position) worldPoint {
+	lat := math.Max(-maxLatitude, math.Min(maxLatitude, position.Lat()))
+	sin := math.Sin(lat * math.Pi / 180)
+	return worldPoint{
+		x: (position.Lon() + 180) / 360,
+		y: 0.5 - math.Log((1+sin)/(1-sin))/(4*math.Pi),
+	}
+}
+
+// tilePoint is a position in the integer coordinates of a tile
+type tilePoint struct{ x, y int64 }
+
+// sourceFeature is an isochrone or station projected on the unit square
+type sourceFeature struct {
+	id         uint64
+	rect       rtree.Rect
+	polygons   [][][]worldPoint
+	point      *worldPoint
+	rangeValue int
+	properties map[string]interface{}
+}
+
+// Source holds the projected features of an isochrone directory, indexed by bounding box
+type Source struct {
+	features []sourceFeature
+	tree     *rtree.Tree
+}
+
+// Load reads every isochrone file of dir. Isochrone polygons go to the isochrones layer with
+// their range; the station points saved with them go, once per station, to the stations layer.
+// Files that cannot be parsed are skipped with a warning.
+func Load(dir string) (*Source, error) {
+	names, err := geojson.ListFiles(dir, 0)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list isochrones: %w", err)
+	}
+
+	var collections []*geojson.FeatureCollection
+	var ranges []int
+	for _, name := range names {
+		content, err := os.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read isochrone: %w", err)
+		}
+		fc, err := geojson.ParseFeatureCollection(content)
+		if err != nil {
+			log.Printf("Warning: skipping %s: %v", name, err)
+			continue
+		}
+
+		_, rangeValue := geojson.ParseFileName(name)
+		collections = append(collections, fc)
+		ranges = append(ranges, rangeValue)
+	}
+
+	return NewSource(collections, ranges), nil
+}
+
+// NewSource projects the features of isochrone collections, each computed for the range at
+// the same index of ranges
+func NewSource(collections []*geojson.FeatureCollection, ranges []int) *Source {
+	source := &Source{}
+	stations := make(map[string]bool)
+
+	for i, fc := range collections {
+		for _, f := range fc.Features {
+			if f.Geometry == nil {
+				continue
+			}
+
+			sf := sourceFeature{id: uint64(len(source.features) + 1), rangeValue: ranges[i], properties: f.Properties}
+			if f.Properties[geojson.PropertyFeatureType] == geojson.FeatureTypeStation && f.Geometry.Type == geojson.TypePoint {
+				// Every range file carries the same station point
+				key := fmt.Sprintf("%v|%v|%v", f.Properties[geojson.PropertyStation], f.Properties[geojson.PropertyLatitude], f.Properties[geojson.PropertyLongitude])
+				if stations[key] {
+					continue
+				}
+				stations[key] = true
+
+				p := mercator(f.Geometry.Point)
+				sf.point = &p
+				sf.rect = rtree.Rect{MinX: p.x, MinY: p.y, MaxX: p.x, MaxY: p.y}
+				sf.properties = stationProperties(f.Properties)
+			} else {
+				polygons := f.Geometry.Polygons()
+				if len(polygons) == 0 {
+					continue
+				}
+				sf.rect = rtree.Rect{MinX: math.Inf(1), MinY: math.Inf(1), MaxX: math.Inf(-1), MaxY: math.Inf(-1)}
+				for _, polygon := range polygons {
+					var rings [][]worldPoint
+					for _, ring := range polygon {
+						projected := make([]worldPoint, len(ring))
+						for j, position := range ring {
+							p := mercator(position)
+							projected[j] = p
+							sf.rect.MinX, sf.rect.MaxX = math.Min(sf.rect.MinX, p.x), math.Max(sf.rect.MaxX, p.x)
+							sf.rect.MinY, sf.rect.MaxY = math.Min(sf.rect.MinY, p.y), math.Max(sf.rect.MaxY, p.y)
+						}
+						rings = append(rings, projected)
+					}
+					sf.polygons = append(sf.polygons, rings)
+				}
+			}
+
+			source.features = append(source.features, sf)
+		}
+	}
+
+	items := make([]rtree.Item, len(source.features))
+	for i, sf := range source.features {
+		items[i] = rtree.Item{Rect: sf.rect, Value: i}
+	}
+	source.tree = rtree.New(items)
+
+	return source
+}
+
+// stationProperties keeps the properties describing the station itself, dropping those that
+// only apply to one range
+func stationProperties(properties map[string]interface{}) map[string]interface{} {
+	kept := make(map[string]interface{})
+	for _, name := range []string{geojson.PropertyFeatureType, geojson.PropertyStation, geojson.PropertyCity, geojson.PropertyLatitude, geojson.PropertyLongitude} {
+		if value, ok := properties[name]; ok {
+			kept[name] = value
+		}
+	}
+	return kept
+}
+
+// Render encodes the tile with an isochrones and a stations layer. With a positive range
+// only the isochrones of that range are included. A tile without features is empty.
+func (s *Source) Render(tile TileID, rangeValue int) []byte {
+	scale := float64(int(1) << uint(tile.Z))
+	margin := float64(Buffer) / Extent
+	bounds := rtree.Rect{
+		MinX: (float64(tile.X) - margin) / scale,
+		MinY: (float64(tile.Y) - margin) / scale,
+		MaxX: (float64(tile.X) + 1 + margin) / scale,
+		MaxY: (float64(tile.Y) + 1 + margin) / scale,
+	}
+
+	// toTile maps a projected position to the coordinates of the tile
+	toTile := func(p worldPoint) (float64, float64) {
+		return (p.x*scale - float64(tile.X)) * Extent, (p.y*scale - float64(tile.Y)) * Extent
+	}
+
+	var matches []int
+	s.tree.Search(bounds, func(item rtree.Item) bool {
+		matches = append(matches, item.Value)
+		return true
+	})
+	// Keep the load order of the features within a tile
+	sort.Ints(matches)
+
+	isochrones := layer{name: LayerIsochrones}
+	stations := layer{name: LayerStations}
+	for _, i := range matches {
+		sf := s.features[i]
+
+		if sf.point != nil {
+			x, y := toTile(*sf.point)
+			// Points are only drawn in the tile containing them, so that labels are not repeated
+			if x < 0 || y < 0 || x >= Extent || y >= Extent {
+				continue
+			}
+			var e geometryEncoder
+			e.moveTo(tilePoint{int64(x), int64(y)})
+			stations.features = append(stations.features, feature{id: sf.id, geomType: geomPoint, geometry: e.commands, properties: sf.properties})
+			continue
+		}
+
+		if rangeValue > 0 && sf.rangeValue != rangeValue {
+			continue
+		}
+
+		var e geometryEncoder
+		for _, polygon := range sf.polygons {
+			encodePolygon(&e, polygon, toTile)
+		}
+		if len(e.commands) > 0 {
+			isochrones.features = append(isochrones.features, feature{id: sf.id, geomType: geomPolygon, geometry: e.commands, properties: sf.properties})
+		}
+	}
+
+	return encodeTile([]layer{isochrones, stations})
+}
+
+// encodePolygon clips the rings of a polygon to the buffered tile, snaps them to the tile grid
+// and appends them with the winding order required by the specification: exterior rings with
+// a positive area and holes with a negative area, in tile coordinates. Polygons whose exterior
+// ring vanishes at this zoom level are dropped.
+func encodePolygon(e *geometryEncoder, polygon [][]worldPoint, toTile func(worldPoint) (float64, float64)) {
+	for i, ring := range polygon {
+		points := make([][2]float64, 0, len(ring))
+		for _, p := range ring {
+			x, y := toTile(p)
+			points = append(points, [2]float64{x, y})
+		}
+
+		snapped := snapRing(clipRing(points, -Buffer, Extent+Buffer))
+		area := tileRingArea(snapped)
+		if area == 0 {
+			if i == 0 {
+				return
+			}
+			continue
+		}
+
+		if (i == 0) != (area > 0) {
+			for l, r := 0, len(snapped)-1; l < r; l, r = l+1, r-1 {
+				snapped[l], snapped[r] = snapped[r], snapped[l]
+			}
+		}
+		e.ring(snapped)
+	}
+}
+
+// clipRing clips a ring to the square [min, max] with the Sutherland-Hodgman algorithm.
+// The result is open: the closing position is not repeated.
+func clipRing(ring [][2]float64, min, max float64) [][2]float64 {
+	// Drop the closing position
+	if n := len(ring); n > 1 && ring[0] == ring[n-1] {
+		ring = ring[:n-1]
+	}
+
+	edges := []struct {
+		axis   int
+		value  float64
+		inside func(v, limit float64) bool
+	}{
+		{0, min, func(v, limit float64) bool { return v >= limit }},
+		{0, max, func(v, limit float64) bool { return v <= limit }},
+		{1, min, func(v, limit float64) bool { return v >= limit }},
+		{1, max, func(v, limit float64) bool { return v <= limit }},
+	}
+
+	for _, edge := range edges {
+		if len(ring) == 0 {
+			break
+		}
+		var clipped [][2]float64
+		prev := ring[len(ring)-1]
+		for _, curr := range ring {
+			currIn := edge.inside(curr[edge.axis], edge.value)
+			prevIn := edge.inside(prev[edge.axis], edge.value)
+			if currIn != prevIn {
+				t := (edge.value - prev[edge.axis]) / (curr[edge.axis] - prev[edge.axis])
+				var p [2]float64
+				p[edge.axis] = edge.value
+				other := 1 - edge.axis
+				p[other] = prev[other] + t*(curr[other]-prev[other])
+				clipped = append(clipped, p)
+			}
+			if currIn {
+				clipped = append(clipped, curr)
+			}
+			prev = curr
+		}
+		ring = clipped
+	}
+
+	return ring
+}
+
+// snapRing rounds an open ring to integer coordinates, dropping repeated positions
+func snapRing(ring [][2]float64) []tilePoint {
+	snapped := make([]tilePoint, 0, len(ring))
+	for _, p := range ring {
+		tp := tilePoint{int64(math.Round(p[0])), int64(math.Round(p[1]))}
+		if len(snapped) > 0 && snapped[len(snapped)-1] == tp {
+			continue
+		}
+		snapped = append(snapped, tp)
+	}
+	for len(snapped) > 1 && snapped[0] == snapped[len(snapped)-1] {
+		snapped = snapped[:len(snapped)-1]
+	}
+	return snapped
+}
+
+// tileRingArea returns twice the signed area of an open ring; rings with fewer than three
+// positions have no area
+func tileRingArea(ring []tilePoint) int64 {
+	if len(ring) < 3 {
+		return 0
+	}
+	var area int64
+	for i, p := range ring {
+		q := ring[(i+1)%len(ring)]
+		area += p.x*q.y - q.x*p.y
+	}
+	return area
+}
+
+// Cache keeps the source of a directory and the most recently served tiles, discarding both
+// when an isochrone file is added, removed or modified
+type Cache struct {
+	dir  string
+	size int
+
+	mu        sync.Mutex
+	signature string
+	source    *Source
+	tiles     map[cacheKey]*list.Element
+	order     *list.List
+}
+
+type cacheKey struct {
+	tile       TileID
+	rangeValue int
+}
+
+type cacheEntry struct {
+	key  cacheKey
+	data []byte
+}
+
+// NewCache creates a cache for the isochrones in dir holding up to size encoded tiles
+func NewCache(dir string, size int) *Cache {
+	if size < 1 {
+		size = 1
+	}
+	return &Cache{dir: dir, size: size, tiles: make(map[cacheKey]*list.Element), order: list.New()}
+}
+
+// Tile returns the encoded tile, rendering it unless it is cached
+func (c *Cache) Tile(tile TileID, rangeValue int) ([]byte, error) {
+	signature, err := geojson.DirSignature(c.dir)
+	if err != nil {
+		return nil, err
+	}
+	key := cacheKey{tile: tile, rangeValue: rangeValue}
+
+	c.mu.Lock()
+	if c.source == nil || signature != c.signature {
+		source, err := Load(c.dir)
+		if err != nil {
+			c.mu.Unlock()
+			return nil, err
+		}
+		c.source, c.signature = source, signature
+		c.tiles = make(map[cacheKey]*list.Element)
+		c.order.Init()
+	}
+	if element, ok := c.tiles[key]; ok {
+		c.order.MoveToFront(element)
+		c.mu.Unlock()
+		return element.Value.(*cacheEntry).data, nil
+	}
+	source := c.source
+	c.mu.Unlock()
+
+	data := source.Render(tile, rangeValue)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	// Only keep the tile if the source was not replaced while rendering
+	if c.source == source {
+		if _, ok := c.tiles[key]; !ok {
+			c.tiles[key] = c.order.PushFront(&cacheEntry{key: key, data: data})
+			if c.order.Len() > c.size {
+				oldest := c.order.Back()
+				c.order.Remove(oldest)
+				delete(c.tiles, oldest.Value.(*cacheEntry).key)
+			}
+		}
+	}
+	return data, nil
+}
@@ -0,0 +1,271 @@
+package tiles
+
+import (
+	"bytes"
+	"encoding/json"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"logreason/internal/geojson"
+)
+
+// testCollection is an isochrone file with a square around a station, as saved by the Manager
+func testCollection(station string, lon, lat, size float64, rangeValue int) *geojson.FeatureCollection {
+	properties := func(featureType string) map[string]interface{} {
+		return map[string]interface{}{
+			geojson.PropertyFeatureType: featureType,
+			geojson.PropertyStation:     station,
+			geojson.PropertyLatitude:    lat,
+			geojson.PropertyLongitude:   lon,
+			geojson.PropertyRange:       float64(rangeValue),
+		}
+	}
+	ring := []geojson.Position{{lon - size, lat - size}, {lon + size, lat - size}, {lon + size, lat + size}, {lon - size, lat + size}, {lon - size, lat - size}}
+
+	return &geojson.FeatureCollection{Type: geojson.TypeFeatureCollection, Features: []*geojson.Feature{
+		{Type: geojson.TypeFeature, Geometry: &geojson.Geometry{Type: geojson.TypePolygon, Polygon: [][]geojson.Position{ring}}, Properties: properties(geojson.FeatureTypeIsochrone)},
+		{Type: geojson.TypeFeature, Geometry: &geojson.Geometry{Type: geojson.TypePoint, Point: geojson.Position{lon, lat}}, Properties: properties(geojson.FeatureTypeStation)},
+	}}
+}
+
+// tileAt returns the tile containing a position at a zoom level
+func tileAt(lon, lat float64, z int) TileID {
+	p := mercator(geojson.Position{lon, lat})
+	n := float64(int(1) << uint(z))
+	return TileID{Z: z, X: int(p.x * n), Y: int(p.y * n)}
+}
+
+// decodedLayer is the part of a tile layer checked by the tests
+type decodedLayer struct {
+	name     string
+	features int
+	extent   uint64
+	geometry [][]uint32
+}
+
+// decodeTile reads the layers of an encoded tile
+func decodeTile(t *testing.T, data []byte) map[string]decodedLayer {
+	t.Helper()
+
+	layers := make(map[string]decodedLayer)
+	for _, field := range readFields(t, data) {
+		if field.number != 3 {
+			t.Fatalf("Unexpected tile field %d", field.number)
+		}
+		var l decodedLayer
+		for _, lf := range readFields(t, field.data) {
+			switch lf.number {
+			case 1:
+				l.name = string(lf.data)
+			case 2:
+				l.features++
+				for _, ff := range readFields(t, lf.data) {
+					if ff.number == 4 {
+						l.geometry = append(l.geometry, readPacked(t, ff.data))
+					}
+				}
+			case 5:
+				l.extent = lf.value
+			}
+		}
+		layers[l.name] = l
+	}
+	return layers
+}
+
+type protoField struct {
+	number int
+	value  uint64
+	data   []byte
+}
+
+func readVarint(t *testing.T, data []byte, i *int) uint64 {
+	t.Helper()
+	var v uint64
+	for shift := uint(0); ; shift += 7 {
+		if *i >= len(data) {
+			t.Fatal("Truncated varint")
+		}
+		b := data[*i]
+		*i++
+		v |= uint64(b&0x7f) << shift
+		if b < 0x80 {
+			return v
+		}
+	}
+}
+
+func readFields(t *testing.T, data []byte) []protoField {
+	t.Helper()
+	var fields []protoField
+	for i := 0; i < len(data); {
+		key := readVarint(t, data, &i)
+		field := protoField{number: int(key >> 3)}
+		switch key & 7 {
+		case 0:
+			field.value = readVarint(t, data, &i)
+		case 1:
+			i += 8
+		case 2:
+			n := int(readVarint(t, data, &i))
+			field.data = data[i : i+n]
+			i += n
+		default:
+			t.Fatalf("Unexpected wire type %d", key&7)
+		}
+		fields = append(fields, field)
+	}
+	return fields
+}
+
+func readPacked(t *testing.T, data []byte) []uint32 {
+	var values []uint32
+	for i := 0; i < len(data); {
+		values = append(values, uint32(readVarint(t, data, &i)))
+	}
+	return values
+}
+
+func TestGeometryEncoder(t *testing.T) {
+	// Examples from the Mapbox Vector Tile specification
+	var point geometryEncoder
+	point.moveTo(tilePoint{25, 17})
+	if want := []uint32{9, 50, 34}; !equalUint32(point.commands, want) {
+		t.Errorf("Point commands = %v, want %v", point.commands, want)
+	}
+
+	var polygon geometryEncoder
+	polygon.ring([]tilePoint{{3, 6}, {8, 12}, {20, 34}})
+	if want := []uint32{9, 6, 12, 18, 10, 12, 24, 44, 15}; !equalUint32(polygon.commands, want) {
+		t.Errorf("Polygon commands = %v, want %v", polygon.commands, want)
+	}
+}
+
+func equalUint32(a, b []uint32) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestClipRing(t *testing.T) {
+	ring := [][2]float64{{-100, -100}, {200, -100}, {200, 200}, {-100, 200}, {-100, -100}}
+	clipped := clipRing(ring, 0, 100)
+	if len(clipped) != 4 {
+		t.Fatalf("Expected the square to be clipped to 4 corners, got %v", clipped)
+	}
+	for _, p := range clipped {
+		if p[0] < 0 || p[0] > 100 || p[1] < 0 || p[1] > 100 {
+			t.Errorf("Position %v lies outside the clip box", p)
+		}
+	}
+
+	if outside := clipRing([][2]float64{{200, 200}, {300, 200}, {300, 300}, {200, 200}}, 0, 100); len(outside) != 0 {
+		t.Errorf("Expected a ring outside the box to vanish, got %v", outside)
+	}
+}
+
+func TestSourceRender(t *testing.T) {
+	source := NewSource([]*geojson.FeatureCollection{
+		testCollection("STA", 9.15, 45.57, 0.05, 480),
+		testCollection("STA", 9.15, 45.57, 0.1, 720),
+		testCollection("STB", 10.5, 45.0, 0.05, 480),
+	}, []int{480, 720, 480})
+
+	tile := tileAt(9.15, 45.57, 10)
+	layers := decodeTile(t, source.Render(tile, 0))
+
+	isochrones, stations := layers[LayerIsochrones], layers[LayerStations]
+	if isochrones.features != 2 {
+		t.Errorf("Expected both isochrones of STA in the tile, got %d", isochrones.features)
+	}
+	if stations.features != 1 {
+		t.Errorf("Expected the STA station once, got %d", stations.features)
+	}
+	if isochrones.extent != Extent {
+		t.Errorf("Layer extent = %d, want %d", isochrones.extent, Extent)
+	}
+
+	// The 720 isochrone covers the whole tile, so it is clipped to the buffered tile square
+	for _, geometry := range isochrones.geometry {
+		if geometry[0] != uint32(command(cmdMoveTo, 1)) || geometry[len(geometry)-1] != uint32(command(cmdClosePath, 1)) {
+			t.Errorf("Unexpected polygon commands %v", geometry)
+		}
+	}
+
+	if filtered := decodeTile(t, source.Render(tile, 480)); filtered[LayerIsochrones].features != 1 {
+		t.Errorf("Expected only the 480 isochrone with a range filter, got %d", filtered[LayerIsochrones].features)
+	}
+
+	if empty := source.Render(tileAt(-70, -30, 10), 0); len(empty) != 0 {
+		t.Errorf("Expected an empty tile far from the stations, got %d bytes", len(empty))
+	}
+}
+
+func TestCache(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name string, fc *geojson.FeatureCollection) {
+		data, err := json.Marshal(fc)
+		if err != nil {
+			t.Fatalf("Failed to marshal isochrone: %v", err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, name), data, 0644); err != nil {
+			t.Fatalf("Failed to write isochrone: %v", err)
+		}
+	}
+	write("STA-a-480.json", testCollection("STA", 9.15, 45.57, 0.05, 480))
+
+	cache := NewCache(dir, 2)
+	tile := tileAt(9.15, 45.57, 12)
+
+	first, err := cache.Tile(tile, 0)
+	if err != nil {
+		t.Fatalf("Tile failed: %v", err)
+	}
+	second, err := cache.Tile(tile, 0)
+	if err != nil {
+		t.Fatalf("Tile failed: %v", err)
+	}
+	if len(first) == 0 || !bytes.Equal(first, second) {
+		t.Fatal("Expected the same non-empty tile from the cache")
+	}
+
+	// A new file invalidates the cached tiles
+	write("STB-b-480.json", testCollection("STB", 9.1501, 45.5701, 0.05, 480))
+	updated, err := cache.Tile(tile, 0)
+	if err != nil {
+		t.Fatalf("Tile failed: %v", err)
+	}
+	if decodeTile(t, updated)[LayerStations].features != 2 {
+		t.Error("Expected the cache to pick up the new station")
+	}
+}
+
+func TestTileID_Valid(t *testing.T) {
+	tests := []struct {
+		tile  TileID
+		valid bool
+	}{
+		{TileID{0, 0, 0}, true},
+		{TileID{10, 1023, 1023}, true},
+		{TileID{10, 1024, 0}, false},
+		{TileID{-1, 0, 0}, false},
+		{TileID{MaxZoom + 1, 0, 0}, false},
+	}
+	for _, tc := range tests {
+		if tc.tile.Valid() != tc.valid {
+			t.Errorf("%v.Valid() = %v, want %v", tc.tile, !tc.valid, tc.valid)
+		}
+	}
+
+	if p := mercator(geojson.Position{0, 0}); math.Abs(p.x-0.5) > 1e-12 || math.Abs(p.y-0.5) > 1e-12 {
+		t.Errorf("mercator(0, 0) = %v, want the centre of the world", p)
+	}
+}
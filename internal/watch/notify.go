@@ -0,0 +1,62 @@
+package watch
+
+import (
+	"context"
+	"log"
+	"path/filepath"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// notifyOps are the operations that may change the file: writes, creation, deletion and the
+// renames of atomic replacements
+const notifyOps = fsnotify.Write | fsnotify.Create | fsnotify.Remove | fsnotify.Rename
+
+// notify watches the directory of the file with the notification API of the platform
+// (inotify, kqueue or ReadDirectoryChangesW), since editors and atomic writes replace the
+// file rather than write to it, and sends an event for every change naming the file
+func notify(ctx context.Context, path string) (<-chan struct{}, error) {
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return nil, err
+	}
+
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, err
+	}
+	if err := watcher.Add(filepath.Dir(absPath)); err != nil {
+		watcher.Close()
+		return nil, err
+	}
+
+	events := make(chan struct{}, 1)
+	go func() {
+		defer close(events)
+		defer watcher.Close()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case event, ok := <-watcher.Events:
+				if !ok {
+					return
+				}
+				if event.Op&notifyOps == 0 || filepath.Base(event.Name) != filepath.Base(absPath) {
+					continue
+				}
+				select {
+				case events <- struct{}{}:
+				default:
+				}
+			case err, ok := <-watcher.Errors:
+				if !ok {
+					return
+				}
+				log.Printf("Warning: error watching %s: %v", path, err)
+			}
+		}
+	}()
+	return events, nil
+}
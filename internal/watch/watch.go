@@ -0,0 +1,138 @@
+// Package watch reports changes to a file, using the file system notifications of the
+// platform through fsnotify and polling the file size and modification time where they are
+// not available.
+package watch
+
+import (
+	"context"
+	"log"
+	"os"
+	"time"
+)
+
+// Defaults of a watcher
+const (
+	// DefaultInterval Default delay between two checks of the file when polling
+	DefaultInterval = 2 * time.Second
+	// DefaultDebounce Default quiet period after an event before a change is reported, so
+	// that the several writes of one save are reported once
+	DefaultDebounce = 500 * time.Millisecond
+)
+
+// Methods used to detect changes
+const (
+	MethodNotify  = "fsnotify"
+	MethodPolling = "polling"
+)
+
+// Options configures a watcher; zero values select the defaults
+type Options struct {
+	Interval time.Duration
+	Debounce time.Duration
+	// Polling disables file system notifications
+	Polling bool
+}
+
+// Watcher reports changes to a file
+type Watcher struct {
+	// C receives a value after the file was created, written, replaced or deleted
+	C <-chan struct{}
+	// Method is MethodNotify or MethodPolling
+	Method string
+}
+
+// File watches the file at path until the context is done. The file does not need to exist
+// yet. Changes may be reported for writes that leave the content unchanged.
+func File(ctx context.Context, path string, opts Options) *Watcher {
+	if opts.Interval <= 0 {
+		opts.Interval = DefaultInterval
+	}
+	if opts.Debounce <= 0 {
+		opts.Debounce = DefaultDebounce
+	}
+
+	method := MethodPolling
+	var events <-chan struct{}
+	if !opts.Polling {
+		notifyEvents, err := notify(ctx, path)
+		if err == nil {
+			method, events = MethodNotify, notifyEvents
+		} else {
+			log.Printf("Warning: falling back to polling %s: %v", path, err)
+		}
+	}
+	if events == nil {
+		events = poll(ctx, path, opts.Interval)
+	}
+
+	changes := make(chan struct{}, 1)
+	go debounce(ctx, events, changes, opts.Debounce)
+	return &Watcher{C: changes, Method: method}
+}
+
+// debounce forwards an event once no other event arrived for the delay
+func debounce(ctx context.Context, events <-chan struct{}, changes chan<- struct{}, delay time.Duration) {
+	timer := time.NewTimer(delay)
+	timer.Stop()
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case _, ok := <-events:
+			if !ok {
+				return
+			}
+			timer.Reset(delay)
+		case <-timer.C:
+			select {
+			case changes <- struct{}{}:
+			default:
+			}
+		}
+	}
+}
+
+// fileState is what polling compares between two checks
+type fileState struct {
+	exists  bool
+	size    int64
+	modTime time.Time
+}
+
+func stat(path string) fileState {
+	info, err := os.Stat(path)
+	if err != nil {
+		return fileState{}
+	}
+	return fileState{exists: true, size: info.Size(), modTime: info.ModTime()}
+}
+
+// poll checks the file every interval and sends an event when its state changed
+func poll(ctx context.Context, path string, interval time.Duration) <-chan struct{} {
+	events := make(chan struct{}, 1)
+	// Take the first state before returning so that changes made right after are seen
+	last := stat(path)
+	go func() {
+		defer close(events)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if current := stat(path); current != last {
+					last = current
+					select {
+					case events <- struct{}{}:
+					default:
+					}
+				}
+			}
+		}
+	}()
+	return events
+}
@@ -0,0 +1,64 @@
+package watch
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// expectChange waits for one change on the watcher
+func expectChange(t *testing.T, w *Watcher, what string) {
+	t.Helper()
+	select {
+	case <-w.C:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("No change reported after %s", what)
+	}
+}
+
+func testWatcher(t *testing.T, opts Options, wantMethod string) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	dir := t.TempDir()
+	path := filepath.Join(dir, "input.csv")
+	w := File(ctx, path, opts)
+	if w.Method != wantMethod {
+		t.Fatalf("Method = %s, want %s", w.Method, wantMethod)
+	}
+
+	// Creating the file is a change
+	if err := os.WriteFile(path, []byte("STAZIONAMENTO,LAT,LON\n"), 0644); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+	expectChange(t, w, "creating the file")
+
+	// So is an atomic replacement, while other files of the directory are ignored
+	tmp := filepath.Join(dir, ".input.csv.tmp")
+	if err := os.WriteFile(tmp, []byte("STAZIONAMENTO,LAT,LON\nA,45.00000,9.00000\n"), 0644); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		t.Fatalf("Failed to rename file: %v", err)
+	}
+	expectChange(t, w, "replacing the file")
+
+	if err := os.WriteFile(filepath.Join(dir, "other.csv"), []byte("x"), 0644); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+	select {
+	case <-w.C:
+		t.Error("Expected other files to be ignored")
+	case <-time.After(3 * opts.Debounce):
+	}
+}
+
+func TestFile_Polling(t *testing.T) {
+	testWatcher(t, Options{Polling: true, Interval: 20 * time.Millisecond, Debounce: 50 * time.Millisecond}, MethodPolling)
+}
+
+func TestFile_Notify(t *testing.T) {
+	testWatcher(t, Options{Debounce: 50 * time.Millisecond}, MethodNotify)
+}
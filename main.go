@@ -1,12 +1,14 @@
 package main
 
 import (
+	"context"
 	"github.com/gofiber/fiber/v2/middleware/cors"
 	"log"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/gofiber/fiber/v2/middleware/logger"
 
+	"logreason/internal/handlers"
 	"logreason/internal/routes"
 )
 
@@ -25,6 +27,13 @@ func main() {
 	// Setup routes
 	routes.SetupRoutes(app)
 
+	// Regenerate the isochrones of stations added or moved in the CSV file when
+	// WATCH_LOCATIONS enables it
+	go handlers.WatchLocations(context.Background())
+
+	// Publish the isochrones written by procgeojson to GET /api/events
+	go handlers.WatchIsochrones(context.Background())
+
 	// Start the server
 	log.Println("Starting server on :3000")
 	if err := app.Listen(":3000"); err != nil {